@@ -0,0 +1,261 @@
+/*
+Package audit keeps the history of the data: who changed which field of which row, from what to what, and from where.
+
+The writes of parser and db take the Actor that makes them and record the change in audit_log. An update takes a
+Snapshot of the row before it is written and records the fields that are different after. Inserts and deletes are
+recorded as a whole row with Created and Deleted.
+
+The state of the conversations (drivers.state, the performing task, the ids of the messages and topics) and the
+marks of the alerts that were sent are not data, they are not recorded. Neither are the backfills, they only fill the new columns from the old ones.
+*/
+package audit
+
+import (
+	"database/sql"
+	"fmt"
+	"logistictbot/errlog"
+	"slices"
+	"strings"
+	"time"
+)
+
+type Source string
+
+const (
+	SourceBot Source = "bot"
+	SourceAPI Source = "api"
+	SourceDev Source = "dev"
+)
+
+// Actor is who makes the change. ChatId is 0 for the bot itself (the workers, the parser)
+type Actor struct {
+	ChatId int64
+	Source Source
+}
+
+// System is the bot changing the data by itself
+var System = Actor{Source: SourceBot}
+
+func Bot(chatId int64) Actor { return Actor{ChatId: chatId, Source: SourceBot} }
+func API(chatId int64) Actor { return Actor{ChatId: chatId, Source: SourceAPI} }
+func Dev(chatId int64) Actor { return Actor{ChatId: chatId, Source: SourceDev} }
+
+// Entity is the table of the row that is changed
+type Entity string
+
+const (
+	EntityShipment    Entity = "shipments"
+	EntityTask        Entity = "tasks"
+	EntityDriver      Entity = "drivers"
+	EntityManager     Entity = "managers"
+	EntityUser        Entity = "users"
+	EntityCar         Entity = "cars"
+	EntitySession     Entity = "drivers_sessions"
+	EntityTankRefuel  Entity = "tank_refuels"
+	EntityGroup       Entity = "driver_groups"
+	EntityCompartment Entity = "task_compartments"
+	EntityCleaning    Entity = "task_cleanings"
+)
+
+// the fields of the whole row being created or deleted
+const (
+	FieldCreated = "created"
+	FieldDeleted = "deleted"
+)
+
+// untracked are the columns that change with every write, they are not worth a line each
+var untracked = []string{"updated_at"}
+
+// Target is the row that is changed, and the shipment and the driver it belongs to, so the history can be looked up by them
+type Target struct {
+	Entity     Entity
+	Id         any
+	ShipmentId int64
+	DriverId   string
+}
+
+func (t Target) id() string {
+	return fmt.Sprint(t.Id)
+}
+
+// Change is a field of the target going from Old to New
+type Change struct {
+	Field string
+	Old   any
+	New   any
+}
+
+type Entry struct {
+	Id         int64     `json:"id"`
+	ChangedAt  time.Time `json:"changed_at"`
+	ChangedBy  int64     `json:"changed_by"`
+	Source     Source    `json:"source"`
+	Entity     Entity    `json:"entity"`
+	EntityId   string    `json:"entity_id"`
+	ShipmentId int64     `json:"shipment_id,omitempty"`
+	DriverId   string    `json:"driver_id,omitempty"`
+	Field      string    `json:"field"`
+	Old        string    `json:"old_value"`
+	New        string    `json:"new_value"`
+}
+
+// Executor is a *sql.DB or a *sql.Tx, the change is recorded in the transaction of the write when there is one
+type Executor interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// Value is how the values are kept in audit_log
+func Value(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+		return v.Format(time.RFC3339)
+	case *time.Time:
+		if v == nil {
+			return ""
+		}
+		return Value(*v)
+	case sql.NullString:
+		return v.String
+	case sql.NullInt64:
+		if !v.Valid {
+			return ""
+		}
+		return fmt.Sprint(v.Int64)
+	case sql.NullFloat64:
+		if !v.Valid {
+			return ""
+		}
+		return fmt.Sprint(v.Float64)
+	case sql.NullTime:
+		if !v.Valid {
+			return ""
+		}
+		return Value(v.Time)
+	}
+	return fmt.Sprint(v)
+}
+
+// Record writes the changes that really change something
+func Record(exec Executor, by Actor, t Target, changes ...Change) error {
+	for _, c := range changes {
+		oldValue, newValue := Value(c.Old), Value(c.New)
+		if oldValue == newValue || slices.Contains(untracked, c.Field) {
+			continue
+		}
+
+		_, err := exec.Exec(`
+			INSERT INTO audit_log (changed_by, source, entity, entity_id, shipment_id, driver_id, field, old_value, new_value)
+			VALUES (?, ?, ?, ?, NULLIF(?, 0), NULLIF(?, ''), ?, ?, ?)`,
+			by.ChatId, by.Source, t.Entity, t.id(), t.ShipmentId, t.DriverId, c.Field, oldValue, newValue)
+		if err != nil {
+			errlog.ERR.Printf("ERR: recording the change of %s %s.%s: %v\n", t.Entity, t.id(), c.Field, err)
+			return fmt.Errorf("ERR: recording the change of %s %s.%s: %v", t.Entity, t.id(), c.Field, err)
+		}
+	}
+	return nil
+}
+
+// Created records the new row, what describes it best goes to what
+func Created(exec Executor, by Actor, t Target, what any) error {
+	return Record(exec, by, t, Change{Field: FieldCreated, New: what})
+}
+
+// Deleted records the row that is gone, what describes it best goes to what
+func Deleted(exec Executor, by Actor, t Target, what any) error {
+	return Record(exec, by, t, Change{Field: FieldDeleted, Old: what})
+}
+
+// Snapshot is a row before it is written
+type Snapshot struct {
+	target  Target
+	columns []string
+	values  []any
+}
+
+func readRow(exec Executor, t Target, columns []string) ([]any, error) {
+	rows, err := exec.Query(fmt.Sprintf(`SELECT %s FROM %s WHERE id = ?`, strings.Join(columns, ", "), t.Entity), t.Id)
+	if err != nil {
+		return nil, fmt.Errorf("ERR: reading %s %s for the audit: %v", t.Entity, t.id(), err)
+	}
+	defer rows.Close()
+
+	values := make([]any, len(columns))
+	if !rows.Next() {
+		return values, rows.Err()
+	}
+	ptrs := make([]any, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	if err = rows.Scan(ptrs...); err != nil {
+		return nil, fmt.Errorf("ERR: scanning %s %s for the audit: %v", t.Entity, t.id(), err)
+	}
+	return values, nil
+}
+
+// Before takes the columns of the row of t before the write, After records the ones the write changed
+func Before(exec Executor, t Target, columns ...string) (*Snapshot, error) {
+	values, err := readRow(exec, t, columns)
+	if err != nil {
+		errlog.ERR.Println(err)
+		return nil, err
+	}
+	return &Snapshot{target: t, columns: columns, values: values}, nil
+}
+
+// After compares the row with the Snapshot and records what is different
+func (s *Snapshot) After(exec Executor, by Actor) error {
+	values, err := readRow(exec, s.target, s.columns)
+	if err != nil {
+		errlog.ERR.Println(err)
+		return err
+	}
+
+	changes := make([]Change, 0, len(s.columns))
+	for i, column := range s.columns {
+		changes = append(changes, Change{Field: column, Old: s.values[i], New: values[i]})
+	}
+	return Record(exec, by, s.target, changes...)
+}
+
+func queryEntries(exec Executor, where string, args ...any) ([]*Entry, error) {
+	rows, err := exec.Query(`
+		SELECT id, changed_at, changed_by, source, entity, entity_id, COALESCE(shipment_id, 0), COALESCE(driver_id, ''),
+		       field, COALESCE(old_value, ''), COALESCE(new_value, '')
+		FROM audit_log
+		WHERE `+where+`
+		ORDER BY changed_at, id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ERR: querying audit_log: %v", err)
+	}
+	defer rows.Close()
+
+	entries := make([]*Entry, 0)
+	for rows.Next() {
+		e := new(Entry)
+		err = rows.Scan(&e.Id, &e.ChangedAt, &e.ChangedBy, &e.Source, &e.Entity, &e.EntityId, &e.ShipmentId, &e.DriverId, &e.Field, &e.Old, &e.New)
+		if err != nil {
+			return nil, fmt.Errorf("ERR: scanning audit_log: %v", err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// ForShipment is the history of the shipment and its tasks
+func ForShipment(exec Executor, shipmentId int64) ([]*Entry, error) {
+	return queryEntries(exec, `shipment_id = ?`, shipmentId)
+}
+
+// ForDriver is the history of what belongs to the driver, and what the driver changed himself from chatId
+func ForDriver(exec Executor, driverId string, chatId int64) ([]*Entry, error) {
+	return queryEntries(exec, `driver_id = ? OR (changed_by = ? AND changed_by != 0)`, driverId, chatId)
+}
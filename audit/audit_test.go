@@ -0,0 +1,36 @@
+package audit
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestValue(t *testing.T) {
+	at := time.Date(2025, 3, 1, 8, 30, 0, 0, time.UTC)
+	cases := []struct {
+		in   any
+		want string
+	}{
+		{nil, ""},
+		{int64(42), "42"},
+		{"Kyiv", "Kyiv"},
+		{[]byte("Lviv"), "Lviv"},
+		{12.5, "12.5"},
+		{at, "2025-03-01T08:30:00Z"},
+		{&at, "2025-03-01T08:30:00Z"},
+		{(*time.Time)(nil), ""},
+		{time.Time{}, ""},
+		{sql.NullString{String: "x", Valid: true}, "x"},
+		{sql.NullInt64{}, ""},
+		{sql.NullInt64{Int64: 7, Valid: true}, "7"},
+		{sql.NullFloat64{}, ""},
+		{sql.NullTime{Time: at, Valid: true}, "2025-03-01T08:30:00Z"},
+	}
+
+	for _, c := range cases {
+		if got := Value(c.in); got != c.want {
+			t.Errorf("Value(%#v) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
@@ -62,6 +62,32 @@ func GetOutDocsPath() string {
 	return "./storage/"
 }
 
+// GetWebAppURL is the base url of the web_interface Mini App, always ends with a slash
+func GetWebAppURL() string {
+	if url := os.Getenv("WEBAPP_URL"); url != "" {
+		return strings.TrimSuffix(url, "/") + "/"
+	}
+
+	return "https://nazarkan.dev/testbot/"
+}
+
+const (
+	PdfExtractorAuto      = "auto"
+	PdfExtractorBuiltin   = "builtin"
+	PdfExtractorPdftotext = "pdftotext"
+)
+
+// GetPdfExtractor says how the text is taken out of the shipment documents:
+// builtin - only the Go extractor, pdftotext - only poppler-utils, auto - Go extractor first and pdftotext if it fails
+func GetPdfExtractor() string {
+	switch extractor := strings.ToLower(os.Getenv("PDF_EXTRACTOR")); extractor {
+	case PdfExtractorBuiltin, PdfExtractorPdftotext:
+		return extractor
+	}
+
+	return PdfExtractorAuto
+}
+
 func GetLogsPath() string {
 	if path := os.Getenv("LOGS_PATH"); path != "" {
 		return path
@@ -70,6 +96,43 @@ func GetLogsPath() string {
 	return "./logs/"
 }
 
+// GetKeywordsPath is the directory with the parser keyword dictionaries (one <language>.json per language).
+// The ones in the repo are also compiled into the binary, so this is only read on start and on dev reload
+func GetKeywordsPath() string {
+	if path := os.Getenv("KEYWORDS_PATH"); path != "" {
+		return path
+	}
+
+	return "./parser/keywords/"
+}
+
+// GetImportMappingsPath is the directory with the column mappings of the senders that send orders as xlsx or csv (one <sender>.json each)
+func GetImportMappingsPath() string {
+	if path := os.Getenv("IMPORT_MAPPINGS_PATH"); path != "" {
+		return path
+	}
+
+	return "./parser/importmappings/"
+}
+
+// GetFreeTimesPath is the json with the free time of the customers and the sites, before the waiting on the site is demurrage
+func GetFreeTimesPath() string {
+	if path := os.Getenv("FREE_TIMES_PATH"); path != "" {
+		return path
+	}
+
+	return "./parser/freetimes.json"
+}
+
+// GetPODRulesPath is the json with what the drivers have to attach to the tasks as the proof of delivery before finishing them
+func GetPODRulesPath() string {
+	if path := os.Getenv("POD_RULES_PATH"); path != "" {
+		return path
+	}
+
+	return "./parser/podrules.json"
+}
+
 func GetFullPathOutDocs(filename string) string {
 	return filepath.Join(GetOutDocsPath(), filename)
 }
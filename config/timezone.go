@@ -0,0 +1,27 @@
+package config
+
+import (
+	"sync"
+	"time"
+)
+
+var (
+	UsersLocations   = make(map[int64]*time.Location) // chat_id -> timezone the chat sees the times in
+	UsersLocationsMu sync.RWMutex
+)
+
+// GetLoc is the timezone of the chat, Warsaw when it did not choose one
+func GetLoc(chatId int64) *time.Location {
+	UsersLocationsMu.RLock()
+	defer UsersLocationsMu.RUnlock()
+	if loc, ok := UsersLocations[chatId]; ok {
+		return loc
+	}
+	return WarsawLoc
+}
+
+func SetChatLoc(chatId int64, loc *time.Location) {
+	UsersLocationsMu.Lock()
+	defer UsersLocationsMu.Unlock()
+	UsersLocations[chatId] = loc
+}
@@ -25,6 +25,17 @@ func (c *CleaningStation) GetByName(globalStorage *sql.DB) error {
 	return row.Scan(&c.Id, &c.Name, &c.Address, &c.Country, &c.Lat, &c.Lon, &c.OpeningHours)
 }
 
+// InlineText is what the inline search of the stations sends to the chat when the manager picks the station
+func (c *CleaningStation) InlineText() string {
+	return c.Name + ", " + c.Address
+}
+
+// GetByInlineText finds the station the manager picked in the inline search by the text it sent
+func (c *CleaningStation) GetByInlineText(globalStorage *sql.DB, text string) error {
+	row := globalStorage.QueryRow(`SELECT id, name, address, country, lat, lon, opening_hours FROM cleaning_stations WHERE name || ', ' || address = ?`, text)
+	return row.Scan(&c.Id, &c.Name, &c.Address, &c.Country, &c.Lat, &c.Lon, &c.OpeningHours)
+}
+
 func GetAllCleaningStations(globalStorage *sql.DB) ([]*CleaningStation, error) {
 	rows, err := globalStorage.Query(`SELECT id, name, address, country, lat, lon, opening_hours FROM cleaning_stations`)
 	if err != nil {
@@ -121,7 +121,7 @@ func CreateRefuelsStatement(from, to time.Time, storage *sql.DB) (string, error)
 
 	var filename string
 	if from.IsZero() && to.IsZero() {
-		filename = fmt.Sprintf(config.GetOutDocsPath() + "refuels_all.xlsx")
+		filename = config.GetOutDocsPath() + "refuels_all.xlsx"
 	} else {
 		filename = fmt.Sprintf(
 			config.GetOutDocsPath()+"refuels_%s_%s.xlsx",
@@ -6,8 +6,9 @@ import (
 	"logistictbot/config"
 	"logistictbot/duration"
 	"logistictbot/parser"
+	"math"
 	"reflect"
-	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -15,20 +16,36 @@ import (
 )
 
 type ShipmentStatement struct {
-	ShipmentId             int64             `excel:"Nr zlecenia"`
-	LoadAddress            string            `excel:"Miejsce zaladunku"`
-	LoadDatetime           string            `excel:"Data i godziny zal."`
-	LoadDuration           duration.Duration `excel:"Czas zal."`
-	UnloadAddress          string            `excel:"Miejsce rozladunku"`
-	UnloadDatetime         string            `excel:"Data i godziny roz."`
-	UnloadDuration         duration.Duration `excel:"Czas roz."`
-	Weight                 string            `excel:"Waga"`
-	DurationLoadAndUnload  duration.Duration `excel:"Czas zal+rozl"`
-	CleaningStationAddress string            `excel:"Myjka"`
-	KmVnR                  int               `excel:"KM V&R"`
-	KmHoyer                int               `excel:"KM Hoyer"`
-	Difference             int               `excel:"Różnica"`
-	Fracht                 int64             `excel:"Fracht"`
+	ShipmentId            int64             `excel:"Nr zlecenia"`
+	Car                   string            `excel:"Auto"` // the truck the load was driven with, a handed over shipment can have more
+	LoadAddress           string            `excel:"Miejsce zaladunku"`
+	LoadDatetime          string            `excel:"Data i godziny zal."`
+	LoadDuration          duration.Duration `excel:"Czas zal."`
+	LoadPunctuality       string            `excel:"Punktualność zal."` // against the window of the document
+	LoadArrived           string            `excel:"Przyjazd zal."`
+	LoadWaiting           duration.Duration `excel:"Postój zal."` // from the arrival, or the opening of the window, to the end
+	LoadFreeTime          duration.Duration `excel:"Czas wolny zal."`
+	LoadDemurrage         float64           `excel:"Przestój zal. (h)"` // the waiting beyond the free time, to invoice
+	UnloadAddress         string            `excel:"Miejsce rozladunku"`
+	UnloadDatetime        string            `excel:"Data i godziny roz."`
+	UnloadDuration        duration.Duration `excel:"Czas roz."`
+	UnloadPunctuality     string            `excel:"Punktualność roz."`
+	UnloadArrived         string            `excel:"Przyjazd roz."`
+	UnloadWaiting         duration.Duration `excel:"Postój roz."`
+	UnloadFreeTime        duration.Duration `excel:"Czas wolny roz."`
+	UnloadDemurrage       float64           `excel:"Przestój roz. (h)"`
+	Demurrage             float64           `excel:"Przestój razem (h)"`
+	Weight                string            `excel:"Waga"`
+	MeasuredWeight        int               `excel:"Waga zmierzona"`
+	DurationLoadAndUnload duration.Duration `excel:"Czas zal+rozl"`
+	CleaningStation       string            `excel:"Myjka"` // the cleaning columns are from the ECDs the drivers gave, not the addresses
+	EcdNumber             string            `excel:"Nr ECD"`
+	PreviousProduct       string            `excel:"Poprzedni produkt"`
+	CleaningType          string            `excel:"Rodzaj mycia"`
+	KmVnR                 int               `excel:"KM V&R"`
+	KmHoyer               int               `excel:"KM Hoyer"`
+	Difference            int               `excel:"Różnica"`
+	Fracht                int64             `excel:"Fracht"`
 }
 
 // for now it won't be used
@@ -166,6 +183,11 @@ func ConvertShipmentToStatements(shipment *parser.Shipment) []ShipmentStatement
 		endKm = shipment.Tasks[len(shipment.Tasks)-1].CurrentKilometrage
 
 		for _, task := range shipment.Tasks {
+			// the declared weight in kg, so the column is comparable with the measured one whatever unit the document used
+			if kg, ok := task.DeclaredWeight.Kilograms(); ok {
+				totalWeight = strconv.FormatFloat(kg, 'f', -1, 64) + " kg"
+				break
+			}
 			if task.Weight != "" {
 				totalWeight = task.Weight
 				break
@@ -176,6 +198,7 @@ func ConvertShipmentToStatements(shipment *parser.Shipment) []ShipmentStatement
 	totalDistance := endKm - startKm
 
 	var loadTask *parser.TaskSection
+	cleanings := make([]*parser.TaskSection, 0)
 
 	for _, task := range shipment.Tasks {
 		taskType := strings.ToLower(strings.TrimSpace(task.Type))
@@ -190,19 +213,26 @@ func ConvertShipmentToStatements(shipment *parser.Shipment) []ShipmentStatement
 				fmt.Printf("  Found unload task, creating statement\n")
 
 				statement := ShipmentStatement{
-					ShipmentId:     shipment.Id,
-					LoadAddress:    loadTask.Address,
-					LoadDatetime:   formatDateTimeRange(loadTask.Start, loadTask.End),
-					LoadDuration:   calculateDuration(loadTask.Start, loadTask.End),
-					UnloadAddress:  task.Address,
-					UnloadDatetime: formatDateTimeRange(task.Start, task.End),
-					UnloadDuration: calculateDuration(task.Start, task.End),
-					Weight:         totalWeight,
-					KmVnR:          int(totalDistance),
+					ShipmentId:        shipment.Id,
+					Car:               shipment.TaskCar(loadTask),
+					LoadAddress:       loadTask.Address,
+					LoadDatetime:      formatDateTimeRange(loadTask.Start, loadTask.End),
+					LoadDuration:      calculateDuration(loadTask.Start, loadTask.End),
+					LoadPunctuality:   loadTask.PunctualityText(config.Polish),
+					UnloadAddress:     task.Address,
+					UnloadDatetime:    formatDateTimeRange(task.Start, task.End),
+					UnloadDuration:    calculateDuration(task.Start, task.End),
+					UnloadPunctuality: task.PunctualityText(config.Polish),
+					Weight:            totalWeight,
+					MeasuredWeight:    loadTask.CurrentWeight,
+					KmVnR:             int(totalDistance),
 				}
 				statement.DurationLoadAndUnload = duration.Duration{
 					Duration: statement.LoadDuration.Duration + statement.UnloadDuration.Duration,
 				}
+				statement.LoadArrived, statement.LoadWaiting, statement.LoadFreeTime, statement.LoadDemurrage = demurrageColumns(loadTask)
+				statement.UnloadArrived, statement.UnloadWaiting, statement.UnloadFreeTime, statement.UnloadDemurrage = demurrageColumns(task)
+				statement.Demurrage = math.Round((statement.LoadDemurrage+statement.UnloadDemurrage)*100) / 100
 
 				statements = append(statements, statement)
 				fmt.Printf("  Statement added: Shipment %d, Load: %s, Unload: %s, Distance: %d km, Weight: %s\n",
@@ -213,18 +243,20 @@ func ConvertShipmentToStatements(shipment *parser.Shipment) []ShipmentStatement
 				fmt.Printf("WARN: WARNING: Found unload without preceding load task\n")
 			}
 		} else if taskType == "cleaning" {
-			idStmt := slices.IndexFunc(statements, func(s ShipmentStatement) bool {
-				return s.ShipmentId == task.ShipmentId
-			})
-			if idStmt == -1 {
-				fmt.Printf("WARN: WARNING: found cleaning task, but could not find the shipment with the same shipment id: task - %d\n", task.ShipmentId)
-				continue
-			}
-			statements[idStmt].CleaningStationAddress = task.Address
+			cleanings = append(cleanings, task)
 			fmt.Printf("  Found cleaning task at: %s\n", task.Address)
 		}
 	}
 
+	// the tank is usually cleaned before the load, so the cleanings go to the first statement of the shipment once they are all known
+	if len(cleanings) > 0 {
+		if len(statements) == 0 {
+			fmt.Printf("WARN: WARNING: found cleaning task, but there is no statement of shipment %d for it\n", shipment.Id)
+		} else {
+			statements[0].CleaningStation, statements[0].EcdNumber, statements[0].PreviousProduct, statements[0].CleaningType = cleaningColumns(cleanings)
+		}
+	}
+
 	fmt.Printf("Total statements created: %d\n", len(statements))
 	return statements
 }
@@ -256,6 +288,46 @@ func formatDateTimeRange(start, end time.Time) string {
 			end.Format("02-01-2006 15:04"))
 	}
 }
+
+// demurrageColumns are the arrival of the task, the waiting on its site, the free time of the site and the hours of the
+// waiting beyond it. They are empty when the driver did not say he arrived
+func demurrageColumns(task *parser.TaskSection) (arrived string, waiting, free duration.Duration, billableHours float64) {
+	wait, billable, ok := task.Demurrage()
+	if !ok {
+		return "", duration.Duration{}, duration.Duration{}, 0
+	}
+	return formatDateTime(task.Arrived), duration.Duration{Duration: wait}, duration.Duration{Duration: task.FreeTime()}, math.Round(billable.Hours()*100) / 100
+}
+
+// cleaningColumns are the station, the ECD number, the previous product and the type of the cleaning tasks of a shipment,
+// a shipment cleaned more than once has them one after another. The station is the address of the task when there is no
+// station picked from the list for it, the cleanings from before the ECDs have only that
+func cleaningColumns(cleanings []*parser.TaskSection) (station, ecd, previousProduct, cleaningType string) {
+	var stations, ecds, previousProducts, cleaningTypes []string
+	add := func(values []string, v string) []string {
+		if v == "" {
+			return values
+		}
+		return append(values, v)
+	}
+
+	for _, t := range cleanings {
+		r := t.Cleaning
+		if r == nil {
+			r = &parser.CleaningRecord{TaskId: t.Id}
+		}
+		if r.StationName != "" {
+			stations = add(stations, r.StationName)
+		} else {
+			stations = add(stations, t.Address)
+		}
+		ecds = add(ecds, r.EcdNumber)
+		previousProducts = add(previousProducts, r.PreviousProduct)
+		cleaningTypes = add(cleaningTypes, r.CleaningType)
+	}
+	return strings.Join(stations, "; "), strings.Join(ecds, "; "), strings.Join(previousProducts, "; "), strings.Join(cleaningTypes, "; ")
+}
+
 func calculateDuration(start, end time.Time) duration.Duration {
 	if start.IsZero() || end.IsZero() {
 		return duration.Duration{Duration: 0}
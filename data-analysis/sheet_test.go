@@ -0,0 +1,65 @@
+package data_analysis
+
+import (
+	"logistictbot/parser"
+	"testing"
+)
+
+func TestCleaningColumns(t *testing.T) {
+	ecd := &parser.CleaningRecord{EcdNumber: "ECD-1", StationId: 4, StationName: "Wash A", PreviousProduct: "ETHANOL", CleaningType: "food grade"}
+	typed := &parser.CleaningRecord{EcdNumber: "ECD-2", PreviousProduct: "METHANOL"}
+
+	tests := []struct {
+		name                                 string
+		cleanings                            []*parser.TaskSection
+		station, ecd, previous, cleaningType string
+	}{
+		{"station from the list", []*parser.TaskSection{{Address: "Hafenstr 1", Cleaning: ecd}}, "Wash A", "ECD-1", "ETHANOL", "food grade"},
+		{"station written by hand", []*parser.TaskSection{{Address: "Hafenstr 1", Cleaning: typed}}, "Hafenstr 1", "ECD-2", "METHANOL", ""},
+		{"cleaning from before the ECDs", []*parser.TaskSection{{Address: "Wash B, Duisburg"}}, "Wash B, Duisburg", "", "", ""},
+		{"cleaned twice", []*parser.TaskSection{{Cleaning: ecd}, {Address: "Wash B"}}, "Wash A; Wash B", "ECD-1", "ETHANOL", "food grade"},
+		{"nothing", nil, "", "", "", ""},
+	}
+
+	for _, tt := range tests {
+		station, ecd, previous, cleaningType := cleaningColumns(tt.cleanings)
+		if station != tt.station || ecd != tt.ecd || previous != tt.previous || cleaningType != tt.cleaningType {
+			t.Errorf("%s: got %q %q %q %q, want %q %q %q %q", tt.name, station, ecd, previous, cleaningType,
+				tt.station, tt.ecd, tt.previous, tt.cleaningType)
+		}
+	}
+}
+
+func TestStatementCleaning(t *testing.T) {
+	tests := []struct {
+		name        string
+		tasks       []*parser.TaskSection
+		wantStation []string // of every statement
+	}{
+		{"cleaning before the load", []*parser.TaskSection{
+			{Type: parser.TaskCleaning, Address: "Wash B", Cleaning: &parser.CleaningRecord{StationName: "Wash A", EcdNumber: "ECD-1"}},
+			{Type: parser.TaskLoad}, {Type: parser.TaskUnload},
+		}, []string{"Wash A"}},
+		{"cleaning after the unload", []*parser.TaskSection{
+			{Type: parser.TaskLoad}, {Type: parser.TaskUnload}, {Type: parser.TaskCleaning, Address: "Wash B"},
+		}, []string{"Wash B"}},
+		{"only the first statement", []*parser.TaskSection{
+			{Type: parser.TaskCleaning, Address: "Wash B"},
+			{Type: parser.TaskLoad}, {Type: parser.TaskUnload}, {Type: parser.TaskLoad}, {Type: parser.TaskUnload},
+		}, []string{"Wash B", ""}},
+		{"no statement for the cleaning", []*parser.TaskSection{{Type: parser.TaskCleaning, Address: "Wash B"}}, []string{}},
+	}
+
+	for _, tt := range tests {
+		statements := ConvertShipmentToStatements(&parser.Shipment{Id: 1, Tasks: tt.tasks})
+		if len(statements) != len(tt.wantStation) {
+			t.Errorf("%s: %d statements, want %d", tt.name, len(statements), len(tt.wantStation))
+			continue
+		}
+		for i, s := range statements {
+			if s.CleaningStation != tt.wantStation[i] {
+				t.Errorf("%s: statement %d has the station %q, want %q", tt.name, i, s.CleaningStation, tt.wantStation[i])
+			}
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/csv"
 	"errors"
 	"fmt"
+	"logistictbot/audit"
 	"logistictbot/config"
 	"logistictbot/errlog"
 	"net/http"
@@ -86,8 +87,13 @@ func GetCarById(exec DBExecutor, carId string) (*Car, error) {
 	return car, nil
 }
 
-func (c *Car) UpdateCarKilometrage(exec DBExecutor) error {
-	_, err := exec.Exec(`
+func (c *Car) UpdateCarKilometrage(exec DBExecutor, by audit.Actor) error {
+	before, err := audit.Before(exec, audit.Target{Entity: audit.EntityCar, Id: c.Id}, "current_kilometrage")
+	if err != nil {
+		return err
+	}
+
+	_, err = exec.Exec(`
 	UPDATE cars
 	SET current_kilometrage = ?
 	WHERE id = ?`,
@@ -99,7 +105,7 @@ func (c *Car) UpdateCarKilometrage(exec DBExecutor) error {
 		return fmt.Errorf("ERR: giving updating kilometrage for %s: %v\n", c.Id, err)
 	}
 
-	return nil
+	return before.After(exec, by)
 }
 
 /*
@@ -135,6 +141,9 @@ func (c *Car) AddCarToDB(chatId int64, bot *tgbotapi.BotAPI, executor DBExecutor
 		errlog.ERR.Printf("ERR: executing stmt to add car to the db: %v\n", err)
 		return fmt.Errorf("ERR: executing stmt to add car to the db: %v\n", err)
 	}
+	if err = audit.Created(executor, audit.Bot(chatId), audit.Target{Entity: audit.EntityCar, Id: c.Id}, c.Kilometrage); err != nil {
+		return err
+	}
 
 	_, err = bot.Send(tgbotapi.NewMessage(chatId, config.Translate(config.GetLang(chatId), "added_car", c.Id, c.Kilometrage)))
 	return err
@@ -209,6 +218,9 @@ func (c *Car) AddCarsFromTelegramCSV(chatId int64, bot *tgbotapi.BotAPI, globalS
 			errSlice = append(errSlice, fmt.Sprintf("Row %d (%s): %v", i+2, carId, err))
 			continue
 		}
+		if err = audit.Created(tx, audit.Bot(chatId), audit.Target{Entity: audit.EntityCar, Id: carId}, kilometrage); err != nil {
+			return err
+		}
 		successCount++
 	}
 
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"logistictbot/audit"
 	"logistictbot/duration"
 	"logistictbot/errlog"
 	"logistictbot/parser"
@@ -43,6 +44,11 @@ const (
 	StateRefuelingAdBlu    DriverConversationState = "refuel_adblu"
 	StateRefuelingDiesel   DriverConversationState = "refuel_diesel"
 	StateRefuelingAddress  DriverConversationState = "refuel_address"
+	// the European Cleaning Document of a cleaning task, asked one after another at its end
+	StateWaitingEcd          DriverConversationState = "waiting_ecd"
+	StateWaitingPrevProduct  DriverConversationState = "waiting_prev_product"
+	StateWaitingCleaningType DriverConversationState = "waiting_cleaning_type"
+	StateWaitingCertificate  DriverConversationState = "waiting_certificate"
 )
 
 var (
@@ -122,7 +128,7 @@ func (d *Driver) ShowManagerList(exec DBExecutor, callback string, caption strin
 	return err
 }
 
-func (d *Driver) StoreDriver(db DBExecutor, bot *tgbotapi.BotAPI) error {
+func (d *Driver) StoreDriver(db DBExecutor, bot *tgbotapi.BotAPI, by audit.Actor) error {
 	id, err := uuid.NewV4()
 	if err != nil {
 		errlog.ERR.Printf("ERR: creating a new uuid for a driver: %v", err)
@@ -168,6 +174,11 @@ func (d *Driver) StoreDriver(db DBExecutor, bot *tgbotapi.BotAPI) error {
 	d.Id = id
 	d.User.DriverId = id
 
+	err = audit.Created(db, by, audit.Target{Entity: audit.EntityDriver, Id: id.String(), DriverId: id.String()}, d.ChatId)
+	if err != nil {
+		return err
+	}
+
 	// err = d.User.SendRequestToSuperAdmins(db, bot)
 	// if err != nil {
 	// 	errlog.ERR.Printf("ERR: sending request to accept user to superadmins: %v\n", err)
@@ -513,10 +524,25 @@ func GetAllDrivers(db DBExecutor) ([]*Driver, error) {
 	return drivers, nil
 }
 
-func (d *Driver) UpdateCarId(db DBExecutor, newCarId string) error {
+func (d *Driver) UpdateCarId(db DBExecutor, newCarId string, by audit.Actor) error {
 	tx, ok := db.(*sql.Tx)
 	var txErr error
 
+	driverBefore, err := audit.Before(db, audit.Target{Entity: audit.EntityDriver, Id: d.Id.String(), DriverId: d.Id.String()}, "car_id")
+	if err != nil {
+		if ok {
+			txErr = tx.Rollback()
+		}
+		return fmt.Errorf("ERR: %v (txErr: %v)", err, txErr)
+	}
+	carBefore, err := audit.Before(db, audit.Target{Entity: audit.EntityCar, Id: newCarId, DriverId: d.Id.String()}, "current_driver")
+	if err != nil {
+		if ok {
+			txErr = tx.Rollback()
+		}
+		return fmt.Errorf("ERR: %v (txErr: %v)", err, txErr)
+	}
+
 	stmtDriver, err := db.Prepare(`
 		UPDATE drivers
 		SET car_id = ?, updated_at = CURRENT_TIMESTAMP
@@ -581,13 +607,22 @@ func (d *Driver) UpdateCarId(db DBExecutor, newCarId string) error {
 		return fmt.Errorf("ERR: executing update driver car_id stmt: %v (txErr: %v)\n", err, txErr)
 	}
 
+	for _, before := range []*audit.Snapshot{driverBefore, carBefore} {
+		if err = before.After(db, by); err != nil {
+			if ok {
+				txErr = tx.Rollback()
+			}
+			return fmt.Errorf("ERR: %v (txErr: %v)", err, txErr)
+		}
+	}
+
 	if tx, ok := db.(*sql.Tx); ok {
 		return tx.Commit()
 	}
 	return nil
 }
 
-func (d *Driver) UnpauseSession(db DBExecutor) (*DriverSession, error) {
+func (d *Driver) UnpauseSession(db DBExecutor, by audit.Actor) (*DriverSession, error) {
 	if d.CarId == "" {
 		if d.ChatId == 0 {
 			return nil, ErrNoDriverSession
@@ -604,8 +639,8 @@ func (d *Driver) UnpauseSession(db DBExecutor) (*DriverSession, error) {
 
 	query := `
 		INSERT INTO drivers_sessions
-		(driver_id, starting_kilometrage)
-		VALUES (?, ?)
+		(driver_id, starting_kilometrage, car_id)
+		VALUES (?, ?, ?)
 	`
 
 	car, err := GetCarById(db, d.CarId)
@@ -613,7 +648,7 @@ func (d *Driver) UnpauseSession(db DBExecutor) (*DriverSession, error) {
 		return nil, fmt.Errorf("ERR: getting a car by id: %v", err)
 	}
 
-	result, err := db.Exec(query, d.Id, car.Kilometrage)
+	result, err := db.Exec(query, d.Id, car.Kilometrage, d.CarId)
 	if err != nil {
 		return nil, fmt.Errorf("ERR: inserting new session: %v", err)
 	}
@@ -622,6 +657,10 @@ func (d *Driver) UnpauseSession(db DBExecutor) (*DriverSession, error) {
 	if err != nil {
 		return nil, fmt.Errorf("ERR: getting last insert id: %v", err)
 	}
+	err = audit.Created(db, by, audit.Target{Entity: audit.EntitySession, Id: sessionID, DriverId: d.Id.String()}, d.CarId)
+	if err != nil {
+		return nil, err
+	}
 
 	session, err := GetSessionById(db, int(sessionID))
 	if err != nil {
@@ -735,7 +774,7 @@ func UpdatePausedTime(db DBExecutor) error {
 	return err
 }
 
-func (d *Driver) PauseSession(db DBExecutor) (*DriverSession, error) {
+func (d *Driver) PauseSession(db DBExecutor, by audit.Actor) (*DriverSession, error) {
 	var sessionId sql.NullInt64
 	session := d.Session
 
@@ -793,6 +832,12 @@ func (d *Driver) PauseSession(db DBExecutor) (*DriverSession, error) {
 		return nil, fmt.Errorf("ERR: getting a car by id: %v", err)
 	}
 
+	before, err := audit.Before(db, audit.Target{Entity: audit.EntitySession, Id: sessionId.Int64, DriverId: d.Id.String()},
+		"paused", "worktime", "drivetime", "pausetime", "kilometrage_accumulated", "end_kilometrage")
+	if err != nil {
+		return nil, err
+	}
+
 	res, err := db.Exec(query,
 		session.Worktime.String(),
 		session.Drivetime.String(),
@@ -813,6 +858,9 @@ func (d *Driver) PauseSession(db DBExecutor) (*DriverSession, error) {
 		return nil, fmt.Errorf("pause session: no rows updated (session id=%d)", sessionId.Int64)
 	}
 
+	if err = before.After(db, by); err != nil {
+		return nil, err
+	}
 	return session, nil
 }
 
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"logistictbot/audit"
 	"logistictbot/config"
 	"logistictbot/errlog"
 	"strings"
@@ -94,10 +95,11 @@ func (f Form) StoreForm(db *sql.DB, bot *tgbotapi.BotAPI) error {
 // if err != nil in this function, transaction must be absolutely fucking rolled back
 func insertIntoSpecTable(data any, tx *sql.Tx, chatId int64, bot *tgbotapi.BotAPI) error {
 	var err error
+	by := audit.Bot(chatId)
 	switch v := data.(type) {
 	case Driver:
 		v.User.ChatId = chatId
-		err = v.User.StoreUser(tx)
+		err = v.User.StoreUser(tx, by)
 		if err != nil {
 			tx.Rollback()
 
@@ -109,7 +111,7 @@ func insertIntoSpecTable(data any, tx *sql.Tx, chatId int64, bot *tgbotapi.BotAP
 		}
 
 		v.UserId = v.User.Id
-		err = v.StoreDriver(tx, bot)
+		err = v.StoreDriver(tx, bot, by)
 		if err != nil {
 			tx.Rollback()
 			errlog.ERR.Printf("ERR: storing driver in the table: %v\n", err)
@@ -125,7 +127,7 @@ func insertIntoSpecTable(data any, tx *sql.Tx, chatId int64, bot *tgbotapi.BotAP
 		return nil
 	case Manager:
 		v.User.ChatId = chatId
-		err = v.User.StoreUser(tx)
+		err = v.User.StoreUser(tx, by)
 		if err != nil {
 			tx.Rollback()
 			errlog.ERR.Printf("ERR: storing user based on manager's form: %v\n", err)
@@ -133,7 +135,7 @@ func insertIntoSpecTable(data any, tx *sql.Tx, chatId int64, bot *tgbotapi.BotAP
 		}
 		v.UserId = v.User.Id
 
-		err = v.StoreManager(tx, bot)
+		err = v.StoreManager(tx, bot, by)
 		if err != nil {
 			tx.Rollback()
 			errlog.ERR.Printf("ERR: storing manager in the table: %v\n", err)
@@ -234,6 +236,27 @@ func CheckAllTables(db *sql.DB) (err error) {
 	}
 	log.Println("shipments is ok.")
 
+	err = CheckShipmentStatusHistoryTable(db)
+	if err != nil {
+		errlog.ERR.Printf("ERR: creating or checking the table shipment_status_history: %v\n", err)
+		return fmt.Errorf("ERR: creating or checking the table shipment_status_history: %v\n", err)
+	}
+	log.Println("shipment_status_history is ok.")
+
+	err = CheckShipmentDriversTable(db)
+	if err != nil {
+		errlog.ERR.Printf("ERR: creating or checking the table shipment_drivers: %v\n", err)
+		return fmt.Errorf("ERR: creating or checking the table shipment_drivers: %v\n", err)
+	}
+	log.Println("shipment_drivers is ok.")
+
+	err = CheckAuditLogTable(db)
+	if err != nil {
+		errlog.ERR.Printf("ERR: creating or checking the table audit_log: %v\n", err)
+		return fmt.Errorf("ERR: creating or checking the table audit_log: %v\n", err)
+	}
+	log.Println("audit_log is ok.")
+
 	err = CheckTasksTable(db)
 	if err != nil {
 		errlog.ERR.Printf("ERR: creating or checking the table tasks: %v\n", err)
@@ -241,6 +264,28 @@ func CheckAllTables(db *sql.DB) (err error) {
 	}
 	log.Println("tasks is ok.")
 
+	err = CheckTaskCompartmentsTable(db)
+	if err != nil {
+		errlog.ERR.Printf("ERR: creating or checking the table task_compartments: %v\n", err)
+		return fmt.Errorf("ERR: creating or checking the table task_compartments: %v\n", err)
+	}
+	log.Println("task_compartments is ok.")
+
+	err = CheckTaskCleaningsTable(db)
+	if err != nil {
+		errlog.ERR.Printf("ERR: creating or checking the table task_cleanings: %v\n", err)
+		return fmt.Errorf("ERR: creating or checking the table task_cleanings: %v\n", err)
+	}
+	log.Println("task_cleanings is ok.")
+
+	err = CheckSearchTables(db)
+	if err != nil {
+		// without the fts5 of sqlite the bot works the same, only /find and /api/search do not
+		errlog.WARN.Printf("WARN: creating or checking the search index, build with -tags sqlite_fts5: %v\n", err)
+	} else {
+		log.Println("search index is ok.")
+	}
+
 	err = CheckShipmentSessionsTable(db)
 	if err != nil {
 		errlog.ERR.Printf("ERR: creating or checking the table shipment_sessions: %v\n", err)
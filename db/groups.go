@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"logistictbot/audit"
 	"logistictbot/config"
 	"logistictbot/errlog"
 	"strings"
@@ -273,7 +274,7 @@ func (g *DriverGroup) GetDriverGroup(globalStorage *sql.DB) error {
 	return nil
 }
 
-func (g *DriverGroup) CreateDriverGroup(globalStorage *sql.DB) error {
+func (g *DriverGroup) CreateDriverGroup(globalStorage *sql.DB, by audit.Actor) error {
 	stmt, err := globalStorage.Prepare("INSERT INTO driver_groups(group_chat_id, current_car_id) VALUES (?, ?)")
 	if err != nil {
 		errlog.ERR.Printf("ERR: prepping stmt for adding a group to the db: %v\n", err)
@@ -291,7 +292,7 @@ func (g *DriverGroup) CreateDriverGroup(globalStorage *sql.DB) error {
 		return fmt.Errorf("ERR: executing stmt to add group to the db: %v\n", err)
 	}
 
-	return err
+	return audit.Created(globalStorage, by, audit.Target{Entity: audit.EntityGroup, Id: g.GroupChatId}, g.CurrentCar.Id)
 }
 
 func (g *DriverGroup) fillTopicId(globalStorage *sql.DB, column string, topicId int, field *int) {
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"logistictbot/audit"
 	"logistictbot/config"
 	"logistictbot/docs"
 	"logistictbot/errlog"
@@ -28,6 +29,7 @@ const (
 	StateWaitingNotes          ManagerConversationState = "waiting_notes"
 	StateWaitingDriver         ManagerConversationState = "waiting_driver"
 	StateSendingWashingStation ManagerConversationState = "giving_washing_stat"
+	StateReviewingDoc          ManagerConversationState = "reviewing_doc"
 )
 
 type PendingMessage struct {
@@ -39,6 +41,14 @@ type PendingMessage struct {
 	DocMimetype     docs.Mimetype
 	Caption         string
 	FileId          string
+
+	// filled in after the document was parsed and is waiting for the manager's review
+	DocId          int
+	Shipment       *parser.Shipment
+	Report         *parser.ParseReport
+	ShipmentStored bool
+	// set when the shipment number is already stored, the document is then a new version of it
+	Amendment *parser.ReparseResult
 }
 
 type Manager struct {
@@ -209,7 +219,7 @@ func GetManagerByChatId(db DBExecutor, chatId int64) (*Manager, error) {
 	return manager, nil
 }
 
-func (m *Manager) StoreManager(db DBExecutor, bot *tgbotapi.BotAPI) error {
+func (m *Manager) StoreManager(db DBExecutor, bot *tgbotapi.BotAPI, by audit.Actor) error {
 	tx, ok := db.(*sql.Tx)
 	var txErr error
 
@@ -271,6 +281,14 @@ func (m *Manager) StoreManager(db DBExecutor, bot *tgbotapi.BotAPI) error {
 		return fmt.Errorf("ERR: executing update user manager_id stmt: %v (txErr: %v)\n", err, txErr)
 	}
 
+	err = audit.Created(db, by, audit.Target{Entity: audit.EntityManager, Id: id.String()}, m.ChatId)
+	if err != nil {
+		if ok {
+			txErr = tx.Rollback()
+		}
+		return fmt.Errorf("ERR: %v (txErr: %v)", err, txErr)
+	}
+
 	/*err = m.User.SendRequestToSuperAdmins(db, bot)
 	if err != nil {
 		errlog.ERR.Printf("ERR: sending request to accept user to superadmins: %v\n", err)
@@ -390,6 +408,80 @@ func (pm *PendingMessage) StoreDocForShipment(exec *sql.DB, bot *tgbotapi.BotAPI
 	return downloadedDoc.Id, err
 }
 
+// ParseDoc runs the parser over the uploaded document and keeps the result on the pending message until the manager reviews it
+func (pm *PendingMessage) ParseDoc(exec *sql.DB) error {
+	f := docs.File{TgFileId: pm.FileId}
+	err := f.GetFile(exec)
+	if err != nil {
+		errlog.ERR.Printf("ERR: getting file from file id of tg: %v\n", err)
+		return fmt.Errorf("ERR: getting file from file id of tg: %v\n", err)
+	}
+
+	shipment, report, err := parser.GetSequenceOfTasksWithReport(f.Path)
+	if err != nil {
+		errlog.ERR.Printf("ERR: reading the shipment doc: %v\n", err)
+		return fmt.Errorf("ERR: reading the shipment doc: %v\n", err)
+	}
+
+	pm.DocId = f.Id
+	pm.Shipment = shipment
+	pm.Report = report
+	pm.ShipmentStored = false
+	pm.Amendment = nil
+
+	exists, err := parser.ShipmentExists(exec, shipment.Id)
+	if err != nil {
+		return err
+	}
+	if exists {
+		shipment.ShipmentDocId = f.Id
+		pm.Amendment, err = parser.DiffAmendment(exec, shipment)
+		if err != nil {
+			errlog.ERR.Printf("ERR: comparing the amended document with shipment %d: %v\n", shipment.Id, err)
+			return fmt.Errorf("ERR: comparing the amended document with shipment %d: %w", shipment.Id, err)
+		}
+	}
+
+	return nil
+}
+
+// StoreReviewedShipment stores the parsed shipment without sending it to the driver, so it can be fixed in the web editor first.
+// It is a draft without the driver and the car until the manager accepts it, the review is only in memory and a draft
+// left by a restart is not driven by anyone
+func (pm *PendingMessage) StoreReviewedShipment(exec *sql.DB) error {
+	if pm.Shipment == nil {
+		return fmt.Errorf("ERR: there is no parsed shipment to store")
+	}
+
+	pm.Shipment.CarId = ""
+	pm.Shipment.DriverId = uuid.Nil
+	pm.Shipment.ShipmentDocId = pm.DocId
+
+	err := pm.Shipment.StoreShipment(exec, audit.Bot(pm.FromChatId))
+	if err != nil {
+		return fmt.Errorf("store shipment: %v", err)
+	}
+	pm.ShipmentStored = true
+
+	return nil
+}
+
+// DiscardReviewedShipment is used when the manager rejects the parsed document
+func (pm *PendingMessage) DiscardReviewedShipment(exec *sql.DB) error {
+	if pm.Shipment != nil && pm.ShipmentStored {
+		err := pm.Shipment.DeleteShipment(exec, audit.Bot(pm.FromChatId))
+		if err != nil {
+			errlog.ERR.Printf("ERR: deleting rejected shipment %d: %v\n", pm.Shipment.Id, err)
+			return fmt.Errorf("ERR: deleting rejected shipment %d: %v\n", pm.Shipment.Id, err)
+		}
+	}
+	pm.Shipment = nil
+	pm.Report = nil
+	pm.ShipmentStored = false
+	pm.Amendment = nil
+	return nil
+}
+
 func (pm *PendingMessage) SendDocToDriver(exec *sql.DB, bot *tgbotapi.BotAPI) error {
 	if manager, err := GetManagerByChatId(exec, pm.FromChatId); err != nil && manager == nil {
 		bot.Send(tgbotapi.NewMessage(pm.FromChatId, config.Translate(config.GetLang(pm.FromChatId), "gotta_be_manager")))
@@ -423,23 +515,34 @@ func (pm *PendingMessage) SendDocToDriver(exec *sql.DB, bot *tgbotapi.BotAPI) er
 		return fmt.Errorf("ERR: getting driver group: %v\n", err)
 	}
 
-	shipment, err := parser.GetSequenceOfTasks(f.Path)
-	if err != nil {
-		errlog.ERR.Printf("ERR: reading the shipment doc: %v\n", err)
-		return fmt.Errorf("ERR: reading the shipment doc: %v\n", err)
+	shipment := pm.Shipment
+	if shipment == nil {
+		shipment, err = parser.GetSequenceOfTasks(f.Path)
+		if err != nil {
+			errlog.ERR.Printf("ERR: reading the shipment doc: %v\n", err)
+			return fmt.Errorf("ERR: reading the shipment doc: %v\n", err)
+		}
 	}
 
-	shipment.CarId = driver.CarId
-	shipment.DriverId = driver.Id
-	shipment.ShipmentDocId = f.Id
+	// if it was stored for fixing, the web editor could have changed it already, so it should not be overwritten by the parsed one.
+	// It is the draft that goes to the driver now
+	if pm.ShipmentStored {
+		if err = shipment.Assign(exec, driver.Id, driver.CarId, audit.Bot(pm.FromChatId)); err != nil {
+			return fmt.Errorf("assign shipment: %v", err)
+		}
+	} else {
+		shipment.CarId = driver.CarId
+		shipment.DriverId = driver.Id
+		shipment.ShipmentDocId = f.Id
 
-	err = shipment.StoreShipment(exec)
-	if err != nil {
-		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
-			_, err = bot.Send(tgbotapi.NewMessage(pm.FromChatId, config.Translate(config.GetLang(pm.FromChatId), "err_shipment_exists")))
-			return err
+		err = shipment.StoreShipment(exec, audit.Bot(pm.FromChatId))
+		if err != nil {
+			if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+				_, err = bot.Send(tgbotapi.NewMessage(pm.FromChatId, config.Translate(config.GetLang(pm.FromChatId), "err_shipment_exists")))
+				return err
+			}
+			return fmt.Errorf("store shipment: %v", err)
 		}
-		return fmt.Errorf("store shipment: %v", err)
 	}
 
 	docMsg := tgbotapi.NewDocument(g.GroupChatId, tgbotapi.FileID(pm.FileId), g.LoadingTopicId)
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"logistictbot/audit"
 	"logistictbot/errlog"
 	"time"
 
@@ -30,7 +31,32 @@ type TankRefuel struct {
 	CarId              string
 }
 
-func (t *TankRefuel) StoreTankRefuel(db DBExecutor) error {
+func (t *TankRefuel) auditTarget() audit.Target {
+	target := audit.Target{Entity: audit.EntityTankRefuel, Id: t.Id}
+	if t.ShipmentId != nil {
+		target.ShipmentId = *t.ShipmentId
+	}
+	if t.Driver != nil {
+		target.DriverId = t.Driver.Id.String()
+	}
+	return target
+}
+
+// update sets a column of the refuel and records it in the audit log
+func (t *TankRefuel) update(db DBExecutor, column string, value any, by audit.Actor) error {
+	before, err := audit.Before(db, t.auditTarget(), column)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(fmt.Sprintf(`UPDATE tank_refuels SET %s = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, column), value, t.Id)
+	if err != nil {
+		errlog.ERR.Printf("ERR: updating %s for tank_refuel %d: %v", column, t.Id, err)
+		return fmt.Errorf("ERR: updating %s for tank_refuel %d: %v", column, t.Id, err)
+	}
+	return before.After(db, by)
+}
+
+func (t *TankRefuel) StoreTankRefuel(db DBExecutor, by audit.Actor) error {
 	stmt, err := db.Prepare(`
 		INSERT INTO tank_refuels (shipment_id, fuel_card_id, driver_id, created_at, car_id)
 		VALUES (?, ?, ?, CURRENT_TIMESTAMP, ?)
@@ -63,52 +89,36 @@ func (t *TankRefuel) StoreTankRefuel(db DBExecutor) error {
 		return fmt.Errorf("ERR: getting last insert id for tank_refuel: %v", err)
 	}
 	t.Id = int(newId)
-	return nil
+	return audit.Created(db, by, t.auditTarget(), t.CarId)
 }
 
-func (t *TankRefuel) UpdateAddress(db DBExecutor, address string) error {
-	_, err := db.Exec(`
-		UPDATE tank_refuels SET address = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?
-	`, address, t.Id)
-	if err != nil {
-		errlog.ERR.Printf("ERR: updating address for tank_refuel %d: %v", t.Id, err)
-		return fmt.Errorf("ERR: updating address for tank_refuel %d: %v", t.Id, err)
+func (t *TankRefuel) UpdateAddress(db DBExecutor, address string, by audit.Actor) error {
+	if err := t.update(db, "address", address, by); err != nil {
+		return err
 	}
 	t.Address = address
 	return nil
 }
 
-func (t *TankRefuel) UpdateKilometrage(db DBExecutor, kilometrage int64) error {
-	_, err := db.Exec(`
-		UPDATE tank_refuels SET current_kilometrage = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?
-	`, kilometrage, t.Id)
-	if err != nil {
-		errlog.ERR.Printf("ERR: updating kilometrage for tank_refuel %d: %v", t.Id, err)
-		return fmt.Errorf("ERR: updating kilometrage for tank_refuel %d: %v", t.Id, err)
+func (t *TankRefuel) UpdateKilometrage(db DBExecutor, kilometrage int64, by audit.Actor) error {
+	if err := t.update(db, "current_kilometrage", kilometrage, by); err != nil {
+		return err
 	}
 	t.CurrentKilometrage = kilometrage
 	return nil
 }
 
-func (t *TankRefuel) UpdateDiesel(db DBExecutor, diesel float64) error {
-	_, err := db.Exec(`
-		UPDATE tank_refuels SET diesel = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?
-	`, diesel, t.Id)
-	if err != nil {
-		errlog.ERR.Printf("ERR: updating diesel for tank_refuel %d: %v", t.Id, err)
-		return fmt.Errorf("ERR: updating diesel for tank_refuel %d: %v", t.Id, err)
+func (t *TankRefuel) UpdateDiesel(db DBExecutor, diesel float64, by audit.Actor) error {
+	if err := t.update(db, "diesel", diesel, by); err != nil {
+		return err
 	}
 	t.Diesel = diesel
 	return nil
 }
 
-func (t *TankRefuel) UpdateAdBlu(db DBExecutor, adBlu float64) error {
-	_, err := db.Exec(`
-		UPDATE tank_refuels SET adblu = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?
-	`, adBlu, t.Id)
-	if err != nil {
-		errlog.ERR.Printf("ERR: updating adblu for tank_refuel %d: %v", t.Id, err)
-		return fmt.Errorf("ERR: updating adblu for tank_refuel %d: %v", t.Id, err)
+func (t *TankRefuel) UpdateAdBlu(db DBExecutor, adBlu float64, by audit.Actor) error {
+	if err := t.update(db, "adblu", adBlu, by); err != nil {
+		return err
 	}
 	t.AdBlu = adBlu
 	return nil
@@ -0,0 +1,137 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"logistictbot/audit"
+	"logistictbot/duration"
+	"logistictbot/errlog"
+	"time"
+)
+
+// A double manned truck has a session of each driver on the same day, the first one to end the day takes the whole
+// kilometrage of the truck and the other one gets nothing. When the last of them ends the day, the kilometrage the
+// truck made while they were on it is split between them by how long each of them drove
+
+// TeamShare is the kilometrage a driver of the team got
+type TeamShare struct {
+	SessionId   int
+	DriverId    string
+	Drivetime   duration.Duration
+	Kilometrage int
+}
+
+// shareKilometrage splits km by the drive times, equally if nobody drove. What is left from the rounding goes to the first ones
+func shareKilometrage(km int, drivetimes []time.Duration) []int {
+	shares := make([]int, len(drivetimes))
+	if len(drivetimes) == 0 || km <= 0 {
+		return shares
+	}
+
+	var total time.Duration
+	for _, d := range drivetimes {
+		total += d
+	}
+
+	given := 0
+	for i, d := range drivetimes {
+		if total > 0 {
+			shares[i] = int(int64(km) * int64(d) / int64(total))
+		} else {
+			shares[i] = km / len(drivetimes)
+		}
+		given += shares[i]
+	}
+	for i := 0; given < km; i = (i + 1) % len(shares) {
+		shares[i]++
+		given++
+	}
+	return shares
+}
+
+// SplitTeamKilometrage splits the kilometrage between the sessions on the truck of sessionId that overlap with it,
+// once all of them are ended. It gives nothing back when the driver was alone or the others are still driving
+func SplitTeamKilometrage(db *sql.DB, sessionId int, by audit.Actor) ([]*TeamShare, error) {
+	rows, err := db.Query(`
+		SELECT o.id, o.driver_id, o.paused, o.drivetime, o.starting_kilometrage, o.end_kilometrage
+		FROM drivers_sessions s
+		JOIN drivers_sessions o ON o.car_id = s.car_id
+			AND o.started < s.paused AND (o.paused IS NULL OR o.paused > s.started)
+		WHERE s.id = ? AND COALESCE(s.car_id, '') != '' AND s.paused IS NOT NULL
+		ORDER BY o.started, o.id`,
+		sessionId)
+	if err != nil {
+		errlog.ERR.Printf("ERR: getting the team sessions of session %d: %v\n", sessionId, err)
+		return nil, fmt.Errorf("ERR: getting the team sessions of session %d: %v", sessionId, err)
+	}
+	defer rows.Close()
+
+	var (
+		shares         []*TeamShare
+		drivers        = make(map[string]bool)
+		startKm, endKm sql.NullInt64
+		stillDriving   bool
+	)
+	for rows.Next() {
+		var (
+			share        = new(TeamShare)
+			sessionEnded sql.NullTime
+			start, end   sql.NullInt64
+		)
+		if err = rows.Scan(&share.SessionId, &share.DriverId, &sessionEnded, &share.Drivetime, &start, &end); err != nil {
+			return nil, fmt.Errorf("ERR: scanning a team session: %v", err)
+		}
+		if !sessionEnded.Valid {
+			stillDriving = true
+		}
+		if start.Valid && (!startKm.Valid || start.Int64 < startKm.Int64) {
+			startKm = start
+		}
+		if end.Valid && (!endKm.Valid || end.Int64 > endKm.Int64) {
+			endKm = end
+		}
+		drivers[share.DriverId] = true
+		shares = append(shares, share)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("ERR: reading the team sessions: %v", err)
+	}
+
+	if len(drivers) < 2 || stillDriving || !startKm.Valid || !endKm.Valid {
+		return nil, nil
+	}
+
+	drivetimes := make([]time.Duration, len(shares))
+	for i, share := range shares {
+		drivetimes[i] = share.Drivetime.Duration
+	}
+	kms := shareKilometrage(int(endKm.Int64-startKm.Int64), drivetimes)
+
+	tx, err := db.Begin()
+	if err != nil {
+		errlog.ERR.Printf("ERR: begin transaction: %v", err)
+		return nil, fmt.Errorf("ERR: begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	for i, share := range shares {
+		share.Kilometrage = kms[i]
+		before, err := audit.Before(tx, audit.Target{Entity: audit.EntitySession, Id: share.SessionId, DriverId: share.DriverId}, "kilometrage_accumulated")
+		if err != nil {
+			return nil, err
+		}
+		if _, err = tx.Exec(`UPDATE drivers_sessions SET kilometrage_accumulated = ? WHERE id = ?`, share.Kilometrage, share.SessionId); err != nil {
+			errlog.ERR.Printf("ERR: setting the team kilometrage of session %d: %v\n", share.SessionId, err)
+			return nil, fmt.Errorf("ERR: setting the team kilometrage of session %d: %v", share.SessionId, err)
+		}
+		if err = before.After(tx, by); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		errlog.ERR.Printf("ERR: commit transaction: %v", err)
+		return nil, fmt.Errorf("ERR: commit transaction: %v", err)
+	}
+	return shares, nil
+}
@@ -0,0 +1,27 @@
+package db
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestShareKilometrage(t *testing.T) {
+	cases := []struct {
+		km         int
+		drivetimes []time.Duration
+		want       []int
+	}{
+		{900, []time.Duration{6 * time.Hour, 3 * time.Hour}, []int{600, 300}},
+		{100, []time.Duration{time.Hour, time.Hour, time.Hour}, []int{34, 33, 33}},
+		{501, []time.Duration{0, 0}, []int{251, 250}},
+		{0, []time.Duration{time.Hour, time.Hour}, []int{0, 0}},
+		{400, []time.Duration{4 * time.Hour, 0}, []int{400, 0}},
+	}
+
+	for _, c := range cases {
+		if got := shareKilometrage(c.km, c.drivetimes); !slices.Equal(got, c.want) {
+			t.Errorf("shareKilometrage(%d, %v) = %v, want %v", c.km, c.drivetimes, got, c.want)
+		}
+	}
+}
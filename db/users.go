@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"logistictbot/audit"
 	"logistictbot/errlog"
 	"time"
 
@@ -135,8 +136,14 @@ func GetAllUsers(globalStorage *sql.DB) ([]*User, error) {
 }
 
 func (u *User) UpdateUserLang(globalStorage *sql.DB) error {
-	_, err := globalStorage.Exec("UPDATE users SET lang = ? WHERE id = ?", u.Language, u.Id)
-	return err
+	before, err := audit.Before(globalStorage, u.auditTarget(), "lang")
+	if err != nil {
+		return err
+	}
+	if _, err = globalStorage.Exec("UPDATE users SET lang = ? WHERE id = ?", u.Language, u.Id); err != nil {
+		return err
+	}
+	return before.After(globalStorage, audit.Bot(u.ChatId))
 }
 
 func (u *User) GetUserById(globalStorage *sql.DB) error {
@@ -269,8 +276,16 @@ func (u *User) GetUserByChatId(globalStorage *sql.DB) error {
 	return nil
 }
 
+func (u *User) auditTarget() audit.Target {
+	t := audit.Target{Entity: audit.EntityUser, Id: u.Id.String()}
+	if !u.DriverId.IsNil() {
+		t.DriverId = u.DriverId.String()
+	}
+	return t
+}
+
 // StoreUser stores a new user in the database.
-func (u *User) StoreUser(db DBExecutor) error {
+func (u *User) StoreUser(db DBExecutor, by audit.Actor) error {
 	tx, ok := db.(*sql.Tx)
 	var txErr error
 
@@ -306,19 +321,22 @@ func (u *User) StoreUser(db DBExecutor) error {
 	}
 
 	u.Id = id
-	return nil
+	return audit.Created(db, by, u.auditTarget(), u.ChatId)
 }
 
 // SetSuperAdminRole sets the super_admin_role for a user.
 // Pass role=0 to set it to NULL.
 // Only works if the user is a super admin.
-func (u *User) SetSuperAdminRole(globalStorage *sql.DB, role SARole) error {
+func (u *User) SetSuperAdminRole(globalStorage *sql.DB, role SARole, by audit.Actor) error {
 	if !u.IsSuperAdmin {
 		errlog.ERR.Printf("ERR: user %v is not a super admin", u.Id)
 		return fmt.Errorf("ERR: user %v is not a super admin", u.Id)
 	}
 
-	var err error
+	before, err := audit.Before(globalStorage, u.auditTarget(), "super_admin_role")
+	if err != nil {
+		return err
+	}
 	if role == 0 {
 		_, err = globalStorage.Exec(
 			"UPDATE users SET super_admin_role = NULL WHERE id = ?",
@@ -336,12 +354,12 @@ func (u *User) SetSuperAdminRole(globalStorage *sql.DB, role SARole) error {
 	}
 
 	u.SuperAdminRole = role
-	return nil
+	return before.After(globalStorage, by)
 }
 
 // ToggleSuperAdminRole switches between SARoleManager ('m') and SARoleDriver ('d').
 // Only works if the user is a super admin and already has a role set.
-func (u *User) ToggleSuperAdminRole(globalStorage *sql.DB) error {
+func (u *User) ToggleSuperAdminRole(globalStorage *sql.DB, by audit.Actor) error {
 	if !u.IsSuperAdmin {
 		errlog.ERR.Printf("ERR: user %v is not a super admin", u.Id)
 		return fmt.Errorf("ERR: user %v is not a super admin", u.Id)
@@ -358,5 +376,47 @@ func (u *User) ToggleSuperAdminRole(globalStorage *sql.DB) error {
 		return fmt.Errorf("ERR: user has no super_admin_role set, use SetSuperAdminRole first")
 	}
 
-	return u.SetSuperAdminRole(globalStorage, newRole)
+	return u.SetSuperAdminRole(globalStorage, newRole, by)
+}
+
+// UpdateUserTimezone stores the IANA timezone the user wants to see the times in, empty resets it to Warsaw
+func UpdateUserTimezone(globalStorage *sql.DB, chatId int64, timezone string, by audit.Actor) error {
+	u := &User{ChatId: chatId}
+	if err := u.GetUserByChatId(globalStorage); err != nil {
+		errlog.ERR.Printf("ERR: getting user of chat %d to update the timezone: %v\n", chatId, err)
+		return fmt.Errorf("ERR: getting user of chat %d to update the timezone: %v", chatId, err)
+	}
+	before, err := audit.Before(globalStorage, u.auditTarget(), "timezone")
+	if err != nil {
+		return err
+	}
+
+	_, err = globalStorage.Exec("UPDATE users SET timezone = NULLIF(?, '') WHERE chat_id = ?", timezone, chatId)
+	if err != nil {
+		errlog.ERR.Printf("ERR: updating timezone of chat %d: %v\n", chatId, err)
+		return fmt.Errorf("ERR: updating timezone of chat %d: %v", chatId, err)
+	}
+	return before.After(globalStorage, by)
+}
+
+// GetUsersTimezones gives chat_id -> timezone of the users that chose one
+func GetUsersTimezones(globalStorage *sql.DB) (map[int64]string, error) {
+	rows, err := globalStorage.Query("SELECT chat_id, timezone FROM users WHERE COALESCE(timezone, '') != ''")
+	if err != nil {
+		errlog.ERR.Printf("ERR: querying users timezones: %v\n", err)
+		return nil, fmt.Errorf("ERR: querying users timezones: %v", err)
+	}
+	defer rows.Close()
+
+	timezones := make(map[int64]string)
+	for rows.Next() {
+		var chatId int64
+		var timezone string
+		if err = rows.Scan(&chatId, &timezone); err != nil {
+			return nil, fmt.Errorf("ERR: scanning user timezone: %v", err)
+		}
+		timezones[chatId] = timezone
+	}
+
+	return timezones, rows.Err()
 }
@@ -1,5 +1,12 @@
 package db
 
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+)
+
 func CheckManagersTable(db DBExecutor) error {
 	_, err := db.Exec(`
 	CREATE TABLE IF NOT EXISTS managers
@@ -12,7 +19,8 @@ func CheckManagersTable(db DBExecutor) error {
     	    constraint managers___fk
     	        references users (chat_id),
     	state      TEXT default 'dormant_mng' not null,
-    	check (state in ('dormant_mng', 'waiting_doc', 'waiting_notes', 'waiting_driver'))
+    	check (state in ('dormant_mng', 'waiting_doc', 'waiting_notes', 'waiting_driver', 'sending_driver_message',
+    	                 'replying_driver', 'giving_washing_stat', 'reviewing_doc'))
 	);
 	`)
 	return err
@@ -84,7 +92,14 @@ func CheckDriversSessionsTable(db DBExecutor) error {
 			FOREIGN KEY (driver_id) REFERENCES drivers(id)
 		)
 	`)
-	return err
+	if err != nil {
+		return err
+	}
+
+	return AddColumnsIfMissing(db, "drivers_sessions", [][2]string{
+		// the truck of the day, the sessions of a double manned truck share its kilometrage (see SplitTeamKilometrage)
+		{"car_id", "TEXT"},
+	})
 }
 
 func CheckFilesTable(db DBExecutor) error {
@@ -116,7 +131,15 @@ func CheckFilesTable(db DBExecutor) error {
 			))
 		)
 	`)
-	return err
+	if err != nil {
+		return err
+	}
+
+	return AddColumnsIfMissing(db, "files", [][2]string{
+		// who signed the proof of delivery in the Mini App and when, NULL for the other files
+		{"signed_by", "TEXT"},
+		{"signed_at", "DATETIME"},
+	})
 }
 
 func CheckFormStatesTable(db DBExecutor) error {
@@ -193,6 +216,85 @@ func CheckShipmentsTable(db DBExecutor) error {
 			CHECK (document_language IN ('fr', 'de', 'en', 'ua', 'pl'))
 		)
 	`)
+	if err != nil {
+		return err
+	}
+
+	return AddColumnsIfMissing(db, "shipments", [][2]string{
+		// parser.TaskOrder, which task the driver may start when
+		{"task_order", "TEXT DEFAULT 'load_before_unload'"},
+		// parser.ShipmentStatus, NULL for the shipments stored before (see parser.BackfillShipmentStatuses)
+		{"status", "TEXT"},
+	})
+}
+
+// CheckShipmentDriversTable is the co-drivers of the shipments of double manned trucks, the lead is shipments.driver_id
+func CheckShipmentDriversTable(db DBExecutor) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS shipment_drivers (
+			shipment_id INTEGER NOT NULL,
+			driver_id TEXT NOT NULL,
+			added_at DATETIME DEFAULT CURRENT_TIMESTAMP NOT NULL,
+			PRIMARY KEY (shipment_id, driver_id),
+			FOREIGN KEY (shipment_id) REFERENCES shipments(id),
+			FOREIGN KEY (driver_id) REFERENCES drivers(id)
+		)
+	`)
+	return err
+}
+
+// CheckAuditLogTable is the history of the writes of parser and db, see the audit package
+func CheckAuditLogTable(db DBExecutor) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS audit_log (
+			id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+			changed_at DATETIME DEFAULT CURRENT_TIMESTAMP NOT NULL,
+			changed_by INTEGER DEFAULT 0 NOT NULL,
+			source TEXT NOT NULL,
+			entity TEXT NOT NULL,
+			entity_id TEXT NOT NULL,
+			shipment_id INTEGER,
+			driver_id TEXT,
+			field TEXT NOT NULL,
+			old_value TEXT,
+			new_value TEXT
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	for _, idx := range []string{
+		`CREATE INDEX IF NOT EXISTS idx_audit_log_shipment ON audit_log(shipment_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_log_driver ON audit_log(driver_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_log_entity ON audit_log(entity, entity_id)`,
+	} {
+		if _, err = db.Exec(idx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckShipmentStatusHistoryTable is every status change of the shipments, from_status is empty for the first store
+func CheckShipmentStatusHistoryTable(db DBExecutor) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS shipment_status_history (
+			id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+			shipment_id INTEGER NOT NULL,
+			from_status TEXT,
+			to_status TEXT NOT NULL,
+			changed_by INTEGER,
+			changed_at DATETIME DEFAULT CURRENT_TIMESTAMP NOT NULL,
+			note TEXT,
+			FOREIGN KEY (shipment_id) REFERENCES shipments(id)
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_shipment_status_history_shipment ON shipment_status_history(shipment_id)`)
 	return err
 }
 
@@ -235,9 +337,229 @@ func CheckTasksTable(db DBExecutor) error {
 			CHECK (edit_status IN ('original', 'editing', 'done'))
 		)
 	`)
+	if err != nil {
+		return err
+	}
+
+	return AddColumnsIfMissing(db, "tasks", [][2]string{
+		{"original_address", "TEXT"},
+		// the weight, volume and temperature from the document as numbers, the text columns keep what was written
+		{"weight_value", "REAL"},
+		{"weight_unit", "TEXT"},
+		{"weight_limit", "TEXT"},
+		{"volume_value", "REAL"},
+		{"volume_unit", "TEXT"},
+		{"volume_limit", "TEXT"},
+		{"temperature_value", "REAL"},
+		{"temperature_unit", "TEXT"},
+		{"temperature_limit", "TEXT"},
+		// Address split up by parser.ParseAddress, NULL when it could not be
+		{"address_name", "TEXT"},
+		{"address_street", "TEXT"},
+		{"address_postcode", "TEXT"},
+		{"address_city", "TEXT"},
+		{"address_country", "TEXT"},
+		// IANA timezone of the site the windows were read in, NULL for the tasks stored before (see parser.BackfillWindowTimezones)
+		{"window_timezone", "TEXT"},
+		// place of the task in the shipment, 1 based. The document order, unless a manager reordered it
+		{"position", "INTEGER"},
+		// the driver that began the task and his truck, NULL while they are the shipment's (see parser.SetTaskPerformer)
+		{"driver_id", "TEXT"},
+		{"car_id", "TEXT"},
+		// how the task was finished against its window (see parser.TaskSection.EvaluatePunctuality), NULL until it is,
+		// and by how many minutes it was out of it, negative when early
+		{"punctuality", "TEXT"},
+		{"window_delay", "INTEGER"},
+		// when the managers were told the window is closing on the task that is not started, so they are told once
+		{"window_alerted_at", "DATETIME"},
+		// when the driver said he is on the site, the waiting and the demurrage are counted from it (see parser.TaskSection.Demurrage)
+		{"arrived", "DATETIME"},
+		// the "in order of" of the document, the customer the free time is matched against (see parser.BackfillTaskCompanies)
+		{"company", "TEXT"},
+	})
+}
+
+// CheckTaskCompartmentsTable is the compartments of the tasks of multi-compartment tanks, with what the document declares
+// for each of them and what the driver measured in it (see parser.TaskCompartment)
+func CheckTaskCompartmentsTable(db DBExecutor) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS task_compartments (
+			id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+			task_id INTEGER NOT NULL,
+			number INTEGER NOT NULL,
+			product TEXT,
+			weight TEXT,
+			volume TEXT,
+			temperature TEXT,
+			weight_value REAL,
+			weight_unit TEXT,
+			weight_limit TEXT,
+			volume_value REAL,
+			volume_unit TEXT,
+			volume_limit TEXT,
+			temperature_value REAL,
+			temperature_unit TEXT,
+			temperature_limit TEXT,
+			actual_weight INTEGER,
+			actual_temperature REAL,
+			created_at TEXT DEFAULT (datetime('now')),
+			updated_at TEXT DEFAULT (datetime('now')),
+			FOREIGN KEY (task_id) REFERENCES tasks(id) ON DELETE CASCADE,
+			UNIQUE (task_id, number)
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// the cascade needs foreign_keys on the connection that deletes, the trigger does not
+	_, err = db.Exec(`CREATE TRIGGER IF NOT EXISTS task_compartments_ad AFTER DELETE ON tasks BEGIN
+		DELETE FROM task_compartments WHERE task_id = old.id;
+	END`)
+	return err
+}
+
+func CheckTaskCleaningsTable(db DBExecutor) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS task_cleanings (
+			id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+			task_id INTEGER NOT NULL UNIQUE,
+			ecd_number TEXT,
+			cleaning_station_id INTEGER,
+			previous_product TEXT,
+			cleaning_type TEXT,
+			certificate_file_id INTEGER,
+			created_at TEXT DEFAULT (datetime('now')),
+			updated_at TEXT DEFAULT (datetime('now')),
+			FOREIGN KEY (task_id) REFERENCES tasks(id) ON DELETE CASCADE,
+			FOREIGN KEY (cleaning_station_id) REFERENCES cleaning_stations(id),
+			FOREIGN KEY (certificate_file_id) REFERENCES files(id)
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`CREATE TRIGGER IF NOT EXISTS task_cleanings_ad AFTER DELETE ON tasks BEGIN
+		DELETE FROM task_cleanings WHERE task_id = old.id;
+	END`)
 	return err
 }
 
+// searchIndexes are the fts5 tables of CheckSearchTables: the external content table they index, and its columns
+var searchIndexes = []struct {
+	table   string
+	columns []string
+}{
+	{"shipments", []string{"id", "container", "chassis", "tankdetails", "generalremark", "car_id"}},
+	{"tasks", []string{"customer_ref", "load_ref", "unload_ref", "product", "company", "address", "destination_address", "remark"}},
+}
+
+// CheckSearchTables is the full-text index of the shipments and the tasks (shipments_fts and tasks_fts, see parser.Search),
+// kept in sync by triggers. A new index is filled with what is already stored.
+// It needs the fts5 of sqlite, so the bot has to be built with the sqlite_fts5 tag. Built without it, the triggers of
+// an earlier build are dropped, every insert into the shipments and the tasks would fail on them. The index is
+// rebuilt when the triggers are made again
+func CheckSearchTables(db DBExecutor) error {
+	var fts5 bool
+	if err := db.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&fts5); err != nil {
+		return fmt.Errorf("ERR: checking if sqlite has fts5: %v", err)
+	}
+
+	for _, idx := range searchIndexes {
+		fts := idx.table + "_fts"
+
+		if !fts5 {
+			for _, trigger := range []string{"_ai", "_ad", "_au"} {
+				if _, err := db.Exec(`DROP TRIGGER IF EXISTS ` + fts + trigger); err != nil {
+					return fmt.Errorf("ERR: dropping the trigger %s%s: %v", fts, trigger, err)
+				}
+			}
+			continue
+		}
+
+		// without the insert trigger the index missed what was stored in the meantime
+		var exists int
+		err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE (type = 'table' AND name = ?) OR (type = 'trigger' AND name = ?)`,
+			fts, fts+"_ai").Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("ERR: checking if %s exists: %v", fts, err)
+		}
+
+		cols := strings.Join(idx.columns, ", ")
+		newCols := "new." + strings.Join(idx.columns, ", new.")
+		oldCols := "old." + strings.Join(idx.columns, ", old.")
+
+		stmts := []string{
+			fmt.Sprintf(`CREATE VIRTUAL TABLE IF NOT EXISTS %s USING fts5(%s, content='%s', content_rowid='id', tokenize='unicode61 remove_diacritics 2')`,
+				fts, cols, idx.table),
+			fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %[1]s_ai AFTER INSERT ON %[2]s BEGIN
+				INSERT INTO %[1]s(rowid, %[3]s) VALUES (new.id, %[4]s);
+			END`, fts, idx.table, cols, newCols),
+			fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %[1]s_ad AFTER DELETE ON %[2]s BEGIN
+				INSERT INTO %[1]s(%[1]s, rowid, %[3]s) VALUES ('delete', old.id, %[4]s);
+			END`, fts, idx.table, cols, oldCols),
+			fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %[1]s_au AFTER UPDATE OF %[3]s ON %[2]s BEGIN
+				INSERT INTO %[1]s(%[1]s, rowid, %[3]s) VALUES ('delete', old.id, %[4]s);
+				INSERT INTO %[1]s(rowid, %[3]s) VALUES (new.id, %[5]s);
+			END`, fts, idx.table, cols, oldCols, newCols),
+		}
+		if exists < 2 {
+			stmts = append(stmts, fmt.Sprintf(`INSERT INTO %[1]s(%[1]s) VALUES ('rebuild')`, fts))
+		}
+
+		for _, stmt := range stmts {
+			if _, err = db.Exec(stmt); err != nil {
+				return fmt.Errorf("ERR: creating the search index %s: %v", fts, err)
+			}
+		}
+	}
+
+	if !fts5 {
+		return fmt.Errorf("ERR: the sqlite of the bot has no fts5, the search index is not kept")
+	}
+	return nil
+}
+
+// AddColumnsIfMissing is the migration for the tables that already exist, CREATE TABLE IF NOT EXISTS does not touch them.
+// columns are {name, definition} and are added in the given order
+func AddColumnsIfMissing(db DBExecutor, table string, columns [][2]string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("ERR: reading the columns of %s: %v", table, err)
+	}
+
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, colType    string
+			defaultValue     sql.NullString
+		)
+		if err = rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			rows.Close()
+			return fmt.Errorf("ERR: scanning the columns of %s: %v", table, err)
+		}
+		existing[name] = true
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("ERR: reading the columns of %s: %v", table, err)
+	}
+
+	for _, column := range columns {
+		if existing[column[0]] {
+			continue
+		}
+		if _, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column[0], column[1])); err != nil {
+			return fmt.Errorf("ERR: adding %s to %s: %v", column[0], table, err)
+		}
+		log.Printf("added the column %s to %s\n", column[0], table)
+	}
+
+	return nil
+}
+
 func CheckTaskDocsTable(db DBExecutor) error {
 	_, err := db.Exec(`
 		CREATE TABLE IF NOT EXISTS task_docs (
@@ -270,5 +592,12 @@ func CheckUsersTable(db DBExecutor) error {
 			CHECK (is_super_admin IN (0, 1))
 		)
 	`)
-	return err
+	if err != nil {
+		return err
+	}
+
+	return AddColumnsIfMissing(db, "users", [][2]string{
+		// IANA timezone the user sees the times in, NULL is Warsaw
+		{"timezone", "TEXT"},
+	})
 }
@@ -7,6 +7,7 @@ import (
 	"logistictbot/db"
 	"logistictbot/errlog"
 	"logistictbot/parser"
+	"slices"
 	"strings"
 	"time"
 
@@ -41,8 +42,9 @@ const (
 )
 
 var (
-	DeleteQueue = make(chan DeleteQueueNode, 1000)
-	EditChannel = make(chan int, 1000) // task_id
+	DeleteQueue    = make(chan DeleteQueueNode, 1000)
+	EditChannel    = make(chan int, 1000) // task_id
+	ReleaseChannel = make(chan Release, 100)
 
 	TaskFinished     RequirementType = "task_finished"     // messages that are left after finishing task, that do not provide any further information
 	TaskEdited       RequirementType = "task_edited"       // works almost the same as does the finished task
@@ -90,7 +92,7 @@ func (n *DeleteQueueNode) CheckRequirements(globalStorage *sql.DB) {
 			return
 		}
 
-		if shipment.IsFinished() {
+		if shipment.IsClosed() {
 			n.Requirements.areMet = true
 			n.UpdateRequirements(globalStorage)
 			n.Scheduled = time.Now().Add(SCHEDULE_SURPLUS)
@@ -136,6 +138,33 @@ func EnqueueToDelete(globalStorage *sql.DB, chatId int64, messageId int, require
 	}
 }
 
+// Release is for the messages of a shipment that was cancelled or handed over to another driver:
+// their tasks will not be finished in that chat anymore, so what waits for them is deleted right away
+type Release struct {
+	ChatId     int64
+	ShipmentId int64
+	TaskIds    []int
+}
+
+// ReleaseShipment deletes the messages in chatId that wait for the shipment or one of the tasks to be finished
+func ReleaseShipment(chatId int64, shipmentId int64, taskIds []int) {
+	log.Println("RELEASED FROM DELETION REQUIREMENTS: ", chatId, shipmentId, taskIds)
+	ReleaseChannel <- Release{ChatId: chatId, ShipmentId: shipmentId, TaskIds: taskIds}
+}
+
+func (r Release) covers(n *DeleteQueueNode) bool {
+	if n.ChatID != r.ChatId {
+		return false
+	}
+	switch n.Requirements.Type {
+	case ShipmentFinished:
+		return n.Requirements.TrackedShipmentId == r.ShipmentId
+	case TaskFinished:
+		return slices.Contains(r.TaskIds, n.Requirements.TrackedTaskId)
+	}
+	return false
+}
+
 func DeleteWorker(globalStorage *sql.DB, bot *tgbotapi.BotAPI) {
 	var pending = make([]DeleteQueueNode, 1000)
 
@@ -154,6 +183,14 @@ func DeleteWorker(globalStorage *sql.DB, bot *tgbotapi.BotAPI) {
 		// 	DeleteQueue <- editDQNode
 		// 	continue
 		// }
+		case r := <-ReleaseChannel:
+			for i := range pending {
+				if !pending[i].Requirements.areMet && r.covers(&pending[i]) {
+					pending[i].Requirements.areMet = true
+					pending[i].UpdateRequirements(globalStorage)
+					pending[i].Scheduled = time.Now().Add(SCHEDULE_SURPLUS)
+				}
+			}
 		case dqNode := <-DeleteQueue:
 			if !dqNode.Requirements.areMet {
 				pending = append(pending, dqNode)
@@ -27,6 +27,9 @@ type File struct {
 	Filetype     Filetype  `db:"filetype"`
 	CreatedAt    time.Time `db:"created_at"`
 	DeletedAt    time.Time `db:"deleted_at"`
+	// the signature of the consignee, the name he wrote and when he signed. Empty for the other files
+	SignedBy string    `db:"signed_by"`
+	SignedAt time.Time `db:"signed_at"`
 }
 
 func (f *File) StoreFile(globalStorage *sql.DB) error {
@@ -41,9 +44,18 @@ func (f *File) StoreFile(globalStorage *sql.DB) error {
 		path,
 		filetype,
 		mimetype,
-		created_at
+		created_at,
+		signed_by,
+		signed_at
 	)
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	var signedBy sql.NullString
+	var signedAt sql.NullTime
+	if f.SignedBy != "" {
+		signedBy = sql.NullString{String: f.SignedBy, Valid: true}
+		signedAt = sql.NullTime{Time: f.SignedAt, Valid: true}
+	}
 
 	result, err := globalStorage.Exec(
 		query,
@@ -55,6 +67,8 @@ func (f *File) StoreFile(globalStorage *sql.DB) error {
 		string(f.Filetype),
 		string(f.Mimetype),
 		time.Now(),
+		signedBy,
+		signedAt,
 	)
 	if err != nil {
 		return fmt.Errorf("insert file: %v", err)
@@ -136,7 +150,9 @@ func GetFilesAttachedToTask(globalStorage *sql.DB, taskId int) ([]*File, error)
 			f.mimetype,
 			f.filetype,
 			f.created_at,
-			f.deleted_at
+			f.deleted_at,
+			f.signed_by,
+			f.signed_at
 		FROM files f
 		INNER JOIN task_docs td ON td.file_id = f.id
 		WHERE td.task_id = ?
@@ -159,6 +175,8 @@ func GetFilesAttachedToTask(globalStorage *sql.DB, taskId int) ([]*File, error)
 			deletedAtStr sql.NullString
 			mimetypeStr  string
 			filetypeStr  string
+			signedBy     sql.NullString
+			signedAt     sql.NullTime
 		)
 
 		err := rows.Scan(
@@ -172,6 +190,8 @@ func GetFilesAttachedToTask(globalStorage *sql.DB, taskId int) ([]*File, error)
 			&filetypeStr,
 			&createdAtStr,
 			&deletedAtStr,
+			&signedBy,
+			&signedAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("scan file: %v", err)
@@ -195,6 +215,9 @@ func GetFilesAttachedToTask(globalStorage *sql.DB, taskId int) ([]*File, error)
 			f.DeletedAt = t
 		}
 
+		f.SignedBy = signedBy.String
+		f.SignedAt = signedAt.Time
+
 		f.Filetype = Filetype(filetypeStr)
 		f.Mimetype = Mimetype(mimetypeStr)
 
@@ -208,6 +231,23 @@ func GetFilesAttachedToTask(globalStorage *sql.DB, taskId int) ([]*File, error)
 	return files, nil
 }
 
+// CountFilesAttachedToTask is how many pictures and how many other files (scans, pdfs, signatures) the task has, the deleted ones do not count
+func CountFilesAttachedToTask(globalStorage *sql.DB, taskId int) (documents, pictures int, err error) {
+	query := `
+		SELECT
+			COALESCE(SUM(CASE WHEN f.filetype = 'image' AND f.signed_by IS NULL THEN 0 ELSE 1 END), 0),
+			COALESCE(SUM(CASE WHEN f.filetype = 'image' AND f.signed_by IS NULL THEN 1 ELSE 0 END), 0)
+		FROM files f
+		INNER JOIN task_docs td ON td.file_id = f.id
+		WHERE td.task_id = ?
+		  AND f.deleted_at IS NULL
+	`
+	if err = globalStorage.QueryRow(query, taskId).Scan(&documents, &pictures); err != nil {
+		return 0, 0, fmt.Errorf("count files attached to task %d: %v", taskId, err)
+	}
+	return documents, pictures, nil
+}
+
 func (f *File) AttachFileToTask(globalStorage *sql.DB, taskId int) error {
 	query := `INSERT INTO task_docs
 	(file_id, task_id)
@@ -1,5 +1,10 @@
 package docs
 
+import (
+	"path/filepath"
+	"strings"
+)
+
 type Mimetype string
 type Filetype string
 
@@ -64,6 +69,18 @@ const (
 	MimeAppApk         Mimetype = "application/vnd.android.package-archive"
 )
 
+// MimetypeByName fixes the mimetype of the spreadsheets by the extension, telegram sends csv as text/comma-separated-values
+// or octet-stream depending on the client
+func MimetypeByName(fileName string, sent Mimetype) Mimetype {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".csv":
+		return MimeTextCSV
+	case ".xlsx":
+		return MimeAppXlsx
+	}
+	return sent
+}
+
 func GetFileCategory(mimeType Mimetype) Filetype {
 	switch mimeType {
 	case MimeImageJPEG, MimeImagePNG, MimeImageGIF, MimeImageWebP,
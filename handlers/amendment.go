@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"logistictbot/config"
+	"logistictbot/db"
+	"logistictbot/errlog"
+	"logistictbot/parser"
+	"strings"
+	"unicode/utf8"
+
+	tgbotapi "github.com/appleofeden110/telegram-bot-api/v5"
+)
+
+// formatAmendment lists what the new version of the document changes, the same for the manager and the driver's group.
+// The changed fields that do not fit into limit characters are only counted
+func formatAmendment(result *parser.ReparseResult, lang config.LangCode, limit int) string {
+	var tasks strings.Builder
+	if len(result.NewTasks) > 0 {
+		tasks.WriteString(config.Translate(lang, "amendment:added", strings.ToUpper(strings.Join(result.NewTasks, ", "))))
+	}
+	if len(result.MissingTasks) > 0 {
+		tasks.WriteString(config.Translate(lang, "amendment:removed", strings.ToUpper(strings.Join(result.MissingTasks, ", "))))
+	}
+	if len(result.KeptTasks) > 0 {
+		tasks.WriteString(config.Translate(lang, "amendment:kept", strings.ToUpper(strings.Join(result.KeptTasks, ", "))))
+	}
+
+	lines := make([]string, 0, len(result.Diffs))
+	for _, d := range result.Diffs {
+		lines = append(lines, fmt.Sprintf("• <b>%s</b>: <s>%s</s> → <code>%s</code>\n",
+			html.EscapeString(reparseFieldTitle(d)), shortReparseValue(d.Stored), shortReparseValue(d.Parsed)))
+	}
+	return fitLines(lines, limit-utf8.RuneCountInString(tasks.String()), lang, "review:more") + tasks.String()
+}
+
+// SendAmendmentReview shows the manager what the resent document changes in the stored shipment, nothing is changed until it is confirmed
+func SendAmendmentReview(chatId int64, topicId int, pm *db.PendingMessage) error {
+	if pm == nil || pm.Shipment == nil || pm.Amendment == nil {
+		return fmt.Errorf("ERR: nothing to review, the document is not an amendment")
+	}
+
+	lang := config.GetLang(chatId)
+	text := config.Translate(lang, "amendment:header", pm.Shipment.Id)
+	if !pm.Amendment.HasChanges() {
+		text += config.Translate(lang, "amendment:no_changes")
+	} else {
+		text += formatAmendment(pm.Amendment, lang, messageLimit-utf8.RuneCountInString(text))
+	}
+
+	msg := tgbotapi.NewMessage(chatId, text, topicId)
+	msg.ParseMode = tgbotapi.ModeHTML
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(config.Translate(lang, "btn:amend_accept"), "manager:amend_accept"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(config.Translate(lang, "btn:review_reject"), "manager:review_reject"),
+		),
+	)
+
+	_, err := Bot.Send(msg)
+	return err
+}
+
+// refuseClosedAmendment tells the manager that the shipment of the resent document is finished, invoiced or cancelled
+// and can not be changed by it anymore, the manager is done with the document
+func refuseClosedAmendment(manager *db.Manager, chatId int64, topicId int, shipmentId int64, globalStorage *sql.DB) error {
+	manager.State = db.StateDormantManager
+	manager.PendingMessage = nil
+	if err := manager.ChangeManagerStatus(globalStorage); err != nil {
+		return err
+	}
+
+	lang := config.GetLang(chatId)
+	shipment, err := parser.GetShipment(globalStorage, shipmentId)
+	if err != nil {
+		return err
+	}
+	msg := tgbotapi.NewMessage(chatId, config.Translate(lang, "amendment:closed", shipmentId, shipment.Status.Title(lang)), topicId)
+	msg.ParseMode = tgbotapi.ModeHTML
+	_, err = Bot.Send(msg)
+	return err
+}
+
+// notifyAmendment tells the driver's group what changed and refreshes the task the driver is doing right now
+func notifyAmendment(shipmentId int64, result *parser.ReparseResult, fileId string, globalStorage *sql.DB) error {
+	shipment, err := parser.GetShipment(globalStorage, shipmentId)
+	if err != nil {
+		errlog.ERR.Printf("ERR: getting amended shipment %d: %v\n", shipmentId, err)
+		return fmt.Errorf("ERR: getting amended shipment %d: %v\n", shipmentId, err)
+	}
+
+	driverSessionsMu.Lock()
+	taskSessionsMu.Lock()
+	for _, d := range driverSessions {
+		if !shipment.HasDriver(d.Id) || d.PerformedTaskId == 0 {
+			continue
+		}
+		task, err := parser.GetTaskById(globalStorage, d.PerformedTaskId)
+		if err != nil {
+			errlog.ERR.Printf("ERR: reloading the task driver %s performs after the amendment: %v\n", d.User.Name, err)
+			continue
+		}
+		taskSessions[d.Id] = task
+	}
+	taskSessionsMu.Unlock()
+	driverSessionsMu.Unlock()
+
+	car, err := db.GetCarById(globalStorage, shipment.CarId)
+	if err != nil {
+		errlog.ERR.Printf("ERR: getting car %s of the amended shipment: %v\n", shipment.CarId, err)
+		return fmt.Errorf("ERR: getting car %s of the amended shipment: %v\n", shipment.CarId, err)
+	}
+	g := &db.DriverGroup{CurrentCar: car}
+	if err = g.GetDriverGroupByCar(globalStorage); err != nil {
+		errlog.ERR.Printf("ERR: getting driver group of the amended shipment: %v\n", err)
+		return fmt.Errorf("ERR: getting driver group of the amended shipment: %v\n", err)
+	}
+
+	lang := config.GetLang(g.GroupChatId)
+	docMsg := tgbotapi.NewDocument(g.GroupChatId, tgbotapi.FileID(fileId), g.LoadingTopicId)
+	// the caption only has room for a few of the changes, the document itself has the rest
+	notice := config.Translate(lang, "amendment:driver_notice", shipmentId)
+	docMsg.Caption = notice + formatAmendment(result, lang, captionLimit-utf8.RuneCountInString(notice))
+	docMsg.ParseMode = tgbotapi.ModeHTML
+	docMsg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(config.Translate(lang, "btn:readdoc"), fmt.Sprintf("readdoc:%d", result.DocId)),
+		),
+	)
+
+	_, err = Bot.Send(docMsg)
+	return err
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"log"
+	"logistictbot/audit"
 	"logistictbot/db"
 	"logistictbot/errlog"
 	"logistictbot/parser"
@@ -79,7 +80,7 @@ func RequestUpdateShipment(w http.ResponseWriter, r *http.Request, u *db.User, g
 		return
 	}
 
-	updated, err := parser.UpdateShipment(globalStorage, shipmentId, payload)
+	updated, err := parser.UpdateShipment(globalStorage, shipmentId, payload, audit.API(u.ChatId))
 	if err != nil {
 		errlog.ERR.Printf("update shipment %d: %v\n", shipmentId, err)
 		http.Error(w, "internal error", http.StatusInternalServerError)
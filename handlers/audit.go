@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"html"
+	"logistictbot/audit"
+	"logistictbot/config"
+	"logistictbot/db"
+	"logistictbot/errlog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	tgbotapi "github.com/appleofeden110/telegram-bot-api/v5"
+	"github.com/gofrs/uuid"
+)
+
+// auditValueLen cuts the long values (remarks, addresses) so the message stays readable
+const auditValueLen = 60
+
+func auditValue(v string) string {
+	if v == "" {
+		return "—"
+	}
+	r := []rune(v)
+	if len(r) > auditValueLen {
+		v = string(r[:auditValueLen]) + "…"
+	}
+	return html.EscapeString(v)
+}
+
+// auditText is the last changes of the entries, with who made them and from where. Only as many of the last ones as fit
+// in one message are shown, the whole history is in the API
+func auditText(chatId int64, header string, entries []*audit.Entry, globalStorage *sql.DB) string {
+	lang := config.GetLang(chatId)
+	loc := config.GetLoc(chatId)
+
+	if len(entries) == 0 {
+		return header + config.Translate(lang, "audit:empty")
+	}
+
+	names := make(map[int64]string)
+	limit := messageLimit - utf8.RuneCountInString(header) - utf8.RuneCountInString(config.Translate(lang, "audit:only_last", len(entries), len(entries)))
+	lines := make([]string, 0)
+	size := 0
+	for i := len(entries) - 1; i >= 0; i-- {
+		line := auditLine(lang, loc, entries[i], names, globalStorage)
+		if size += utf8.RuneCountInString(line); size > limit {
+			break
+		}
+		lines = append(lines, line)
+	}
+	slices.Reverse(lines)
+
+	text := header
+	if len(lines) < len(entries) {
+		text += config.Translate(lang, "audit:only_last", len(lines), len(entries))
+	}
+	return text + strings.Join(lines, "")
+}
+
+// auditLine is one change, names keeps the names of who made the changes so every user is only looked up once
+func auditLine(lang config.LangCode, loc *time.Location, e *audit.Entry, names map[int64]string, globalStorage *sql.DB) string {
+	by, ok := names[e.ChangedBy]
+	if !ok {
+		by = config.Translate(lang, "status:by_bot")
+		if e.ChangedBy != 0 {
+			u := &db.User{ChatId: e.ChangedBy}
+			if err := u.GetUserByChatId(globalStorage); err == nil {
+				by = u.Name
+			} else {
+				by = strconv.FormatInt(e.ChangedBy, 10)
+			}
+		}
+		names[e.ChangedBy] = by
+	}
+
+	changedAt := e.ChangedAt.In(loc).Format("02.01.2006 15:04")
+	entity := config.Translate(lang, "audit:entity:"+string(e.Entity), html.EscapeString(e.EntityId))
+	switch e.Field {
+	case audit.FieldCreated:
+		return config.Translate(lang, "audit:created", changedAt, entity, auditValue(e.New), html.EscapeString(by), e.Source)
+	case audit.FieldDeleted:
+		return config.Translate(lang, "audit:deleted", changedAt, entity, auditValue(e.Old), html.EscapeString(by), e.Source)
+	default:
+		return config.Translate(lang, "audit:line", changedAt, entity, html.EscapeString(e.Field), auditValue(e.Old), auditValue(e.New), html.EscapeString(by), e.Source)
+	}
+}
+
+// SendShipmentAudit shows the last changes of the shipment and its tasks
+func SendShipmentAudit(chatId int64, topicId int, shipmentId int64, globalStorage *sql.DB) error {
+	entries, err := audit.ForShipment(globalStorage, shipmentId)
+	if err != nil {
+		errlog.ERR.Printf("ERR: getting the audit log of shipment %d: %v\n", shipmentId, err)
+		return fmt.Errorf("ERR: getting the audit log of shipment %d: %v\n", shipmentId, err)
+	}
+
+	header := config.Translate(config.GetLang(chatId), "audit:shipment_header", shipmentId)
+	msg := tgbotapi.NewMessage(chatId, auditText(chatId, header, entries, globalStorage), topicId)
+	msg.ParseMode = tgbotapi.ModeHTML
+	_, err = Bot.Send(msg)
+	return err
+}
+
+// SendDriverAudit shows the last changes of what belongs to the driver and of what he changed himself
+func SendDriverAudit(chatId int64, topicId int, driverChatId int64, globalStorage *sql.DB) error {
+	driver, err := db.GetDriverByChatId(globalStorage, driverChatId)
+	if err != nil {
+		errlog.ERR.Printf("ERR: getting driver of chat %d for the audit log: %v\n", driverChatId, err)
+		return fmt.Errorf("ERR: getting driver of chat %d for the audit log: %v\n", driverChatId, err)
+	}
+
+	entries, err := audit.ForDriver(globalStorage, driver.Id.String(), driver.ChatId)
+	if err != nil {
+		errlog.ERR.Printf("ERR: getting the audit log of driver %s: %v\n", driver.Id, err)
+		return fmt.Errorf("ERR: getting the audit log of driver %s: %v\n", driver.Id, err)
+	}
+
+	header := config.Translate(config.GetLang(chatId), "audit:driver_header", html.EscapeString(driver.User.Name))
+	msg := tgbotapi.NewMessage(chatId, auditText(chatId, header, entries, globalStorage), topicId)
+	msg.ParseMode = tgbotapi.ModeHTML
+	_, err = Bot.Send(msg)
+	return err
+}
+
+// RequestShipmentAudit gives the whole history of the changes of the shipment and its tasks
+func RequestShipmentAudit(w http.ResponseWriter, r *http.Request, u *db.User, globalStorage *sql.DB) {
+	shipment, ok := shipmentForStatus(w, r, u, globalStorage)
+	if !ok {
+		return
+	}
+
+	entries, err := audit.ForShipment(globalStorage, shipment.Id)
+	if err != nil {
+		errlog.ERR.Printf("audit log of shipment %d: %v\n", shipment.Id, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// RequestDriverAudit gives the whole history of the changes of the driver, only for managers
+func RequestDriverAudit(w http.ResponseWriter, r *http.Request, u *db.User, globalStorage *sql.DB) {
+	driverId, err := uuid.FromString(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid driver id", http.StatusBadRequest)
+		return
+	}
+
+	if ok, err := u.IsManager(globalStorage); err != nil || !ok {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	driver, err := db.GetDriverById(globalStorage, driverId)
+	if err != nil {
+		errlog.INFO.Printf("get driver %s: %v\n", driverId, err)
+		http.Error(w, "driver not found", http.StatusNotFound)
+		return
+	}
+
+	entries, err := audit.ForDriver(globalStorage, driver.Id.String(), driver.ChatId)
+	if err != nil {
+		errlog.ERR.Printf("audit log of driver %s: %v\n", driver.Id, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
@@ -2,8 +2,10 @@ package handlers
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"logistictbot/audit"
 	"logistictbot/config"
 	data_analysis "logistictbot/data-analysis"
 	"logistictbot/db"
@@ -59,6 +61,19 @@ func HandleCallbackQuery(cbq *tgbotapi.CallbackQuery, globalStorage *sql.DB) err
 		config.SetChatLang(cbq.Message.Chat.ID, config.LangCode(a))
 		Bot.Send(tgbotapi.NewMessage(cbq.Message.Chat.ID, config.Translate(config.LangCode(a), "lang_set"), topicId))
 		return HandleCommand(cbq.Message.Chat.ID, cbq.From, "/start", globalStorage, a, topicId)
+	case strings.HasPrefix(cbq.Data, "set_tz:"):
+		a, _ := strings.CutPrefix(cbq.Data, "set_tz:")
+		loc, err := time.LoadLocation(a)
+		if err != nil {
+			errlog.ERR.Printf("ERR: loading timezone %s: %v", a, err)
+			return fmt.Errorf("ERR: loading timezone %s: %v", a, err)
+		}
+		if err = db.UpdateUserTimezone(globalStorage, cbq.Message.Chat.ID, loc.String(), audit.Bot(cbq.From.ID)); err != nil {
+			return err
+		}
+		config.SetChatLoc(cbq.Message.Chat.ID, loc)
+		_, err = Bot.Send(tgbotapi.NewMessage(cbq.Message.Chat.ID, config.Translate(config.GetLang(cbq.Message.Chat.ID), "timezone_set", loc.String()), topicId))
+		return err
 	case strings.HasPrefix(cbq.Data, "mrefuel:"):
 		after, _ := strings.CutPrefix(cbq.Data, "mrefuel:")
 
@@ -146,6 +161,18 @@ func HandleCallbackQuery(cbq *tgbotapi.CallbackQuery, globalStorage *sql.DB) err
 			return fmt.Errorf("ERR: parsing shipment id (og str: %s) was not successful: %v\n", shipmentIdString, err)
 		}
 		return HandleShipmentDetails(cbq.Message.Chat.ID, shipmentId, topicId, globalStorage)
+	case strings.HasPrefix(cbq.Data, "shipment:routesheet:"):
+		shipmentIdString, _ := strings.CutPrefix(cbq.Data, "shipment:routesheet:")
+		shipmentId, err := strconv.ParseInt(shipmentIdString, 10, 64)
+		if err != nil {
+			errlog.ERR.Printf("ERR: parsing shipment id (og str: %s) was not successful: %v\n", shipmentIdString, err)
+			return fmt.Errorf("ERR: parsing shipment id (og str: %s) was not successful: %v\n", shipmentIdString, err)
+		}
+		if err = SendRouteSheet(shipmentId, globalStorage); err != nil {
+			return err
+		}
+		_, err = Bot.Send(tgbotapi.NewMessage(cbq.Message.Chat.ID, config.Translate(config.GetLang(cbq.Message.Chat.ID), "routesheet:sent", shipmentId), topicId))
+		return err
 	case strings.HasPrefix(cbq.Data, "startform:"):
 		after, found := strings.CutPrefix(cbq.Data, "startform:")
 		var whichTable db.TableType
@@ -219,7 +246,7 @@ func HandleCallbackQuery(cbq *tgbotapi.CallbackQuery, globalStorage *sql.DB) err
 			return fmt.Errorf("ERR: getting shipment by id: %v\n", err)
 		}
 
-		if shipment.DriverId != driver.Id {
+		if !shipment.HasDriver(driver.Id) {
 			errlog.INFO.Printf("The driver %s just tried to access %s's order", driver.User.Name, shipment.DriverName)
 			_, err = Bot.Send(tgbotapi.NewMessage(cbq.Message.Chat.ID, config.Translate(config.GetLang(cbq.Message.Chat.ID), "shipment_does_not_belong_to_you"), loadingTopicId))
 			if err != nil {
@@ -227,17 +254,20 @@ func HandleCallbackQuery(cbq *tgbotapi.CallbackQuery, globalStorage *sql.DB) err
 			}
 		}
 
-		if !shipment.Started.IsZero() {
+		if shipment.Status == parser.StatusCancelled {
+			_, err = Bot.Send(tgbotapi.NewMessage(cbq.Message.Chat.ID, config.Translate(config.GetLang(cbq.Message.Chat.ID), "status:shipment_cancelled", shipment.Id), loadingTopicId))
+			return err
+		}
+
+		if !shipment.Status.CanTransition(parser.StatusAccepted) {
 			_, err = Bot.Send(tgbotapi.NewMessage(cbq.Message.Chat.ID, config.Translate(config.GetLang(cbq.Message.Chat.ID), "shipment_already_started"), loadingTopicId))
 			return err
 		}
 
-		if shipment.Started.IsZero() {
-			err = shipment.StartShipment(globalStorage)
-			if err != nil {
-				errlog.ERR.Printf("ERR: starting shipment: %v\n", err)
-				return fmt.Errorf("ERR: starting shipment: %v\n", err)
-			}
+		err = shipment.StartShipment(globalStorage, audit.Bot(cbq.From.ID))
+		if err != nil {
+			errlog.ERR.Printf("ERR: starting shipment: %v\n", err)
+			return fmt.Errorf("ERR: starting shipment: %v\n", err)
 		}
 
 		shipment.Tasks, err = parser.GetAllTasksByShipmentId(globalStorage, shipmentId)
@@ -254,10 +284,11 @@ func HandleCallbackQuery(cbq *tgbotapi.CallbackQuery, globalStorage *sql.DB) err
 		markup := make([][]tgbotapi.InlineKeyboardButton, 0)
 		markup = append(markup, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(config.Translate(config.GetLang(cbq.Message.Chat.ID), "btn:end_shipment"), "shipment:end:"+shipmentIdString)))
 
+		lang := config.GetLang(cbq.Message.Chat.ID)
 		for _, task := range shipment.Tasks {
-			msg.Text += config.Translate(config.GetLang(cbq.Message.Chat.ID), "shipment:task_header", task.Type)
-			msg.Text += parser.ReadTaskShort(task)
-			markup = append(markup, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(config.Translate(config.GetLang(cbq.Message.Chat.ID), "btn:start_task")+task.Type, "driver:begintask:"+strconv.Itoa(task.Id))))
+			msg.Text += config.Translate(lang, "shipment:task_header", parser.TaskTypeTitle(lang, task.Type))
+			msg.Text += parser.ReadTaskShort(task, lang, config.GetLoc(cbq.Message.Chat.ID))
+			markup = append(markup, taskStartRow(lang, task))
 		}
 		msg.ParseMode = tgbotapi.ModeHTML
 		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(markup...)
@@ -290,17 +321,22 @@ func HandleCallbackQuery(cbq *tgbotapi.CallbackQuery, globalStorage *sql.DB) err
 		}
 		log.Println(shipment.Started)
 
-		if shipment.Started.IsZero() {
-			_, err = Bot.Send(tgbotapi.NewMessage(cbq.Message.Chat.ID, config.Translate(config.GetLang(cbq.Message.Chat.ID), "shipment_has_not_started"), loadingTopicId))
+		if shipment.Status == parser.StatusCancelled {
+			_, err = Bot.Send(tgbotapi.NewMessage(cbq.Message.Chat.ID, config.Translate(config.GetLang(cbq.Message.Chat.ID), "status:shipment_cancelled", shipment.Id), loadingTopicId))
 			return err
 		}
 
-		if !shipment.Finished.IsZero() {
+		if shipment.IsFinished() {
 			_, err = Bot.Send(tgbotapi.NewMessage(cbq.Message.Chat.ID, config.Translate(config.GetLang(cbq.Message.Chat.ID), "shipment_already_ended"), loadingTopicId))
 			return err
 		}
 
-		err = shipment.FinishShipment(globalStorage)
+		if !shipment.Status.CanTransition(parser.StatusFinished) {
+			_, err = Bot.Send(tgbotapi.NewMessage(cbq.Message.Chat.ID, config.Translate(config.GetLang(cbq.Message.Chat.ID), "shipment_has_not_started"), loadingTopicId))
+			return err
+		}
+
+		err = shipment.FinishShipment(globalStorage, audit.Bot(cbq.From.ID))
 		if err != nil {
 			errlog.ERR.Printf("ERR: starting shipment: %v\n", err)
 			return fmt.Errorf("ERR: starting shipment: %v\n", err)
@@ -323,15 +359,16 @@ func HandleCallbackQuery(cbq *tgbotapi.CallbackQuery, globalStorage *sql.DB) err
 			errlog.ERR.Printf("ERR: getting shipment by id: %v\n", err)
 			return fmt.Errorf("ERR: getting shipment by id: %v\n", err)
 		}
-		if shipment.Finished.IsZero() {
+		if !shipment.IsFinished() {
 			_, err = Bot.Send(tgbotapi.NewMessage(cbq.Message.Chat.ID, config.Translate(config.GetLang(cbq.Message.Chat.ID), "shipment_has_not_ended"), loadingTopicId))
 			return err
 		}
-		if time.Since(shipment.Finished) > 10*time.Minute {
+		// an invoiced shipment can not be driven anymore
+		if time.Since(shipment.Finished) > 10*time.Minute || !shipment.Status.CanTransition(parser.StatusInProgress) {
 			_, err = Bot.Send(tgbotapi.NewMessage(cbq.Message.Chat.ID, config.Translate(config.GetLang(cbq.Message.Chat.ID), "cannot_get_shipment_back"), loadingTopicId))
 			return err
 		}
-		err = shipment.UnfinishShipment(globalStorage)
+		err = shipment.UnfinishShipment(globalStorage, audit.Bot(cbq.From.ID))
 		if err != nil {
 			errlog.ERR.Printf("ERR: unfinishing shipment: %v\n", err)
 			return fmt.Errorf("ERR: unfinishing shipment: %v\n", err)
@@ -485,32 +522,26 @@ func HandleCallbackQuery(cbq *tgbotapi.CallbackQuery, globalStorage *sql.DB) err
 			// somehow store pending messages?
 			pm.ToChatId = driverChatId
 
-			if err := pm.SendDocToDriver(globalStorage, Bot); err != nil {
-				if strings.Contains(err.Error(), "UNIQUE constraint failed") {
-					log.Printf("From %d to %d doc unique error: %v\n", pm.FromChatId, pm.ToChatId, err)
-					session.State = db.StateDormantManager
-
-					err = session.ChangeManagerStatus(globalStorage)
-					if err != nil {
-						errlog.ERR.Printf("ERR: changing status from waiting driver to dormant_mng: %v\n", err)
-						return fmt.Errorf("ERR: changing status from waiting driver to dormant_mng: %v\n", err)
+			// nothing is stored before the manager looks at what the parser found, it is usually parsed already when the doc came
+			if pm.Shipment == nil {
+				if err := pm.ParseDoc(globalStorage); err != nil {
+					if errors.Is(err, parser.ErrShipmentClosed) {
+						return refuseClosedAmendment(session, cbq.Message.Chat.ID, topicId, pm.Shipment.Id, globalStorage)
 					}
-					return nil
+					errlog.ERR.Printf("ERR: parsing document for review: %v\n", err)
+					return fmt.Errorf("ERR: parsing document for review: %v\n", err)
 				}
-				errlog.ERR.Printf("ERR: sending document: %v\n", err)
-				return fmt.Errorf("ERR: sending document: %v\n", err)
 			}
 
-			session.State = db.StateDormantManager
+			session.State = db.StateReviewingDoc
 
 			err = session.ChangeManagerStatus(globalStorage)
 			if err != nil {
-				errlog.ERR.Printf("ERR: changing status from waiting driver to dormant_mng: %v\n", err)
-				return fmt.Errorf("ERR: changing status from waiting driver to dormant_mng: %v\n", err)
+				errlog.ERR.Printf("ERR: changing status from waiting driver to reviewing_doc: %v\n", err)
+				return fmt.Errorf("ERR: changing status from waiting driver to reviewing_doc: %v\n", err)
 			}
-			/*msg := tgbotapi.NewMessage(cbq.Message.Chat.ID, config.Translate(config.GetLang(cbq.Message.Chat.ID), "manager:shipment_sent"))
-			_, err = Bot.Send(msg)*/
-			return err
+
+			return SendParseReview(cbq.Message.Chat.ID, topicId, pm)
 		}
 	case strings.HasPrefix(cbq.Data, "video:"):
 		videoData, f := strings.CutPrefix(cbq.Data, "video:")
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"logistictbot/audit"
 	"logistictbot/config"
 	"logistictbot/db"
 	"logistictbot/parser"
@@ -63,31 +64,31 @@ func TestCanAcceptShipment(t *testing.T) {
 	wrongDriver.Id = okShipment.Id + 1
 	wrongDriver.DriverId = uuid.FromStringOrNil(jumbleUUID(wrongDriver.DriverId.String()))
 
-	err = wrongDriver.StoreShipment(globalStorage)
+	err = wrongDriver.StoreShipment(globalStorage, audit.System)
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer wrongDriver.DeleteShipment(globalStorage)
+	defer wrongDriver.DeleteShipment(globalStorage, audit.System)
 
 	alreadyStarted := shipment
 	alreadyStarted.Id = okShipment.Id + 2
 	alreadyStarted.Started = time.Now().Add(time.Minute)
 
-	err = alreadyStarted.StoreShipment(globalStorage)
+	err = alreadyStarted.StoreShipment(globalStorage, audit.System)
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer alreadyStarted.DeleteShipment(globalStorage)
+	defer alreadyStarted.DeleteShipment(globalStorage, audit.System)
 
 	tasksAreEmpty := shipment
 	tasksAreEmpty.Id = okShipment.Id + 3
 	tasksAreEmpty.Tasks = make([]*parser.TaskSection, 0)
 
-	err = tasksAreEmpty.StoreShipment(globalStorage)
+	err = tasksAreEmpty.StoreShipment(globalStorage, audit.System)
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer tasksAreEmpty.DeleteShipment(globalStorage)
+	defer tasksAreEmpty.DeleteShipment(globalStorage, audit.System)
 
 	tests := []struct {
 		name     string
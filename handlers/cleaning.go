@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"logistictbot/audit"
+	"logistictbot/config"
+	"logistictbot/db"
+	"logistictbot/delq"
+	"logistictbot/docs"
+	"logistictbot/errlog"
+	"logistictbot/parser"
+	"strings"
+
+	tgbotapi "github.com/appleofeden110/telegram-bot-api/v5"
+)
+
+var errNoCertificate = errors.New("the message has no photo or document of the certificate")
+
+// askCleaning puts the driver in the state of the next thing of the ECD and asks him for it
+func askCleaning(driver *db.Driver, chatId int64, topicId int, taskId int, state db.DriverConversationState, key string, globalStorage *sql.DB) error {
+	driver.State = state
+	if err := driver.ChangeDriverStatus(globalStorage); err != nil {
+		return err
+	}
+
+	msg := tgbotapi.NewMessage(chatId, config.Translate(config.GetLang(chatId), key), topicId)
+	msg.ParseMode = tgbotapi.ModeHTML
+	sent, err := Bot.Send(msg)
+	delq.EnqueueToDelete(globalStorage, sent.Chat.ID, sent.MessageID, delq.Requirements{
+		Type:          delq.TaskFinished,
+		TrackedTaskId: taskId,
+	})
+	return err
+}
+
+// HandleCleaningInput takes what the driver answers about the European Cleaning Document of the cleaning task he ends:
+// its number, the previous product, the type of the cleaning and then the photo of it, after which the task is summed up
+func HandleCleaningInput(driver *db.Driver, msg *tgbotapi.Message, topicId int, globalStorage *sql.DB) (*db.Driver, error) {
+	taskSessionsMu.Lock()
+	task, exists := taskSessions[driver.Id]
+	taskSessionsMu.Unlock()
+	if !exists {
+		return driver, fmt.Errorf("ERR: getting the cleaning task of driver %s for the ECD\n", driver.Id.String())
+	}
+
+	by := audit.Bot(driver.ChatId)
+	text := strings.TrimSpace(msg.Text)
+
+	if driver.State == db.StateWaitingCertificate {
+		fileId, err := saveCertificateToTask(msg, task.Id, globalStorage)
+		if errors.Is(err, errNoCertificate) {
+			return driver, askCleaning(driver, msg.Chat.ID, topicId, task.Id, db.StateWaitingCertificate, "driver:ecd_certificate", globalStorage)
+		}
+		if err != nil {
+			return driver, err
+		}
+		if err = task.UpdateCleaningCertificate(globalStorage, fileId, by); err != nil {
+			return driver, err
+		}
+		// the photo stays in the chat for the managers, the rest of the questions go with the task
+		return driver, HandleDriverCommands(msg.Chat.ID, driver.ChatId, "driver:sumtask", msg.MessageID, globalStorage)
+	}
+
+	if text == "" {
+		return driver, nil
+	}
+	delq.EnqueueToDelete(globalStorage, msg.Chat.ID, msg.MessageID, delq.Requirements{
+		Type:          delq.TaskFinished,
+		TrackedTaskId: task.Id,
+	})
+
+	var err error
+	switch driver.State {
+	case db.StateWaitingEcd:
+		if err = task.UpdateEcdNumber(globalStorage, text, by); err != nil {
+			return driver, err
+		}
+		err = askCleaning(driver, msg.Chat.ID, topicId, task.Id, db.StateWaitingPrevProduct, "driver:ecd_previous_product", globalStorage)
+	case db.StateWaitingPrevProduct:
+		if err = task.UpdatePreviousProduct(globalStorage, strings.ToUpper(text), by); err != nil {
+			return driver, err
+		}
+		err = askCleaning(driver, msg.Chat.ID, topicId, task.Id, db.StateWaitingCleaningType, "driver:ecd_cleaning_type", globalStorage)
+	case db.StateWaitingCleaningType:
+		if err = task.UpdateCleaningType(globalStorage, text, by); err != nil {
+			return driver, err
+		}
+		err = askCleaning(driver, msg.Chat.ID, topicId, task.Id, db.StateWaitingCertificate, "driver:ecd_certificate", globalStorage)
+	}
+	return driver, err
+}
+
+// saveCertificateToTask stores the photo, or the scan sent as a document, of the ECD and attaches it to the task
+func saveCertificateToTask(msg *tgbotapi.Message, taskId int, globalStorage *sql.DB) (int, error) {
+	var certificate docs.File
+	switch {
+	case len(msg.Photo) > 0:
+		photo := msg.Photo[len(msg.Photo)-1]
+		certificate = docs.File{TgFileId: photo.FileID, Mimetype: docs.Mimetype("image/jpeg"), Filetype: docs.Image}
+	case msg.Document != nil:
+		mimetype := docs.MimetypeByName(msg.Document.FileName, docs.Mimetype(msg.Document.MimeType))
+		certificate = docs.File{TgFileId: msg.Document.FileID, OriginalName: msg.Document.FileName, Mimetype: mimetype, Filetype: docs.GetFileCategory(mimetype)}
+	default:
+		return 0, errNoCertificate
+	}
+
+	file, err := Bot.GetFile(tgbotapi.FileConfig{FileID: certificate.TgFileId})
+	if err != nil {
+		errlog.ERR.Printf("ERR: getting certificate file info: %v", err)
+		return 0, fmt.Errorf("ERR: getting certificate file info: %v", err)
+	}
+	fileURL := file.Link(Bot.Token)
+	filename := strings.Split(fileURL, "/")[6]
+
+	fullPath, err := config.DownloadFile(fileURL, filename)
+	if err != nil {
+		errlog.ERR.Printf("ERR: downloading certificate: %v", err)
+		return 0, fmt.Errorf("ERR: downloading certificate: %v", err)
+	}
+
+	certificate.From = msg.Chat.ID
+	certificate.Name = filename
+	certificate.Path = fullPath
+	if certificate.OriginalName == "" {
+		certificate.OriginalName = filename
+	}
+	if err = certificate.StoreFile(globalStorage); err != nil {
+		errlog.ERR.Printf("ERR: storing certificate: %v", err)
+		return 0, fmt.Errorf("ERR: storing certificate: %v", err)
+	}
+	if err = certificate.AttachFileToTask(globalStorage, taskId); err != nil {
+		return 0, err
+	}
+	return certificate.Id, nil
+}
+
+// cleaningSummary is the ECD of the cleaning task for the message that ends it, the station is the address of the task
+// when the manager wrote it himself
+func cleaningSummary(lang config.LangCode, task *parser.TaskSection, r *parser.CleaningRecord) string {
+	station := r.StationName
+	if station == "" {
+		station = task.Address
+	}
+	return config.Translate(lang, "endmsg:cleaning", html.EscapeString(r.EcdNumber), html.EscapeString(station),
+		html.EscapeString(r.PreviousProduct), html.EscapeString(r.CleaningType))
+}
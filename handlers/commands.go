@@ -5,8 +5,11 @@ import (
 	"encoding/csv"
 	"errors"
 	"fmt"
+	"html"
 	"log"
+	"logistictbot/audit"
 	"logistictbot/config"
+	data_analysis "logistictbot/data-analysis"
 	"logistictbot/db"
 	"logistictbot/delq"
 	"logistictbot/docs"
@@ -54,11 +57,31 @@ func HandleShipmentDetails(chatId, shipmentId int64, topicId int, globalStorage
 
 	msg := tgbotapi.NewDocument(chatId, tgbotapi.FileID(f.TgFileId), topicId)
 	msg.ParseMode = tgbotapi.ModeHTML
-	msg.Caption = fmt.Sprintf("<b><i>Shipment</i></b> №%d:\n<b>Водій</b>: %s (@%s) - %s\nЗавдання:\n\n", shipment.Id, driver.User.Name, driver.User.TgTag, driver.CarId)
+	lang := config.GetLang(chatId)
+	msg.Caption = config.Translate(lang, "card:details_header", shipment.Id, shipment.Status.Title(lang), driver.User.Name, driver.User.TgTag, driver.CarId)
 
 	for i, task := range shipment.Tasks {
-		msg.Caption += fmt.Sprintf("%d. <b><i>%s</i></b>\n<b>Адреса в документі</b>: %s\n\n", i+1, strings.ToUpper(string(task.Type[0]))+task.Type[1:], task.Address)
+		title := []rune(parser.TaskTypeTitle(lang, task.Type))
+		msg.Caption += config.Translate(lang, "card:details_task", i+1, strings.ToUpper(string(title[:1]))+string(title[1:]), task.Address)
 	}
+	markup := [][]tgbotapi.InlineKeyboardButton{tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(config.Translate(lang, "btn:routesheet"), fmt.Sprintf("shipment:routesheet:%d", shipment.Id)),
+	)}
+	managerSessionsMu.Lock()
+	_, isManager := managerSessions[chatId]
+	managerSessionsMu.Unlock()
+	if isManager {
+		markup = append(markup, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(config.Translate(lang, "btn:task_order"), fmt.Sprintf("manager:taskorder:%d", shipment.Id)),
+		))
+		markup = append(markup, statusButtons(shipment, lang)...)
+		markup = append(markup, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(config.Translate(lang, "btn:team"), fmt.Sprintf("manager:team:%d", shipment.Id)),
+			tgbotapi.NewInlineKeyboardButtonData(config.Translate(lang, "btn:auditlog"), fmt.Sprintf("manager:auditlog:%d", shipment.Id)),
+		))
+		markup = append(markup, handOverButtons(shipment, lang)...)
+	}
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(markup...)
 
 	_, err = Bot.Send(msg)
 	return err
@@ -73,6 +96,8 @@ func HandleCommand(chatId int64, user *tgbotapi.User, command string, globalStor
 		errlog.ERR.Printf("ERR: it is not a command: %s\n", command)
 		return fmt.Errorf("ERR: it is not a command: %s\n", command)
 	}
+	// the text after the command, like "/find MSCU1234567"
+	cmd, args, _ := strings.Cut(cmd, " ")
 
 	cmd, isGroupCmd = strings.CutSuffix(cmd, "@logistictbot")
 	if isGroupCmd {
@@ -188,6 +213,12 @@ func HandleCommand(chatId int64, user *tgbotapi.User, command string, globalStor
 		}
 		_, err = Bot.Send(tgbotapi.NewMessage(chatId, "Всі водії тепер в дефолтному статусі", loadingTopicId))
 		return err
+	case "routesheet":
+		if isGroupCmd {
+			return SendActiveRouteSheets(chatId, topicId, globalStorage)
+		}
+		_, err := Bot.Send(tgbotapi.NewMessage(chatId, config.Translate(config.GetLang(chatId), "for_groups_only")))
+		return err
 	case "language":
 		msg := tgbotapi.NewMessage(chatId, config.Translate(config.GetLang(chatId), "choose_lang"), loadingTopicId)
 		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
@@ -202,6 +233,16 @@ func HandleCommand(chatId int64, user *tgbotapi.User, command string, globalStor
 			),
 		)
 
+		_, err := Bot.Send(msg)
+		return err
+	case "timezone":
+		msg := tgbotapi.NewMessage(chatId, config.Translate(config.GetLang(chatId), "choose_timezone", config.GetLoc(chatId).String()), loadingTopicId)
+		markup := make([][]tgbotapi.InlineKeyboardButton, 0, len(timezoneChoices))
+		for _, tz := range timezoneChoices {
+			markup = append(markup, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(tz.label, "set_tz:"+tz.name)))
+		}
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(markup...)
+
 		_, err := Bot.Send(msg)
 		return err
 	case "test":
@@ -227,6 +268,8 @@ func HandleCommand(chatId int64, user *tgbotapi.User, command string, globalStor
 		}
 	case "menu":
 		return HandleCommand(chatId, user, "/start", globalStorage, langCode, topicId)
+	case "find":
+		return HandleFind(chatId, user.ID, strings.TrimSpace(args), topicId, globalStorage)
 	case "dev:init":
 		devSesh, err := db.GetDev(globalStorage, chatId)
 		if err != nil {
@@ -278,6 +321,95 @@ func HandleManagerCommands(chatId int64, fromId int64, command string, messageId
 	}
 
 	switch cmd {
+	case "taskorder", "setorder", "moveup":
+		shipmentIdString, arg, _ := strings.Cut(_idString, ":")
+		shipmentId, err := strconv.ParseInt(shipmentIdString, 10, 64)
+		if err != nil {
+			errlog.ERR.Printf("ERR: parsing shipment id (og str: %s) was not successful: %v\n", shipmentIdString, err)
+			return fmt.Errorf("ERR: parsing shipment id (og str: %s) was not successful: %v\n", shipmentIdString, err)
+		}
+
+		switch cmd {
+		case "taskorder":
+			return SendTaskOrderMenu(chatId, loadingTopicId, 0, shipmentId, globalStorage)
+		case "setorder":
+			err = parser.SetTaskOrder(globalStorage, shipmentId, parser.TaskOrder(arg), audit.Bot(fromId))
+		case "moveup":
+			taskId, convErr := strconv.Atoi(arg)
+			if convErr != nil {
+				return fmt.Errorf("ERR: parsing task id (og str: %s) was not successful: %v\n", arg, convErr)
+			}
+			err = parser.MoveTaskUp(globalStorage, shipmentId, taskId, audit.Bot(fromId))
+		}
+		if err != nil {
+			return err
+		}
+		return SendTaskOrderMenu(chatId, loadingTopicId, messageId, shipmentId, globalStorage)
+	case "handover", "handoverto", "cancelship", "cancelship_yes":
+		shipmentIdString, arg, _ := strings.Cut(_idString, ":")
+		shipmentId, err := strconv.ParseInt(shipmentIdString, 10, 64)
+		if err != nil {
+			errlog.ERR.Printf("ERR: parsing shipment id (og str: %s) was not successful: %v\n", shipmentIdString, err)
+			return fmt.Errorf("ERR: parsing shipment id (og str: %s) was not successful: %v\n", shipmentIdString, err)
+		}
+
+		switch cmd {
+		case "handover":
+			return managerSesh.ShowDriverList(globalStorage, fmt.Sprintf("manager:handoverto:%d", shipmentId), config.Translate(config.GetLang(chatId), "handover:choose_driver", shipmentId), chatId, loadingTopicId, Bot)
+		case "handoverto":
+			driverChatId, err := strconv.ParseInt(arg, 10, 64)
+			if err != nil {
+				return fmt.Errorf("ERR: parsing driver chat id (og str: %s) was not successful: %v\n", arg, err)
+			}
+			return HandOverShipment(chatId, fromId, loadingTopicId, shipmentId, driverChatId, globalStorage)
+		case "cancelship":
+			return AskCancelShipment(chatId, loadingTopicId, shipmentId)
+		}
+		return CancelShipment(chatId, fromId, loadingTopicId, shipmentId, globalStorage)
+	case "team", "teamtoggle":
+		shipmentIdString, arg, _ := strings.Cut(_idString, ":")
+		shipmentId, err := strconv.ParseInt(shipmentIdString, 10, 64)
+		if err != nil {
+			errlog.ERR.Printf("ERR: parsing shipment id (og str: %s) was not successful: %v\n", shipmentIdString, err)
+			return fmt.Errorf("ERR: parsing shipment id (og str: %s) was not successful: %v\n", shipmentIdString, err)
+		}
+
+		if cmd == "team" {
+			return SendTeamMenu(chatId, loadingTopicId, 0, shipmentId, globalStorage)
+		}
+		driverChatId, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return fmt.Errorf("ERR: parsing driver chat id (og str: %s) was not successful: %v\n", arg, err)
+		}
+		return ToggleCoDriver(chatId, fromId, loadingTopicId, messageId, shipmentId, driverChatId, globalStorage)
+	case "auditlog":
+		shipmentId, err := strconv.ParseInt(_idString, 10, 64)
+		if err != nil {
+			errlog.ERR.Printf("ERR: parsing shipment id (og str: %s) was not successful: %v\n", _idString, err)
+			return fmt.Errorf("ERR: parsing shipment id (og str: %s) was not successful: %v\n", _idString, err)
+		}
+		return SendShipmentAudit(chatId, loadingTopicId, shipmentId, globalStorage)
+	case "driveraudit":
+		if _idString == "" {
+			return managerSesh.ShowDriverList(globalStorage, "manager:driveraudit", config.Translate(config.GetLang(chatId), "audit:choose_driver"), chatId, loadingTopicId, Bot)
+		}
+		driverChatId, err := strconv.ParseInt(_idString, 10, 64)
+		if err != nil {
+			return fmt.Errorf("ERR: parsing driver chat id (og str: %s) was not successful: %v\n", _idString, err)
+		}
+		return SendDriverAudit(chatId, loadingTopicId, driverChatId, globalStorage)
+	case "setstatus", "statushistory":
+		shipmentIdString, arg, _ := strings.Cut(_idString, ":")
+		shipmentId, err := strconv.ParseInt(shipmentIdString, 10, 64)
+		if err != nil {
+			errlog.ERR.Printf("ERR: parsing shipment id (og str: %s) was not successful: %v\n", shipmentIdString, err)
+			return fmt.Errorf("ERR: parsing shipment id (og str: %s) was not successful: %v\n", shipmentIdString, err)
+		}
+
+		if cmd == "statushistory" {
+			return SendStatusHistory(chatId, loadingTopicId, shipmentId, globalStorage)
+		}
+		return SetShipmentStatus(chatId, fromId, loadingTopicId, shipmentId, parser.ShipmentStatus(arg), globalStorage)
 	case "create":
 		managerSesh.State = db.StateWaitingDoc
 
@@ -327,6 +459,139 @@ func HandleManagerCommands(chatId int64, fromId int64, command string, messageId
 			TrackedTaskId: cleaningTask.Id,
 		})
 		return err
+	case "review_accept":
+		if managerSesh.State != db.StateReviewingDoc || managerSesh.PendingMessage == nil {
+			return reviewExpired(managerSesh, chatId, loadingTopicId, globalStorage)
+		}
+		pm := managerSesh.PendingMessage
+
+		// it could have been changed in the web editor, so the stored one is the one that goes to the driver
+		if pm.ShipmentStored {
+			shipment, err := parser.GetShipment(globalStorage, pm.Shipment.Id)
+			if err != nil {
+				errlog.ERR.Printf("ERR: getting fixed shipment %d: %v\n", pm.Shipment.Id, err)
+				return fmt.Errorf("ERR: getting fixed shipment %d: %v\n", pm.Shipment.Id, err)
+			}
+			pm.Shipment = shipment
+		}
+
+		if err := pm.SendDocToDriver(globalStorage, Bot); err != nil {
+			if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+				log.Printf("From %d to %d doc unique error: %v\n", pm.FromChatId, pm.ToChatId, err)
+				managerSesh.State = db.StateDormantManager
+				return managerSesh.ChangeManagerStatus(globalStorage)
+			}
+			errlog.ERR.Printf("ERR: sending document: %v\n", err)
+			return fmt.Errorf("ERR: sending document: %v\n", err)
+		}
+
+		managerSesh.State = db.StateDormantManager
+		managerSesh.PendingMessage = nil
+
+		err := managerSesh.ChangeManagerStatus(globalStorage)
+		if err != nil {
+			return err
+		}
+
+		Bot.Request(tgbotapi.NewEditMessageReplyMarkup(chatId, messageId, tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}))
+		_, err = Bot.Send(tgbotapi.NewMessage(chatId, config.Translate(config.GetLang(chatId), "manager:shipment_sent"), loadingTopicId))
+		return err
+	case "amend_accept":
+		if managerSesh.State != db.StateReviewingDoc || managerSesh.PendingMessage == nil || managerSesh.PendingMessage.Amendment == nil {
+			return reviewExpired(managerSesh, chatId, loadingTopicId, globalStorage)
+		}
+		pm := managerSesh.PendingMessage
+
+		result, err := parser.ApplyAmendment(globalStorage, pm.Shipment, audit.Bot(fromId))
+		if errors.Is(err, parser.ErrShipmentClosed) {
+			Bot.Request(tgbotapi.NewEditMessageReplyMarkup(chatId, messageId, tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}))
+			return refuseClosedAmendment(managerSesh, chatId, loadingTopicId, pm.Shipment.Id, globalStorage)
+		}
+		if err != nil {
+			errlog.ERR.Printf("ERR: applying amendment of shipment %d: %v\n", pm.Shipment.Id, err)
+			return fmt.Errorf("ERR: applying amendment of shipment %d: %v\n", pm.Shipment.Id, err)
+		}
+
+		managerSesh.State = db.StateDormantManager
+		managerSesh.PendingMessage = nil
+		if err = managerSesh.ChangeManagerStatus(globalStorage); err != nil {
+			return err
+		}
+
+		Bot.Request(tgbotapi.NewEditMessageReplyMarkup(chatId, messageId, tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}))
+		text := config.Translate(config.GetLang(chatId), "amendment:applied", pm.Shipment.Id)
+		if len(result.KeptTasks) > 0 {
+			text += "\n" + config.Translate(config.GetLang(chatId), "amendment:kept", strings.ToUpper(strings.Join(result.KeptTasks, ", ")))
+		}
+		applied := tgbotapi.NewMessage(chatId, text, loadingTopicId)
+		applied.ParseMode = tgbotapi.ModeHTML
+		if _, err = Bot.Send(applied); err != nil {
+			return err
+		}
+
+		if !result.HasChanges() && len(result.KeptTasks) == 0 {
+			return nil
+		}
+		return notifyAmendment(pm.Shipment.Id, result, pm.FileId, globalStorage)
+	case "review_fix":
+		if managerSesh.State != db.StateReviewingDoc || managerSesh.PendingMessage == nil {
+			return reviewExpired(managerSesh, chatId, loadingTopicId, globalStorage)
+		}
+		pm := managerSesh.PendingMessage
+
+		if !pm.ShipmentStored {
+			err := pm.StoreReviewedShipment(globalStorage)
+			if err != nil {
+				errlog.ERR.Printf("ERR: storing shipment for fixing: %v\n", err)
+				return fmt.Errorf("ERR: storing shipment for fixing: %v\n", err)
+			}
+		}
+
+		msg := tgbotapi.NewMessage(chatId, config.Translate(config.GetLang(chatId), "review:fix", pm.Shipment.Id), loadingTopicId)
+		msg.ParseMode = tgbotapi.ModeHTML
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonWebApp(config.Translate(config.GetLang(chatId), "btn:open_editor"), tgbotapi.WebAppInfo{
+					URL: fmt.Sprintf("%sshipments.html?id=%d", config.GetWebAppURL(), pm.Shipment.Id),
+				}),
+			),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(config.Translate(config.GetLang(chatId), "btn:review_accept"), "manager:review_accept"),
+			),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(config.Translate(config.GetLang(chatId), "btn:review_reject"), fmt.Sprintf("manager:review_reject:%d", pm.Shipment.Id)),
+			),
+		)
+		_, err := Bot.Send(msg)
+		return err
+	case "review_reject":
+		// the reject of the fix message has the number of the stored shipment, it is found after a restart too, or when
+		// another document is reviewed by now
+		pm := managerSesh.PendingMessage
+		if shipmentId, err := strconv.ParseInt(_idString, 10, 64); idFound && err == nil && (pm == nil || pm.Shipment == nil || pm.Shipment.Id != shipmentId) {
+			Bot.Request(tgbotapi.NewEditMessageReplyMarkup(chatId, messageId, tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}))
+			return discardExpiredReview(managerSesh, chatId, loadingTopicId, shipmentId, globalStorage)
+		}
+		if managerSesh.State != db.StateReviewingDoc || pm == nil {
+			return reviewExpired(managerSesh, chatId, loadingTopicId, globalStorage)
+		}
+
+		err := managerSesh.PendingMessage.DiscardReviewedShipment(globalStorage)
+		if err != nil {
+			return err
+		}
+
+		managerSesh.State = db.StateDormantManager
+		managerSesh.PendingMessage = nil
+
+		err = managerSesh.ChangeManagerStatus(globalStorage)
+		if err != nil {
+			return err
+		}
+
+		Bot.Request(tgbotapi.NewEditMessageReplyMarkup(chatId, messageId, tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}))
+		_, err = Bot.Send(tgbotapi.NewMessage(chatId, config.Translate(config.GetLang(chatId), "review:rejected"), loadingTopicId))
+		return err
 	case "viewdrivers":
 		drivers, err := db.GetAllDrivers(globalStorage)
 		if err != nil {
@@ -343,6 +608,9 @@ func HandleManagerCommands(chatId int64, fromId int64, command string, messageId
 			}
 			msg.Text += config.Translate(config.GetLang(chatId), "manager:driver_hasnocar", d.User.Name, d.User.TgTag)
 		}
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(config.Translate(config.GetLang(chatId), "btn:driveraudit"), "manager:driveraudit"),
+		))
 
 		Bot.Send(msg)
 
@@ -442,6 +710,8 @@ func HandleManagerCommands(chatId int64, fromId int64, command string, messageId
 		_, err = Bot.Send(msg)
 		return err
 
+	case "podreport":
+		return SendPODReport(chatId, loadingTopicId, globalStorage)
 	case "mrefuel":
 		drivers, err := db.GetAllDrivers(globalStorage)
 		if err != nil {
@@ -522,11 +792,21 @@ func HandleManagerInputState(manager *db.Manager, msg *tgbotapi.Message, globalS
 			taskSessions[driver.Id].Address = cleaningTask.Address
 			taskSessionsMu.Unlock()
 
-			err = cleaningTask.UpdateAddress(globalStorage)
+			err = cleaningTask.UpdateAddress(globalStorage, audit.Bot(manager.ChatId))
 			if err != nil {
 				return manager, fmt.Errorf("ERR: updating address: %v\n", err)
 			}
 
+			// a station picked in the inline search is kept for the ECD, a written address is only the address
+			station := data_analysis.CleaningStation{}
+			err = station.GetByInlineText(globalStorage, msg.Text)
+			if err == nil {
+				err = cleaningTask.UpdateCleaningStation(globalStorage, station.Id, audit.Bot(manager.ChatId))
+			}
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return manager, fmt.Errorf("ERR: updating cleaning station of task %d: %v\n", cleaningTask.Id, err)
+			}
+
 			manager.State = db.StateDormantManager
 			err = manager.ChangeManagerStatus(globalStorage)
 			if err != nil {
@@ -563,7 +843,7 @@ func HandleManagerInputState(manager *db.Manager, msg *tgbotapi.Message, globalS
 				MessageType:     "document",
 				FromUser:        msg.From,
 				DocOriginalName: msg.Document.FileName,
-				DocMimetype:     docs.Mimetype(msg.Document.MimeType),
+				DocMimetype:     docs.MimetypeByName(msg.Document.FileName, docs.Mimetype(msg.Document.MimeType)),
 				FileId:          msg.Document.FileID,
 			}
 			manager.State = db.StateWaitingNotes
@@ -584,6 +864,45 @@ func HandleManagerInputState(manager *db.Manager, msg *tgbotapi.Message, globalS
 				return manager, err
 			}
 
+			doc := docs.File{Id: id}
+			err = doc.GetFile(globalStorage)
+			if err != nil {
+				return manager, fmt.Errorf("ERR: getting stored shipment doc: %v\n", err)
+			}
+
+			docParser, err := parser.DetectParserForFile(doc.Path)
+			if err != nil {
+				if errors.Is(err, parser.ErrNoParser) || errors.Is(err, parser.ErrNoTextLayer) {
+					reason := "manager:unknown_doc_format"
+					if errors.Is(err, parser.ErrNoTextLayer) {
+						reason = "manager:no_text_layer"
+					}
+					_, err = Bot.Send(tgbotapi.NewMessage(msg.Chat.ID, config.Translate(config.GetLang(msg.Chat.ID), reason), msg.MessageThreadID))
+					manager.State = db.StateDormantManager
+					manager.PendingMessage = nil
+
+					return manager, manager.ChangeManagerStatus(globalStorage)
+				}
+				return manager, err
+			}
+			log.Printf("shipment doc %d is going to be read by the %s parser\n", id, docParser.Name())
+
+			// a resent document for a stored shipment does not need notes and a driver, it goes straight to the diff
+			if err = manager.PendingMessage.ParseDoc(globalStorage); err != nil {
+				if errors.Is(err, parser.ErrShipmentClosed) {
+					return manager, refuseClosedAmendment(manager, msg.Chat.ID, loadingTopicId, manager.PendingMessage.Shipment.Id, globalStorage)
+				}
+				errlog.ERR.Printf("ERR: parsing document: %v\n", err)
+				return manager, fmt.Errorf("ERR: parsing document: %v\n", err)
+			}
+			if manager.PendingMessage.Amendment != nil {
+				manager.State = db.StateReviewingDoc
+				if err = manager.ChangeManagerStatus(globalStorage); err != nil {
+					return manager, err
+				}
+				return manager, SendAmendmentReview(msg.Chat.ID, loadingTopicId, manager.PendingMessage)
+			}
+
 			notesMsg := tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("%s\n\n%s", config.Translate(config.GetLang(msg.Chat.ID), "manager:notes"), config.Translate(config.GetLang(msg.Chat.ID), "manager:readdoc")), loadingTopicId)
 			notesMsg.ParseMode = tgbotapi.ModeHTML
 			notesMsg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(config.Translate(config.GetLang(msg.Chat.ID), "btn:readdoc"), "readdoc:"+strconv.Itoa(id))))
@@ -1148,7 +1467,7 @@ func HandleDriverCommands(chatId int64, fromId int64, command string, messageId
 
 		tr := &db.TankRefuel{Driver: driverSesh, CarId: driverSesh.CarId, FuelCardId: cardId, ShipmentId: &s.Id}
 
-		err = tr.StoreTankRefuel(globalStorage)
+		err = tr.StoreTankRefuel(globalStorage, audit.Bot(fromId))
 		if err != nil {
 			errlog.ERR.Printf("ERR: storing tank refuel: %v\n", err)
 			return fmt.Errorf("ERR: storing tank refuel: %v\n", err)
@@ -1187,7 +1506,94 @@ func HandleDriverCommands(chatId int64, fromId int64, command string, messageId
 		})
 		return err
 
-	case "begintask":
+	case "arrived":
+		taskId, err := strconv.Atoi(_idString)
+		if err != nil {
+			return err
+		}
+
+		task, err := parser.GetTaskById(globalStorage, taskId)
+		if err != nil {
+			errlog.ERR.Printf("ERR: getting task by id (%d): %v\n", taskId, err)
+			return fmt.Errorf("ERR: getting task by id (%d): %v\n", taskId, err)
+		}
+
+		lang := config.GetLang(chatId)
+		loc := config.GetLoc(chatId)
+		switch {
+		case task.IsFinished():
+			_, err = Bot.Send(tgbotapi.NewMessage(chatId, config.Translate(lang, "task_already_finished", task.Id, task.Type, task.ShipmentId), loadingTopicId))
+			return err
+		case task.IsStarted():
+			_, err = Bot.Send(tgbotapi.NewMessage(chatId, config.Translate(lang, "task_already_started", task.Id, task.Type, task.ShipmentId), loadingTopicId))
+			return err
+		case !task.Arrived.IsZero():
+			_, err = Bot.Send(tgbotapi.NewMessage(chatId, config.Translate(lang, "driver:already_arrived", task.Arrived.In(loc).Format("02.01 15:04")), loadingTopicId))
+			return err
+		}
+
+		shipment, err := parser.GetShipment(globalStorage, task.ShipmentId)
+		if err != nil {
+			errlog.ERR.Printf("ERR: getting shipment %d of the task the driver arrived to: %v\n", task.ShipmentId, err)
+			return fmt.Errorf("ERR: getting shipment %d of the task the driver arrived to: %v\n", task.ShipmentId, err)
+		}
+
+		if shipment.Status == parser.StatusCancelled {
+			_, err = Bot.Send(tgbotapi.NewMessage(chatId, config.Translate(lang, "status:shipment_cancelled", shipment.Id), loadingTopicId))
+			return err
+		}
+
+		if !shipment.HasDriver(driverSesh.Id) {
+			errlog.INFO.Printf("The driver %s tried to arrive to task %d of %s's shipment %d", driverSesh.User.Name, task.Id, shipment.DriverName, shipment.Id)
+			_, err = Bot.Send(tgbotapi.NewMessage(chatId, config.Translate(lang, "shipment_does_not_belong_to_you"), loadingTopicId))
+			return err
+		}
+
+		task.Arrived = time.Now()
+		if err = task.MarkArrived(globalStorage, audit.Bot(fromId)); err != nil {
+			errlog.ERR.Printf("ERR: storing the arrival to task %d: %v\n", task.Id, err)
+			return fmt.Errorf("ERR: storing the arrival to task %d: %v\n", task.Id, err)
+		}
+
+		free := duration.Duration{Duration: task.FreeTime()}
+		msg := tgbotapi.NewMessage(chatId, config.Translate(lang, "driver:arrived",
+			parser.TaskTypeTitle(lang, task.Type), html.EscapeString(task.Address), task.Arrived.In(loc).Format("02.01 15:04"), free.Format(duration.ForPresentation)), loadingTopicId)
+		msg.ParseMode = tgbotapi.ModeHTML
+		_, err = Bot.Send(msg)
+		return err
+
+	case "signature":
+		taskId, err := strconv.Atoi(_idString)
+		if err != nil {
+			return err
+		}
+
+		// the Mini App buttons only work in the private chats, so the driver gets it from the bot directly
+		lang := config.GetLang(fromId)
+		msg := tgbotapi.NewMessage(fromId, config.Translate(lang, "signature:open"))
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonWebApp(config.Translate(lang, "btn:open_signature"), tgbotapi.WebAppInfo{
+				URL: fmt.Sprintf("%ssignature.html?task=%d", config.GetWebAppURL(), taskId),
+			}),
+		))
+		if _, err = Bot.Send(msg); err != nil {
+			errlog.INFO.Printf("could not send the signature page to driver %s (%d): %v\n", driverSesh.User.Name, fromId, err)
+			_, err = Bot.Send(tgbotapi.NewMessage(chatId, config.Translate(config.GetLang(chatId), "signature:start_bot"), loadingTopicId))
+			return err
+		}
+		if chatId != fromId {
+			sent, err := Bot.Send(tgbotapi.NewMessage(chatId, config.Translate(config.GetLang(chatId), "signature:sent_private"), loadingTopicId))
+			if err != nil {
+				return err
+			}
+			delq.EnqueueToDelete(globalStorage, sent.Chat.ID, sent.MessageID, delq.Requirements{
+				Type:          delq.TaskFinished,
+				TrackedTaskId: taskId,
+			})
+		}
+		return nil
+
+	case "begintask", "begintask_force":
 		taskId, err := strconv.Atoi(_idString)
 		if err != nil {
 			return err
@@ -1211,6 +1617,35 @@ func HandleDriverCommands(chatId int64, fromId int64, command string, messageId
 			return fmt.Errorf("Driver %s (in group %d, chat_id %d) tried to start task (%d) when it's finished\n", driverSesh.User.Name, chatId, fromId, task.Id)
 		}
 
+		shipment, err := parser.GetShipment(globalStorage, task.ShipmentId)
+		if err != nil {
+			errlog.ERR.Printf("ERR: getting shipment to check if it is done: %v\n", err)
+			return fmt.Errorf("ERR: getting shipment to check if it is done: %v\n", err)
+		}
+
+		if shipment.Status == parser.StatusCancelled {
+			_, err = Bot.Send(tgbotapi.NewMessage(chatId, config.Translate(config.GetLang(chatId), "status:shipment_cancelled", shipment.Id), loadingTopicId))
+			return err
+		}
+
+		if shipment.IsFinished() {
+			_, err = Bot.Send(tgbotapi.NewMessage(chatId, config.Translate(config.GetLang(chatId), "driver:shipment_already_done"), loadingTopicId))
+			return err
+		}
+
+		// the lead and the co-drivers of a double manned truck can all begin its tasks
+		if !shipment.HasDriver(driverSesh.Id) {
+			errlog.INFO.Printf("The driver %s tried to begin task %d of %s's shipment %d", driverSesh.User.Name, task.Id, shipment.DriverName, shipment.Id)
+			_, err = Bot.Send(tgbotapi.NewMessage(chatId, config.Translate(config.GetLang(chatId), "shipment_does_not_belong_to_you"), loadingTopicId))
+			return err
+		}
+
+		// begintask_force is the "start anyway" of the warning, a strict order is checked again, the manager could have
+		// set it after the warning was sent
+		if ok, err := checkTaskOrder(chatId, loadingTopicId, shipment, task, cmd == "begintask_force"); !ok || err != nil {
+			return err
+		}
+
 		switch task.Type {
 		case parser.TaskLoad:
 			driverSesh.State = db.StateLoad
@@ -1227,19 +1662,18 @@ func HandleDriverCommands(chatId int64, fromId int64, command string, messageId
 			return fmt.Errorf("ERR: wrong type of task: %s\n", task.Type)
 		}
 
-		shipment, err := parser.GetShipment(globalStorage, task.ShipmentId)
-		if err != nil {
-			errlog.ERR.Printf("ERR: getting shipment to check if it is done: %v\n", err)
-			return fmt.Errorf("ERR: getting shipment to check if it is done: %v\n", err)
+		driverSesh.PerformedTaskId = taskId
+
+		// the first task started puts the accepted shipment in progress
+		if err = shipment.BeginShipment(globalStorage, audit.Bot(fromId)); err != nil {
+			errlog.ERR.Printf("ERR: putting shipment %d in progress: %v\n", shipment.Id, err)
+			return fmt.Errorf("ERR: putting shipment %d in progress: %v\n", shipment.Id, err)
 		}
 
-		if shipment.IsFinished() {
-			_, err = Bot.Send(tgbotapi.NewMessage(chatId, config.Translate(config.GetLang(chatId), "driver:shipment_already_done"), loadingTopicId))
+		if err = parser.SetTaskPerformer(globalStorage, task, driverSesh.Id, driverSesh.CarId, audit.Bot(fromId)); err != nil {
 			return err
 		}
 
-		driverSesh.PerformedTaskId = taskId
-
 		err = driverSesh.SetPerformingTask(globalStorage)
 		if err != nil {
 			errlog.ERR.Printf("ERR: changing driver's performing task: %v\n", err)
@@ -1277,6 +1711,11 @@ func HandleDriverCommands(chatId int64, fromId int64, command string, messageId
 		taskSessionsMu.Unlock()
 
 		if f {
+			// the proof of delivery the rule of the task asks for, a blocked task waits for the files
+			if ok, err := checkPOD(chatId, loadingTopicId, driverSesh, task, globalStorage); !ok || err != nil {
+				return err
+			}
+
 			delq.EnqueueToDelete(globalStorage, chatId, messageId, delq.Requirements{
 				Type:          delq.TaskFinished,
 				TrackedTaskId: task.Id,
@@ -1284,13 +1723,23 @@ func HandleDriverCommands(chatId int64, fromId int64, command string, messageId
 
 			switch task.Type {
 			case parser.TaskLoad, parser.TaskUnload, parser.TaskCollect, parser.TaskDropoff:
+				compartments, err := parser.GetTaskCompartments(globalStorage, task.Id)
+				if err != nil {
+					return err
+				}
+
 				driverSesh.State = db.StateWaitingWeight
-				err := driverSesh.ChangeDriverStatus(globalStorage)
+				err = driverSesh.ChangeDriverStatus(globalStorage)
 				if err != nil {
 					return err
 				}
 
-				msg := tgbotapi.NewMessage(chatId, config.Translate(config.GetLang(chatId), "driver:weight"), loadingTopicId)
+				// with the compartments in the document the driver measures them one by one
+				text := config.Translate(config.GetLang(chatId), "driver:weight")
+				if c := parser.NextToMeasure(compartments); c != nil {
+					text = compartmentPrompt(chatId, "driver:compartment_weight", c)
+				}
+				msg := tgbotapi.NewMessage(chatId, text, loadingTopicId)
 				msg.ParseMode = tgbotapi.ModeHTML
 				sent, err := Bot.Send(msg)
 				delq.EnqueueToDelete(globalStorage, sent.Chat.ID, sent.MessageID, delq.Requirements{
@@ -1300,7 +1749,8 @@ func HandleDriverCommands(chatId int64, fromId int64, command string, messageId
 				return err
 
 			case parser.TaskCleaning:
-				return HandleDriverCommands(chatId, fromId, "driver:sumtask", messageId, globalStorage)
+				// the European Cleaning Document of the station goes with the task before it ends
+				return askCleaning(driverSesh, chatId, loadingTopicId, task.Id, db.StateWaitingEcd, "driver:ecd_number", globalStorage)
 			default:
 				errlog.ERR.Printf("ERR: wrong type of task: %s\n", task.Type)
 				return fmt.Errorf("ERR: wrong type of task: %s\n", task.Type)
@@ -1328,7 +1778,7 @@ func HandleDriverCommands(chatId int64, fromId int64, command string, messageId
 		taskSessionsMu.Unlock()
 
 		if f {
-			err := task.FinishTaskById(globalStorage)
+			err := task.FinishTaskById(globalStorage, audit.Bot(fromId))
 			if err != nil {
 				return err
 			}
@@ -1709,7 +2159,7 @@ func HandleDriverCommands(chatId int64, fromId int64, command string, messageId
 			return fmt.Errorf("ERR: changing driver's status: %v\n", err)
 		}
 
-		_, err = driverSesh.UnpauseSession(globalStorage)
+		_, err = driverSesh.UnpauseSession(globalStorage, audit.Bot(fromId))
 		if err != nil {
 			errlog.ERR.Printf("ERR: starting a day: %v\n", err)
 			return fmt.Errorf("ERR: starting a day: %v\n", err)
@@ -1818,7 +2268,7 @@ func HandleDriverInputState(driver *db.Driver, msg *tgbotapi.Message, globalStor
 				log.Println("ERR: not the right km format, msg: ", msg.Text, msg.Chat.ID)
 				return driver, err
 			}
-			err = tr.UpdateKilometrage(globalStorage, km)
+			err = tr.UpdateKilometrage(globalStorage, km, audit.Bot(driver.ChatId))
 			if err != nil {
 				return driver, fmt.Errorf("ERR: update km for the refueling: %v\n", err)
 			}
@@ -1859,7 +2309,7 @@ func HandleDriverInputState(driver *db.Driver, msg *tgbotapi.Message, globalStor
 				log.Println("ERR: not the right diesel format, msg: ", msg.Text, msg.Chat.ID)
 				return driver, err
 			}
-			err = tr.UpdateDiesel(globalStorage, diesel)
+			err = tr.UpdateDiesel(globalStorage, diesel, audit.Bot(driver.ChatId))
 			if err != nil {
 				return driver, fmt.Errorf("ERR: update diesel for the refueling: %v\n", err)
 			}
@@ -1899,7 +2349,7 @@ func HandleDriverInputState(driver *db.Driver, msg *tgbotapi.Message, globalStor
 				log.Println("ERR: not the right adblue format, msg: ", msg.Text, msg.Chat.ID)
 				return driver, err
 			}
-			err = tr.UpdateAdBlu(globalStorage, adblu)
+			err = tr.UpdateAdBlu(globalStorage, adblu, audit.Bot(driver.ChatId))
 			if err != nil {
 				return driver, fmt.Errorf("ERR: update ablue for the refueling: %v\n", err)
 			}
@@ -1943,7 +2393,7 @@ func HandleDriverInputState(driver *db.Driver, msg *tgbotapi.Message, globalStor
 				Type:            delq.Refueled,
 			})
 
-			err = tr.UpdateAddress(globalStorage, msg.Text)
+			err = tr.UpdateAddress(globalStorage, msg.Text, audit.Bot(driver.ChatId))
 			if err != nil {
 				return driver, fmt.Errorf("ERR: update km for the refueling: %v\n", err)
 			}
@@ -2022,7 +2472,7 @@ func HandleDriverInputState(driver *db.Driver, msg *tgbotapi.Message, globalStor
 			}
 
 			task.CurrentKilometrage = km
-			if err = task.UpdateCurrentKilometrage(globalStorage); err != nil {
+			if err = task.UpdateCurrentKilometrage(globalStorage, audit.Bot(driver.ChatId)); err != nil {
 				return driver, fmt.Errorf("ERR: updating kilometrage: %v\n", err)
 			}
 
@@ -2073,7 +2523,7 @@ func HandleDriverInputState(driver *db.Driver, msg *tgbotapi.Message, globalStor
 			}
 
 			task.Start = db.CombineDateTime(task.Start, parsed)
-			if err = task.UpdateStart(globalStorage); err != nil {
+			if err = task.UpdateStart(globalStorage, audit.Bot(driver.ChatId)); err != nil {
 				return driver, fmt.Errorf("ERR: updating start time: %v\n", err)
 			}
 
@@ -2123,7 +2573,7 @@ func HandleDriverInputState(driver *db.Driver, msg *tgbotapi.Message, globalStor
 			}
 
 			task.End = db.CombineDateTime(task.End, parsed)
-			if err = task.UpdateEnd(globalStorage); err != nil {
+			if err = task.UpdateEnd(globalStorage, audit.Bot(driver.ChatId)); err != nil {
 				return driver, fmt.Errorf("ERR: updating end time: %v\n", err)
 			}
 
@@ -2173,7 +2623,7 @@ func HandleDriverInputState(driver *db.Driver, msg *tgbotapi.Message, globalStor
 			}
 
 			task.CurrentTemperature = temp
-			if err = task.UpdateCurrentTemperature(globalStorage); err != nil {
+			if err = task.UpdateCurrentTemperature(globalStorage, audit.Bot(driver.ChatId)); err != nil {
 				return driver, fmt.Errorf("ERR: updating temperature: %v\n", err)
 			}
 
@@ -2223,7 +2673,7 @@ func HandleDriverInputState(driver *db.Driver, msg *tgbotapi.Message, globalStor
 			}
 
 			task.CurrentWeight = weight
-			if err = task.UpdateCurrentWeight(globalStorage); err != nil {
+			if err = task.UpdateCurrentWeight(globalStorage, audit.Bot(driver.ChatId)); err != nil {
 				return driver, fmt.Errorf("ERR: updating weight: %v\n", err)
 			}
 
@@ -2268,7 +2718,7 @@ func HandleDriverInputState(driver *db.Driver, msg *tgbotapi.Message, globalStor
 
 			task.OriginalAddress = task.Address
 			task.Address = msg.Text
-			if err = task.UpdateAddress(globalStorage); err != nil {
+			if err = task.UpdateAddress(globalStorage, audit.Bot(driver.ChatId)); err != nil {
 				return driver, fmt.Errorf("ERR: updating address: %v\n", err)
 			}
 
@@ -2514,12 +2964,12 @@ func HandleDriverInputState(driver *db.Driver, msg *tgbotapi.Message, globalStor
 				TrackedTaskId: task.Id,
 			})
 
-			err = task.UpdateCurrentKmById(globalStorage)
+			err = task.UpdateCurrentKmById(globalStorage, audit.Bot(driver.ChatId))
 			if err != nil {
 				return driver, fmt.Errorf("ERR: updating kilometrage by task id: %v\n", err)
 			}
 
-			err = task.StartTaskById(globalStorage)
+			err = task.StartTaskById(globalStorage, audit.Bot(driver.ChatId))
 			if err != nil {
 				return driver, fmt.Errorf("ERR: starting a task: %v\n", err)
 			}
@@ -2536,7 +2986,7 @@ func HandleDriverInputState(driver *db.Driver, msg *tgbotapi.Message, globalStor
 
 			car.Kilometrage = task.CurrentKilometrage
 
-			err = car.UpdateCarKilometrage(globalStorage)
+			err = car.UpdateCarKilometrage(globalStorage, audit.Bot(driver.ChatId))
 			if err != nil {
 				return driver, err
 			}
@@ -2596,16 +3046,35 @@ func HandleDriverInputState(driver *db.Driver, msg *tgbotapi.Message, globalStor
 				_, err = Bot.Send(tgbotapi.NewMessage(msg.Chat.ID, config.Translate(config.GetLang(msg.Chat.ID), "driver:err_wrongweightformat"), loadingTopicId))
 				return driver, err
 			}
-			task.CurrentWeight = kg
 
 			delq.EnqueueToDelete(globalStorage, msg.Chat.ID, msg.MessageID, delq.Requirements{
 				Type:          delq.TaskFinished,
 				TrackedTaskId: task.Id,
 			})
 
-			err = task.UpdateCurrentWeightById(globalStorage)
+			compartments, err := parser.GetTaskCompartments(globalStorage, task.Id)
 			if err != nil {
-				return driver, fmt.Errorf("ERR: updating weight by task id: %v\n", err)
+				return driver, err
+			}
+			tempPrompt := config.Translate(config.GetLang(msg.Chat.ID), "driver:enter_temp")
+
+			if c := parser.NextToMeasure(compartments); c != nil {
+				// the task gets the total when the last compartment is measured
+				c.ActualWeight = &kg
+				if err = c.UpdateActualWeight(globalStorage, task, audit.Bot(driver.ChatId)); err != nil {
+					return driver, fmt.Errorf("ERR: updating weight of compartment %d: %v\n", c.Number, err)
+				}
+				declaredKg, _ := c.DeclaredWeight.Kilograms()
+				warnDeclaredMismatch(msg.Chat.ID, loadingTopicId, task.Id, "driver:weight_differs", c.DeclaredWeight, float64(kg), declaredKg*declaredWeightTolerance, globalStorage)
+				tempPrompt = compartmentPrompt(msg.Chat.ID, "driver:compartment_temp", c)
+			} else {
+				task.CurrentWeight = kg
+				err = task.UpdateCurrentWeightById(globalStorage, audit.Bot(driver.ChatId))
+				if err != nil {
+					return driver, fmt.Errorf("ERR: updating weight by task id: %v\n", err)
+				}
+				declaredKg, _ := task.DeclaredWeight.Kilograms()
+				warnDeclaredMismatch(msg.Chat.ID, loadingTopicId, task.Id, "driver:weight_differs", task.DeclaredWeight, float64(kg), declaredKg*declaredWeightTolerance, globalStorage)
 			}
 
 			driver.State = db.StateWaitingTemp
@@ -2614,7 +3083,7 @@ func HandleDriverInputState(driver *db.Driver, msg *tgbotapi.Message, globalStor
 				return driver, fmt.Errorf("ERR: changing status for waiting temp: %v\n", err)
 			}
 
-			tempMsg := tgbotapi.NewMessage(msg.Chat.ID, config.Translate(config.GetLang(msg.Chat.ID), "driver:enter_temp"), loadingTopicId)
+			tempMsg := tgbotapi.NewMessage(msg.Chat.ID, tempPrompt, loadingTopicId)
 			tempMsg.ParseMode = tgbotapi.ModeHTML
 			sent, err := Bot.Send(tempMsg)
 			delq.EnqueueToDelete(globalStorage, sent.Chat.ID, sent.MessageID, delq.Requirements{
@@ -2641,18 +3110,56 @@ func HandleDriverInputState(driver *db.Driver, msg *tgbotapi.Message, globalStor
 				TrackedTaskId: task.Id,
 			})
 
-			task.CurrentTemperature = celcius
-			err = task.UpdateCurrentTempById(globalStorage)
+			compartments, err := parser.GetTaskCompartments(globalStorage, task.Id)
 			if err != nil {
-				return driver, fmt.Errorf("ERR: updating weight by task id: %v\n", err)
+				return driver, err
 			}
 
+			if c := parser.NextToMeasure(compartments); c != nil {
+				c.ActualTemperature = &celcius
+				if err = c.UpdateActualTemperature(globalStorage, task, audit.Bot(driver.ChatId)); err != nil {
+					return driver, fmt.Errorf("ERR: updating temperature of compartment %d: %v\n", c.Number, err)
+				}
+				warnDeclaredMismatch(msg.Chat.ID, loadingTopicId, task.Id, "driver:temp_differs", c.DeclaredTemperature, celcius, declaredTempTolerance, globalStorage)
+
+				// the next compartment starts with its weight again
+				if next := parser.NextToMeasure(compartments); next != nil {
+					driver.State = db.StateWaitingWeight
+					if err = driver.ChangeDriverStatus(globalStorage); err != nil {
+						return driver, fmt.Errorf("ERR: changing status for waiting weight: %v\n", err)
+					}
+					weightMsg := tgbotapi.NewMessage(msg.Chat.ID, compartmentPrompt(msg.Chat.ID, "driver:compartment_weight", next), loadingTopicId)
+					weightMsg.ParseMode = tgbotapi.ModeHTML
+					sent, err := Bot.Send(weightMsg)
+					delq.EnqueueToDelete(globalStorage, sent.Chat.ID, sent.MessageID, delq.Requirements{
+						Type:          delq.TaskFinished,
+						TrackedTaskId: task.Id,
+					})
+					return driver, err
+				}
+
+				task.SumCompartments(compartments)
+				if err = task.UpdateCurrentWeightById(globalStorage, audit.Bot(driver.ChatId)); err != nil {
+					return driver, fmt.Errorf("ERR: updating weight by task id: %v\n", err)
+				}
+			} else {
+				task.CurrentTemperature = celcius
+				warnDeclaredMismatch(msg.Chat.ID, loadingTopicId, task.Id, "driver:temp_differs", task.DeclaredTemperature, celcius, declaredTempTolerance, globalStorage)
+			}
+
+			err = task.UpdateCurrentTempById(globalStorage, audit.Bot(driver.ChatId))
+			if err != nil {
+				return driver, fmt.Errorf("ERR: updating weight by task id: %v\n", err)
+			}
 		}
 
 		err = HandleDriverCommands(msg.Chat.ID, driver.ChatId, "driver:sumtask", msg.MessageID, globalStorage)
 
 		return driver, err
 
+	case db.StateWaitingEcd, db.StateWaitingPrevProduct, db.StateWaitingCleaningType, db.StateWaitingCertificate:
+		return HandleCleaningInput(driver, msg, loadingTopicId, globalStorage)
+
 	case db.StateEndingDay:
 
 		if driver.Session == nil {
@@ -2694,7 +3201,7 @@ func HandleDriverInputState(driver *db.Driver, msg *tgbotapi.Message, globalStor
 			session.EndKilometrage = sql.NullInt64{Valid: km > 0, Int64: km}
 			session.KilometrageAccumulated = kmAccum
 
-			err = car.UpdateCarKilometrage(globalStorage)
+			err = car.UpdateCarKilometrage(globalStorage, audit.Bot(driver.ChatId))
 			if err != nil {
 				return driver, err
 			}
@@ -2744,10 +3251,27 @@ func HandleDriverInputState(driver *db.Driver, msg *tgbotapi.Message, globalStor
 			session.Paused = sql.NullTime{Valid: true, Time: time.Now()}
 
 			session.Pausetime = pausedTime
-			session, err = driver.PauseSession(globalStorage)
+			session, err = driver.PauseSession(globalStorage, audit.Bot(driver.ChatId))
 			if err != nil {
 				return driver, fmt.Errorf("ERR: pausing day's session: %v\n", err)
 			}
+
+			// the last driver of a double manned truck to end the day splits its kilometrage with the team
+			team, err := db.SplitTeamKilometrage(globalStorage, session.ID, audit.Bot(driver.ChatId))
+			if err != nil {
+				errlog.ERR.Printf("ERR: splitting the team kilometrage of session %d: %v\n", session.ID, err)
+			}
+			teamText := ""
+			for _, share := range team {
+				if share.SessionId == session.ID {
+					session.KilometrageAccumulated = share.Kilometrage
+				}
+				name := share.DriverId
+				if teammate, err := db.GetDriverById(globalStorage, uuid.FromStringOrNil(share.DriverId)); err == nil {
+					name = teammate.User.Name
+				}
+				teamText += config.Translate(config.GetLang(msg.Chat.ID), "team:km_share", name, share.Drivetime.Format(duration.ForPresentation), db.FormatKilometrage(share.Kilometrage))
+			}
 			finishMsg := tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("%s\nІнформація по дню:\n\nПочаток зміни: %s\nКінець зміни: %s\nПочатковий кілометраж: %s\nКінцевий кілометраж: %s\nЗагальна дистанція: %s\n\nТривалість:\nПраці (Work) - %s годин\nВодіння (Drive) - %s годин\nПаузи (Pause) - %s годин\n\nДякуємо за вашу працю, гарного дня!",
 				time.Now().In(config.WarsawLoc).Format("02/01/2006"),
 				session.Started.Format("15:04"),
@@ -2773,6 +3297,14 @@ func HandleDriverInputState(driver *db.Driver, msg *tgbotapi.Message, globalStor
 				return driver, err
 			}
 
+			if teamText != "" {
+				teamMsg := tgbotapi.NewMessage(msg.Chat.ID, config.Translate(config.GetLang(msg.Chat.ID), "team:km_split")+teamText)
+				teamMsg.ParseMode = tgbotapi.ModeHTML
+				if _, err = Bot.Send(teamMsg); err != nil {
+					return driver, err
+				}
+			}
+
 			return driver, err
 		}
 
@@ -2847,7 +3379,7 @@ func HandleSACommands(chatId int64, fromId int64, command string, messageId int,
 	cmd, _idString, _ := strings.Cut(a, ":")
 	switch cmd {
 	case "switch_to_manager":
-		err = u.ToggleSuperAdminRole(globalStorage)
+		err = u.ToggleSuperAdminRole(globalStorage, audit.Bot(fromId))
 		if err != nil {
 			errlog.ERR.Printf("ERR: toggling switch for sa: %v\n", err)
 			return fmt.Errorf("ERR: toggling switch for sa: %v\n", err)
@@ -2855,7 +3387,7 @@ func HandleSACommands(chatId int64, fromId int64, command string, messageId int,
 
 		return HandleMenu(chatId, globalStorage, u)
 	case "switch_to_driver":
-		err = u.ToggleSuperAdminRole(globalStorage)
+		err = u.ToggleSuperAdminRole(globalStorage, audit.Bot(fromId))
 		if err != nil {
 			errlog.ERR.Printf("ERR: toggling switch for sa: %v\n", err)
 			return fmt.Errorf("ERR: toggling switch for sa: %v\n", err)
@@ -2939,7 +3471,7 @@ func HandleSACommands(chatId int64, fromId int64, command string, messageId int,
 			return fmt.Errorf("ERR: getting driver by chat id: %v\n", err)
 		}
 
-		err = d.UpdateCarId(globalStorage, carId)
+		err = d.UpdateCarId(globalStorage, carId, audit.Bot(fromId))
 		if err != nil {
 			errlog.ERR.Printf("ERR: updating car id: %v\n", err)
 			return fmt.Errorf("ERR: updating car id: %v\n", err)
@@ -3050,6 +3582,10 @@ func HandleSACommands(chatId int64, fromId int64, command string, messageId int,
 				errlog.ERR.Printf("ERR: deleting declined driver: %v\n", err)
 				return fmt.Errorf("ERR: deleting declined driver: %v\n", err)
 			}
+			err = audit.Deleted(tx, audit.Bot(fromId), audit.Target{Entity: audit.EntityDriver, Id: u.DriverId.String(), DriverId: u.DriverId.String()}, declinedChatId)
+			if err != nil {
+				return err
+			}
 
 			driverSessionsMu.Lock()
 			delete(driverSessions, declinedChatId)
@@ -3060,6 +3596,10 @@ func HandleSACommands(chatId int64, fromId int64, command string, messageId int,
 				errlog.ERR.Printf("ERR: deleting declined manager: %v\n", err)
 				return fmt.Errorf("ERR: deleting declined manager: %v\n", err)
 			}
+			err = audit.Deleted(tx, audit.Bot(fromId), audit.Target{Entity: audit.EntityManager, Id: u.ManagerId.String()}, declinedChatId)
+			if err != nil {
+				return err
+			}
 
 			managerSessionsMu.Lock()
 			delete(managerSessions, declinedChatId)
@@ -3071,6 +3611,9 @@ func HandleSACommands(chatId int64, fromId int64, command string, messageId int,
 			errlog.ERR.Printf("ERR: deleting declined user: %v\n", err)
 			return fmt.Errorf("ERR: deleting declined user: %v\n", err)
 		}
+		if err = audit.Deleted(tx, audit.Bot(fromId), audit.Target{Entity: audit.EntityUser, Id: u.Id.String()}, declinedChatId); err != nil {
+			return err
+		}
 
 		Bot.Send(tgbotapi.NewMessage(chatId, config.Translate(
 			config.GetLang(chatId),
@@ -3103,7 +3646,7 @@ func HandleSACommands(chatId int64, fromId int64, command string, messageId int,
 			return fmt.Errorf("ERR: getting driver by id: %v\n", err)
 		}
 
-		err = driver.UpdateCarId(globalStorage, carId)
+		err = driver.UpdateCarId(globalStorage, carId, audit.Bot(fromId))
 		if err != nil {
 			errlog.ERR.Printf("ERR: updating car id: %v\n", err)
 			return fmt.Errorf("ERR: updating car id: %v\n", err)
@@ -3153,7 +3696,80 @@ func HandleDevCommands(chatId int64, command string, messageId int, globalStorag
 		return fmt.Errorf("not a dev session, use /dev:init first")
 	}
 
+	cmd, args, _ := strings.Cut(cmd, ":")
+
 	switch cmd {
+	case "reparse":
+		_, err := Bot.Send(tgbotapi.NewMessage(devSesh.ChatId, "Reparsing all stored shipment documents, it can take a while..."))
+		if err != nil {
+			return err
+		}
+		return SendReparseOverview(devSesh.ChatId, globalStorage)
+	case "reparse_show":
+		shipmentId, err := strconv.ParseInt(args, 10, 64)
+		if err != nil {
+			return fmt.Errorf("ERR: wrong shipment id in %s: %v", command, err)
+		}
+		return SendReparseDiff(devSesh.ChatId, 0, shipmentId, globalStorage)
+	case "reparse_apply":
+		// shipmentId:taskId:field
+		parts := strings.SplitN(args, ":", 3)
+		if len(parts) != 3 {
+			return fmt.Errorf("ERR: wrong format of %s, should be dev:reparse_apply:<shipment>:<task>:<field>", command)
+		}
+		shipmentId, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("ERR: wrong shipment id in %s: %v", command, err)
+		}
+		taskId, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return fmt.Errorf("ERR: wrong task id in %s: %v", command, err)
+		}
+
+		_, err = parser.ApplyReparseDiff(globalStorage, shipmentId, taskId, parts[2], audit.Dev(chatId))
+		if err != nil && !errors.Is(err, parser.ErrNoDiff) {
+			Bot.Send(tgbotapi.NewMessage(devSesh.ChatId, err.Error()))
+			return err
+		}
+		return SendReparseDiff(devSesh.ChatId, messageId, shipmentId, globalStorage)
+	case "reparse_applyall":
+		shipmentId, err := strconv.ParseInt(args, 10, 64)
+		if err != nil {
+			return fmt.Errorf("ERR: wrong shipment id in %s: %v", command, err)
+		}
+		if _, err = parser.ApplyAllReparseDiffs(globalStorage, shipmentId, audit.Dev(chatId)); err != nil {
+			Bot.Send(tgbotapi.NewMessage(devSesh.ChatId, err.Error()))
+			return err
+		}
+		return SendReparseDiff(devSesh.ChatId, messageId, shipmentId, globalStorage)
+	// the keywords, import mappings, free times and proof of delivery rules, "reloadkeywords" is the button of the dev menus
+	// sent before it reloaded more than the keywords
+	case "reloadconfig", "reloadkeywords":
+		languages, err := parser.LoadKeywords(config.GetKeywordsPath())
+		if err != nil {
+			Bot.Send(tgbotapi.NewMessage(devSesh.ChatId, fmt.Sprintf("Keywords are NOT reloaded, the parser keeps the previous ones:\n\n%v", err)))
+			return err
+		}
+
+		senders, err := parser.LoadImportMappings(config.GetImportMappingsPath())
+		if err != nil {
+			Bot.Send(tgbotapi.NewMessage(devSesh.ChatId, fmt.Sprintf("Keywords are reloaded, but the import mappings are NOT, the previous ones stay:\n\n%v", err)))
+			return err
+		}
+
+		if err = parser.LoadFreeTimes(config.GetFreeTimesPath()); err != nil {
+			Bot.Send(tgbotapi.NewMessage(devSesh.ChatId, fmt.Sprintf("Keywords and import mappings are reloaded, but the free times are NOT, the previous ones stay:\n\n%v", err)))
+			return err
+		}
+		if err = parser.LoadPODRules(config.GetPODRulesPath()); err != nil {
+			Bot.Send(tgbotapi.NewMessage(devSesh.ChatId, fmt.Sprintf("Keywords, import mappings and free times are reloaded, but the proof of delivery rules are NOT, the previous ones stay:\n\n%v", err)))
+			return err
+		}
+
+		msg := tgbotapi.NewMessage(devSesh.ChatId, fmt.Sprintf("Reloaded keywords from %s: %v\nReloaded import mappings from %s: %v\nReloaded free times from %s\nReloaded proof of delivery rules from %s\nUse \"reparse docs\" to see what it changes for the stored shipments",
+			config.GetKeywordsPath(), languages, config.GetImportMappingsPath(), senders, config.GetFreeTimesPath(), config.GetPODRulesPath()))
+		_, err = Bot.Send(msg)
+		return err
 	case "updatecleaningstations":
 		devSesh.State = db.StateWaitingForCleaningCSV
 
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"logistictbot/audit"
 	"logistictbot/config"
 	"logistictbot/db"
 	"logistictbot/errlog"
@@ -68,7 +69,7 @@ func storeRefuel(f db.Form, storage *sql.DB, bot *tgbotapi.BotAPI, driverSesh *d
 		CarId:              driverSesh.CarId,
 	}
 
-	if err := refuel.StoreTankRefuel(storage); err != nil {
+	if err := refuel.StoreTankRefuel(storage, audit.Bot(driverSesh.ChatId)); err != nil {
 		errlog.ERR.Printf("ERR: storing refuel: %v", err)
 		return fmt.Errorf("ERR: storing refuel: %v", err)
 	}
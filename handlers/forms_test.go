@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"logistictbot/config"
 	"logistictbot/parser"
 	"strings"
 	"testing"
@@ -18,7 +19,7 @@ func TestReadDoc(t *testing.T) {
 		t.Fatalf("shipment id should be 4359172, but it is: %d", shipment.Id)
 	}
 
-	res, secRes := parser.ReadDoc(shipment)
+	res, secRes := parser.ReadDoc(shipment, config.Ukrainian, config.WarsawLoc)
 	t.Log(res)
 
 	for k, v := range secRes {
@@ -8,6 +8,7 @@ import (
 	"log"
 	"logistictbot/config"
 	data_analysis "logistictbot/data-analysis"
+	"logistictbot/db"
 	"logistictbot/docs"
 	"logistictbot/errlog"
 	"logistictbot/tracking"
@@ -92,7 +93,7 @@ func HandleUpdate(update tgbotapi.Update, globalStorage *sql.DB) error {
 			results = append(results, tgbotapi.NewInlineQueryResultArticle(
 				fmt.Sprintf("%d", cs.Id),
 				cs.Name,
-				cs.Name+", "+cs.Address,
+				cs.InlineText(),
 			))
 		}
 
@@ -152,6 +153,8 @@ func HandleMessage(msg *tgbotapi.Message, globalStorage *sql.DB) (err error) {
 		driverSesh, err = HandleDriverInputState(driverSesh, msg, globalStorage)
 	}
 
+	// a csv sent as a transport order is not the list of cleaning stations, even if the manager is a dev too
+	managerTookDoc := isManagerSesh && managerSesh.State == db.StateWaitingDoc
 	if isManagerSesh {
 		managerSesh, err = HandleManagerInputState(managerSesh, msg, globalStorage)
 	}
@@ -162,7 +165,7 @@ func HandleMessage(msg *tgbotapi.Message, globalStorage *sql.DB) (err error) {
 
 	if isDev {
 		switch {
-		case msg.Document != nil && msg.Document.MimeType == string(docs.MimeTextCSV):
+		case msg.Document != nil && msg.Document.MimeType == string(docs.MimeTextCSV) && !managerTookDoc:
 			err = HandleCleaningDevCSV(devSesh.ChatId, msg.Document, globalStorage)
 			return err
 		}
@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"logistictbot/audit"
+	"logistictbot/config"
+	"logistictbot/db"
+	"logistictbot/delq"
+	"logistictbot/errlog"
+	"logistictbot/parser"
+	"slices"
+
+	tgbotapi "github.com/appleofeden110/telegram-bot-api/v5"
+	"github.com/gofrs/uuid"
+)
+
+// handOverButtons are the hand over and cancel buttons of the shipment details, for the shipments that are still driven
+func handOverButtons(s *parser.Shipment, lang config.LangCode) [][]tgbotapi.InlineKeyboardButton {
+	if s.IsClosed() {
+		return nil
+	}
+	return [][]tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(config.Translate(lang, "btn:handover"), fmt.Sprintf("manager:handover:%d", s.Id))),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(config.Translate(lang, "btn:cancel_shipment"), fmt.Sprintf("manager:cancelship:%d", s.Id))),
+	}
+}
+
+func driverGroupOfCar(carId string, globalStorage *sql.DB) (*db.DriverGroup, error) {
+	car, err := db.GetCarById(globalStorage, carId)
+	if err != nil {
+		return nil, fmt.Errorf("ERR: getting car %s: %v", carId, err)
+	}
+	g := &db.DriverGroup{CurrentCar: car}
+	if err = g.GetDriverGroupByCar(globalStorage); err != nil {
+		return nil, fmt.Errorf("ERR: getting driver group of car %s: %v", carId, err)
+	}
+	return g, nil
+}
+
+// HandOverShipment gives what is left of the shipment to the driver of driverChatId and his truck.
+// The old group is told and its messages waiting for the shipment are cleaned up, the new one gets the shipment
+func HandOverShipment(chatId, fromId int64, topicId int, shipmentId, driverChatId int64, globalStorage *sql.DB) error {
+	lang := config.GetLang(chatId)
+
+	shipment, err := parser.GetShipment(globalStorage, shipmentId)
+	if err != nil {
+		errlog.ERR.Printf("ERR: getting shipment %d to hand over: %v\n", shipmentId, err)
+		return fmt.Errorf("ERR: getting shipment %d to hand over: %v\n", shipmentId, err)
+	}
+
+	newDriver, err := db.GetDriverByChatId(globalStorage, driverChatId)
+	if err != nil {
+		errlog.ERR.Printf("ERR: getting driver %d to hand over to: %v\n", driverChatId, err)
+		return fmt.Errorf("ERR: getting driver %d to hand over to: %v\n", driverChatId, err)
+	}
+
+	if newDriver.Id == shipment.DriverId && newDriver.CarId == shipment.CarId {
+		_, err = Bot.Send(tgbotapi.NewMessage(chatId, config.Translate(lang, "handover:same_driver", shipment.Id), topicId))
+		return err
+	}
+
+	newGroup, err := driverGroupOfCar(newDriver.CarId, globalStorage)
+	if err != nil {
+		errlog.ERR.Printf("ERR: getting the group to hand over shipment %d to: %v\n", shipment.Id, err)
+		_, err = Bot.Send(tgbotapi.NewMessage(chatId, config.Translate(lang, "handover:no_group", newDriver.CarId), topicId))
+		return err
+	}
+
+	oldDriverId, oldCarId := shipment.DriverId, shipment.CarId
+	// the co-drivers go with the handover too, any of them could be in the middle of a task
+	oldDrivers := shipment.Drivers()
+	moved := shipment.UnfinishedTasks()
+	movedIds := make([]int, 0, len(moved))
+	for _, t := range moved {
+		movedIds = append(movedIds, t.Id)
+	}
+
+	err = shipment.HandOver(globalStorage, newDriver.Id, newDriver.CarId, audit.Bot(fromId))
+	if err != nil {
+		switch {
+		case errors.Is(err, parser.ErrNothingToHandOver):
+			_, err = Bot.Send(tgbotapi.NewMessage(chatId, config.Translate(lang, "handover:nothing_left", shipment.Id), topicId))
+			return err
+		case errors.Is(err, parser.ErrStatusTransition):
+			_, err = Bot.Send(tgbotapi.NewMessage(chatId, config.Translate(lang, "handover:closed", shipment.Id, shipment.Status.Title(lang)), topicId))
+			return err
+		}
+		return err
+	}
+
+	if shipment.Status == parser.StatusDraft {
+		if err = shipment.SetStatus(globalStorage, parser.StatusAssigned, audit.Bot(fromId), "handover"); err != nil {
+			errlog.ERR.Printf("ERR: assigning the draft shipment %d: %v\n", shipment.Id, err)
+		}
+	}
+
+	releaseShipment(shipment.Id, oldDrivers, oldCarId, movedIds, globalStorage)
+
+	if oldGroup, err := driverGroupOfCar(oldCarId, globalStorage); err == nil && !oldDriverId.IsNil() {
+		text := config.Translate(config.GetLang(oldGroup.GroupChatId), "handover:taken_away", shipment.Id, newDriver.User.Name, newDriver.CarId)
+		if _, err = Bot.Send(tgbotapi.NewMessage(oldGroup.GroupChatId, text, oldGroup.LoadingTopicId)); err != nil {
+			errlog.ERR.Printf("ERR: telling the old group about the handover of shipment %d: %v\n", shipment.Id, err)
+		}
+	}
+
+	if err = sendHandedOverShipment(shipment, newDriver, newGroup, moved); err != nil {
+		errlog.ERR.Printf("ERR: sending the handed over shipment %d: %v\n", shipment.Id, err)
+		return fmt.Errorf("ERR: sending the handed over shipment %d: %v\n", shipment.Id, err)
+	}
+
+	_, err = Bot.Send(tgbotapi.NewMessage(chatId, config.Translate(lang, "handover:done", shipment.Id, newDriver.User.Name, newDriver.CarId, len(moved)), topicId))
+	return err
+}
+
+// sendHandedOverShipment gives the new group the shipment: to accept, if the old driver had not yet,
+// or the tasks that are left to start them right away
+func sendHandedOverShipment(shipment *parser.Shipment, driver *db.Driver, g *db.DriverGroup, tasks []*parser.TaskSection) error {
+	lang := config.GetLang(g.GroupChatId)
+
+	if shipment.Status == parser.StatusAssigned || shipment.Status == parser.StatusDraft {
+		markup := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(config.Translate(lang, "btn:shipment:start"), fmt.Sprintf("shipment:accept:%d", shipment.Id)),
+		))
+		msg := tgbotapi.NewMessage(g.GroupChatId, config.Translate(lang, "handover:to_accept", driver.User.TagPerson(), shipment.Id), g.LoadingTopicId)
+		msg.ParseMode = tgbotapi.ModeHTML
+		msg.ReplyMarkup = markup
+		_, err := Bot.Send(msg)
+		return err
+	}
+
+	msg := tgbotapi.NewMessage(g.GroupChatId, config.Translate(lang, "handover:to_continue", driver.User.TagPerson(), shipment.Id), g.LoadingTopicId)
+	markup := make([][]tgbotapi.InlineKeyboardButton, 0, len(tasks)+1)
+	markup = append(markup, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(config.Translate(lang, "btn:end_shipment"), fmt.Sprintf("shipment:end:%d", shipment.Id))))
+	for _, task := range tasks {
+		msg.Text += config.Translate(lang, "shipment:task_header", parser.TaskTypeTitle(lang, task.Type))
+		msg.Text += parser.ReadTaskShort(task, lang, config.GetLoc(driver.ChatId))
+		markup = append(markup, taskStartRow(lang, task))
+	}
+	msg.ParseMode = tgbotapi.ModeHTML
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(markup...)
+
+	pinMsg, err := Bot.Send(msg)
+	if err != nil {
+		return err
+	}
+	_, err = Bot.Send(tgbotapi.PinChatMessageConfig{
+		ChatID:    pinMsg.Chat.ID,
+		MessageID: pinMsg.MessageID,
+	})
+	return err
+}
+
+// AskCancelShipment makes sure the manager did not press cancel by accident
+func AskCancelShipment(chatId int64, topicId int, shipmentId int64) error {
+	lang := config.GetLang(chatId)
+	msg := tgbotapi.NewMessage(chatId, config.Translate(lang, "cancel:confirm", shipmentId), topicId)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(config.Translate(lang, "btn:cancel_confirm"), fmt.Sprintf("manager:cancelship_yes:%d", shipmentId)),
+	))
+	_, err := Bot.Send(msg)
+	return err
+}
+
+// CancelShipment cancels the shipment for good, the driver's group is told and its messages waiting for the shipment are cleaned up. The tasks
+// finished before stay on the monthly statement
+func CancelShipment(chatId, fromId int64, topicId int, shipmentId int64, globalStorage *sql.DB) error {
+	lang := config.GetLang(chatId)
+
+	shipment, err := parser.GetShipment(globalStorage, shipmentId)
+	if err != nil {
+		errlog.ERR.Printf("ERR: getting shipment %d to cancel: %v\n", shipmentId, err)
+		return fmt.Errorf("ERR: getting shipment %d to cancel: %v\n", shipmentId, err)
+	}
+
+	from := shipment.Status
+	if err = shipment.SetStatus(globalStorage, parser.StatusCancelled, audit.Bot(fromId), ""); err != nil {
+		if errors.Is(err, parser.ErrStatusTransition) {
+			_, err = Bot.Send(tgbotapi.NewMessage(chatId, config.Translate(lang, "status:not_allowed", shipment.Id, from.Title(lang), parser.StatusCancelled.Title(lang)), topicId))
+			return err
+		}
+		return err
+	}
+
+	shipmentCancelled(shipment, globalStorage)
+
+	msg := tgbotapi.NewMessage(chatId, config.Translate(lang, "status:changed", shipment.Id, parser.StatusCancelled.Title(lang)), topicId)
+	msg.ParseMode = tgbotapi.ModeHTML
+	_, err = Bot.Send(msg)
+	return err
+}
+
+// shipmentCancelled is what follows the cancel of the shipment, by the bot or through the API: its drivers are released
+// and the group of the truck is told
+func shipmentCancelled(shipment *parser.Shipment, globalStorage *sql.DB) {
+	left := make([]int, 0)
+	for _, t := range shipment.UnfinishedTasks() {
+		left = append(left, t.Id)
+	}
+	releaseShipment(shipment.Id, shipment.Drivers(), shipment.CarId, left, globalStorage)
+
+	if g, err := driverGroupOfCar(shipment.CarId, globalStorage); err == nil {
+		if _, err = Bot.Send(tgbotapi.NewMessage(g.GroupChatId, config.Translate(config.GetLang(g.GroupChatId), "status:shipment_cancelled", shipment.Id), g.LoadingTopicId)); err != nil {
+			errlog.ERR.Printf("ERR: telling the group about the cancelled shipment %d: %v\n", shipment.Id, err)
+		}
+	}
+}
+
+// releaseShipment takes the tasks away from the drivers that had the shipment, the lead and the co-drivers: a task one of
+// them is in the middle of is stopped, and the messages in their chats waiting for the shipment or the tasks are deleted
+func releaseShipment(shipmentId int64, driverIds []uuid.UUID, carId string, taskIds []int, globalStorage *sql.DB) {
+	if g, err := driverGroupOfCar(carId, globalStorage); err == nil {
+		delq.ReleaseShipment(g.GroupChatId, shipmentId, taskIds)
+	}
+	for _, driverId := range driverIds {
+		releaseDriver(shipmentId, driverId, taskIds, globalStorage)
+	}
+}
+
+// releaseDriver is releaseShipment for one driver, a co-driver taken off the team is released the same way
+func releaseDriver(shipmentId int64, driverId uuid.UUID, taskIds []int, globalStorage *sql.DB) {
+	if driverId.IsNil() {
+		return
+	}
+
+	driver, err := db.GetDriverById(globalStorage, driverId)
+	if err != nil {
+		errlog.ERR.Printf("ERR: getting the driver %s to release shipment %d: %v\n", driverId, shipmentId, err)
+		return
+	}
+	delq.ReleaseShipment(driver.ChatId, shipmentId, taskIds)
+
+	driverSessionsMu.Lock()
+	if sesh, ok := driverSessions[driver.ChatId]; ok {
+		driver = sesh
+	}
+	if !slices.Contains(taskIds, driver.PerformedTaskId) {
+		driverSessionsMu.Unlock()
+		return
+	}
+	driver.State = db.StateWorking
+	driver.PerformedTaskId = 0
+	driverSessionsMu.Unlock()
+
+	taskSessionsMu.Lock()
+	delete(taskSessions, driver.Id)
+	taskSessionsMu.Unlock()
+
+	// both log their errors themselves
+	if err = driver.DeletePerformingTask(globalStorage); err == nil {
+		driver.ChangeDriverStatus(globalStorage)
+	}
+}
@@ -5,14 +5,54 @@ import (
 	"fmt"
 	"logistictbot/config"
 	"logistictbot/db"
+	"logistictbot/delq"
+	"logistictbot/errlog"
 	"logistictbot/parser"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	tgbotapi "github.com/appleofeden110/telegram-bot-api/v5"
 )
 
+const (
+	// messageLimit keeps a message under the 4096 characters telegram takes, with room for a header
+	messageLimit = 4000
+	// captionLimit is the same for the 1024 characters of a caption
+	captionLimit = 1000
+)
+
+// fitLines joins as many of the lines as fit into limit characters and says how many did not with the moreKey
+// ("…and %d more"). The lines are whole pieces of html, so a tag or an entity is never cut in half
+func fitLines(lines []string, limit int, lang config.LangCode, moreKey string) string {
+	more := utf8.RuneCountInString(config.Translate(lang, moreKey, len(lines)))
+
+	var text strings.Builder
+	size := 0
+	for i, line := range lines {
+		size += utf8.RuneCountInString(line)
+		// the last line does not need the room for the "more" after it
+		if size > limit || (i < len(lines)-1 && size+more > limit) {
+			text.WriteString(config.Translate(lang, moreKey, len(lines)-i))
+			break
+		}
+		text.WriteString(line)
+	}
+	return text.String()
+}
+
+// taskStartRow is the row of a task in the pinned shipment message: the driver says he is on the site, then starts the task.
+// The waiting on a cleaning station is not paid by anyone, so it has only the start
+func taskStartRow(lang config.LangCode, task *parser.TaskSection) []tgbotapi.InlineKeyboardButton {
+	id := strconv.Itoa(task.Id)
+	start := tgbotapi.NewInlineKeyboardButtonData(config.Translate(lang, "btn:start_task")+parser.TaskTypeTitle(lang, task.Type), "driver:begintask:"+id)
+	if task.Type == parser.TaskCleaning {
+		return tgbotapi.NewInlineKeyboardRow(start)
+	}
+	return tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(config.Translate(lang, "btn:arrived"), "driver:arrived:"+id), start)
+}
+
 func GenStartTaskMsg(chatId int64, task *parser.TaskSection, globalStorage *sql.DB) (tgbotapi.MessageConfig, error) {
 	var loadingTopicId int
 
@@ -66,7 +106,7 @@ func GenStartTaskMsg(chatId int64, task *parser.TaskSection, globalStorage *sql.
 
 		return startTaskMsg, nil
 	}
-	startTaskMsg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+	rows := [][]tgbotapi.InlineKeyboardButton{
 		tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData(config.Translate(config.GetLang(chatId), "btn:driver:endtask"), fmt.Sprintf("driver:endtask:%d", task.Id)),
 		),
@@ -76,7 +116,14 @@ func GenStartTaskMsg(chatId int64, task *parser.TaskSection, globalStorage *sql.
 		tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData(config.Translate(config.GetLang(chatId), "btn:driver:add_picstotask"), fmt.Sprintf("driver:add_picstotask:%d", task.Id)),
 		),
-	)
+	}
+	// the consignee signs the delivery on the phone of the driver
+	if task.Type == parser.TaskUnload || task.Type == parser.TaskDropoff {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(config.Translate(config.GetLang(chatId), "btn:driver:signature"), fmt.Sprintf("driver:signature:%d", task.Id)),
+		))
+	}
+	startTaskMsg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
 
 	return startTaskMsg, nil
 }
@@ -128,6 +175,26 @@ func GenEndTaskMessage(chatId int64, task *parser.TaskSection, globalStorage *sq
 		)
 	}
 
+	compartments, err := parser.GetTaskCompartments(globalStorage, task.Id)
+	if err != nil {
+		return tgbotapi.MessageConfig{}, err
+	}
+	for _, c := range compartments {
+		if c.Measured() {
+			endMsg.Text += config.Translate(config.GetLang(chatId), "endmsg:compartment", c.Number, c.Product, *c.ActualWeight, *c.ActualTemperature)
+		}
+	}
+
+	if task.Type == parser.TaskCleaning {
+		cleaning, err := parser.GetCleaningRecord(globalStorage, task.Id)
+		if err != nil {
+			return tgbotapi.MessageConfig{}, err
+		}
+		if cleaning.Id != 0 {
+			endMsg.Text += cleaningSummary(config.GetLang(chatId), task, cleaning)
+		}
+	}
+
 	endMsg.ParseMode = tgbotapi.ModeHTML
 	endMsg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
@@ -137,3 +204,54 @@ func GenEndTaskMessage(chatId int64, task *parser.TaskSection, globalStorage *sq
 
 	return endMsg, nil
 }
+
+const (
+	// share of the declared weight the scale may differ by
+	declaredWeightTolerance = 0.05
+	declaredTempTolerance   = 3.0
+)
+
+// warnDeclaredMismatch tells the driver that the entered value does not fit what the document declares. It does not stop the task,
+// the weighbridge can be right and the document wrong, but this way a typo is noticed before the statement is made
+func warnDeclaredMismatch(chatId int64, topicId int, taskId int, key string, declared parser.Quantity, measured, tolerance float64, globalStorage *sql.DB) {
+	if declared.IsZero() || measured == 0 || declared.Allows(measured, tolerance) {
+		return
+	}
+
+	sent, err := Bot.Send(tgbotapi.NewMessage(chatId, config.Translate(config.GetLang(chatId), key, declared.String()), topicId))
+	if err != nil {
+		errlog.ERR.Printf("ERR: sending declared %s warning: %v\n", key, err)
+		return
+	}
+	delq.EnqueueToDelete(globalStorage, sent.Chat.ID, sent.MessageID, delq.Requirements{
+		Type:          delq.TaskFinished,
+		TrackedTaskId: taskId,
+	})
+}
+
+// compartmentPrompt asks the driver for the weight or the temperature of the compartment, with what the document declares for it
+func compartmentPrompt(chatId int64, key string, c *parser.TaskCompartment) string {
+	declared := c.Weight
+	if key == "driver:compartment_temp" {
+		declared = c.Temperature
+	}
+	product := c.Product
+	if product == "" {
+		product = "—"
+	}
+	if declared == "" {
+		declared = "—"
+	}
+	return config.Translate(config.GetLang(chatId), key, c.Number, product, declared)
+}
+
+// timezoneChoices are offered by /timezone, the drivers and managers are in these ones most of the time
+var timezoneChoices = []struct {
+	label string
+	name  string
+}{
+	{"🇵🇱 Warszawa (CET)", "Europe/Warsaw"},
+	{"🇺🇦 Київ (EET)", "Europe/Kyiv"},
+	{"🇬🇧 London (GMT)", "Europe/London"},
+	{"🇵🇹 Lisboa (WET)", "Europe/Lisbon"},
+}
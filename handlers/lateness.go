@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"log"
+	"logistictbot/audit"
+	"logistictbot/config"
+	"logistictbot/db"
+	"logistictbot/duration"
+	"logistictbot/errlog"
+	"logistictbot/parser"
+	"time"
+
+	tgbotapi "github.com/appleofeden110/telegram-bot-api/v5"
+)
+
+const (
+	windowTickRate = 5 * time.Minute
+	// windowAlertLead is how long before the window closes the managers are told the task is not started
+	windowAlertLead = time.Hour
+	// finishedAlertWithin keeps the tasks finished long ago quiet, their punctuality is only recorded.
+	// They are the tasks of before the monitor, and the old ones the editor changed the times of
+	finishedAlertWithin = 24 * time.Hour
+)
+
+// MonitorTimeWindows compares the tasks with their windows: the managers of the group are told about the windows that
+// are closing on the tasks not started yet, and about the tasks finished out of their window. The punctuality of every
+// finished task is recorded for the reports
+func MonitorTimeWindows(globalStorage *sql.DB) {
+	ticker := time.NewTicker(windowTickRate)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		alertClosingWindows(globalStorage)
+		rateFinishedTasks(globalStorage)
+	}
+}
+
+func alertClosingWindows(globalStorage *sql.DB) {
+	tasks, err := parser.ClosingWindows(globalStorage, time.Now(), windowAlertLead)
+	if err != nil {
+		log.Printf("ERR: getting the closing windows: %v\n", err)
+		return
+	}
+
+	for _, t := range tasks {
+		_, end := t.Window()
+		err = alertManagersOfCar(t.CarId, globalStorage, func(lang config.LangCode, loc *time.Location) string {
+			return config.Translate(lang, "window:closing",
+				parser.TaskTypeTitle(lang, t.Type), t.ShipmentId, html.EscapeString(t.Address), end.In(loc).Format("02.01 15:04"))
+		})
+		if err != nil {
+			log.Printf("ERR: alerting the closing window of task %d: %v\n", t.Id, err)
+			continue
+		}
+		parser.MarkWindowAlerted(globalStorage, t.Id)
+	}
+}
+
+func rateFinishedTasks(globalStorage *sql.DB) {
+	tasks, err := parser.UnratedTasks(globalStorage)
+	if err != nil {
+		log.Printf("ERR: getting the tasks to record the punctuality of: %v\n", err)
+		return
+	}
+
+	for _, t := range tasks {
+		if err = t.RecordPunctuality(globalStorage, audit.System); err != nil {
+			continue
+		}
+		// nothing is recorded when the window can not be read, there is nothing to tell the managers then
+		if t.Punctuality == "" || t.Punctuality == parser.PunctualityOnTime || time.Since(t.End) > finishedAlertWithin {
+			continue
+		}
+
+		start, end := t.Window()
+		key, edge := "window:finished_late", end
+		if t.Punctuality == parser.PunctualityEarly {
+			key, edge = "window:finished_early", start
+		}
+		off := t.OutOfWindow()
+		err = alertManagersOfCar(t.CarId, globalStorage, func(lang config.LangCode, loc *time.Location) string {
+			return config.Translate(lang, key,
+				parser.TaskTypeTitle(lang, t.Type), t.ShipmentId, html.EscapeString(t.Address),
+				off.Format(duration.ForPresentation), edge.In(loc).Format("02.01 15:04"))
+		})
+		if err != nil {
+			log.Printf("ERR: alerting the punctuality of task %d: %v\n", t.Id, err)
+		}
+	}
+}
+
+// alertManagersOfCar tags the managers of the group of the car in its loading topic, the way the washing requests do
+func alertManagersOfCar(carId string, globalStorage *sql.DB, text func(lang config.LangCode, loc *time.Location) string) error {
+	g, err := driverGroupOfCar(carId, globalStorage)
+	if err != nil {
+		return err
+	}
+
+	users, err := db.GetAllUsers(globalStorage)
+	if err != nil {
+		return err
+	}
+	managers, err := GetAllManagersOfGroup(g.GroupChatId, users)
+	if err != nil {
+		errlog.ERR.Printf("ERR: getting all managers of a group: %v\n", err)
+		return fmt.Errorf("ERR: getting all managers of a group: %v\n", err)
+	}
+
+	var managerList string
+	for _, m := range managers {
+		managerList += fmt.Sprintf("@%s ", m.TgTag)
+	}
+
+	msg := tgbotapi.NewMessage(g.GroupChatId, managerList+text(config.GetLang(g.GroupChatId), config.GetLoc(g.GroupChatId)), g.LoadingTopicId)
+	msg.ParseMode = tgbotapi.ModeHTML
+	_, err = Bot.Send(msg)
+	return err
+}
@@ -10,6 +10,8 @@ var (
 	devInitMessage = "What would you like to do?"
 	devInit        = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
 		tgbotapi.NewInlineKeyboardButtonData("update cleaning stations", "dev:updatecleaningstations"),
+		tgbotapi.NewInlineKeyboardButtonData("reparse docs", "dev:reparse"),
+		tgbotapi.NewInlineKeyboardButtonData("reload config", "dev:reloadconfig"),
 		tgbotapi.NewInlineKeyboardButtonData("finish dev sesh", "dev:finish"),
 	))
 
@@ -78,6 +80,9 @@ func SuperAdminMarkupManager(lang config.LangCode) tgbotapi.InlineKeyboardMarkup
 		tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData(config.Translate(config.LangCode(lang), "btn:refuel_report"), "manager:mrefuel"),
 		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(config.Translate(lang, "btn:pod_report"), "manager:podreport"),
+		),
 		// tgbotapi.NewInlineKeyboardRow(
 		// 	tgbotapi.NewInlineKeyboardButtonData(config.Translate(config.LangCode(lang), "btn:write_driver"), "manager:sendmessage"),
 		// ),
@@ -135,6 +140,9 @@ func ManagerStartMarkup(lang config.LangCode) tgbotapi.InlineKeyboardMarkup {
 		tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData(config.Translate(config.LangCode(lang), "btn:refuel_report"), "manager:mrefuel"),
 		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(config.Translate(lang, "btn:pod_report"), "manager:podreport"),
+		),
 		// tgbotapi.NewInlineKeyboardRow(
 		// 	tgbotapi.NewInlineKeyboardButtonData(config.Translate(config.LangCode(lang), "btn:write_driver"), "manager:sendmessage"),
 		// ),
@@ -11,6 +11,7 @@ import (
 	"logistictbot/parser"
 	"logistictbot/tracking"
 	"sync"
+	"time"
 
 	tgbotapi "github.com/appleofeden110/telegram-bot-api/v5"
 	"github.com/gofrs/uuid"
@@ -120,6 +121,20 @@ func FillSessions(globalStorage *sql.DB) error {
 
 	log.Printf("Manager sessions are filled (len: %d)\n", len(managerSessions))
 
+	timezones, err := db.GetUsersTimezones(globalStorage)
+	if err != nil {
+		errlog.ERR.Printf("ERR: getting the timezones of the users: %v\n", err)
+		return fmt.Errorf("ERR: getting the timezones of the users: %v\n", err)
+	}
+	for chatId, timezone := range timezones {
+		loc, err := time.LoadLocation(timezone)
+		if err != nil {
+			errlog.WARN.Printf("unknown timezone %q of chat %d, using Warsaw: %v\n", timezone, chatId, err)
+			continue
+		}
+		config.SetChatLoc(chatId, loc)
+	}
+
 	comms, err := GetAllNonRepliedMessages(globalStorage)
 	if err != nil {
 		errlog.ERR.Printf("ERR: getting all non replied messages: %v\n", err)
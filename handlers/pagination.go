@@ -38,17 +38,10 @@ const (
 //}
 
 func FormatShipmentForList(s *parser.Shipment, index int, lang config.LangCode) string {
-	status := config.Translate(lang, "shipment_notstarted")
-	if !s.Started.IsZero() && s.Finished.IsZero() {
-		status = config.Translate(lang, "shipment_active")
-	} else if !s.Finished.IsZero() {
-		status = config.Translate(lang, "shipment_done")
-	}
-
 	return config.Translate(lang,
 		"shipment_format",
 		index+1, s.Id,
-		status,
+		s.Status.Title(lang),
 		s.CarId,
 		s.Container,
 		len(s.Tasks),
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"logistictbot/config"
+	"logistictbot/db"
+	"logistictbot/delq"
+	"logistictbot/errlog"
+	"logistictbot/parser"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	tgbotapi "github.com/appleofeden110/telegram-bot-api/v5"
+)
+
+// podReportDays is how far back the report of the incomplete proof of delivery looks
+const podReportDays = 30
+
+// missingPOD is what the task still needs, like "1 document, 2 photos"
+func missingPOD(lang config.LangCode, status parser.PODStatus) string {
+	parts := make([]string, 0, 2)
+	if n := status.MissingDocuments(); n > 0 {
+		parts = append(parts, config.Translate(lang, "pod:documents", n))
+	}
+	if n := status.MissingPhotos(); n > 0 {
+		parts = append(parts, config.Translate(lang, "pod:photos", n))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// checkPOD is checked when the driver ends the task: without the files the rule of the task asks for, he is told what
+// to attach and ok is false. With an escalating rule the task goes on and the managers of the group are told instead
+func checkPOD(chatId int64, topicId int, driver *db.Driver, task *parser.TaskSection, globalStorage *sql.DB) (ok bool, err error) {
+	status, found, err := task.CheckPOD(globalStorage)
+	if err != nil {
+		return false, err
+	}
+	if !found || status.Complete() {
+		return true, nil
+	}
+
+	if status.Rule.OnMissing == parser.PODEscalate {
+		err = alertManagersOfCar(driver.CarId, globalStorage, func(lang config.LangCode, loc *time.Location) string {
+			return config.Translate(lang, "pod:escalated", html.EscapeString(driver.User.Name),
+				parser.TaskTypeTitle(lang, task.Type), task.ShipmentId, html.EscapeString(task.Address), missingPOD(lang, status))
+		})
+		if err != nil {
+			// the managers not being told should not stop the driver
+			errlog.ERR.Printf("ERR: telling the managers about the proof of delivery of task %d: %v\n", task.Id, err)
+		}
+		return true, nil
+	}
+
+	lang := config.GetLang(chatId)
+	msg := tgbotapi.NewMessage(chatId, config.Translate(lang, "pod:missing", parser.TaskTypeTitle(lang, task.Type), missingPOD(lang, status)), topicId)
+	msg.ParseMode = tgbotapi.ModeHTML
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(config.Translate(lang, "btn:driver:add_docstotask"), fmt.Sprintf("driver:add_doctotask:%d", task.Id)),
+			tgbotapi.NewInlineKeyboardButtonData(config.Translate(lang, "btn:driver:add_picstotask"), fmt.Sprintf("driver:add_picstotask:%d", task.Id)),
+		),
+	)
+	sent, err := Bot.Send(msg)
+	if err != nil {
+		return false, err
+	}
+	delq.EnqueueToDelete(globalStorage, sent.Chat.ID, sent.MessageID, delq.Requirements{
+		Type:          delq.TaskFinished,
+		TrackedTaskId: task.Id,
+	})
+	return false, nil
+}
+
+// SendPODReport shows the managers the finished tasks of the last podReportDays whose proof of delivery is not complete
+func SendPODReport(chatId int64, topicId int, globalStorage *sql.DB) error {
+	incomplete, err := parser.IncompletePODs(globalStorage, time.Now().AddDate(0, 0, -podReportDays))
+	if err != nil {
+		return err
+	}
+
+	lang := config.GetLang(chatId)
+	loc := config.GetLoc(chatId)
+	text := config.Translate(lang, "pod:report_header", podReportDays)
+	if len(incomplete) == 0 {
+		text += config.Translate(lang, "pod:report_empty")
+	}
+
+	lines := make([]string, 0, len(incomplete))
+	for _, p := range incomplete {
+		lines = append(lines, config.Translate(lang, "pod:report_line", p.Task.ShipmentId, html.EscapeString(p.Task.CarId),
+			parser.TaskTypeTitle(lang, p.Task.Type), html.EscapeString(p.Task.Address), p.Task.End.In(loc).Format("02.01 15:04"), missingPOD(lang, p.Status)))
+	}
+	// as many tasks as fit in one message, the rest are only counted
+	text += fitLines(lines, messageLimit-utf8.RuneCountInString(text), lang, "pod:report_more")
+
+	msg := tgbotapi.NewMessage(chatId, text, topicId)
+	msg.ParseMode = tgbotapi.ModeHTML
+	_, err = Bot.Send(msg)
+	return err
+}
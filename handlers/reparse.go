@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"logistictbot/config"
+	"logistictbot/parser"
+	"strings"
+	"unicode/utf8"
+
+	tgbotapi "github.com/appleofeden110/telegram-bot-api/v5"
+)
+
+const (
+	reparseMaxShipments = 40
+	reparseMaxValue     = 200
+)
+
+func shortReparseValue(s string) string {
+	if s == "" {
+		return "∅"
+	}
+	if runes := []rune(s); len(runes) > reparseMaxValue {
+		s = string(runes[:reparseMaxValue]) + "…"
+	}
+	return html.EscapeString(html.UnescapeString(s))
+}
+
+func reparseFieldTitle(d parser.FieldDiff) string {
+	if d.TaskId == 0 {
+		return "shipment / " + d.Field
+	}
+	return strings.ToUpper(d.TaskType) + " / " + d.Field
+}
+
+// SendReparseOverview parses every stored document again and lists the shipments that would change
+func SendReparseOverview(chatId int64, globalStorage *sql.DB) error {
+	ids, err := parser.GetReparsableShipmentIds(globalStorage)
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0)
+	changed, failed := 0, 0
+	var failures strings.Builder
+
+	for _, id := range ids {
+		result, err := parser.ReparseShipment(globalStorage, id)
+		if err != nil {
+			failed++
+			if failed <= 10 {
+				failures.WriteString(fmt.Sprintf("• %d: %s\n", id, html.EscapeString(err.Error())))
+			}
+			continue
+		}
+		if !result.HasChanges() {
+			continue
+		}
+
+		changed++
+		if changed <= reparseMaxShipments {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+				fmt.Sprintf("%d: %d fields, +%d/-%d tasks", id, len(result.Diffs), len(result.NewTasks), len(result.MissingTasks)),
+				fmt.Sprintf("dev:reparse_show:%d", id),
+			)))
+		}
+	}
+
+	text := fmt.Sprintf("Reparsed <b>%d</b> shipments with documents.\nWould change: <b>%d</b>, could not parse: <b>%d</b>\n", len(ids), changed, failed)
+	if changed > reparseMaxShipments {
+		text += fmt.Sprintf("Only the first %d are listed\n", reparseMaxShipments)
+	}
+	if failures.Len() > 0 {
+		text += "\n" + failures.String()
+	}
+
+	msg := tgbotapi.NewMessage(chatId, text)
+	msg.ParseMode = tgbotapi.ModeHTML
+	if len(rows) > 0 {
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	}
+	_, err = Bot.Send(msg)
+	return err
+}
+
+func formatReparseResult(result *parser.ReparseResult) (string, tgbotapi.InlineKeyboardMarkup) {
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0)
+
+	header := fmt.Sprintf("<b>Shipment %d</b> (document %d)\n\n", result.ShipmentId, result.DocId)
+	if !result.HasChanges() {
+		return header + "The current parser reads the document the same way as it is stored ✅", tgbotapi.InlineKeyboardMarkup{InlineKeyboard: rows}
+	}
+
+	lines := make([]string, 0, len(result.Diffs))
+	for i, d := range result.Diffs {
+		lines = append(lines, fmt.Sprintf("%d. <b>%s</b>\n   stored: <code>%s</code>\n   parsed: <code>%s</code>\n",
+			i+1, html.EscapeString(reparseFieldTitle(d)), shortReparseValue(d.Stored), shortReparseValue(d.Parsed)))
+
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+			fmt.Sprintf("apply %d: %s", i+1, reparseFieldTitle(d)),
+			fmt.Sprintf("dev:reparse_apply:%d:%d:%s", result.ShipmentId, d.TaskId, d.Field),
+		)))
+	}
+
+	var tasks strings.Builder
+	if len(result.NewTasks) > 0 {
+		tasks.WriteString(fmt.Sprintf("\nOnly in the document now: <b>%s</b>\n", strings.Join(result.NewTasks, ", ")))
+	}
+	if len(result.MissingTasks) > 0 {
+		tasks.WriteString(fmt.Sprintf("\nOnly in the db: <b>%s</b>\n", strings.Join(result.MissingTasks, ", ")))
+	}
+	if len(result.NewTasks) > 0 || len(result.MissingTasks) > 0 {
+		tasks.WriteString("<i>tasks are not added or removed from here</i>\n")
+	}
+
+	if len(result.Diffs) > 1 {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+			"apply all fields", fmt.Sprintf("dev:reparse_applyall:%d", result.ShipmentId),
+		)))
+	}
+
+	// the diffs are cut by whole fields, a cut in the middle would leave a tag open and telegram would refuse the message
+	limit := messageLimit - utf8.RuneCountInString(header) - utf8.RuneCountInString(tasks.String())
+	return header + fitLines(lines, limit, config.English, "review:more") + tasks.String(), tgbotapi.InlineKeyboardMarkup{InlineKeyboard: rows}
+}
+
+// SendReparseDiff shows the field by field diff of one shipment, if messageId is given the message is edited in place
+func SendReparseDiff(chatId int64, messageId int, shipmentId int64, globalStorage *sql.DB) error {
+	result, err := parser.ReparseShipment(globalStorage, shipmentId)
+	if err != nil {
+		_, sendErr := Bot.Send(tgbotapi.NewMessage(chatId, err.Error()))
+		if sendErr != nil {
+			return sendErr
+		}
+		return err
+	}
+
+	text, markup := formatReparseResult(result)
+	if messageId != 0 {
+		edit := tgbotapi.NewEditMessageTextAndMarkup(chatId, messageId, text, markup)
+		edit.ParseMode = tgbotapi.ModeHTML
+		_, err = Bot.Send(edit)
+		return err
+	}
+
+	msg := tgbotapi.NewMessage(chatId, text)
+	msg.ParseMode = tgbotapi.ModeHTML
+	msg.ReplyMarkup = markup
+	_, err = Bot.Send(msg)
+	return err
+}
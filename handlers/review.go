@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"logistictbot/audit"
+	"logistictbot/config"
+	"logistictbot/db"
+	"logistictbot/parser"
+	"strings"
+	"unicode/utf8"
+
+	tgbotapi "github.com/appleofeden110/telegram-bot-api/v5"
+)
+
+// values coming from the parser are already escaped in some places, so unescape first to not do it twice
+func escReview(s string) string {
+	return html.EscapeString(html.UnescapeString(s))
+}
+
+func reviewField(field, task string) string {
+	if task != "" {
+		return strings.ToUpper(task) + " / " + field
+	}
+	return field
+}
+
+// FormatParseReport fits into one message by whole lines: what is missing is always shown, the matched fields get
+// at least half of the rest and the lines nobody used what is left
+func FormatParseReport(shipment *parser.Shipment, report *parser.ParseReport, lang config.LangCode) string {
+	header := config.Translate(lang, "review:header", shipment.Id, report.Parser) +
+		config.Translate(lang, "review:matched", len(report.Matched))
+
+	missing := config.Translate(lang, "review:complete")
+	if !report.IsComplete() {
+		lines := make([]string, 0, len(report.Missing))
+		for _, m := range report.Missing {
+			lines = append(lines, fmt.Sprintf("• <b>%s</b>\n", escReview(reviewField(m.Field, m.Task))))
+		}
+		missing = config.Translate(lang, "review:missing", len(report.Missing))
+		missing += fitLines(lines, messageLimit-utf8.RuneCountInString(header+missing), lang, "review:more")
+	}
+
+	unusedHeader := ""
+	unusedLines := make([]string, 0, len(report.UnusedLines))
+	unusedSize := 0
+	if len(report.UnusedLines) > 0 {
+		unusedHeader = config.Translate(lang, "review:unused", len(report.UnusedLines))
+		for _, line := range report.UnusedLines {
+			unusedLines = append(unusedLines, fmt.Sprintf("<i>%s</i>\n", escReview(line)))
+			unusedSize += utf8.RuneCountInString(unusedLines[len(unusedLines)-1])
+		}
+	}
+
+	rest := messageLimit - utf8.RuneCountInString(header+missing+unusedHeader)
+	matchedLines := make([]string, 0, len(report.Matched))
+	for _, m := range report.Matched {
+		matchedLines = append(matchedLines, fmt.Sprintf("• <b>%s</b> ← <code>%s</code>: %s\n",
+			escReview(reviewField(m.Field, m.Task)), escReview(m.Keyword), escReview(m.Value)))
+	}
+	matched := fitLines(matchedLines, rest-min(unusedSize, rest/2), lang, "review:more")
+
+	unused := ""
+	if unusedHeader != "" {
+		unused = unusedHeader + fitLines(unusedLines, rest-utf8.RuneCountInString(matched), lang, "review:more")
+	}
+	return header + matched + missing + unused
+}
+
+func ParseReviewMarkup(lang config.LangCode) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(config.Translate(lang, "btn:review_accept"), "manager:review_accept"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(config.Translate(lang, "btn:review_fix"), "manager:review_fix"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(config.Translate(lang, "btn:review_reject"), "manager:review_reject"),
+		),
+	)
+}
+
+func SendParseReview(chatId int64, topicId int, pm *db.PendingMessage) error {
+	if pm == nil || pm.Shipment == nil || pm.Report == nil {
+		return fmt.Errorf("ERR: nothing to review, the document was not parsed")
+	}
+
+	lang := config.GetLang(chatId)
+	msg := tgbotapi.NewMessage(chatId, FormatParseReport(pm.Shipment, pm.Report, lang), topicId)
+	msg.ParseMode = tgbotapi.ModeHTML
+	msg.ReplyMarkup = ParseReviewMarkup(lang)
+
+	_, err := Bot.Send(msg)
+	return err
+}
+
+// reviewExpired answers a review button when nothing waits for the review, after a restart the review that was in memory
+// is gone
+func reviewExpired(managerSesh *db.Manager, chatId int64, topicId int, globalStorage *sql.DB) error {
+	if err := leaveExpiredReview(managerSesh, globalStorage); err != nil {
+		return err
+	}
+	_, err := Bot.Send(tgbotapi.NewMessage(chatId, config.Translate(config.GetLang(chatId), "review:expired"), topicId))
+	return err
+}
+
+// discardExpiredReview deletes the shipment stored for fixing when its review is gone. Only a draft without a driver is
+// deleted, that is the one StoreReviewedShipment left, the rest went to a driver
+func discardExpiredReview(managerSesh *db.Manager, chatId int64, topicId int, shipmentId int64, globalStorage *sql.DB) error {
+	shipment, err := parser.GetShipment(globalStorage, shipmentId)
+	if err != nil || shipment.Status != parser.StatusDraft || !shipment.DriverId.IsNil() {
+		return reviewExpired(managerSesh, chatId, topicId, globalStorage)
+	}
+
+	if err = shipment.DeleteShipment(globalStorage, audit.Bot(managerSesh.ChatId)); err != nil {
+		return err
+	}
+	if err = leaveExpiredReview(managerSesh, globalStorage); err != nil {
+		return err
+	}
+	_, err = Bot.Send(tgbotapi.NewMessage(chatId, config.Translate(config.GetLang(chatId), "review:rejected"), topicId))
+	return err
+}
+
+// leaveExpiredReview puts the manager that was reviewing a document lost by a restart back to dormant
+func leaveExpiredReview(managerSesh *db.Manager, globalStorage *sql.DB) error {
+	if managerSesh.State != db.StateReviewingDoc || managerSesh.PendingMessage != nil {
+		return nil
+	}
+	managerSesh.State = db.StateDormantManager
+	return managerSesh.ChangeManagerStatus(globalStorage)
+}
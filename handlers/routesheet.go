@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"logistictbot/config"
+	"logistictbot/db"
+	"logistictbot/errlog"
+	"logistictbot/parser"
+	"net/http"
+	"strconv"
+
+	tgbotapi "github.com/appleofeden110/telegram-bot-api/v5"
+)
+
+// SendRouteSheet sends the printable route sheet of the shipment into the document topic of its truck's group,
+// in the language and the timezone of the driver
+func SendRouteSheet(shipmentId int64, globalStorage *sql.DB) error {
+	shipment, err := parser.GetShipment(globalStorage, shipmentId)
+	if err != nil {
+		errlog.ERR.Printf("ERR: getting shipment %d for the route sheet: %v\n", shipmentId, err)
+		return fmt.Errorf("ERR: getting shipment %d for the route sheet: %v\n", shipmentId, err)
+	}
+
+	car, err := db.GetCarById(globalStorage, shipment.CarId)
+	if err != nil {
+		errlog.ERR.Printf("ERR: getting car %s for the route sheet: %v\n", shipment.CarId, err)
+		return fmt.Errorf("ERR: getting car %s for the route sheet: %v\n", shipment.CarId, err)
+	}
+	g := &db.DriverGroup{CurrentCar: car}
+	if err = g.GetDriverGroupByCar(globalStorage); err != nil {
+		errlog.ERR.Printf("ERR: getting driver group for the route sheet: %v\n", err)
+		return fmt.Errorf("ERR: getting driver group for the route sheet: %v\n", err)
+	}
+
+	// the group is the fallback, when the shipment has no driver yet
+	readerChatId := g.GroupChatId
+	if driver, err := db.GetDriverById(globalStorage, shipment.DriverId); err == nil {
+		readerChatId = driver.ChatId
+	}
+	lang := config.GetLang(readerChatId)
+
+	sheet, err := parser.RouteSheet(shipment, lang, config.GetLoc(readerChatId))
+	if err != nil {
+		errlog.ERR.Printf("ERR: rendering route sheet: %v\n", err)
+		return fmt.Errorf("ERR: rendering route sheet: %v\n", err)
+	}
+
+	docMsg := tgbotapi.NewDocument(g.GroupChatId, tgbotapi.FileBytes{Name: fmt.Sprintf("route_%d.html", shipment.Id), Bytes: sheet}, g.DocumentTopicId)
+	docMsg.Caption = config.Translate(lang, "routesheet:caption", shipment.Id)
+
+	_, err = Bot.Send(docMsg)
+	return err
+}
+
+// SendActiveRouteSheets is the /routesheet of a driver's group, a sheet for every shipment its truck has going on
+func SendActiveRouteSheets(groupChatId int64, topicId int, globalStorage *sql.DB) error {
+	g := &db.DriverGroup{GroupChatId: groupChatId}
+	if err := g.GetDriverGroup(globalStorage); err != nil {
+		errlog.ERR.Printf("ERR: getting driver group %d for the route sheet: %v\n", groupChatId, err)
+		return fmt.Errorf("ERR: getting driver group %d for the route sheet: %v\n", groupChatId, err)
+	}
+
+	var shipments []*parser.Shipment
+	if g.CurrentCar != nil {
+		var err error
+		shipments, err = parser.GetAllActiveShipmentsByCarId(g.CurrentCar.Id, globalStorage)
+		if err != nil {
+			errlog.ERR.Printf("ERR: getting active shipments of car %s: %v\n", g.CurrentCar.Id, err)
+			return fmt.Errorf("ERR: getting active shipments of car %s: %v\n", g.CurrentCar.Id, err)
+		}
+	}
+
+	if len(shipments) == 0 {
+		_, err := Bot.Send(tgbotapi.NewMessage(groupChatId, config.Translate(config.GetLang(groupChatId), "routesheet:no_active"), topicId))
+		return err
+	}
+
+	for _, s := range shipments {
+		if err := SendRouteSheet(s.Id, globalStorage); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RequestRouteSheet gives the route sheet as a page to print from the browser, in ?lang= or the language of the user
+func RequestRouteSheet(w http.ResponseWriter, r *http.Request, u *db.User, globalStorage *sql.DB) {
+	shipmentId, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid shipment id", http.StatusBadRequest)
+		return
+	}
+
+	shipment, err := parser.GetShipment(globalStorage, shipmentId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "shipment not found", http.StatusNotFound)
+			return
+		}
+		errlog.ERR.Printf("get shipment %d: %v\n", shipmentId, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	if !CanAccessShipment(u, shipment, globalStorage) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	lang := config.GetLang(u.ChatId)
+	switch l := config.LangCode(r.URL.Query().Get("lang")); l {
+	case config.English, config.Ukrainian, config.Polish:
+		lang = l
+	}
+
+	sheet, err := parser.RouteSheet(shipment, lang, config.GetLoc(u.ChatId))
+	if err != nil {
+		errlog.ERR.Printf("route sheet %d: %v\n", shipmentId, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(sheet)
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"logistictbot/config"
+	"logistictbot/db"
+	"logistictbot/errlog"
+	"logistictbot/parser"
+	"net/http"
+	"strconv"
+
+	tgbotapi "github.com/appleofeden110/telegram-bot-api/v5"
+)
+
+// searchShown is how many hits /find answers with, the API gives up to searchMaxLimit
+const searchShown = 10
+
+const (
+	searchDefaultLimit = 20
+	searchMaxLimit     = 100
+)
+
+type searchHitResponse struct {
+	ShipmentId int64   `json:"ShipmentId"`
+	TaskId     int     `json:"TaskId,omitempty"`
+	TaskType   string  `json:"TaskType,omitempty"`
+	Rank       float64 `json:"Rank"`
+	Snippet    string  `json:"Snippet"` // html, the matched words in <mark>
+}
+
+// HandleFind answers the /find <text> of a manager with the shipments and the tasks that match it, the best first
+func HandleFind(chatId int64, fromId int64, text string, topicId int, globalStorage *sql.DB) error {
+	lang := config.GetLang(chatId)
+
+	if ok, err := (&db.User{ChatId: fromId}).IsManager(globalStorage); err != nil || !ok {
+		_, err = Bot.Send(tgbotapi.NewMessage(chatId, config.Translate(lang, "find:managers_only"), topicId))
+		return err
+	}
+	if text == "" {
+		_, err := Bot.Send(tgbotapi.NewMessage(chatId, config.Translate(lang, "find:usage"), topicId))
+		return err
+	}
+
+	hits, err := parser.Search(globalStorage, text, searchShown)
+	if errors.Is(err, parser.ErrSearchUnavailable) {
+		_, err = Bot.Send(tgbotapi.NewMessage(chatId, config.Translate(lang, "find:unavailable"), topicId))
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	msg := tgbotapi.NewMessage(chatId, "", topicId)
+	msg.ParseMode = tgbotapi.ModeHTML
+	if len(hits) == 0 {
+		msg.Text = config.Translate(lang, "find:nothing", html.EscapeString(text))
+		_, err = Bot.Send(msg)
+		return err
+	}
+
+	msg.Text = config.Translate(lang, "find:header", html.EscapeString(text))
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0)
+	shown := make(map[int64]bool)
+	for i, h := range hits {
+		what := config.Translate(lang, "find:shipment")
+		if h.TaskId != 0 {
+			what = parser.TaskTypeTitle(lang, h.TaskType)
+		}
+		msg.Text += config.Translate(lang, "find:line", i+1, h.ShipmentId, what, h.Highlight("<b>", "</b>"))
+
+		if !shown[h.ShipmentId] {
+			shown[h.ShipmentId] = true
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(config.Translate(lang, "btn:find_shipment", h.ShipmentId), fmt.Sprintf("shipment:details:%d", h.ShipmentId)),
+			))
+		}
+	}
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+
+	_, err = Bot.Send(msg)
+	return err
+}
+
+// RequestSearch gives the managers the shipments and the tasks matching ?q=, the best first, up to ?limit=
+func RequestSearch(w http.ResponseWriter, r *http.Request, u *db.User, globalStorage *sql.DB) {
+	if ok, err := u.IsManager(globalStorage); err != nil || !ok {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	text := r.URL.Query().Get("q")
+	if text == "" {
+		http.Error(w, "the q parameter is required", http.StatusBadRequest)
+		return
+	}
+	limit := searchDefaultLimit
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 || n > searchMaxLimit {
+			http.Error(w, fmt.Sprintf("limit should be from 1 to %d", searchMaxLimit), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	hits, err := parser.Search(globalStorage, text, limit)
+	if errors.Is(err, parser.ErrSearchUnavailable) {
+		http.Error(w, "search is unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		errlog.ERR.Printf("search for %q: %v\n", text, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]searchHitResponse, 0, len(hits))
+	for _, h := range hits {
+		resp = append(resp, searchHitResponse{
+			ShipmentId: h.ShipmentId,
+			TaskId:     h.TaskId,
+			TaskType:   h.TaskType,
+			Rank:       h.Rank,
+			Snippet:    h.Highlight("<mark>", "</mark>"),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
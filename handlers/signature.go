@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html"
+	"logistictbot/config"
+	"logistictbot/db"
+	"logistictbot/docs"
+	"logistictbot/errlog"
+	"logistictbot/parser"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/appleofeden110/telegram-bot-api/v5"
+)
+
+// maxSignatureSize is the biggest png the signature page can send, a drawn signature is a few dozen kb
+const maxSignatureSize = 1 << 20
+
+type signatureInput struct {
+	SignerName string `json:"SignerName"`
+	Image      string `json:"Image"` // the png of the canvas as a data url
+}
+
+type signatureResponse struct {
+	FileId   int       `json:"FileId,omitempty"`
+	SignedBy string    `json:"SignedBy"`
+	SignedAt time.Time `json:"SignedAt"`
+}
+
+type taskSignaturesResponse struct {
+	TaskId     int                 `json:"TaskId"`
+	ShipmentId int64               `json:"ShipmentId"`
+	Type       string              `json:"Type"`
+	Address    string              `json:"Address"`
+	Company    string              `json:"Company"`
+	Signatures []signatureResponse `json:"Signatures"`
+}
+
+// taskForSignature gives the task of the path to the drivers of its shipment and to the managers
+func taskForSignature(w http.ResponseWriter, r *http.Request, u *db.User, globalStorage *sql.DB) (*parser.TaskSection, *parser.Shipment, bool) {
+	taskId, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid task id", http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	task, err := parser.GetTaskById(globalStorage, taskId)
+	if err != nil {
+		errlog.INFO.Printf("get task %d for the signature: %v\n", taskId, err)
+		http.Error(w, "task not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+
+	shipment, err := parser.GetShipment(globalStorage, task.ShipmentId)
+	if err != nil {
+		errlog.ERR.Printf("get shipment %d of task %d: %v\n", task.ShipmentId, task.Id, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+
+	if isManager, err := u.IsManager(globalStorage); err == nil && isManager {
+		return task, shipment, true
+	}
+	// the consignee signs on the phone of the driver, so it is the driver who is authenticated
+	driver, err := db.GetDriverByChatId(globalStorage, u.ChatId)
+	if err != nil || !shipment.HasDriver(driver.Id) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return nil, nil, false
+	}
+	return task, shipment, true
+}
+
+// RequestTaskSignatures gives the signature page the task to sign and who already signed it
+func RequestTaskSignatures(w http.ResponseWriter, r *http.Request, u *db.User, globalStorage *sql.DB) {
+	task, _, ok := taskForSignature(w, r, u, globalStorage)
+	if !ok {
+		return
+	}
+
+	files, err := docs.GetFilesAttachedToTask(globalStorage, task.Id)
+	if err != nil {
+		errlog.ERR.Printf("files of task %d: %v\n", task.Id, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	resp := taskSignaturesResponse{
+		TaskId:     task.Id,
+		ShipmentId: task.ShipmentId,
+		Type:       task.Type,
+		Address:    task.Address,
+		Company:    task.Company,
+		Signatures: make([]signatureResponse, 0),
+	}
+	for _, f := range files {
+		if f.SignedBy != "" {
+			resp.Signatures = append(resp.Signatures, signatureResponse{FileId: f.Id, SignedBy: f.SignedBy, SignedAt: f.SignedAt})
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// RequestSignTask stores the signature drawn in the Mini App as an image of the task, with the name of the signer.
+// The group of the truck gets it too, so the managers see the delivery was signed
+func RequestSignTask(w http.ResponseWriter, r *http.Request, u *db.User, globalStorage *sql.DB) {
+	task, shipment, ok := taskForSignature(w, r, u, globalStorage)
+	if !ok {
+		return
+	}
+	if shipment.Status == parser.StatusCancelled {
+		http.Error(w, "the shipment is cancelled", http.StatusConflict)
+		return
+	}
+	// only the deliveries are signed by the consignee, the same tasks the bot shows the signature button for
+	if task.Type != parser.TaskUnload && task.Type != parser.TaskDropoff {
+		http.Error(w, fmt.Sprintf("a %s task is not signed, only unload and dropoff are", task.Type), http.StatusBadRequest)
+		return
+	}
+
+	var payload signatureInput
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 2*maxSignatureSize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&payload); err != nil {
+		http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	payload.SignerName = strings.TrimSpace(payload.SignerName)
+	if payload.SignerName == "" || len(payload.SignerName) > 200 {
+		http.Error(w, "validation failed: the name of the signer is required, up to 200 characters", http.StatusBadRequest)
+		return
+	}
+	encoded, found := strings.CutPrefix(payload.Image, "data:image/png;base64,")
+	if !found {
+		http.Error(w, "validation failed: the signature should be a png data url", http.StatusBadRequest)
+		return
+	}
+	png, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(png) > maxSignatureSize || http.DetectContentType(png) != string(docs.MimeImagePNG) {
+		http.Error(w, "validation failed: the signature is not a png up to 1mb", http.StatusBadRequest)
+		return
+	}
+
+	signedAt := time.Now()
+	name := fmt.Sprintf("signature_%d_%d.png", task.Id, signedAt.UnixNano())
+	path := config.GetFullPathOutDocs(name)
+	if err = os.WriteFile(path, png, 0o644); err != nil {
+		errlog.ERR.Printf("writing the signature of task %d: %v\n", task.Id, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	f := &docs.File{
+		From:         u.ChatId,
+		Name:         name,
+		OriginalName: name,
+		Path:         path,
+		Mimetype:     docs.MimeImagePNG,
+		Filetype:     docs.Image,
+		SignedBy:     payload.SignerName,
+		SignedAt:     signedAt,
+	}
+	f.TgFileId = sendSignature(shipment, task, f, globalStorage)
+
+	if err = f.StoreFile(globalStorage); err != nil {
+		errlog.ERR.Printf("storing the signature of task %d: %v\n", task.Id, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	fileId := f.Id
+	if err = f.AttachFileToTask(globalStorage, task.Id); err != nil {
+		errlog.ERR.Printf("attaching the signature to task %d: %v\n", task.Id, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(signatureResponse{FileId: fileId, SignedBy: f.SignedBy, SignedAt: f.SignedAt})
+}
+
+// sendSignature posts the signature in the loading topic of the truck of the task and gives its telegram file id.
+// The signature is stored even when it could not be sent, the id is then empty
+func sendSignature(shipment *parser.Shipment, task *parser.TaskSection, f *docs.File, globalStorage *sql.DB) string {
+	g, err := driverGroupOfCar(shipment.TaskCar(task), globalStorage)
+	if err != nil {
+		errlog.ERR.Printf("ERR: getting the group to send the signature of task %d: %v\n", task.Id, err)
+		return ""
+	}
+
+	lang := config.GetLang(g.GroupChatId)
+	photo := tgbotapi.NewPhoto(g.GroupChatId, tgbotapi.FilePath(f.Path), g.LoadingTopicId)
+	photo.Caption = config.Translate(lang, "signature:signed", parser.TaskTypeTitle(lang, task.Type), shipment.Id,
+		html.EscapeString(task.Address), html.EscapeString(f.SignedBy), f.SignedAt.In(config.GetLoc(g.GroupChatId)).Format("02.01.2006 15:04"))
+	photo.ParseMode = tgbotapi.ModeHTML
+	sent, err := Bot.Send(photo)
+	if err != nil {
+		errlog.ERR.Printf("ERR: sending the signature of task %d: %v\n", task.Id, err)
+		return ""
+	}
+	if len(sent.Photo) == 0 {
+		return ""
+	}
+	return sent.Photo[len(sent.Photo)-1].FileID
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"logistictbot/audit"
+	"logistictbot/db"
+	"logistictbot/docs"
+	"logistictbot/errlog"
+	"logistictbot/parser"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// pngHeader is enough of a png for the content sniffing
+const pngHeader = "\x89PNG\r\n\x1a\n"
+
+// openSignatureTestDB is a database with a manager and a shipment with a load and an unload, it gives the ids of the two tasks
+func openSignatureTestDB(t *testing.T, status parser.ShipmentStatus) (*sql.DB, *db.User, int, int) {
+	t.Helper()
+	for _, m := range []*errlog.ErrMonitor{errlog.ERR, errlog.WARN, errlog.INFO} {
+		if m.Logger == nil {
+			m.Logger = log.Default()
+		}
+	}
+
+	s, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	for _, check := range []func(db.DBExecutor) error{
+		db.CheckUsersTable, db.CheckManagersTable, db.CheckFilesTable, db.CheckTaskDocsTable, db.CheckCleaningStationsTable,
+		db.CheckShipmentsTable, db.CheckShipmentDriversTable, db.CheckAuditLogTable, db.CheckShipmentStatusHistoryTable,
+		db.CheckTasksTable, db.CheckTaskCompartmentsTable, db.CheckTaskCleaningsTable,
+	} {
+		if err = check(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err = s.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_tasks_shipment_type ON tasks(shipment_id, type)`); err != nil {
+		t.Fatal(err)
+	}
+
+	manager := &db.User{Id: uuid.Must(uuid.NewV4()), ChatId: 1001, Name: "Manager"}
+	if _, err = s.Exec(`INSERT INTO users (id, chat_id, name, manager_id) VALUES (?, ?, ?, ?)`,
+		manager.Id, manager.ChatId, manager.Name, uuid.Must(uuid.NewV4()).String()); err != nil {
+		t.Fatal(err)
+	}
+
+	shipment := &parser.Shipment{Id: 4334007, DocLang: parser.German, InstructionType: parser.InstructionType("x"), CarId: "CAR1",
+		Tasks: []*parser.TaskSection{
+			{Type: parser.TaskLoad, Address: "BASF SE, CARL-BOSCH-STRASSE 38, DE-67056 LUDWIGSHAFEN", Product: "METHANOL"},
+			{Type: parser.TaskUnload, Address: "INEOS KÖLN GMBH, DE-50769 KÖLN", Product: "METHANOL"},
+		}}
+	if err = shipment.StoreShipment(s, audit.System); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Exec(`UPDATE shipments SET status = ? WHERE id = ?`, status, shipment.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := parser.GetShipment(s, shipment.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, manager, stored.Tasks[0].Id, stored.Tasks[1].Id
+}
+
+func TestRequestSignTaskValidation(t *testing.T) {
+	validImage := "data:image/png;base64," + base64.StdEncoding.EncodeToString([]byte(pngHeader+"signature"))
+
+	tests := []struct {
+		name       string
+		status     parser.ShipmentStatus
+		signLoad   bool
+		payload    signatureInput
+		wantStatus int
+		wantError  string
+	}{
+		{
+			name:       "jpeg data url",
+			payload:    signatureInput{SignerName: "J. Schmidt", Image: "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString([]byte("\xff\xd8\xff\xe0"))},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "png data url",
+		},
+		{
+			name:       "png data url that is not a png",
+			payload:    signatureInput{SignerName: "J. Schmidt", Image: "data:image/png;base64," + base64.StdEncoding.EncodeToString([]byte("<svg></svg>"))},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "not a png",
+		},
+		{
+			name:       "not base64",
+			payload:    signatureInput{SignerName: "J. Schmidt", Image: "data:image/png;base64,%%%"},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "not a png",
+		},
+		{
+			name: "image over 1mb",
+			payload: signatureInput{SignerName: "J. Schmidt",
+				Image: "data:image/png;base64," + base64.StdEncoding.EncodeToString(append([]byte(pngHeader), make([]byte, maxSignatureSize)...))},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "not a png up to 1mb",
+		},
+		{
+			name:       "empty signer name",
+			payload:    signatureInput{SignerName: "   ", Image: validImage},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "name of the signer",
+		},
+		{
+			name:       "signer name over 200 characters",
+			payload:    signatureInput{SignerName: strings.Repeat("x", 201), Image: validImage},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "up to 200 characters",
+		},
+		{
+			name:       "load task",
+			signLoad:   true,
+			payload:    signatureInput{SignerName: "J. Schmidt", Image: validImage},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "only unload and dropoff",
+		},
+		{
+			name:       "cancelled shipment",
+			status:     parser.StatusCancelled,
+			payload:    signatureInput{SignerName: "J. Schmidt", Image: validImage},
+			wantStatus: http.StatusConflict,
+			wantError:  "cancelled",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := tt.status
+			if status == "" {
+				status = parser.StatusInProgress
+			}
+			s, manager, loadId, unloadId := openSignatureTestDB(t, status)
+			taskId := unloadId
+			if tt.signLoad {
+				taskId = loadId
+			}
+
+			body, err := json.Marshal(tt.payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := httptest.NewRequest(http.MethodPost, "/api/tasks/"+strconv.Itoa(taskId)+"/signature", bytes.NewReader(body))
+			r.SetPathValue("id", strconv.Itoa(taskId))
+			w := httptest.NewRecorder()
+
+			RequestSignTask(w, r, manager, s)
+			if w.Code != tt.wantStatus || !strings.Contains(w.Body.String(), tt.wantError) {
+				t.Errorf("got %d %q, want %d %q", w.Code, w.Body.String(), tt.wantStatus, tt.wantError)
+			}
+
+			// nothing is stored for a refused signature
+			files, err := docs.GetFilesAttachedToTask(s, taskId)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != 0 {
+				t.Errorf("%d files were attached to the task", len(files))
+			}
+		})
+	}
+}
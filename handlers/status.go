@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"logistictbot/audit"
+	"logistictbot/config"
+	"logistictbot/db"
+	"logistictbot/errlog"
+	"logistictbot/parser"
+	"net/http"
+	"slices"
+	"strconv"
+
+	tgbotapi "github.com/appleofeden110/telegram-bot-api/v5"
+)
+
+// managerStatuses are the statuses a manager moves the shipment to by hand, the rest follow what the driver does
+var managerStatuses = []parser.ShipmentStatus{parser.StatusInvoiced}
+
+// apiStatuses are the statuses the API moves the shipment to. finished and in_progress go with the times of the shipment,
+// so they only come from the driver ending the shipment or undoing it
+var apiStatuses = append(slices.Clone(managerStatuses), parser.StatusCancelled)
+
+// statusButtons are the buttons for the manager to move the shipment on from the status it has
+func statusButtons(s *parser.Shipment, lang config.LangCode) [][]tgbotapi.InlineKeyboardButton {
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0)
+	for _, to := range s.Status.Transitions() {
+		if !slices.Contains(managerStatuses, to) {
+			continue
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(config.Translate(lang, "btn:set_status", to.Title(lang)), fmt.Sprintf("manager:setstatus:%d:%s", s.Id, to)),
+		))
+	}
+	return append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(config.Translate(lang, "btn:status_history"), fmt.Sprintf("manager:statushistory:%d", s.Id)),
+	))
+}
+
+// SetShipmentStatus is the manager moving the shipment to the status by the button
+func SetShipmentStatus(chatId, fromId int64, topicId int, shipmentId int64, to parser.ShipmentStatus, globalStorage *sql.DB) error {
+	shipment, err := parser.GetShipment(globalStorage, shipmentId)
+	if err != nil {
+		errlog.ERR.Printf("ERR: getting shipment %d to change the status: %v\n", shipmentId, err)
+		return fmt.Errorf("ERR: getting shipment %d to change the status: %v\n", shipmentId, err)
+	}
+
+	lang := config.GetLang(chatId)
+	from := shipment.Status
+	if !slices.Contains(managerStatuses, to) || !from.CanTransition(to) {
+		_, err = Bot.Send(tgbotapi.NewMessage(chatId, config.Translate(lang, "status:not_allowed", shipment.Id, from.Title(lang), to.Title(lang)), topicId))
+		return err
+	}
+
+	if err = shipment.SetStatus(globalStorage, to, audit.Bot(fromId), ""); err != nil {
+		if errors.Is(err, parser.ErrStatusTransition) {
+			_, err = Bot.Send(tgbotapi.NewMessage(chatId, config.Translate(lang, "status:not_allowed", shipment.Id, from.Title(lang), to.Title(lang)), topicId))
+			return err
+		}
+		return err
+	}
+
+	msg := tgbotapi.NewMessage(chatId, config.Translate(lang, "status:changed", shipment.Id, to.Title(lang)), topicId)
+	msg.ParseMode = tgbotapi.ModeHTML
+	_, err = Bot.Send(msg)
+	return err
+}
+
+// SendStatusHistory shows who moved the shipment through its statuses and when
+func SendStatusHistory(chatId int64, topicId int, shipmentId int64, globalStorage *sql.DB) error {
+	history, err := parser.GetStatusHistory(globalStorage, shipmentId)
+	if err != nil {
+		errlog.ERR.Printf("ERR: getting status history of shipment %d: %v\n", shipmentId, err)
+		return fmt.Errorf("ERR: getting status history of shipment %d: %v\n", shipmentId, err)
+	}
+
+	lang := config.GetLang(chatId)
+	loc := config.GetLoc(chatId)
+	text := config.Translate(lang, "status:history_header", shipmentId)
+	if len(history) == 0 {
+		text += config.Translate(lang, "status:history_empty")
+	}
+
+	names := make(map[int64]string)
+	for _, c := range history {
+		by, ok := names[c.ChangedBy]
+		if !ok {
+			by = config.Translate(lang, "status:by_bot")
+			if c.ChangedBy != 0 {
+				u := &db.User{ChatId: c.ChangedBy}
+				if err := u.GetUserByChatId(globalStorage); err == nil {
+					by = u.Name
+				} else {
+					by = strconv.FormatInt(c.ChangedBy, 10)
+				}
+			}
+			names[c.ChangedBy] = by
+		}
+
+		changedAt := c.ChangedAt.In(loc).Format("02.01.2006 15:04")
+		if c.From == "" {
+			text += config.Translate(lang, "status:history_created", changedAt, c.To.Title(lang), html.EscapeString(by))
+			continue
+		}
+		text += config.Translate(lang, "status:history_line", changedAt, c.From.Title(lang), c.To.Title(lang), html.EscapeString(by))
+	}
+
+	msg := tgbotapi.NewMessage(chatId, text, topicId)
+	msg.ParseMode = tgbotapi.ModeHTML
+	_, err = Bot.Send(msg)
+	return err
+}
+
+type shipmentStatusResponse struct {
+	Id          int64                   `json:"id"`
+	Status      parser.ShipmentStatus   `json:"status"`
+	Transitions []parser.ShipmentStatus `json:"transitions"`
+	History     []*parser.StatusChange  `json:"history"`
+}
+
+// RequestShipmentStatus gives the status of the shipment, where it can go from it and how it got there
+func RequestShipmentStatus(w http.ResponseWriter, r *http.Request, u *db.User, globalStorage *sql.DB) {
+	shipment, ok := shipmentForStatus(w, r, u, globalStorage)
+	if !ok {
+		return
+	}
+	writeShipmentStatus(w, shipment, globalStorage)
+}
+
+// RequestUpdateShipmentStatus moves the shipment to {"status": ..., "note": ...}, one of apiStatuses.
+// 409 when the transition is not allowed. A cancel releases the drivers and tells the group, the same as the cancel in the bot
+func RequestUpdateShipmentStatus(w http.ResponseWriter, r *http.Request, u *db.User, globalStorage *sql.DB) {
+	shipment, ok := shipmentForStatus(w, r, u, globalStorage)
+	if !ok {
+		return
+	}
+
+	var payload struct {
+		Status parser.ShipmentStatus `json:"status"`
+		Note   string                `json:"note"`
+	}
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&payload); err != nil {
+		http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !payload.Status.IsValid() {
+		http.Error(w, "unknown status", http.StatusBadRequest)
+		return
+	}
+	if !slices.Contains(apiStatuses, payload.Status) {
+		http.Error(w, fmt.Sprintf("%s is set by the driver, not through the API", payload.Status), http.StatusConflict)
+		return
+	}
+
+	if err := shipment.SetStatus(globalStorage, payload.Status, audit.API(u.ChatId), payload.Note); err != nil {
+		if errors.Is(err, parser.ErrStatusTransition) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		errlog.ERR.Printf("set status of shipment %d: %v\n", shipment.Id, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if payload.Status == parser.StatusCancelled {
+		shipmentCancelled(shipment, globalStorage)
+	}
+	writeShipmentStatus(w, shipment, globalStorage)
+}
+
+func shipmentForStatus(w http.ResponseWriter, r *http.Request, u *db.User, globalStorage *sql.DB) (*parser.Shipment, bool) {
+	shipmentId, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid shipment id", http.StatusBadRequest)
+		return nil, false
+	}
+
+	shipment, err := parser.GetShipment(globalStorage, shipmentId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "shipment not found", http.StatusNotFound)
+			return nil, false
+		}
+		errlog.ERR.Printf("get shipment %d: %v\n", shipmentId, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if !CanAccessShipment(u, shipment, globalStorage) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return nil, false
+	}
+	return shipment, true
+}
+
+func writeShipmentStatus(w http.ResponseWriter, shipment *parser.Shipment, globalStorage *sql.DB) {
+	history, err := parser.GetStatusHistory(globalStorage, shipment.Id)
+	if err != nil {
+		errlog.ERR.Printf("status history of shipment %d: %v\n", shipment.Id, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	transitions := shipment.Status.Transitions()
+	if transitions == nil {
+		transitions = []parser.ShipmentStatus{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(shipmentStatusResponse{
+		Id:          shipment.Id,
+		Status:      shipment.Status,
+		Transitions: transitions,
+		History:     history,
+	})
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"logistictbot/config"
+	"logistictbot/errlog"
+	"logistictbot/parser"
+
+	tgbotapi "github.com/appleofeden110/telegram-bot-api/v5"
+)
+
+// SendTaskOrderMenu shows the manager the order of the tasks and the rule for starting them.
+// With messageId it edits the menu that is already there, after a change
+func SendTaskOrderMenu(chatId int64, topicId, messageId int, shipmentId int64, globalStorage *sql.DB) error {
+	shipment, err := parser.GetShipment(globalStorage, shipmentId)
+	if err != nil {
+		errlog.ERR.Printf("ERR: getting shipment %d for the task order: %v\n", shipmentId, err)
+		return fmt.Errorf("ERR: getting shipment %d for the task order: %v\n", shipmentId, err)
+	}
+
+	lang := config.GetLang(chatId)
+	var tasks string
+	markup := make([][]tgbotapi.InlineKeyboardButton, 0, len(parser.TaskOrders)+len(shipment.Tasks))
+
+	for _, order := range parser.TaskOrders {
+		title := config.Translate(lang, "task_order:"+string(order))
+		if order == shipment.TaskOrder {
+			title = "✅ " + title
+		}
+		markup = append(markup, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(title, fmt.Sprintf("manager:setorder:%d:%s", shipment.Id, order)),
+		))
+	}
+
+	for i, task := range shipment.Tasks {
+		title := parser.TaskTypeTitle(lang, task.Type)
+		tasks += fmt.Sprintf("%d. <b>%s</b> %s\n", i+1, title, html.EscapeString(task.Address))
+		if i > 0 {
+			markup = append(markup, tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(config.Translate(lang, "btn:move_up", i+1, title), fmt.Sprintf("manager:moveup:%d:%d", shipment.Id, task.Id)),
+			))
+		}
+	}
+
+	text := config.Translate(lang, "task_order:menu", shipment.Id, config.Translate(lang, "task_order:"+string(shipment.TaskOrder)), tasks)
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(markup...)
+
+	if messageId != 0 {
+		edit := tgbotapi.NewEditMessageText(chatId, messageId, text)
+		edit.ParseMode = tgbotapi.ModeHTML
+		edit.ReplyMarkup = &keyboard
+		_, err = Bot.Send(edit)
+		return err
+	}
+
+	msg := tgbotapi.NewMessage(chatId, text, topicId)
+	msg.ParseMode = tgbotapi.ModeHTML
+	msg.ReplyMarkup = keyboard
+	_, err = Bot.Send(msg)
+	return err
+}
+
+// checkTaskOrder tells the driver if the task can not be started yet. A strict order is refused,
+// the unload before the load only warned about, the tank could have been loaded already. force is the "start anyway"
+// of that warning, it skips the warning but not a strict order. ok is false when the task should not start
+func checkTaskOrder(chatId int64, topicId int, shipment *parser.Shipment, task *parser.TaskSection, force bool) (ok bool, err error) {
+	before := shipment.TaskBefore(task)
+	if before == nil || (force && shipment.TaskOrder != parser.TaskOrderStrict) {
+		return true, nil
+	}
+
+	lang := config.GetLang(chatId)
+	taskTitle, beforeTitle := parser.TaskTypeTitle(lang, task.Type), parser.TaskTypeTitle(lang, before.Type)
+
+	if shipment.TaskOrder == parser.TaskOrderStrict {
+		_, err = Bot.Send(tgbotapi.NewMessage(chatId, config.Translate(lang, "task_order:blocked", taskTitle, beforeTitle), topicId))
+		return false, err
+	}
+
+	msg := tgbotapi.NewMessage(chatId, config.Translate(lang, "task_order:warn", beforeTitle, taskTitle), topicId)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(config.Translate(lang, "btn:start_anyway"), fmt.Sprintf("driver:begintask_force:%d", task.Id)),
+	))
+	_, err = Bot.Send(msg)
+	return false, err
+}
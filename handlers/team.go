@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"logistictbot/audit"
+	"logistictbot/config"
+	"logistictbot/db"
+	"logistictbot/errlog"
+	"logistictbot/parser"
+
+	tgbotapi "github.com/appleofeden110/telegram-bot-api/v5"
+)
+
+// SendTeamMenu shows the drivers of the shipment, the manager adds or takes away the co-drivers of a double manned
+// truck by pressing on them. With messageId the menu that is already sent is updated
+func SendTeamMenu(chatId int64, topicId, messageId int, shipmentId int64, globalStorage *sql.DB) error {
+	shipment, err := parser.GetShipment(globalStorage, shipmentId)
+	if err != nil {
+		errlog.ERR.Printf("ERR: getting shipment %d for the team: %v\n", shipmentId, err)
+		return fmt.Errorf("ERR: getting shipment %d for the team: %v\n", shipmentId, err)
+	}
+
+	drivers, err := db.GetAllDrivers(globalStorage)
+	if err != nil {
+		errlog.ERR.Printf("ERR: getting all drivers: %v\n", err)
+		return fmt.Errorf("ERR: getting all drivers: %v\n", err)
+	}
+
+	lang := config.GetLang(chatId)
+	var team string
+	markup := make([][]tgbotapi.InlineKeyboardButton, 0, len(drivers))
+	for _, d := range drivers {
+		switch {
+		case d.Id == shipment.DriverId:
+			team = config.Translate(lang, "team:lead", html.EscapeString(d.User.Name), d.CarId) + team
+			continue
+		case shipment.HasDriver(d.Id):
+			team += config.Translate(lang, "team:codriver", html.EscapeString(d.User.Name), d.CarId)
+			markup = append(markup, tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(config.Translate(lang, "btn:team_remove", d.User.Name), fmt.Sprintf("manager:teamtoggle:%d:%d", shipment.Id, d.ChatId)),
+			))
+		case !shipment.IsClosed():
+			markup = append(markup, tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(config.Translate(lang, "btn:team_add", d.User.Name, d.CarId), fmt.Sprintf("manager:teamtoggle:%d:%d", shipment.Id, d.ChatId)),
+			))
+		}
+	}
+
+	text := config.Translate(lang, "team:menu", shipment.Id, team)
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(markup...)
+
+	if messageId != 0 {
+		edit := tgbotapi.NewEditMessageText(chatId, messageId, text)
+		edit.ParseMode = tgbotapi.ModeHTML
+		edit.ReplyMarkup = &keyboard
+		_, err = Bot.Send(edit)
+		return err
+	}
+
+	msg := tgbotapi.NewMessage(chatId, text, topicId)
+	msg.ParseMode = tgbotapi.ModeHTML
+	msg.ReplyMarkup = keyboard
+	_, err = Bot.Send(msg)
+	return err
+}
+
+// ToggleCoDriver adds the driver of driverChatId to the team of the shipment, or takes him away if he is in it already.
+// The driver is told, so he knows he can begin the tasks of the shipment
+func ToggleCoDriver(chatId, fromId int64, topicId, messageId int, shipmentId, driverChatId int64, globalStorage *sql.DB) error {
+	shipment, err := parser.GetShipment(globalStorage, shipmentId)
+	if err != nil {
+		errlog.ERR.Printf("ERR: getting shipment %d for the team: %v\n", shipmentId, err)
+		return fmt.Errorf("ERR: getting shipment %d for the team: %v\n", shipmentId, err)
+	}
+
+	driver, err := db.GetDriverByChatId(globalStorage, driverChatId)
+	if err != nil {
+		errlog.ERR.Printf("ERR: getting driver %d for the team: %v\n", driverChatId, err)
+		return fmt.Errorf("ERR: getting driver %d for the team: %v\n", driverChatId, err)
+	}
+
+	lang := config.GetLang(chatId)
+	if driver.Id == shipment.DriverId {
+		_, err = Bot.Send(tgbotapi.NewMessage(chatId, config.Translate(lang, "team:is_lead", driver.User.Name, shipment.Id), topicId))
+		return err
+	}
+
+	key := "team:removed"
+	if shipment.HasDriver(driver.Id) {
+		err = parser.RemoveCoDriver(globalStorage, shipment.Id, driver.Id, audit.Bot(fromId))
+	} else {
+		if shipment.IsClosed() {
+			_, err = Bot.Send(tgbotapi.NewMessage(chatId, config.Translate(lang, "handover:closed", shipment.Id, shipment.Status.Title(lang)), topicId))
+			return err
+		}
+		key = "team:added"
+		err = parser.AddCoDriver(globalStorage, shipment.Id, driver.Id, audit.Bot(fromId))
+	}
+	if err != nil {
+		return err
+	}
+	if key == "team:removed" {
+		left := make([]int, 0)
+		for _, t := range shipment.UnfinishedTasks() {
+			left = append(left, t.Id)
+		}
+		releaseDriver(shipment.Id, driver.Id, left, globalStorage)
+	}
+
+	driverMsg := tgbotapi.NewMessage(driver.ChatId, config.Translate(config.GetLang(driver.ChatId), key, shipment.Id), 0)
+	driverMsg.ParseMode = tgbotapi.ModeHTML
+	if _, err = Bot.Send(driverMsg); err != nil {
+		errlog.ERR.Printf("ERR: telling driver %s about the team of shipment %d: %v\n", driver.User.Name, shipment.Id, err)
+	}
+
+	return SendTeamMenu(chatId, topicId, messageId, shipment.Id, globalStorage)
+}
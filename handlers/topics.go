@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"logistictbot/audit"
 	"logistictbot/config"
 	"logistictbot/db"
 	"logistictbot/errlog"
@@ -78,7 +79,7 @@ func HandleGroupCommands(chatId int64, command string, messageId int, user *tgbo
 		}
 
 		g := db.DriverGroup{CurrentCar: car, GroupChatId: groupChatId}
-		err = g.CreateDriverGroup(globalStorage)
+		err = g.CreateDriverGroup(globalStorage, audit.Bot(user.ID))
 		if err != nil {
 			errlog.ERR.Printf("ERR: Creating driver group: %v\n", err)
 			return fmt.Errorf("ERR: Creating driver group: %v\n", err)
@@ -100,7 +101,7 @@ func HandleGroupCommands(chatId int64, command string, messageId int, user *tgbo
 
 	if cmd == "register" {
 		u := db.User{ChatId: user.ID, Name: fmt.Sprintf("%s %s", user.FirstName, user.LastName), TgTag: user.UserName}
-		err := u.StoreUser(globalStorage)
+		err := u.StoreUser(globalStorage, audit.Bot(user.ID))
 		if err != nil {
 			errlog.ERR.Printf("ERR: storing user for a group: %v\n", err)
 			return fmt.Errorf("ERR: storing user for a group: %v\n", err)
@@ -151,7 +152,7 @@ func HandleGroupCommands(chatId int64, command string, messageId int, user *tgbo
 				return fmt.Errorf("ERR: getting user by id: %v\n", err)
 			}
 			d := &db.Driver{UserId: driverUser.Id, ChatId: driverUser.ChatId}
-			err = d.StoreDriver(globalStorage, Bot)
+			err = d.StoreDriver(globalStorage, Bot, audit.Bot(user.ID))
 			if err != nil {
 				errlog.ERR.Printf("ERR: storing driver: %v\n", err)
 				return fmt.Errorf("ERR: storing driver: %v\n", err)
@@ -183,7 +184,7 @@ func HandleGroupCommands(chatId int64, command string, messageId int, user *tgbo
 				return fmt.Errorf("ERR: getting user by id: %v\n", err)
 			}
 			m := &db.Manager{UserId: driverUser.Id, ChatId: driverUser.ChatId}
-			err = m.StoreManager(globalStorage, Bot)
+			err = m.StoreManager(globalStorage, Bot, audit.Bot(user.ID))
 			if err != nil {
 				errlog.ERR.Printf("ERR: storing manager: %v\n", err)
 				return fmt.Errorf("ERR: storing manager: %v\n", err)
@@ -210,7 +211,7 @@ func HandleGroupCommands(chatId int64, command string, messageId int, user *tgbo
 				errlog.ERR.Printf("ERR: getting driver by id: %v\n", err)
 				return fmt.Errorf("ERR: getting driver by id: %v\n", err)
 			}
-			err = driver.UpdateCarId(globalStorage, carId)
+			err = driver.UpdateCarId(globalStorage, carId, audit.Bot(user.ID))
 			if err != nil {
 				errlog.ERR.Printf("ERR: updating car id: %v\n", err)
 				return fmt.Errorf("ERR: updating car id: %v\n", err)
@@ -10,6 +10,7 @@ import (
 	"logistictbot/errlog"
 
 	"logistictbot/handlers"
+	"logistictbot/parser"
 	"net/http"
 	"os"
 
@@ -36,6 +37,20 @@ func main() {
 		return
 	}
 
+	// the dictionaries compiled into the binary stay in use if the files can not be read
+	if _, err = parser.LoadKeywords(config.GetKeywordsPath()); err != nil {
+		errlog.WARN.Printf("loading the parser keywords from %s: %v\n", config.GetKeywordsPath(), err)
+	}
+	if _, err = parser.LoadImportMappings(config.GetImportMappingsPath()); err != nil {
+		errlog.WARN.Printf("loading the import mappings from %s: %v\n", config.GetImportMappingsPath(), err)
+	}
+	if err = parser.LoadFreeTimes(config.GetFreeTimesPath()); err != nil {
+		errlog.WARN.Printf("loading the free times from %s: %v\n", config.GetFreeTimesPath(), err)
+	}
+	if err = parser.LoadPODRules(config.GetPODRulesPath()); err != nil {
+		errlog.WARN.Printf("loading the proof of delivery rules from %s: %v\n", config.GetPODRulesPath(), err)
+	}
+
 	globalStorage, err := sql.Open("sqlite3", "./bot.db")
 	if err != nil {
 		log.Fatalln("ERR: ", err)
@@ -52,6 +67,37 @@ func main() {
 		log.Fatalf("ERR: with the table: %v\n", err)
 	}
 
+	if n, err := parser.BackfillDeclaredQuantities(globalStorage); err != nil {
+		errlog.WARN.Printf("filling the declared quantities of the old tasks: %v\n", err)
+	} else if n > 0 {
+		log.Printf("filled the declared quantities of %d tasks\n", n)
+	}
+	if n, err := parser.BackfillAddressParts(globalStorage); err != nil {
+		errlog.WARN.Printf("splitting the addresses of the old tasks: %v\n", err)
+	} else if n > 0 {
+		log.Printf("split the addresses of %d tasks\n", n)
+	}
+	if n, err := parser.BackfillTaskCompanies(globalStorage); err != nil {
+		errlog.WARN.Printf("reading the company of the old tasks: %v\n", err)
+	} else if n > 0 {
+		log.Printf("read the company of %d tasks\n", n)
+	}
+	if n, err := parser.BackfillWindowTimezones(globalStorage); err != nil {
+		errlog.WARN.Printf("setting the timezone of the windows of the old tasks: %v\n", err)
+	} else if n > 0 {
+		log.Printf("set the window timezone of %d tasks\n", n)
+	}
+	if n, err := parser.BackfillTaskPositions(globalStorage); err != nil {
+		errlog.WARN.Printf("numbering the old tasks in their shipments: %v\n", err)
+	} else if n > 0 {
+		log.Printf("numbered %d tasks in their shipments\n", n)
+	}
+	if n, err := parser.BackfillShipmentStatuses(globalStorage); err != nil {
+		errlog.WARN.Printf("setting the status of the old shipments: %v\n", err)
+	} else if n > 0 {
+		log.Printf("set the status of %d shipments\n", n)
+	}
+
 	err = handlers.FillSessions(globalStorage)
 	if err != nil {
 		log.Fatalf("ERR: filling sessions: %v\n", err)
@@ -85,6 +131,7 @@ func main() {
 	defer cancel()
 
 	go handlers.PingNonReplies(globalStorage)
+	go handlers.MonitorTimeWindows(globalStorage)
 	go delq.DeleteWorker(globalStorage, handlers.Bot)
 	go handlers.ReceiveUpdates(ctx, updates, globalStorage)
 
@@ -95,6 +142,14 @@ func main() {
 
 	mux.HandleFunc("GET /api/shipments/{id}", handlers.WithAuth(globalStorage, handlers.Bot.Token, handlers.RequestShipment))
 	mux.HandleFunc("PUT /api/shipments/{id}", handlers.WithAuth(globalStorage, handlers.Bot.Token, handlers.RequestUpdateShipment))
+	mux.HandleFunc("GET /api/shipments/{id}/routesheet", handlers.WithAuth(globalStorage, handlers.Bot.Token, handlers.RequestRouteSheet))
+	mux.HandleFunc("GET /api/shipments/{id}/status", handlers.WithAuth(globalStorage, handlers.Bot.Token, handlers.RequestShipmentStatus))
+	mux.HandleFunc("PUT /api/shipments/{id}/status", handlers.WithAuth(globalStorage, handlers.Bot.Token, handlers.RequestUpdateShipmentStatus))
+	mux.HandleFunc("GET /api/shipments/{id}/audit", handlers.WithAuth(globalStorage, handlers.Bot.Token, handlers.RequestShipmentAudit))
+	mux.HandleFunc("GET /api/drivers/{id}/audit", handlers.WithAuth(globalStorage, handlers.Bot.Token, handlers.RequestDriverAudit))
+	mux.HandleFunc("GET /api/search", handlers.WithAuth(globalStorage, handlers.Bot.Token, handlers.RequestSearch))
+	mux.HandleFunc("GET /api/tasks/{id}/signature", handlers.WithAuth(globalStorage, handlers.Bot.Token, handlers.RequestTaskSignatures))
+	mux.HandleFunc("POST /api/tasks/{id}/signature", handlers.WithAuth(globalStorage, handlers.Bot.Token, handlers.RequestSignTask))
 
 	log.Printf("Listening on port %s", port)
 	if err := http.ListenAndServe(":"+port, mux); err != nil {
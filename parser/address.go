@@ -0,0 +1,197 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+)
+
+// AddressParts is TaskSection.Address split up. It always describes Address, the place the truck goes to,
+// even after it was replaced by a cleaning station or corrected by the driver (OriginalAddress keeps the one from the document)
+type AddressParts struct {
+	Name     string // company or site, everything before the street
+	Street   string
+	Postcode string
+	City     string
+	Country  string // ISO 3166-1 alpha-2, the same codes as in Countries
+}
+
+func (a AddressParts) IsZero() bool {
+	return a == AddressParts{}
+}
+
+// postcodePatterns are the postcodes without the country prefix, the way the post of the country writes them
+var postcodePatterns = map[string]*regexp.Regexp{
+	CountryBE: regexp.MustCompile(`^\d{4}$`),
+	CountryDE: regexp.MustCompile(`^\d{5}$`),
+	CountryNL: regexp.MustCompile(`^\d{4} ?[A-Z]{2}$`),
+	CountryFR: regexp.MustCompile(`^\d{5}$`),
+	CountryPL: regexp.MustCompile(`^\d{2}-\d{3}$`),
+	CountryCZ: regexp.MustCompile(`^\d{3} ?\d{2}$`),
+	CountryAT: regexp.MustCompile(`^\d{4}$`),
+	CountrySK: regexp.MustCompile(`^\d{3} ?\d{2}$`),
+	CountryHU: regexp.MustCompile(`^\d{4}$`),
+	CountrySI: regexp.MustCompile(`^\d{4}$`),
+	CountryHR: regexp.MustCompile(`^\d{5}$`),
+	CountryRO: regexp.MustCompile(`^\d{6}$`),
+	CountryBG: regexp.MustCompile(`^\d{4}$`),
+	CountryRS: regexp.MustCompile(`^\d{5}$`),
+	CountryUA: regexp.MustCompile(`^\d{5}$`),
+	CountryLT: regexp.MustCompile(`^\d{5}$`),
+	CountryLV: regexp.MustCompile(`^\d{4}$`),
+	CountryEE: regexp.MustCompile(`^\d{5}$`),
+	CountryCH: regexp.MustCompile(`^\d{4}$`),
+	CountryLU: regexp.MustCompile(`^\d{4}$`),
+	CountryPT: regexp.MustCompile(`^\d{4}-\d{3}$`),
+	CountryES: regexp.MustCompile(`^\d{5}$`),
+	CountryIT: regexp.MustCompile(`^\d{5}$`),
+	CountryGB: regexp.MustCompile(`^[A-Z]{1,2}\d[A-Z\d]? ?\d[A-Z]{2}$`),
+	CountryIE: regexp.MustCompile(`^[A-Z]\d[\dW] ?[\dA-Z]{4}$`), // Eircode
+}
+
+// countryAliases are the other ways the documents name the country, next to the ISO code
+var countryAliases = map[string]string{
+	"D": CountryDE, "GERMANY": CountryDE, "DEUTSCHLAND": CountryDE, "ALLEMAGNE": CountryDE, "NIEMCY": CountryDE,
+	"B": CountryBE, "BELGIUM": CountryBE, "BELGIQUE": CountryBE, "BELGIË": CountryBE, "BELGIEN": CountryBE,
+	"F": CountryFR, "FRANCE": CountryFR, "FRANKREICH": CountryFR, "FRANCJA": CountryFR,
+	"NETHERLANDS": CountryNL, "NEDERLAND": CountryNL, "NIEDERLANDE": CountryNL, "PAYS-BAS": CountryNL, "HOLANDIA": CountryNL,
+	"POLAND": CountryPL, "POLSKA": CountryPL, "POLEN": CountryPL, "POLOGNE": CountryPL,
+	"A": CountryAT, "AUSTRIA": CountryAT, "ÖSTERREICH": CountryAT,
+	"CZECHIA": CountryCZ, "CZECH REPUBLIC": CountryCZ, "TSCHECHIEN": CountryCZ,
+	"L": CountryLU, "LUXEMBOURG": CountryLU, "LUXEMBURG": CountryLU,
+	"SWITZERLAND": CountryCH, "SCHWEIZ": CountryCH, "SUISSE": CountryCH,
+	"UK": CountryGB, "UNITED KINGDOM": CountryGB, "GREAT BRITAIN": CountryGB, "ENGLAND": CountryGB,
+	"IRL": CountryIE, "IRELAND": CountryIE,
+	"P": CountryPT, "PORTUGAL": CountryPT,
+	"E": CountryES, "SPAIN": CountryES, "ESPAÑA": CountryES, "SPANIEN": CountryES, "HISZPANIA": CountryES,
+	"I": CountryIT, "ITALY": CountryIT, "ITALIA": CountryIT, "ITALIEN": CountryIT, "WŁOCHY": CountryIT,
+}
+
+// "DE-67056 LUDWIGSHAFEN", "D 67056 LUDWIGSHAFEN", "67056 LUDWIGSHAFEN", "PL-56-120 BRZEG DOLNY", "NL-4542 NM HOEK", "PT-4450-001 MATOSINHOS",
+// "GB-E16 2EW LONDON", "IRL-T12 X5R2 CORK"
+var postcodeLineRe = regexp.MustCompile(`(?i)^(?:([A-Z]{1,3})[- ])?(\d{4}-\d{3}|\d{2}-\d{3}|\d{4} ?[A-Z]{2}\b|\d{3} \d{2}\b|\d{4,6}|` +
+	britishPostcode + `)\b\s*(.*)$`)
+
+// the UK and Ireland write the postcode after the town: "MIDDLESBROUGH TS2 1UB", "CORK T12 X5R2"
+var postcodeAfterCityRe = regexp.MustCompile(`(?i)^(.+?)\s+(` + britishPostcode + `)$`)
+
+// britishPostcode is a UK postcode or an Eircode
+const britishPostcode = `[A-Z]{1,2}\d[A-Z\d]? ?\d[A-Z]{2}|[A-Z]\d[\dW] ?[\dA-Z]{4}`
+
+// matchPostcodeLine finds the postcode in one part of the address, with the country prefix before it and the city
+func matchPostcodeLine(part string) (prefix, postcode, city string, ok bool) {
+	if m := postcodeLineRe.FindStringSubmatch(part); m != nil {
+		return m[1], m[2], m[3], true
+	}
+	if m := postcodeAfterCityRe.FindStringSubmatch(part); m != nil {
+		return "", m[2], m[1], true
+	}
+	return "", "", "", false
+}
+
+// ParseAddress splits an address like "BASF SE, CARL-BOSCH-STRASSE 38, DE-67056 LUDWIGSHAFEN".
+// The postcode part is searched from the end, the part before it is the street and the rest is the name.
+// false means there was no postcode that fits the country, the parts are then empty and only Address is usable.
+// Country is empty when the address does not say it and the postcode could be of several countries
+func ParseAddress(address string) (AddressParts, bool) {
+	parts := make([]string, 0)
+	for part := range strings.SplitSeq(address, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	// a country written as its own part at the end ("..., 67056 LUDWIGSHAFEN, GERMANY")
+	trailingCountry := ""
+	if len(parts) > 1 {
+		if code, ok := countryFromName(parts[len(parts)-1]); ok {
+			trailingCountry = code
+			parts = parts[:len(parts)-1]
+		}
+	}
+
+	for i := len(parts) - 1; i >= 0; i-- {
+		prefix, postcode, city, ok := matchPostcodeLine(parts[i])
+		if !ok {
+			continue
+		}
+
+		postcode = strings.ToUpper(postcode)
+		country := trailingCountry
+		if prefix != "" {
+			code, ok := countryFromName(prefix)
+			if !ok {
+				continue
+			}
+			country = code
+		}
+		if country == "" {
+			// a code somewhere in the text is only taken when the postcode is one of that country
+			if code := ExtractCountryCode(address); postcodeOf(code, postcode) {
+				country = code
+			}
+		}
+		if country == "" {
+			country = countryFromPostcode(postcode)
+		}
+
+		if country != "" && !postcodeOf(country, postcode) {
+			continue
+		}
+		// "76700 HARFLEUR" is a postcode, but of France, Spain or Germany alike, so the country stays unknown
+		if country == "" && !anyPostcode(postcode) {
+			continue
+		}
+
+		a := AddressParts{
+			Postcode: postcode,
+			City:     strings.TrimSpace(city),
+			Country:  country,
+		}
+		// "..., 12345, CITY" - the city got its own part
+		if a.City == "" && i+1 < len(parts) {
+			a.City = parts[i+1]
+		}
+		if i > 0 {
+			a.Street = parts[i-1]
+		}
+		if i > 1 {
+			a.Name = strings.Join(parts[:i-1], ", ")
+		}
+		return a, true
+	}
+
+	return AddressParts{}, false
+}
+
+func countryFromName(s string) (string, bool) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if _, ok := Countries[s]; ok {
+		return s, true
+	}
+	code, ok := countryAliases[s]
+	return code, ok
+}
+
+func postcodeOf(country, postcode string) bool {
+	pattern, ok := postcodePatterns[country]
+	return ok && pattern.MatchString(postcode)
+}
+
+func anyPostcode(postcode string) bool {
+	for _, pattern := range postcodePatterns {
+		if pattern.MatchString(postcode) {
+			return true
+		}
+	}
+	return false
+}
+
+// countryFromPostcode only knows the formats that no other country uses
+func countryFromPostcode(postcode string) string {
+	for _, country := range []string{CountryPL, CountryNL, CountryPT, CountryGB, CountryIE} {
+		if postcodePatterns[country].MatchString(postcode) {
+			return country
+		}
+	}
+	return ""
+}
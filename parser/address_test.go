@@ -0,0 +1,50 @@
+package parser
+
+import "testing"
+
+func TestParseAddress(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want AddressParts
+		ok   bool
+	}{
+		{"country prefix", "BASF SE, CARL-BOSCH-STRASSE 38, DE-67056 LUDWIGSHAFEN",
+			AddressParts{Name: "BASF SE", Street: "CARL-BOSCH-STRASSE 38", Postcode: "67056", City: "LUDWIGSHAFEN", Country: CountryDE}, true},
+		{"dutch postcode", "VOPAK, SLOEWEG 1, 4542 NM HOEK",
+			AddressParts{Name: "VOPAK", Street: "SLOEWEG 1", Postcode: "4542 NM", City: "HOEK", Country: CountryNL}, true},
+		{"polish postcode", "PCC ROKITA, SIENKIEWICZA 4, 56-120 BRZEG DOLNY",
+			AddressParts{Name: "PCC ROKITA", Street: "SIENKIEWICZA 4", Postcode: "56-120", City: "BRZEG DOLNY", Country: CountryPL}, true},
+		{"trailing country", "HAFENSTRASSE 2, 47059 DUISBURG, GERMANY",
+			AddressParts{Street: "HAFENSTRASSE 2", Postcode: "47059", City: "DUISBURG", Country: CountryDE}, true},
+		{"city in its own part", "RUE DU PORT 5, F-69007, LYON",
+			AddressParts{Street: "RUE DU PORT 5", Postcode: "69007", City: "LYON", Country: CountryFR}, true},
+		{"uk postcode after the country", "CHEMICAL TERMINAL, DOCK ROAD, GB-E16 2EW LONDON",
+			AddressParts{Name: "CHEMICAL TERMINAL", Street: "DOCK ROAD", Postcode: "E16 2EW", City: "LONDON", Country: CountryGB}, true},
+		{"uk postcode after the town", "SABIC UK, SEAL SANDS ROAD, MIDDLESBROUGH TS2 1UB, UNITED KINGDOM",
+			AddressParts{Name: "SABIC UK", Street: "SEAL SANDS ROAD", Postcode: "TS2 1UB", City: "MIDDLESBROUGH", Country: CountryGB}, true},
+		{"eircode", "PFIZER, RINGASKIDDY, CORK T12 X5R2, IRELAND",
+			AddressParts{Name: "PFIZER", Street: "RINGASKIDDY", Postcode: "T12 X5R2", City: "CORK", Country: CountryIE}, true},
+		{"eircode with the country prefix", "DUBLIN PORT, ALEXANDRA ROAD, IRL-D01 K2X4 DUBLIN",
+			AddressParts{Name: "DUBLIN PORT", Street: "ALEXANDRA ROAD", Postcode: "D01 K2X4", City: "DUBLIN", Country: CountryIE}, true},
+		{"french address without the country", "TOTAL, RUE DE LA PAIX 5, 76700 HARFLEUR",
+			AddressParts{Name: "TOTAL", Street: "RUE DE LA PAIX 5", Postcode: "76700", City: "HARFLEUR"}, true},
+		{"spanish address without the country", "REPSOL, CALLE DE LA INDUSTRIA 3, 28001 MADRID",
+			AddressParts{Name: "REPSOL", Street: "CALLE DE LA INDUSTRIA 3", Postcode: "28001", City: "MADRID"}, true},
+		{"portuguese address without the country", "GALP, RUA DE SANTA MARIA 5, 4450-001 MATOSINHOS",
+			AddressParts{Name: "GALP", Street: "RUA DE SANTA MARIA 5", Postcode: "4450-001", City: "MATOSINHOS", Country: CountryPT}, true},
+		{"code in the text that does not fit the postcode", "TERMINAL AT PIER 7, 28001 MADRID",
+			AddressParts{Street: "TERMINAL AT PIER 7", Postcode: "28001", City: "MADRID"}, true},
+		{"postcode not of the country", "SOMEWHERE 1, DE-1234 NOWHERE", AddressParts{}, false},
+		{"no postcode", "TERMINAL 3, ANTWERP", AddressParts{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseAddress(tt.in)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("ParseAddress(%q) = %+v, %v; want %+v, %v", tt.in, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
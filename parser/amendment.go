@@ -0,0 +1,125 @@
+package parser
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"logistictbot/audit"
+	"logistictbot/errlog"
+	"time"
+)
+
+// ErrShipmentClosed is given for an amendment of a shipment that is finished, invoiced or cancelled, its data is not
+// changed by a resent document anymore
+var ErrShipmentClosed = errors.New("the shipment is closed")
+
+// ShipmentExists says if a shipment with the number is stored already, a document with it is then an amendment
+func ShipmentExists(db *sql.DB, shipmentId int64) (bool, error) {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM shipments WHERE id = ?`, shipmentId).Scan(&count)
+	if err != nil {
+		errlog.ERR.Printf("ERR: checking if shipment %d exists: %v\n", shipmentId, err)
+		return false, fmt.Errorf("ERR: checking if shipment %d exists: %v", shipmentId, err)
+	}
+	return count > 0, nil
+}
+
+// DiffAmendment compares the amended document with the stored shipment. It is the same diff as the reparse one,
+// only that the new and missing tasks are also added and removed when the amendment is applied. A closed shipment
+// gives ErrShipmentClosed
+func DiffAmendment(db *sql.DB, amended *Shipment) (*ReparseResult, error) {
+	stored, err := GetShipment(db, amended.Id)
+	if err != nil {
+		return nil, fmt.Errorf("ERR: getting shipment %d for the amendment: %v", amended.Id, err)
+	}
+	if stored.IsClosed() {
+		return nil, fmt.Errorf("%w: shipment %d is %s", ErrShipmentClosed, stored.Id, stored.Status)
+	}
+
+	result := diffShipments(stored, amended)
+	result.DocId = amended.ShipmentDocId
+	return result, nil
+}
+
+// ApplyAmendment updates the stored shipment in place with the amended document. The diff is made again, the shipment
+// could have changed since the manager saw it, a shipment closed in the meantime gives ErrShipmentClosed. Driver progress (start, end, entered values, a replaced address) stays,
+// and tasks missing from the new document are only removed if they were not started yet, the rest are in KeptTasks
+func ApplyAmendment(db *sql.DB, amended *Shipment, by audit.Actor) (*ReparseResult, error) {
+	result, err := DiffAmendment(db, amended)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		errlog.ERR.Printf("ERR: begin transaction: %v", err)
+		return nil, fmt.Errorf("ERR: begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	for _, diff := range result.Diffs {
+		if err = applyFieldDiff(tx, amended.Id, diff, by); err != nil {
+			return nil, err
+		}
+	}
+
+	// the new tasks go after the stored ones, the order the manager may have set stays
+	var lastPosition int
+	if err = tx.QueryRow(`SELECT COALESCE(MAX(position), 0) FROM tasks WHERE shipment_id = ?`, amended.Id).Scan(&lastPosition); err != nil {
+		errlog.ERR.Printf("ERR: getting the last task position of shipment %d: %v\n", amended.Id, err)
+		return nil, fmt.Errorf("ERR: getting the last task position of shipment %d: %v", amended.Id, err)
+	}
+	for _, taskType := range result.NewTasks {
+		for _, t := range amended.Tasks {
+			if t.Type != taskType {
+				continue
+			}
+			lastPosition++
+			if err = amended.storeTask(tx, t, lastPosition, by); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	missing := result.MissingTasks
+	result.MissingTasks = nil
+	for _, taskType := range missing {
+		var removedId int
+		err := tx.QueryRow(`DELETE FROM tasks WHERE shipment_id = ? AND type = ? AND start IS NULL RETURNING id`, amended.Id, taskType).Scan(&removedId)
+		if errors.Is(err, sql.ErrNoRows) {
+			result.KeptTasks = append(result.KeptTasks, taskType)
+			continue
+		}
+		if err != nil {
+			errlog.ERR.Printf("ERR: removing %s task of shipment %d: %v\n", taskType, amended.Id, err)
+			return nil, fmt.Errorf("ERR: removing %s task of shipment %d: %v", taskType, amended.Id, err)
+		}
+		if err = audit.Deleted(tx, by, audit.Target{Entity: audit.EntityTask, Id: removedId, ShipmentId: amended.Id}, taskType); err != nil {
+			return nil, err
+		}
+		result.MissingTasks = append(result.MissingTasks, taskType)
+	}
+
+	docBefore, err := audit.Before(tx, audit.Target{Entity: audit.EntityShipment, Id: amended.Id, ShipmentId: amended.Id}, "doc_id")
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if _, err = tx.Exec(`UPDATE shipments SET doc_id = ?, updated_at = ? WHERE id = ?`, amended.ShipmentDocId, now, amended.Id); err != nil {
+		errlog.ERR.Printf("ERR: linking amended document to shipment %d: %v\n", amended.Id, err)
+		return nil, fmt.Errorf("ERR: linking amended document to shipment %d: %v", amended.Id, err)
+	}
+	if _, err = tx.Exec(`UPDATE tasks SET doc_id = ? WHERE shipment_id = ?`, amended.ShipmentDocId, amended.Id); err != nil {
+		errlog.ERR.Printf("ERR: linking amended document to the tasks of shipment %d: %v\n", amended.Id, err)
+		return nil, fmt.Errorf("ERR: linking amended document to the tasks of shipment %d: %v", amended.Id, err)
+	}
+	if err = docBefore.After(tx, by); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		errlog.ERR.Printf("ERR: commit transaction: %v", err)
+		return nil, fmt.Errorf("ERR: commit transaction: %v", err)
+	}
+	return result, nil
+}
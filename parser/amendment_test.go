@@ -0,0 +1,140 @@
+package parser_test
+
+import (
+	"errors"
+	"logistictbot/audit"
+	"logistictbot/parser"
+	"slices"
+	"testing"
+)
+
+func compartmentLoad(products ...string) *parser.TaskSection {
+	t := &parser.TaskSection{Type: parser.TaskLoad, Address: "BASF SE, CARL-BOSCH-STRASSE 38, DE-67056 LUDWIGSHAFEN"}
+	for i, product := range products {
+		t.Compartments = append(t.Compartments, &parser.TaskCompartment{Number: i + 1, Product: product, Weight: "8000 kg"})
+	}
+	t.Compartment = len(products)
+	return t
+}
+
+func TestApplyAmendmentCompartments(t *testing.T) {
+	s := openTestDB(t)
+	storeTestShipment(t, s, 4334001, compartmentLoad("METHANOL", "ETHANOL", "ACETONE"))
+
+	stored, err := parser.GetShipment(s, 4334001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the driver measured the first and the third compartment
+	kg, temp := 7950, 12.5
+	for _, i := range []int{0, 2} {
+		c := stored.Tasks[0].Compartments[i]
+		c.ActualWeight, c.ActualTemperature = &kg, &temp
+		if err = c.UpdateActualWeight(s, stored.Tasks[0], audit.System); err != nil {
+			t.Fatal(err)
+		}
+		if err = c.UpdateActualTemperature(s, stored.Tasks[0], audit.System); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the new document changes the product of the first one and does not list the second and the third anymore
+	result, err := parser.ApplyAmendment(s, testShipment(4334001, compartmentLoad("ISOPROPANOL")), audit.System)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Diffs) != 1 || result.Diffs[0].Field != "compartments" {
+		t.Fatalf("diffs = %+v, want only the compartments", result.Diffs)
+	}
+
+	amended, err := parser.GetShipment(s, 4334001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	task := amended.Tasks[0]
+	if task.Compartment != 1 {
+		t.Errorf("compartment count = %d, want 1", task.Compartment)
+	}
+	if len(task.Compartments) != 2 {
+		t.Fatalf("got %d compartments, want the amended one and the measured one that is not listed anymore", len(task.Compartments))
+	}
+	first, third := task.Compartments[0], task.Compartments[1]
+	if first.Number != 1 || first.Product != "ISOPROPANOL" || !first.Measured() || *first.ActualWeight != kg {
+		t.Errorf("first compartment = %+v, want the new product with the measured weight kept", first)
+	}
+	if third.Number != 3 || !third.Measured() {
+		t.Errorf("measured compartment 3 was not kept: %+v", third)
+	}
+
+	// the same document again changes nothing
+	if result, err = parser.DiffAmendment(s, testShipment(4334001, compartmentLoad("ISOPROPANOL"))); err != nil {
+		t.Fatal(err)
+	}
+	if result.HasChanges() {
+		t.Errorf("the applied amendment still differs: %+v", result.Diffs)
+	}
+}
+
+func TestApplyAmendmentTasks(t *testing.T) {
+	s := openTestDB(t)
+	load, unload := testShipment(0).Tasks[0], testShipment(0).Tasks[1]
+	cleaning := &parser.TaskSection{Type: parser.TaskCleaning, Address: "TANKREINIGUNG, DE-67063 LUDWIGSHAFEN"}
+	storeTestShipment(t, s, 4334002, load, cleaning, unload)
+	// the driver is at the load already
+	mustExec(t, s, `UPDATE tasks SET start = CURRENT_TIMESTAMP WHERE shipment_id = ? AND type = ?`, 4334002, parser.TaskLoad)
+
+	// the new document has neither the load nor the cleaning, and a dropoff after the unload
+	dropoff := &parser.TaskSection{Type: parser.TaskDropoff, Address: "CONTAINER DEPOT, DE-68159 MANNHEIM"}
+	result, err := parser.ApplyAmendment(s, testShipment(4334002, unload, dropoff), audit.System)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(result.KeptTasks, []string{parser.TaskLoad}) {
+		t.Errorf("kept tasks = %v, want the started load", result.KeptTasks)
+	}
+	if !slices.Equal(result.MissingTasks, []string{parser.TaskCleaning}) {
+		t.Errorf("removed tasks = %v, want the cleaning", result.MissingTasks)
+	}
+	if !slices.Equal(result.NewTasks, []string{parser.TaskDropoff}) {
+		t.Errorf("new tasks = %v, want the dropoff", result.NewTasks)
+	}
+
+	amended, err := parser.GetShipment(s, 4334002)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for _, task := range amended.Tasks {
+		types = append(types, task.Type)
+	}
+	if want := []string{parser.TaskLoad, parser.TaskUnload, parser.TaskDropoff}; !slices.Equal(types, want) {
+		t.Errorf("tasks = %v, want %v with the new one at the end", types, want)
+	}
+}
+
+func TestApplyAmendmentClosedShipment(t *testing.T) {
+	for _, status := range []parser.ShipmentStatus{parser.StatusFinished, parser.StatusInvoiced, parser.StatusCancelled} {
+		t.Run(string(status), func(t *testing.T) {
+			s := openTestDB(t)
+			storeTestShipment(t, s, 4334003)
+			mustExec(t, s, `UPDATE shipments SET status = ? WHERE id = ?`, status, 4334003)
+
+			amended := testShipment(4334003)
+			amended.CarId = "CAR2"
+			if _, err := parser.DiffAmendment(s, amended); !errors.Is(err, parser.ErrShipmentClosed) {
+				t.Errorf("DiffAmendment err = %v, want ErrShipmentClosed", err)
+			}
+			if _, err := parser.ApplyAmendment(s, amended, audit.System); !errors.Is(err, parser.ErrShipmentClosed) {
+				t.Errorf("ApplyAmendment err = %v, want ErrShipmentClosed", err)
+			}
+
+			stored, err := parser.GetShipment(s, 4334003)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.CarId != "CAR1" {
+				t.Errorf("car = %s, the closed shipment was changed", stored.CarId)
+			}
+		})
+	}
+}
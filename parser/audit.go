@@ -0,0 +1,52 @@
+package parser
+
+import (
+	"database/sql"
+	"fmt"
+	"logistictbot/audit"
+	"logistictbot/errlog"
+
+	"github.com/gofrs/uuid"
+)
+
+func auditDriver(id uuid.UUID) string {
+	if id.IsNil() {
+		return ""
+	}
+	return id.String()
+}
+
+func (s *Shipment) auditTarget() audit.Target {
+	return audit.Target{Entity: audit.EntityShipment, Id: s.Id, ShipmentId: s.Id, DriverId: auditDriver(s.DriverId)}
+}
+
+func (t *TaskSection) auditTarget() audit.Target {
+	return audit.Target{Entity: audit.EntityTask, Id: t.Id, ShipmentId: t.ShipmentId, DriverId: auditDriver(t.DriverId)}
+}
+
+// auditedWrite runs write in a transaction and records what it changed in the columns of target
+func auditedWrite(db *sql.DB, by audit.Actor, target audit.Target, columns []string, write func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		errlog.ERR.Printf("ERR: begin transaction: %v", err)
+		return fmt.Errorf("ERR: begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	before, err := audit.Before(tx, target, columns...)
+	if err != nil {
+		return err
+	}
+	if err = write(tx); err != nil {
+		return err
+	}
+	if err = before.After(tx, by); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		errlog.ERR.Printf("ERR: commit transaction: %v", err)
+		return fmt.Errorf("ERR: commit transaction: %v", err)
+	}
+	return nil
+}
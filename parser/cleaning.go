@@ -0,0 +1,125 @@
+package parser
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"logistictbot/audit"
+	"logistictbot/errlog"
+)
+
+// CleaningRecord is what the European Cleaning Document (ECD) of a cleaning task says: on which station the tank was
+// cleaned, what was in it before and how it was cleaned. The driver gives it at the end of the task, with a photo of it
+type CleaningRecord struct {
+	Id        int
+	TaskId    int
+	EcdNumber string
+	// cleaning_stations.id of the station the manager chose, 0 when he wrote the address himself
+	StationId       int
+	StationName     string
+	StationAddress  string
+	PreviousProduct string
+	CleaningType    string
+	// files.id of the photo of the certificate, 0 until the driver sends it
+	CertificateFileId int
+}
+
+const cleaningColumns = `c.id, c.task_id, COALESCE(c.ecd_number, ''), COALESCE(c.cleaning_station_id, 0),
+	COALESCE(s.name, ''), COALESCE(s.address, ''), COALESCE(c.previous_product, ''), COALESCE(c.cleaning_type, ''),
+	COALESCE(c.certificate_file_id, 0)`
+
+func (r *CleaningRecord) auditTarget(t *TaskSection) audit.Target {
+	return audit.Target{Entity: audit.EntityCleaning, Id: r.Id, ShipmentId: t.ShipmentId, DriverId: auditDriver(t.DriverId)}
+}
+
+func scanCleaning(rows interface{ Scan(...any) error }) (*CleaningRecord, error) {
+	r := new(CleaningRecord)
+	err := rows.Scan(&r.Id, &r.TaskId, &r.EcdNumber, &r.StationId, &r.StationName, &r.StationAddress,
+		&r.PreviousProduct, &r.CleaningType, &r.CertificateFileId)
+	return r, err
+}
+
+// GetCleaningRecord gives the ECD of the cleaning task, an empty one when nothing of it is known yet
+func GetCleaningRecord(db *sql.DB, taskId int) (*CleaningRecord, error) {
+	r, err := scanCleaning(db.QueryRow(`SELECT `+cleaningColumns+`
+		FROM task_cleanings c
+		LEFT JOIN cleaning_stations s ON s.id = c.cleaning_station_id
+		WHERE c.task_id = ?`, taskId))
+	if errors.Is(err, sql.ErrNoRows) {
+		return &CleaningRecord{TaskId: taskId}, nil
+	}
+	if err != nil {
+		errlog.ERR.Printf("ERR: getting the cleaning of task %d: %v\n", taskId, err)
+		return nil, fmt.Errorf("ERR: getting the cleaning of task %d: %v", taskId, err)
+	}
+	return r, nil
+}
+
+// loadCleanings puts the ECDs into the cleaning tasks of the shipment
+func loadCleanings(exec audit.Executor, shipmentId int64, tasks []*TaskSection) error {
+	rows, err := exec.Query(`SELECT `+cleaningColumns+`
+		FROM task_cleanings c
+		JOIN tasks t ON t.id = c.task_id
+		LEFT JOIN cleaning_stations s ON s.id = c.cleaning_station_id
+		WHERE t.shipment_id = ?`, shipmentId)
+	if err != nil {
+		errlog.ERR.Printf("ERR: querying the cleanings of shipment %d: %v\n", shipmentId, err)
+		return fmt.Errorf("ERR: querying the cleanings of shipment %d: %v", shipmentId, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		r, err := scanCleaning(rows)
+		if err != nil {
+			return fmt.Errorf("ERR: scanning a cleaning: %v", err)
+		}
+		for _, t := range tasks {
+			if t.Id == r.TaskId {
+				t.Cleaning = r
+			}
+		}
+	}
+	return rows.Err()
+}
+
+// writeCleaning sets one column of the ECD of the cleaning task t, the row is made when it is the first thing known of it
+func (t *TaskSection) writeCleaning(db *sql.DB, column string, value any, by audit.Actor) error {
+	r := &CleaningRecord{TaskId: t.Id}
+	err := db.QueryRow(`INSERT INTO task_cleanings (task_id) VALUES (?)
+		ON CONFLICT(task_id) DO UPDATE SET task_id = excluded.task_id
+		RETURNING id`, t.Id).Scan(&r.Id)
+	if err != nil {
+		errlog.ERR.Printf("ERR: making the cleaning of task %d: %v\n", t.Id, err)
+		return fmt.Errorf("ERR: making the cleaning of task %d: %v", t.Id, err)
+	}
+
+	return auditedWrite(db, by, r.auditTarget(t), []string{column}, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`UPDATE task_cleanings SET `+column+` = ?, updated_at = datetime('now') WHERE id = ?`, value, r.Id)
+		return err
+	})
+}
+
+// UpdateCleaningStation writes the station (cleaning_stations.id) the manager chose for the cleaning task
+func (t *TaskSection) UpdateCleaningStation(db *sql.DB, stationId int, by audit.Actor) error {
+	return t.writeCleaning(db, "cleaning_station_id", stationId, by)
+}
+
+// UpdateEcdNumber writes the number of the European Cleaning Document
+func (t *TaskSection) UpdateEcdNumber(db *sql.DB, number string, by audit.Actor) error {
+	return t.writeCleaning(db, "ecd_number", number, by)
+}
+
+// UpdatePreviousProduct writes the product that was in the tank before the cleaning
+func (t *TaskSection) UpdatePreviousProduct(db *sql.DB, product string, by audit.Actor) error {
+	return t.writeCleaning(db, "previous_product", product, by)
+}
+
+// UpdateCleaningType writes how the tank was cleaned, as the ECD says it
+func (t *TaskSection) UpdateCleaningType(db *sql.DB, cleaningType string, by audit.Actor) error {
+	return t.writeCleaning(db, "cleaning_type", cleaningType, by)
+}
+
+// UpdateCleaningCertificate writes the file (files.id) of the photo of the ECD
+func (t *TaskSection) UpdateCleaningCertificate(db *sql.DB, fileId int, by audit.Actor) error {
+	return t.writeCleaning(db, "certificate_file_id", fileId, by)
+}
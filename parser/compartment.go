@@ -0,0 +1,282 @@
+package parser
+
+import (
+	"database/sql"
+	"fmt"
+	"logistictbot/audit"
+	"logistictbot/errlog"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// TaskCompartment is one compartment of a multi-compartment tank: what the document declares for it,
+// and what the driver measured in it at the end of the task
+type TaskCompartment struct {
+	Id     int
+	TaskId int
+	Number int // the number of the compartment in the document
+	// as written in the document
+	Product     string
+	Weight      string
+	Volume      string
+	Temperature string
+	// Weight, Volume and Temperature as numbers with units, zero when they could not be read
+	DeclaredWeight      Quantity
+	DeclaredVolume      Quantity
+	DeclaredTemperature Quantity
+	// what the driver measured, nil until he did
+	ActualWeight      *int // kg
+	ActualTemperature *float64
+}
+
+// Measured says if the driver gave both the weight and the temperature of the compartment
+func (c *TaskCompartment) Measured() bool {
+	return c.ActualWeight != nil && c.ActualTemperature != nil
+}
+
+// summary is what the document declares for the compartment in one line
+func (c *TaskCompartment) summary() string {
+	parts := make([]string, 0, 4)
+	for _, part := range []string{c.Product, c.Weight, c.Volume, c.Temperature} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// NextToMeasure is the first compartment the driver has not measured yet, nil when he measured all of them
+func NextToMeasure(compartments []*TaskCompartment) *TaskCompartment {
+	for _, c := range compartments {
+		if !c.Measured() {
+			return c
+		}
+	}
+	return nil
+}
+
+// hasCompartmentBlocks says if the compartments of the task are listed one by one, every one with its own product, weight,
+// volume and temperature below it ("Kammer 1", "Kammer 2"). A single compartment line is how many compartments the tank has
+func hasCompartmentBlocks(lines []string) bool {
+	found := 0
+	for _, line := range lines {
+		a, f := cutLongestPrefix(strings.ToLower(line), DetailsKeywords[Compartment])
+		if !f {
+			continue
+		}
+		if _, err := strconv.Atoi(strings.TrimSpace(a)); err == nil {
+			found++
+		}
+	}
+	return found > 1
+}
+
+// finishCompartments cleans up what getTaskDetails read into the compartments the way it does for the task.
+// The task counts the compartments, and without a product of its own it carries the products of the compartments
+func (t *TaskSection) finishCompartments() {
+	if len(t.Compartments) == 0 {
+		return
+	}
+
+	products := make([]string, 0, len(t.Compartments))
+	for _, c := range t.Compartments {
+		c.Product = esc(strings.ToUpper(strings.TrimSuffix(c.Product, ", ")))
+		c.Weight = esc(c.Weight)
+		c.Volume = esc(c.Volume)
+		c.Temperature = esc(c.Temperature)
+
+		c.DeclaredWeight, _ = ParseWeight(c.Weight)
+		c.DeclaredVolume, _ = ParseVolume(c.Volume)
+		c.DeclaredTemperature, _ = ParseTemperature(c.Temperature)
+
+		if c.Product != "" && !slices.Contains(products, c.Product) {
+			products = append(products, c.Product)
+		}
+	}
+
+	t.Compartment = len(t.Compartments)
+	if t.Product == "" {
+		t.Product = strings.Join(products, "; ")
+	}
+	if t.Weight == "" {
+		if total, ok := sumCompartments(t.Compartments, func(c *TaskCompartment) Quantity { return c.DeclaredWeight }, Quantity.Kilograms); ok {
+			t.DeclaredWeight = Quantity{Value: total, Unit: UnitKilogram}
+			t.Weight = t.DeclaredWeight.String()
+		}
+	}
+	if t.Volume == "" {
+		if total, ok := sumCompartments(t.Compartments, func(c *TaskCompartment) Quantity { return c.DeclaredVolume }, Quantity.Litres); ok {
+			t.DeclaredVolume = Quantity{Value: total, Unit: UnitLitre}
+			t.Volume = t.DeclaredVolume.String()
+		}
+	}
+}
+
+// sumCompartments is the total of the value of every compartment, not ok when one of them does not have it
+// or has it as a bound ("max 30 °C"), then there is no total to tell
+func sumCompartments(compartments []*TaskCompartment, quantity func(c *TaskCompartment) Quantity, in func(Quantity) (float64, bool)) (float64, bool) {
+	var total float64
+	for _, c := range compartments {
+		q := quantity(c)
+		v, ok := in(q)
+		if !ok || q.Limit != "" {
+			return 0, false
+		}
+		total += v
+	}
+	return total, true
+}
+
+func (c *TaskCompartment) auditTarget(t *TaskSection) audit.Target {
+	return audit.Target{Entity: audit.EntityCompartment, Id: c.Id, ShipmentId: t.ShipmentId, DriverId: auditDriver(t.DriverId)}
+}
+
+// storeCompartments writes the compartments of the document of the task, what the driver already measured in them stays.
+// The compartments the document does not list anymore are removed, unless the driver measured something in them
+func storeCompartments(tx *sql.Tx, task *TaskSection) error {
+	numbers := make([]any, 0, len(task.Compartments))
+	for _, c := range task.Compartments {
+		c.TaskId = task.Id
+		err := tx.QueryRow(`INSERT INTO task_compartments (task_id, number, product, weight, volume, temperature,
+				weight_value, weight_unit, weight_limit, volume_value, volume_unit, volume_limit,
+				temperature_value, temperature_unit, temperature_limit)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(task_id, number) DO UPDATE SET
+				product = excluded.product,
+				weight = excluded.weight,
+				volume = excluded.volume,
+				temperature = excluded.temperature,
+				weight_value = excluded.weight_value,
+				weight_unit = excluded.weight_unit,
+				weight_limit = excluded.weight_limit,
+				volume_value = excluded.volume_value,
+				volume_unit = excluded.volume_unit,
+				volume_limit = excluded.volume_limit,
+				temperature_value = excluded.temperature_value,
+				temperature_unit = excluded.temperature_unit,
+				temperature_limit = excluded.temperature_limit,
+				updated_at = datetime('now')
+			RETURNING id`,
+			slices.Concat([]any{task.Id, c.Number, c.Product, c.Weight, c.Volume, c.Temperature},
+				quantityArgs(c.DeclaredWeight), quantityArgs(c.DeclaredVolume), quantityArgs(c.DeclaredTemperature))...).Scan(&c.Id)
+		if err != nil {
+			errlog.ERR.Printf("ERR: storing compartment %d of task %d: %v", c.Number, task.Id, err)
+			return fmt.Errorf("ERR: storing compartment %d of task %d: %v", c.Number, task.Id, err)
+		}
+		numbers = append(numbers, c.Number)
+	}
+
+	query := `DELETE FROM task_compartments WHERE task_id = ? AND actual_weight IS NULL AND actual_temperature IS NULL`
+	if len(numbers) > 0 {
+		query += ` AND number NOT IN (?` + strings.Repeat(", ?", len(numbers)-1) + `)`
+	}
+	if _, err := tx.Exec(query, append([]any{task.Id}, numbers...)...); err != nil {
+		errlog.ERR.Printf("ERR: removing the old compartments of task %d: %v", task.Id, err)
+		return fmt.Errorf("ERR: removing the old compartments of task %d: %v", task.Id, err)
+	}
+	return nil
+}
+
+// GetTaskCompartments gives the compartments of the task in the order of their numbers, none when the document did not list them
+func GetTaskCompartments(db *sql.DB, taskId int) ([]*TaskCompartment, error) {
+	return queryCompartments(db, `task_id = ?`, taskId)
+}
+
+// loadCompartments puts the compartments into the tasks of the shipment
+func loadCompartments(exec audit.Executor, shipmentId int64, tasks []*TaskSection) error {
+	compartments, err := queryCompartments(exec, `task_id IN (SELECT id FROM tasks WHERE shipment_id = ?)`, shipmentId)
+	if err != nil {
+		return err
+	}
+	for _, t := range tasks {
+		for _, c := range compartments {
+			if c.TaskId == t.Id {
+				t.Compartments = append(t.Compartments, c)
+			}
+		}
+	}
+	return nil
+}
+
+func queryCompartments(exec audit.Executor, where string, args ...any) ([]*TaskCompartment, error) {
+	rows, err := exec.Query(`SELECT id, task_id, number, COALESCE(product, ''), COALESCE(weight, ''), COALESCE(volume, ''),
+			COALESCE(temperature, ''), weight_value, weight_unit, weight_limit, volume_value, volume_unit, volume_limit,
+			temperature_value, temperature_unit, temperature_limit, actual_weight, actual_temperature
+		FROM task_compartments WHERE `+where+` ORDER BY task_id, number`, args...)
+	if err != nil {
+		errlog.ERR.Printf("ERR: querying the compartments: %v\n", err)
+		return nil, fmt.Errorf("ERR: querying the compartments: %v", err)
+	}
+	defer rows.Close()
+
+	compartments := make([]*TaskCompartment, 0)
+	for rows.Next() {
+		var (
+			c                 = new(TaskCompartment)
+			declared          declaredQuantities
+			actualWeight      sql.NullInt64
+			actualTemperature sql.NullFloat64
+		)
+		err = rows.Scan(&c.Id, &c.TaskId, &c.Number, &c.Product, &c.Weight, &c.Volume, &c.Temperature,
+			&declared.weight.value, &declared.weight.unit, &declared.weight.limit,
+			&declared.volume.value, &declared.volume.unit, &declared.volume.limit,
+			&declared.temperature.value, &declared.temperature.unit, &declared.temperature.limit,
+			&actualWeight, &actualTemperature)
+		if err != nil {
+			return nil, fmt.Errorf("ERR: scanning a compartment: %v", err)
+		}
+
+		c.DeclaredWeight = declared.weight.quantity()
+		c.DeclaredVolume = declared.volume.quantity()
+		c.DeclaredTemperature = declared.temperature.quantity()
+		if actualWeight.Valid {
+			kg := int(actualWeight.Int64)
+			c.ActualWeight = &kg
+		}
+		if actualTemperature.Valid {
+			c.ActualTemperature = &actualTemperature.Float64
+		}
+		compartments = append(compartments, c)
+	}
+	return compartments, rows.Err()
+}
+
+// UpdateActualWeight writes the weight the driver measured in the compartment of task t
+func (c *TaskCompartment) UpdateActualWeight(db *sql.DB, t *TaskSection, by audit.Actor) error {
+	return auditedWrite(db, by, c.auditTarget(t), []string{"actual_weight"}, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`UPDATE task_compartments SET actual_weight = ?, updated_at = datetime('now') WHERE id = ?`, c.ActualWeight, c.Id)
+		return err
+	})
+}
+
+// UpdateActualTemperature writes the temperature the driver measured in the compartment of task t
+func (c *TaskCompartment) UpdateActualTemperature(db *sql.DB, t *TaskSection, by audit.Actor) error {
+	return auditedWrite(db, by, c.auditTarget(t), []string{"actual_temperature"}, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`UPDATE task_compartments SET actual_temperature = ?, updated_at = datetime('now') WHERE id = ?`, c.ActualTemperature, c.Id)
+		return err
+	})
+}
+
+// SumCompartments is what the measured compartments make for the whole task: the weight of all of them,
+// and the mean of their temperatures (every compartment keeps its own)
+func (t *TaskSection) SumCompartments(compartments []*TaskCompartment) {
+	var (
+		kg          int
+		temperature float64
+		measured    int
+	)
+	for _, c := range compartments {
+		if !c.Measured() {
+			continue
+		}
+		kg += *c.ActualWeight
+		temperature += *c.ActualTemperature
+		measured++
+	}
+	if measured == 0 {
+		return
+	}
+	t.CurrentWeight = kg
+	t.CurrentTemperature = temperature / float64(measured)
+}
@@ -0,0 +1,51 @@
+package parser
+
+import "testing"
+
+func TestCompartmentMeasuring(t *testing.T) {
+	kg1, kg2 := 8000, 6000
+	temp1, temp2 := 15.0, 9.0
+	compartments := []*TaskCompartment{
+		{Number: 1, ActualWeight: &kg1, ActualTemperature: &temp1},
+		{Number: 2, ActualWeight: &kg2},
+		{Number: 3},
+	}
+
+	if next := NextToMeasure(compartments); next == nil || next.Number != 2 {
+		t.Fatalf("next to measure is %+v, want compartment 2", next)
+	}
+
+	compartments[1].ActualTemperature = &temp2
+	task := &TaskSection{}
+	task.SumCompartments(compartments)
+	if task.CurrentWeight != 14000 || task.CurrentTemperature != 12 {
+		t.Errorf("sum of the measured compartments is %d kg %v °C, want 14000 kg 12 °C", task.CurrentWeight, task.CurrentTemperature)
+	}
+
+	compartments[2].ActualWeight, compartments[2].ActualTemperature = &kg1, &temp1
+	if next := NextToMeasure(compartments); next != nil {
+		t.Errorf("every compartment is measured, got %+v", next)
+	}
+}
+
+func TestFinishCompartmentsTotals(t *testing.T) {
+	tests := []struct {
+		name         string
+		compartments []*TaskCompartment
+		wantWeight   string
+		wantProduct  string
+	}{
+		{"tonnes and kg", []*TaskCompartment{{Product: "ethanol", Weight: "8 t"}, {Product: "ethanol", Weight: "6000 kg"}}, "14000 kg", "ETHANOL"},
+		{"a bound has no total", []*TaskCompartment{{Product: "a", Weight: "max 8000 kg"}, {Product: "b", Weight: "6000 kg"}}, "", "A; B"},
+		{"a compartment without weight", []*TaskCompartment{{Weight: "8000 kg"}, {}}, "", ""},
+	}
+
+	for _, tt := range tests {
+		task := &TaskSection{Compartments: tt.compartments}
+		task.finishCompartments()
+		if task.Weight != tt.wantWeight || task.Product != tt.wantProduct || task.Compartment != len(tt.compartments) {
+			t.Errorf("%s: got weight %q product %q compartment %d, want %q %q %d",
+				tt.name, task.Weight, task.Product, task.Compartment, tt.wantWeight, tt.wantProduct, len(tt.compartments))
+		}
+	}
+}
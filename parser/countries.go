@@ -1,8 +1,13 @@
 package parser
 
 import (
+	"log"
 	"regexp"
 	"strings"
+	"sync"
+	"time"
+
+	"logistictbot/config"
 )
 
 const (
@@ -26,35 +31,93 @@ const (
 	CountryEE = "EE"
 	CountryCH = "CH"
 	CountryLU = "LU"
+	CountryGB = "GB"
+	CountryIE = "IE"
+	CountryPT = "PT"
+	CountryES = "ES"
+	CountryIT = "IT"
 )
 
 type Country struct {
-	Code  string
-	Name  string
-	Emoji string
+	Code     string
+	Name     string
+	Emoji    string
+	Timezone string // IANA name, the load and unload windows of the sites in the country are written in it
 }
 
 var Countries = map[string]Country{
-	CountryBE: {Code: "BE", Name: "Belgium", Emoji: "🇧🇪"},
-	CountryDE: {Code: "DE", Name: "Germany", Emoji: "🇩🇪"},
-	CountryNL: {Code: "NL", Name: "Netherlands", Emoji: "🇳🇱"},
-	CountryFR: {Code: "FR", Name: "France", Emoji: "🇫🇷"},
-	CountryPL: {Code: "PL", Name: "Poland", Emoji: "🇵🇱"},
-	CountryCZ: {Code: "CZ", Name: "Czechia", Emoji: "🇨🇿"},
-	CountryAT: {Code: "AT", Name: "Austria", Emoji: "🇦🇹"},
-	CountrySK: {Code: "SK", Name: "Slovakia", Emoji: "🇸🇰"},
-	CountryHU: {Code: "HU", Name: "Hungary", Emoji: "🇭🇺"},
-	CountrySI: {Code: "SI", Name: "Slovenia", Emoji: "🇸🇮"},
-	CountryHR: {Code: "HR", Name: "Croatia", Emoji: "🇭🇷"},
-	CountryRO: {Code: "RO", Name: "Romania", Emoji: "🇷🇴"},
-	CountryBG: {Code: "BG", Name: "Bulgaria", Emoji: "🇧🇬"},
-	CountryRS: {Code: "RS", Name: "Serbia", Emoji: "🇷🇸"},
-	CountryUA: {Code: "UA", Name: "Ukraine", Emoji: "🇺🇦"},
-	CountryLT: {Code: "LT", Name: "Lithuania", Emoji: "🇱🇹"},
-	CountryLV: {Code: "LV", Name: "Latvia", Emoji: "🇱🇻"},
-	CountryEE: {Code: "EE", Name: "Estonia", Emoji: "🇪🇪"},
-	CountryCH: {Code: "CH", Name: "Switzerland", Emoji: "🇨🇭"},
-	CountryLU: {Code: "LU", Name: "Luxembourg", Emoji: "🇱🇺"},
+	CountryBE: {Code: "BE", Name: "Belgium", Emoji: "🇧🇪", Timezone: "Europe/Brussels"},
+	CountryDE: {Code: "DE", Name: "Germany", Emoji: "🇩🇪", Timezone: "Europe/Berlin"},
+	CountryNL: {Code: "NL", Name: "Netherlands", Emoji: "🇳🇱", Timezone: "Europe/Amsterdam"},
+	CountryFR: {Code: "FR", Name: "France", Emoji: "🇫🇷", Timezone: "Europe/Paris"},
+	CountryPL: {Code: "PL", Name: "Poland", Emoji: "🇵🇱", Timezone: "Europe/Warsaw"},
+	CountryCZ: {Code: "CZ", Name: "Czechia", Emoji: "🇨🇿", Timezone: "Europe/Prague"},
+	CountryAT: {Code: "AT", Name: "Austria", Emoji: "🇦🇹", Timezone: "Europe/Vienna"},
+	CountrySK: {Code: "SK", Name: "Slovakia", Emoji: "🇸🇰", Timezone: "Europe/Bratislava"},
+	CountryHU: {Code: "HU", Name: "Hungary", Emoji: "🇭🇺", Timezone: "Europe/Budapest"},
+	CountrySI: {Code: "SI", Name: "Slovenia", Emoji: "🇸🇮", Timezone: "Europe/Ljubljana"},
+	CountryHR: {Code: "HR", Name: "Croatia", Emoji: "🇭🇷", Timezone: "Europe/Zagreb"},
+	CountryRO: {Code: "RO", Name: "Romania", Emoji: "🇷🇴", Timezone: "Europe/Bucharest"},
+	CountryBG: {Code: "BG", Name: "Bulgaria", Emoji: "🇧🇬", Timezone: "Europe/Sofia"},
+	CountryRS: {Code: "RS", Name: "Serbia", Emoji: "🇷🇸", Timezone: "Europe/Belgrade"},
+	CountryUA: {Code: "UA", Name: "Ukraine", Emoji: "🇺🇦", Timezone: "Europe/Kyiv"},
+	CountryLT: {Code: "LT", Name: "Lithuania", Emoji: "🇱🇹", Timezone: "Europe/Vilnius"},
+	CountryLV: {Code: "LV", Name: "Latvia", Emoji: "🇱🇻", Timezone: "Europe/Riga"},
+	CountryEE: {Code: "EE", Name: "Estonia", Emoji: "🇪🇪", Timezone: "Europe/Tallinn"},
+	CountryCH: {Code: "CH", Name: "Switzerland", Emoji: "🇨🇭", Timezone: "Europe/Zurich"},
+	CountryLU: {Code: "LU", Name: "Luxembourg", Emoji: "🇱🇺", Timezone: "Europe/Luxembourg"},
+	CountryGB: {Code: "GB", Name: "United Kingdom", Emoji: "🇬🇧", Timezone: "Europe/London"},
+	CountryIE: {Code: "IE", Name: "Ireland", Emoji: "🇮🇪", Timezone: "Europe/Dublin"},
+	CountryPT: {Code: "PT", Name: "Portugal", Emoji: "🇵🇹", Timezone: "Europe/Lisbon"},
+	CountryES: {Code: "ES", Name: "Spain", Emoji: "🇪🇸", Timezone: "Europe/Madrid"},
+	CountryIT: {Code: "IT", Name: "Italy", Emoji: "🇮🇹", Timezone: "Europe/Rome"},
+}
+
+var (
+	countryLocationsMu sync.Mutex
+	countryLocations   = make(map[string]*time.Location)
+)
+
+// CountryLocation gives the timezone of the country. Unknown countries (and a missing tzdata entry) fall back
+// to Warsaw, which is what every window was taken as before the countries were known
+func CountryLocation(code string) *time.Location {
+	country, ok := Countries[code]
+	if !ok || country.Timezone == "" {
+		return config.WarsawLoc
+	}
+
+	countryLocationsMu.Lock()
+	defer countryLocationsMu.Unlock()
+
+	if loc, ok := countryLocations[code]; ok {
+		return loc
+	}
+	loc, err := time.LoadLocation(country.Timezone)
+	if err != nil {
+		log.Printf("WARN: loading timezone %s of %s, using Warsaw: %v\n", country.Timezone, code, err)
+		loc = config.WarsawLoc
+	}
+	countryLocations[code] = loc
+	return loc
+}
+
+// SiteLocation is the timezone of the site in the document, the load and unload windows are written in its local time.
+// A site replaced later (cleaning station, driver correction) does not move the windows, so OriginalAddress goes first
+func (t *TaskSection) SiteLocation() *time.Location {
+	if t.OriginalAddress != "" {
+		return AddressLocation(t.OriginalAddress)
+	}
+	if t.AddressParts.Country != "" {
+		return CountryLocation(t.AddressParts.Country)
+	}
+	return AddressLocation(t.Address)
+}
+
+func AddressLocation(address string) *time.Location {
+	if parts, ok := ParseAddress(address); ok {
+		return CountryLocation(parts.Country)
+	}
+	return CountryLocation(ExtractCountryCode(address))
 }
 
 func GetCountryByCode(code string) (Country, bool) {
@@ -76,25 +139,55 @@ func GetCountryName(code string) string {
 	return ""
 }
 
+// "GB-E16 2EW", "UK TS2 1UB", "IRL-D02 X285": the postcodes of the UK and Ireland start with letters
+var britishPostcodeRe = regexp.MustCompile(`\b(GB|UK|IE|IRL)[\s-][A-Z]{1,2}\d`)
+
+// "DE 68219" or "DE-68219", with what follows the code to check the postcode against
+var countryPrefixRe = regexp.MustCompile(`\b([A-Z]{2})[\s-](\d[\d-]*)`)
+
+// streetWords are the articles and prepositions of the street names ("RUA DE SANTA MARIA", "CALLE DE LA INDUSTRIA").
+// They only count as a country when the postcode of that country follows them
+var streetWords = map[string]bool{"DE": true, "DA": true, "DO": true, "LA": true, "EN": true}
+
 func ExtractCountryCode(address string) string {
-	// "DE 68219" or "DE-68219"
-	pattern := regexp.MustCompile(`\b([A-Z]{2})[\s-]\d`)
-
-	matches := pattern.FindStringSubmatch(address)
-	if len(matches) > 1 {
-		code := matches[1]
-		if _, exists := Countries[code]; exists {
-			return code
+	for _, m := range countryPrefixRe.FindAllStringSubmatch(address, -1) {
+		code := m[1]
+		if _, exists := Countries[code]; !exists {
+			continue
+		}
+		if streetWords[code] && !postcodePatterns[code].MatchString(strings.TrimRight(m[2], "-")) {
+			continue
+		}
+		return code
+	}
+
+	if matches := britishPostcodeRe.FindStringSubmatch(address); matches != nil {
+		code, _ := countryFromName(matches[1])
+		return code
+	}
+
+	// the country written out as its own part, "..., UNITED KINGDOM", or a postcode only one country writes like that
+	for part := range strings.SplitSeq(address, ",") {
+		part = strings.TrimSpace(part)
+		if len(part) > 2 {
+			if code, ok := countryFromName(part); ok {
+				return code
+			}
+		}
+		if _, postcode, _, ok := matchPostcodeLine(part); ok {
+			if code := countryFromPostcode(strings.ToUpper(postcode)); code != "" {
+				return code
+			}
 		}
 	}
 
 	words := strings.Fields(address)
 	for _, word := range words {
 		cleaned := strings.Trim(word, ",.")
-		if len(cleaned) == 2 {
-			upper := strings.ToUpper(cleaned)
-			if _, exists := Countries[upper]; exists {
-				return upper
+		if len(cleaned) == 2 && !streetWords[strings.ToUpper(cleaned)] {
+			// "UK" is not an ISO code, but the documents use it
+			if code, ok := countryFromName(cleaned); ok {
+				return code
 			}
 		}
 	}
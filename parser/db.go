@@ -4,8 +4,10 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"logistictbot/audit"
 	"logistictbot/config"
 	"logistictbot/errlog"
+	"slices"
 	"strconv"
 	"time"
 
@@ -22,7 +24,7 @@ type MonthYear struct {
 func scanShipment(rows *sql.Rows) (*Shipment, error) {
 	shipment := &Shipment{}
 	var docLang, instrType string
-	var createdAt, updatedAt, started, finished sql.NullString
+	var createdAt, updatedAt, started, finished, taskOrder, status sql.NullString
 
 	err := rows.Scan(
 		&shipment.Id,
@@ -39,12 +41,15 @@ func scanShipment(rows *sql.Rows) (*Shipment, error) {
 		&updatedAt,
 		&started,
 		&finished,
+		&taskOrder,
+		&status,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("ERR: scan shipment: %v", err)
 	}
 
 	shipment.DocLang = Language(docLang)
+	shipment.TaskOrder = parseTaskOrder(taskOrder)
 	shipment.InstructionType = InstructionType(instrType)
 
 	if createdAt.Valid {
@@ -59,6 +64,7 @@ func scanShipment(rows *sql.Rows) (*Shipment, error) {
 	if finished.Valid {
 		shipment.Finished, _ = parseTimeString(finished.String)
 	}
+	shipment.Status = parseShipmentStatus(status, shipment)
 
 	return shipment, nil
 }
@@ -74,6 +80,12 @@ func scanTask(taskRows *sql.Rows) (*TaskSection, error) {
 	var currentTemp sql.NullFloat64
 	var editMessageId sql.NullInt32
 	var editStatus sql.NullString
+	var declared declaredQuantities
+	var addressParts nullAddressParts
+	var credit taskCredit
+	var punct taskPunctuality
+	var arrival taskArrival
+	var company sql.NullString
 
 	err := taskRows.Scan(
 		&task.Id,
@@ -107,12 +119,38 @@ func scanTask(taskRows *sql.Rows) (*TaskSection, error) {
 		&originalAddress,
 		&editMessageId,
 		&editStatus,
+		&declared.weight.value,
+		&declared.weight.unit,
+		&declared.weight.limit,
+		&declared.volume.value,
+		&declared.volume.unit,
+		&declared.volume.limit,
+		&declared.temperature.value,
+		&declared.temperature.unit,
+		&declared.temperature.limit,
+		&addressParts.name,
+		&addressParts.street,
+		&addressParts.postcode,
+		&addressParts.city,
+		&addressParts.country,
+		&credit.driver,
+		&credit.car,
+		&punct.value,
+		&punct.delay,
+		&arrival.at,
+		&company,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("ERR: scan task: %v", err)
 	}
 
 	task.Type = taskType
+	declared.apply(task)
+	addressParts.apply(task)
+	credit.apply(task)
+	punct.apply(task)
+	arrival.apply(task)
+	task.Company = company.String
 
 	if editStatus.Valid {
 		task.EditStatus = EditStatus(editStatus.String)
@@ -208,7 +246,7 @@ func (in UpdateShipmentInput) Validate() error {
 			return fmt.Errorf("task %d: unload reference too long", i)
 		}
 
-		if t.Start.Ptr != nil && t.End.Ptr != nil && !t.Start.IsZero() && !t.End.IsZero() &&
+		if t.Start.Ptr() != nil && t.End.Ptr() != nil && !t.Start.IsZero() && !t.End.IsZero() &&
 			t.End.Before(*t.Start.Ptr()) {
 			return fmt.Errorf("task %d: end before start", i)
 		}
@@ -224,13 +262,31 @@ func (in UpdateShipmentInput) Validate() error {
 	return nil
 }
 
-func UpdateShipment(db *sql.DB, shipmentId int64, in UpdateShipmentInput) (*Shipment, error) {
+// editorTaskColumns are the columns of a task the web editor can change
+var editorTaskColumns = []string{"type", "address", "destination_address", "product", "tank_status", "remark", "start", "end",
+	"load_ref", "load_start_date", "load_end_date", "unload_ref", "unload_start_date", "unload_end_date"}
+
+func UpdateShipment(db *sql.DB, shipmentId int64, in UpdateShipmentInput, by audit.Actor) (*Shipment, error) {
 	tx, err := db.Begin()
 	if err != nil {
 		return nil, fmt.Errorf("begin tx: %v", err)
 	}
 	defer tx.Rollback()
 
+	var driverId string
+	if err = tx.QueryRow(`SELECT driver_id FROM shipments WHERE id = ?`, shipmentId).Scan(&driverId); err != nil {
+		return nil, fmt.Errorf("get shipment driver: %v", err)
+	}
+	target := audit.Target{Entity: audit.EntityShipment, Id: shipmentId, ShipmentId: shipmentId, DriverId: driverId}
+	taskTarget := func(id int64) audit.Target {
+		return audit.Target{Entity: audit.EntityTask, Id: id, ShipmentId: shipmentId, DriverId: driverId}
+	}
+
+	before, err := audit.Before(tx, target, "started", "finished", "generalremark")
+	if err != nil {
+		return nil, err
+	}
+
 	now := time.Now().UTC()
 
 	_, err = tx.Exec(
@@ -240,6 +296,9 @@ func UpdateShipment(db *sql.DB, shipmentId int64, in UpdateShipmentInput) (*Ship
 	if err != nil {
 		return nil, fmt.Errorf("update shipment: %v", err)
 	}
+	if err = before.After(tx, by); err != nil {
+		return nil, err
+	}
 
 	// Existing task ids for this shipment, so we can delete ones the
 	// client removed rather than trusting a client-sent "delete" flag.
@@ -261,21 +320,42 @@ func UpdateShipment(db *sql.DB, shipmentId int64, in UpdateShipmentInput) (*Ship
 	keptIds := map[int64]bool{}
 
 	for _, t := range in.Tasks {
+		// the editor may send the windows without an offset, they are then the local time of the site like in the document
+		site := AddressLocation(t.Address)
+		t.LoadStartDate, t.LoadEndDate = t.LoadStartDate.At(site), t.LoadEndDate.At(site)
+		t.UnloadStartDate, t.UnloadEndDate = t.UnloadStartDate.At(site), t.UnloadEndDate.At(site)
+
 		if t.Id != 0 && existingIds[t.Id] {
+			taskBefore, err := audit.Before(tx, taskTarget(t.Id), editorTaskColumns...)
+			if err != nil {
+				return nil, err
+			}
+			rerate, err := timingChanged(tx, t.Id, t.End.Ptr(), t.LoadStartDate.Ptr(), t.LoadEndDate.Ptr(), t.UnloadStartDate.Ptr(), t.UnloadEndDate.Ptr())
+			if err != nil {
+				return nil, err
+			}
 			_, err = tx.Exec(`
 				UPDATE tasks SET type=?, address=?, destination_address=?, product=?,
 					tank_status=?, remark=?, start=?, end=?, load_ref=?, load_start_date=?,
 					load_end_date=?, unload_ref=?, unload_start_date=?, unload_end_date=?,
-					updated_at=?
+					window_timezone=?, punctuality=CASE WHEN ? THEN NULL ELSE punctuality END,
+					window_delay=CASE WHEN ? THEN NULL ELSE window_delay END,
+					window_alerted_at=CASE WHEN ? THEN NULL ELSE window_alerted_at END, updated_at=?
 				WHERE id = ? AND shipment_id = ?`,
 				t.Type, t.Address, t.DestinationAddress, t.Product, t.TankStatus, t.Remark,
 				nullTime(t.Start.Ptr()), nullTime(t.End.Ptr()), t.LoadReference, nullTime(t.LoadStartDate.Ptr()),
 				nullTime(t.LoadEndDate.Ptr()), t.UnloadReference, nullTime(t.UnloadStartDate.Ptr()),
-				nullTime(t.UnloadEndDate.Ptr()), now, t.Id, shipmentId,
+				nullTime(t.UnloadEndDate.Ptr()), site.String(), rerate, rerate, rerate, now, t.Id, shipmentId,
 			)
 			if err != nil {
 				return nil, fmt.Errorf("update task %d: %v", t.Id, err)
 			}
+			if err = updateAddressParts(tx, t.Id, t.Address); err != nil {
+				return nil, err
+			}
+			if err = taskBefore.After(tx, by); err != nil {
+				return nil, err
+			}
 			keptIds[t.Id] = true
 		} else {
 			newId, err := uuid.NewV4() // TODO: confirm tasks.id is int64 not uuid — schema you showed suggests int64
@@ -283,27 +363,38 @@ func UpdateShipment(db *sql.DB, shipmentId int64, in UpdateShipmentInput) (*Ship
 			res, err := tx.Exec(`
 				INSERT INTO tasks (type, shipment_id, address, destination_address, product,
 					tank_status, remark, start, end, load_ref, load_start_date, load_end_date,
-					unload_ref, unload_start_date, unload_end_date, created_at, updated_at, edit_status)
-				VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`,
+					unload_ref, unload_start_date, unload_end_date, window_timezone, created_at, updated_at, edit_status, position)
+				VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,
+					(SELECT COALESCE(MAX(position), 0) + 1 FROM tasks WHERE shipment_id = ?))`,
 				t.Type, shipmentId, t.Address, t.DestinationAddress, t.Product, t.TankStatus,
 				t.Remark, nullTime(t.Start.Ptr()), nullTime(t.End.Ptr()), t.LoadReference, nullTime(t.LoadStartDate.Ptr()),
 				nullTime(t.LoadEndDate.Ptr()), t.UnloadReference, nullTime(t.UnloadStartDate.Ptr()),
-				nullTime(t.UnloadEndDate.Ptr()), now, now, "added",
+				nullTime(t.UnloadEndDate.Ptr()), site.String(), now, now, "added", shipmentId,
 			)
 			if err != nil {
 				return nil, fmt.Errorf("insert task: %v", err)
 			}
 			newRowId, _ := res.LastInsertId()
+			if err = updateAddressParts(tx, newRowId, t.Address); err != nil {
+				return nil, err
+			}
+			if err = audit.Created(tx, by, taskTarget(newRowId), t.Type); err != nil {
+				return nil, err
+			}
 			keptIds[newRowId] = true
 		}
 	}
 
 	for id := range existingIds {
 		if !keptIds[id] {
-			_, err = tx.Exec(`DELETE FROM tasks WHERE id = ? AND shipment_id = ?`, id, shipmentId)
+			var taskType string
+			err = tx.QueryRow(`DELETE FROM tasks WHERE id = ? AND shipment_id = ? RETURNING type`, id, shipmentId).Scan(&taskType)
 			if err != nil {
 				return nil, fmt.Errorf("delete task %d: %v", id, err)
 			}
+			if err = audit.Deleted(tx, by, taskTarget(id), taskType); err != nil {
+				return nil, err
+			}
 		}
 	}
 
@@ -325,7 +416,7 @@ func GetLatestShipmentByDriverId(db *sql.DB, driverId uuid.UUID) (*Shipment, err
 	query := `
 		SELECT id, document_language, instruction_type, car_id, driver_id,
 		       container, chassis, tankdetails, generalremark, doc_id,
-		       created_at, updated_at, started, finished
+		       created_at, updated_at, started, finished, task_order, status
 		FROM shipments
 		WHERE driver_id = ?
 		ORDER BY created_at DESC
@@ -341,40 +432,54 @@ func GetLatestShipmentByDriverId(db *sql.DB, driverId uuid.UUID) (*Shipment, err
 	return shipments[0], nil
 }
 
-func (t *TaskSection) UpdateStart(db *sql.DB) error {
-	_, err := db.Exec(`UPDATE tasks SET start = ?, updated_at = datetime('now') WHERE id = ?`,
-		t.Start.In(config.WarsawLoc).Format(time.RFC3339), t.Id)
-	return err
+func (t *TaskSection) UpdateStart(db *sql.DB, by audit.Actor) error {
+	return auditedWrite(db, by, t.auditTarget(), []string{"start"}, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`UPDATE tasks SET start = ?, updated_at = datetime('now') WHERE id = ?`,
+			t.Start.In(config.WarsawLoc).Format(time.RFC3339), t.Id)
+		return err
+	})
 }
 
-func (t *TaskSection) UpdateEnd(db *sql.DB) error {
-	_, err := db.Exec(`UPDATE tasks SET end = ?, updated_at = datetime('now') WHERE id = ?`,
-		t.End.In(config.WarsawLoc).Format(time.RFC3339), t.Id)
-	return err
+func (t *TaskSection) UpdateEnd(db *sql.DB, by audit.Actor) error {
+	// the punctuality is recorded again for the new end
+	return auditedWrite(db, by, t.auditTarget(), []string{"end", "punctuality"}, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`UPDATE tasks SET end = ?, punctuality = NULL, window_delay = NULL, updated_at = datetime('now') WHERE id = ?`,
+			t.End.In(config.WarsawLoc).Format(time.RFC3339), t.Id)
+		return err
+	})
 }
 
-func (t *TaskSection) UpdateCurrentKilometrage(db *sql.DB) error {
-	_, err := db.Exec(`UPDATE tasks SET current_kilometrage = ?, updated_at = datetime('now') WHERE id = ?`,
-		t.CurrentKilometrage, t.Id)
-	return err
+func (t *TaskSection) UpdateCurrentKilometrage(db *sql.DB, by audit.Actor) error {
+	return auditedWrite(db, by, t.auditTarget(), []string{"current_kilometrage"}, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`UPDATE tasks SET current_kilometrage = ?, updated_at = datetime('now') WHERE id = ?`,
+			t.CurrentKilometrage, t.Id)
+		return err
+	})
 }
 
-func (t *TaskSection) UpdateCurrentWeight(db *sql.DB) error {
-	_, err := db.Exec(`UPDATE tasks SET current_weight = ?, updated_at = datetime('now') WHERE id = ?`,
-		t.CurrentWeight, t.Id)
-	return err
+func (t *TaskSection) UpdateCurrentWeight(db *sql.DB, by audit.Actor) error {
+	return auditedWrite(db, by, t.auditTarget(), []string{"current_weight"}, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`UPDATE tasks SET current_weight = ?, updated_at = datetime('now') WHERE id = ?`,
+			t.CurrentWeight, t.Id)
+		return err
+	})
 }
 
-func (t *TaskSection) UpdateCurrentTemperature(db *sql.DB) error {
-	_, err := db.Exec(`UPDATE tasks SET current_temperature = ?, updated_at = datetime('now') WHERE id = ?`,
-		t.CurrentTemperature, t.Id)
-	return err
+func (t *TaskSection) UpdateCurrentTemperature(db *sql.DB, by audit.Actor) error {
+	return auditedWrite(db, by, t.auditTarget(), []string{"current_temperature"}, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`UPDATE tasks SET current_temperature = ?, updated_at = datetime('now') WHERE id = ?`,
+			t.CurrentTemperature, t.Id)
+		return err
+	})
 }
 
-func (t *TaskSection) UpdateAddress(db *sql.DB) error {
-	_, err := db.Exec(`UPDATE tasks SET address = ?, original_address = ? WHERE id = ?`,
-		t.Address, t.OriginalAddress, t.Id)
-	return err
+func (t *TaskSection) UpdateAddress(db *sql.DB, by audit.Actor) error {
+	t.AddressParts, _ = ParseAddress(t.Address)
+	return auditedWrite(db, by, t.auditTarget(), []string{"address", "original_address"}, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`UPDATE tasks SET address = ?, original_address = ?, `+addressPartsSet+` WHERE id = ?`,
+			slices.Concat([]any{t.Address, t.OriginalAddress}, addressPartsArgs(t.AddressParts), []any{t.Id})...)
+		return err
+	})
 }
 
 // UpdateEditMessageId sets edit_message_id for a task by task id.
@@ -434,10 +539,12 @@ func loadTasksForShipment(tx *sql.Tx, shipmentId int64) ([]*TaskSection, error)
 		       unload_end_date, tank_status, product, weight, volume,
 		       temperature, compartment, remark, address, destination_address,
 		       doc_id, start, end, current_kilometrage, current_weight,
-		       current_temperature, created_at, updated_at, original_address, edit_message_id, edit_status
+		       current_temperature, created_at, updated_at, original_address, edit_message_id, edit_status,
+		       weight_value, weight_unit, weight_limit, volume_value, volume_unit, volume_limit, temperature_value, temperature_unit, temperature_limit,
+		       address_name, address_street, address_postcode, address_city, address_country, driver_id, car_id, punctuality, window_delay, arrived, company
 		FROM tasks
 		WHERE shipment_id = ?
-		ORDER BY id
+		ORDER BY position, id
 	`
 
 	taskRows, err := tx.Query(taskQuery, shipmentId)
@@ -508,7 +615,7 @@ func GetAllShipments(db *sql.DB) ([]*Shipment, error) {
 	query := `
 		SELECT id, document_language, instruction_type, car_id, driver_id,
 		       container, chassis, tankdetails, generalremark, doc_id,
-		       created_at, updated_at, started, finished
+		       created_at, updated_at, started, finished, task_order, status
 		FROM shipments
 	`
 	return queryShipments(db, query)
@@ -518,7 +625,7 @@ func GetAllShipmentsByCarId(carId string, db *sql.DB) ([]*Shipment, error) {
 	query := `
 		SELECT id, document_language, instruction_type, car_id, driver_id,
 		       container, chassis, tankdetails, generalremark, doc_id,
-		       created_at, updated_at, started, finished
+		       created_at, updated_at, started, finished, task_order, status
 		FROM shipments
 		WHERE car_id = ?
 	`
@@ -529,9 +636,9 @@ func GetAllActiveShipments(db *sql.DB) ([]*Shipment, error) {
 	query := `
 		SELECT id, document_language, instruction_type, car_id, driver_id,
 		       container, chassis, tankdetails, generalremark, doc_id,
-		       created_at, updated_at, started, finished
+		       created_at, updated_at, started, finished, task_order, status
 		FROM shipments
-		WHERE finished IS NULL OR finished = ''
+		WHERE status IN (` + sqlStatuses(ActiveStatuses) + `)
 	`
 	return queryShipments(db, query)
 }
@@ -540,27 +647,54 @@ func GetAllActiveShipmentsByCarId(carId string, db *sql.DB) ([]*Shipment, error)
 	query := `
 		SELECT id, document_language, instruction_type, car_id, driver_id,
 		       container, chassis, tankdetails, generalremark, doc_id,
-		       created_at, updated_at, started, finished
+		       created_at, updated_at, started, finished, task_order, status
 		FROM shipments
-		WHERE car_id = ? AND (finished IS NULL OR finished = '')
+		WHERE car_id = ? AND status IN (` + sqlStatuses(ActiveStatuses) + `)
 	`
 	return queryShipments(db, query, carId)
 }
 
-// GroupByMonth retrieves all shipments finished in a specific month and year
+// GroupByMonth retrieves all shipments finished in a specific month and year. A cancelled shipment is in the month its
+// last task was finished in, with only its finished tasks, the part driven before the cancel goes on the statement too
 func GroupByMonth(month time.Month, year int, db *sql.DB) ([]*Shipment, error) {
 	query := `
 		SELECT id, document_language, instruction_type, car_id, driver_id,
 		       container, chassis, tankdetails, generalremark, doc_id,
-		       created_at, updated_at, started, finished
-		FROM shipments
-		WHERE strftime('%m', finished) = ?
-		  AND strftime('%Y', finished) = ?
-		ORDER BY finished
+		       created_at, updated_at, started, finished, task_order, status
+		FROM (` + statementShipments + `)
+		WHERE strftime('%m', closed) = ?
+		  AND strftime('%Y', closed) = ?
+		ORDER BY closed
 	`
-	return queryShipments(db, query, fmt.Sprintf("%02d", month), fmt.Sprintf("%d", year))
+	shipments, err := queryShipments(db, query, fmt.Sprintf("%02d", month), fmt.Sprintf("%d", year))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range shipments {
+		if s.Status != StatusCancelled {
+			continue
+		}
+		finished := make([]*TaskSection, 0, len(s.Tasks))
+		for _, t := range s.Tasks {
+			if t.IsFinished() {
+				finished = append(finished, t)
+			}
+		}
+		s.Tasks = finished
+	}
+	return shipments, nil
 }
 
+// statementShipments are the shipments of the monthly statements with the time they are closed at, the finished time,
+// or the end of the last finished task for a cancelled one. Cancelled without a finished task it is NULL
+var statementShipments = `
+		SELECT *, CASE WHEN status = '` + string(StatusCancelled) + `'
+		               THEN (SELECT MAX(datetime(t.end)) FROM tasks t WHERE t.shipment_id = shipments.id AND t.end IS NOT NULL)
+		               ELSE finished END AS closed
+		FROM shipments
+		WHERE status IN (` + sqlStatuses(append([]ShipmentStatus{StatusCancelled}, DoneStatuses...)) + `)`
+
 func parseTimeString(s string) (time.Time, error) {
 	formats := []string{
 		"2006-01-02 15:04:05.999999999-07:00",
@@ -587,10 +721,10 @@ func parseTimeString(s string) (time.Time, error) {
 func GetAvailableMonths(db *sql.DB) ([]MonthYear, error) {
 	query := `
 		SELECT DISTINCT
-			strftime('%Y', finished) as year,
-			strftime('%m', finished) as month
-		FROM shipments
-		WHERE started IS NOT NULL
+			strftime('%Y', closed) as year,
+			strftime('%m', closed) as month
+		FROM (` + statementShipments + `)
+		WHERE closed IS NOT NULL
 		ORDER BY year DESC, month DESC
 	`
 	rows, err := db.Query(query)
@@ -631,7 +765,7 @@ func GetAvailableMonths(db *sql.DB) ([]MonthYear, error) {
 
 // StoreShipment stores a shipment and all its tasks in the database
 // Returns the created shipment ID
-func (s *Shipment) StoreShipment(db *sql.DB) error {
+func (s *Shipment) StoreShipment(db *sql.DB, by audit.Actor) error {
 	tx, err := db.Begin()
 	if err != nil {
 		errlog.ERR.Printf("ERR: begin transaction: %v", err)
@@ -639,10 +773,23 @@ func (s *Shipment) StoreShipment(db *sql.DB) error {
 	}
 	defer tx.Rollback()
 
+	// the same document can be stored again, then it is the fields that changed
+	var existed bool
+	if err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM shipments WHERE id = ?)`, s.Id).Scan(&existed); err != nil {
+		errlog.ERR.Printf("ERR: checking if shipment %d exists: %v", s.Id, err)
+		return fmt.Errorf("ERR: checking if shipment %d exists: %v", s.Id, err)
+	}
+	var before *audit.Snapshot
+	if existed {
+		if before, err = audit.Before(tx, s.auditTarget(), shipmentAuditColumns...); err != nil {
+			return err
+		}
+	}
+
 	query := `INSERT INTO shipments
 		(id, document_language, instruction_type, car_id, driver_id, container, chassis,
-		tankdetails, generalremark, doc_id, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		tankdetails, generalremark, doc_id, created_at, updated_at, task_order, status)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		ON CONFLICT(id) DO UPDATE SET
 			document_language = excluded.document_language,
 			instruction_type = excluded.instruction_type,
@@ -670,17 +817,59 @@ func (s *Shipment) StoreShipment(db *sql.DB) error {
 		s.ShipmentDocId,
 		time.Now(),
 		time.Now(),
+		string(s.TaskOrder.OrDefault()),
+		string(statusFromTimes(false, false, !s.DriverId.IsNil())),
 	)
 	if err != nil {
 		errlog.ERR.Printf("ERR: insert shipment: %v", err)
 		return fmt.Errorf("ERR: insert shipment: %v", err)
 	}
 
-	taskQuery := `INSERT INTO tasks
+	if existed {
+		err = before.After(tx, by)
+	} else {
+		err = audit.Created(tx, by, s.auditTarget(), fmt.Sprintf("doc %d", s.ShipmentDocId))
+	}
+	if err != nil {
+		return err
+	}
+
+	// a stored shipment keeps its status, the history starts with the first store
+	if err = tx.QueryRow(`SELECT status FROM shipments WHERE id = ?`, s.Id).Scan(&s.Status); err != nil {
+		errlog.ERR.Printf("ERR: reading status of shipment %d: %v", s.Id, err)
+		return fmt.Errorf("ERR: reading status of shipment %d: %v", s.Id, err)
+	}
+	_, err = tx.Exec(`INSERT INTO shipment_status_history (shipment_id, from_status, to_status, changed_by, changed_at)
+		SELECT ?, '', ?, 0, ? WHERE NOT EXISTS (SELECT 1 FROM shipment_status_history WHERE shipment_id = ?)`,
+		s.Id, string(s.Status), time.Now(), s.Id)
+	if err != nil {
+		errlog.ERR.Printf("ERR: writing status history of shipment %d: %v", s.Id, err)
+		return fmt.Errorf("ERR: writing status history of shipment %d: %v", s.Id, err)
+	}
+
+	position := 0
+	for _, task := range s.Tasks {
+		if task.Type == "" {
+			continue
+		}
+		position++
+		if err = s.storeTask(tx, task, position, by); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		errlog.ERR.Printf("ERR: commit transaction: %v", err)
+		return fmt.Errorf("ERR: commit transaction: %v", err)
+	}
+	return nil
+}
+
+const storeTaskQuery = `INSERT INTO tasks
 		(type, shipment_id, content, customer_ref, load_ref, load_start_date, load_end_date,
 		unload_ref, unload_start_date, unload_end_date, tank_status, product, weight, volume,
-		temperature, compartment, remark, address, destination_address, doc_id, current_kilometrage, current_weight, current_temperature, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		temperature, compartment, remark, address, destination_address, doc_id, current_kilometrage, current_weight, current_temperature, created_at, updated_at, position, company)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		ON CONFLICT(shipment_id, type) DO UPDATE SET
 			content = excluded.content,
 			customer_ref = excluded.customer_ref,
@@ -703,60 +892,99 @@ func (s *Shipment) StoreShipment(db *sql.DB) error {
 			current_kilometrage = excluded.current_kilometrage,
 			current_weight = excluded.current_weight,
 			current_temperature = excluded.current_temperature,
-			updated_at = excluded.updated_at`
+			updated_at = excluded.updated_at,
+			position = excluded.position,
+			company = excluded.company`
+
+// the columns of shipments and tasks that are compared when a document stores them again
+var (
+	shipmentAuditColumns = []string{"document_language", "instruction_type", "car_id", "driver_id", "container", "chassis",
+		"tankdetails", "generalremark", "doc_id", "started", "finished", "task_order"}
+	taskAuditColumns = []string{"content", "customer_ref", "load_ref", "load_start_date", "load_end_date", "unload_ref",
+		"unload_start_date", "unload_end_date", "tank_status", "product", "weight", "volume", "temperature", "compartment",
+		"remark", "address", "destination_address", "doc_id", "position", "company"}
+)
 
-	for _, task := range s.Tasks {
-		if task.Type == "" {
-			continue
+// storeTask inserts the task of s, a task of the same type is updated instead (there is one task of a type in a shipment).
+// position is the place of the task in the shipment, 1 based
+func (s *Shipment) storeTask(tx *sql.Tx, task *TaskSection, position int, by audit.Actor) error {
+	task.ShipmentId = s.Id
+	task.ShipmentDocId = s.ShipmentDocId
+
+	var existingId sql.NullInt64
+	err := tx.QueryRow(`SELECT id FROM tasks WHERE shipment_id = ? AND type = ?`, s.Id, task.Type).Scan(&existingId)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		errlog.ERR.Printf("ERR: looking for the %s of shipment %d: %v", task.Type, s.Id, err)
+		return fmt.Errorf("ERR: looking for the %s of shipment %d: %v", task.Type, s.Id, err)
+	}
+	var before *audit.Snapshot
+	if existingId.Valid {
+		task.Id = int(existingId.Int64)
+		if before, err = audit.Before(tx, task.auditTarget(), taskAuditColumns...); err != nil {
+			return err
 		}
-		task.ShipmentId = s.Id
-		task.ShipmentDocId = s.ShipmentDocId
-		fmt.Println(task.Product)
-		result, err := tx.Exec(
-			taskQuery,
-			task.Type,
-			s.Id,
-			task.Content,
-			task.CustomerReference,
-			task.LoadReference,
-			formatTime(task.LoadStartDate),
-			formatTime(task.LoadEndDate),
-			task.UnloadReference,
-			formatTime(task.UnloadStartDate),
-			formatTime(task.UnloadEndDate),
-			task.TankStatus,
-			task.Product,
-			task.Weight,
-			task.Volume,
-			task.Temperature,
-			task.Compartment,
-			task.Remark,
-			task.Address,
-			task.DestinationAddress,
-			task.ShipmentDocId,
-			task.CurrentKilometrage,
-			task.CurrentTemperature,
-			task.CurrentWeight,
-			time.Now(),
-			time.Now(),
-		)
-		if err != nil {
-			errlog.ERR.Printf("ERR: insert task: %v", err)
-			return fmt.Errorf("ERR: insert task: %v", err)
-		}
-		taskId, err := result.LastInsertId()
-		if err != nil {
-			errlog.ERR.Printf("ERR: get task id: %v", err)
-			return fmt.Errorf("ERR: get task id: %v", err)
-		}
-		task.Id = int(taskId)
 	}
 
-	if err := tx.Commit(); err != nil {
-		errlog.ERR.Printf("ERR: commit transaction: %v", err)
-		return fmt.Errorf("ERR: commit transaction: %v", err)
+	fmt.Println(task.Product)
+	result, err := tx.Exec(
+		storeTaskQuery,
+		task.Type,
+		s.Id,
+		task.Content,
+		task.CustomerReference,
+		task.LoadReference,
+		formatTime(task.LoadStartDate),
+		formatTime(task.LoadEndDate),
+		task.UnloadReference,
+		formatTime(task.UnloadStartDate),
+		formatTime(task.UnloadEndDate),
+		task.TankStatus,
+		task.Product,
+		task.Weight,
+		task.Volume,
+		task.Temperature,
+		task.Compartment,
+		task.Remark,
+		task.Address,
+		task.DestinationAddress,
+		task.ShipmentDocId,
+		task.CurrentKilometrage,
+		task.CurrentTemperature,
+		task.CurrentWeight,
+		time.Now(),
+		time.Now(),
+		position,
+		task.Company,
+	)
+	if err != nil {
+		errlog.ERR.Printf("ERR: insert task: %v", err)
+		return fmt.Errorf("ERR: insert task: %v", err)
 	}
-	return nil
+	taskId, err := result.LastInsertId()
+	if err != nil {
+		errlog.ERR.Printf("ERR: get task id: %v", err)
+		return fmt.Errorf("ERR: get task id: %v", err)
+	}
+	if existingId.Valid {
+		taskId = existingId.Int64
+	}
+	task.Id = int(taskId)
+
+	// on conflict the task is updated and LastInsertId is not its id, so it goes by the type
+	_, err = tx.Exec(`UPDATE tasks SET `+declaredQuantitiesSet+`, `+addressPartsSet+`, window_timezone = ? WHERE shipment_id = ? AND type = ?`,
+		slices.Concat(task.declaredQuantityArgs(), addressPartsArgs(task.AddressParts), []any{task.SiteLocation().String(), s.Id, task.Type})...)
+	if err != nil {
+		errlog.ERR.Printf("ERR: storing declared quantities, address parts and window timezone of %s: %v", task.Type, err)
+		return fmt.Errorf("ERR: storing declared quantities, address parts and window timezone of %s: %v", task.Type, err)
+	}
+	if err = storeCompartments(tx, task); err != nil {
+		return err
+	}
+
+	if before != nil {
+		return before.After(tx, by)
+	}
+	return audit.Created(tx, by, task.auditTarget(), task.Type)
 }
 
 // GetShipment retrieves a shipment by ID (without tasks)
@@ -768,7 +996,7 @@ func GetShipment(db *sql.DB, shipmentId int64) (*Shipment, error) {
 	defer tx.Rollback()
 
 	query := `SELECT id, document_language, instruction_type, car_id, driver_id,
-		container, chassis, tankdetails, generalremark, doc_id, created_at, updated_at, started, finished
+		container, chassis, tankdetails, generalremark, doc_id, created_at, updated_at, started, finished, task_order, status
 		FROM shipments WHERE id = ?`
 	row := tx.QueryRow(query, shipmentId)
 	s := &Shipment{}
@@ -778,6 +1006,7 @@ func GetShipment(db *sql.DB, shipmentId int64) (*Shipment, error) {
 
 	var started sql.NullTime
 	var finished sql.NullTime
+	var taskOrder, status sql.NullString
 
 	err = row.Scan(
 		&s.Id,
@@ -794,6 +1023,8 @@ func GetShipment(db *sql.DB, shipmentId int64) (*Shipment, error) {
 		&updatedAtStr,
 		&started,
 		&finished,
+		&taskOrder,
+		&status,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -803,6 +1034,7 @@ func GetShipment(db *sql.DB, shipmentId int64) (*Shipment, error) {
 	}
 	s.DocLang = Language(docLang)
 	s.InstructionType = InstructionType(instrType)
+	s.TaskOrder = parseTaskOrder(taskOrder)
 	if driverIdStr != "" {
 		driverId, err := uuid.FromString(driverIdStr)
 		if err != nil {
@@ -834,74 +1066,155 @@ func GetShipment(db *sql.DB, shipmentId int64) (*Shipment, error) {
 	if finished.Valid {
 		s.Finished = finished.Time
 	}
+	s.Status = parseShipmentStatus(status, s)
 
 	s.Tasks, err = loadTasksForShipment(tx, s.Id)
 	if err != nil {
 		return nil, fmt.Errorf("ERR: getting tasks for the shipment: %v\n", err)
 	}
+	if err = loadCompartments(tx, s.Id, s.Tasks); err != nil {
+		return nil, err
+	}
+	if err = loadCleanings(tx, s.Id, s.Tasks); err != nil {
+		return nil, err
+	}
+
+	s.CoDrivers, err = loadCoDrivers(tx, s.Id)
+	if err != nil {
+		return nil, fmt.Errorf("ERR: getting co-drivers for the shipment: %v\n", err)
+	}
 
 	return s, nil
 }
 
-// all that is needed is the id
-func (s *Shipment) DeleteShipment(db *sql.DB) error {
-	_, err := db.Exec("DELETE from shipments WHERE id = ?", s.Id)
+// all that is needed is the id. Tasks of the shipment are deleted with it
+func (s *Shipment) DeleteShipment(db *sql.DB, by audit.Actor) error {
+	tx, err := db.Begin()
 	if err != nil {
-		errlog.ERR.Printf("deleting shipment by id (%d): %v\n", s.Id, err)
-		return fmt.Errorf("ERR: deleting shipment by id: %v\n", err)
+		errlog.ERR.Printf("ERR: begin transaction: %v", err)
+		return fmt.Errorf("ERR: begin transaction: %v", err)
 	}
+	defer tx.Rollback()
 
-	return nil
-}
+	// the rows that reference the tasks and the shipment go first, with the foreign keys on the delete fails otherwise.
+	// The cascade of the tasks only works on the connections with the pragma set, so it is not counted on
+	for _, table := range []string{"task_compartments", "task_cleanings", "task_docs"} {
+		if _, err = tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE task_id IN (SELECT id FROM tasks WHERE shipment_id = ?)`, table), s.Id); err != nil {
+			errlog.ERR.Printf("deleting %s of shipment (%d): %v\n", table, s.Id, err)
+			return fmt.Errorf("ERR: deleting %s of shipment: %v\n", table, err)
+		}
+	}
 
-func (s *Shipment) StartShipment(db *sql.DB) error {
-	query := `
-		UPDATE shipments
-		SET started = ?
-		WHERE id = ?
-	`
+	_, err = tx.Exec("DELETE from tasks WHERE shipment_id = ?", s.Id)
+	if err != nil {
+		errlog.ERR.Printf("deleting tasks of shipment (%d): %v\n", s.Id, err)
+		return fmt.Errorf("ERR: deleting tasks of shipment: %v\n", err)
+	}
 
-	s.Started = time.Now().In(config.WarsawLoc)
+	// a document sent again with the same number starts a new history
+	for _, table := range []string{"shipment_status_history", "shipment_drivers"} {
+		if _, err = tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE shipment_id = ?`, table), s.Id); err != nil {
+			errlog.ERR.Printf("deleting %s of shipment (%d): %v\n", table, s.Id, err)
+			return fmt.Errorf("ERR: deleting %s of shipment: %v\n", table, err)
+		}
+	}
 
-	_, err := db.Exec(query, s.Started.Format("2006-01-02 15:04:05.999999999-07:00"), s.Id)
+	_, err = tx.Exec("DELETE from shipments WHERE id = ?", s.Id)
 	if err != nil {
-		errlog.ERR.Printf("ERR: starting shipment: %v\n", err)
-		return fmt.Errorf("ERR: starting shipment: %v\n", err)
+		errlog.ERR.Printf("deleting shipment by id (%d): %v\n", s.Id, err)
+		return fmt.Errorf("ERR: deleting shipment by id: %v\n", err)
 	}
 
-	return nil
-}
+	if err = audit.Deleted(tx, by, s.auditTarget(), fmt.Sprintf("doc %d", s.ShipmentDocId)); err != nil {
+		return err
+	}
 
-func (s *Shipment) FinishShipment(db *sql.DB) error {
-	query := `
-		UPDATE shipments
-		SET finished = ?
-		WHERE id = ?
-	`
+	return tx.Commit()
+}
 
-	s.Finished = time.Now().In(config.WarsawLoc)
+// StartShipment is the driver accepting the shipment
+func (s *Shipment) StartShipment(db *sql.DB, by audit.Actor) error {
+	return s.changeStatusAndTime(db, StatusAccepted, "started", &s.Started, by)
+}
 
-	_, err := db.Exec(query, s.Finished.Format("2006-01-02 15:04:05.999999999-07:00"), s.Id)
-	if err != nil {
-		errlog.ERR.Printf("ERR: finishing shipment: %v\n", err)
-		return fmt.Errorf("ERR: finishing shipment: %v\n", err)
+// BeginShipment moves an accepted shipment in progress, when the driver starts its first task
+func (s *Shipment) BeginShipment(db *sql.DB, by audit.Actor) error {
+	if s.Status != StatusAccepted {
+		return nil
 	}
+	return s.SetStatus(db, StatusInProgress, by, "")
+}
 
-	return nil
+func (s *Shipment) FinishShipment(db *sql.DB, by audit.Actor) error {
+	return s.changeStatusAndTime(db, StatusFinished, "finished", &s.Finished, by)
 }
 
-func (s *Shipment) UnfinishShipment(db *sql.DB) error {
-	query := `UPDATE shipments SET finished = NULL WHERE id = ?`
-	_, err := db.Exec(query, s.Id)
+// UnfinishShipment is the undo of FinishShipment, the shipment goes back in progress
+func (s *Shipment) UnfinishShipment(db *sql.DB, by audit.Actor) error {
+	tx, err := db.Begin()
 	if err != nil {
+		errlog.ERR.Printf("ERR: begin transaction: %v", err)
+		return fmt.Errorf("ERR: begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err = s.setStatus(tx, StatusInProgress, by, "undo"); err != nil {
+		return err
+	}
+	before, err := audit.Before(tx, s.auditTarget(), "finished")
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec(`UPDATE shipments SET finished = NULL WHERE id = ?`, s.Id); err != nil {
 		errlog.ERR.Printf("ERR: unfinish shipment %d: %v", s.Id, err)
 		return fmt.Errorf("ERR: unfinish shipment %d: %v", s.Id, err)
 	}
+	if err = before.After(tx, by); err != nil {
+		return err
+	}
+	s.Finished = time.Time{}
+
+	return tx.Commit()
+}
+
+// changeStatusAndTime moves the shipment to the status and sets the time column of it (started, finished) to now
+func (s *Shipment) changeStatusAndTime(db *sql.DB, to ShipmentStatus, column string, t *time.Time, by audit.Actor) error {
+	tx, err := db.Begin()
+	if err != nil {
+		errlog.ERR.Printf("ERR: begin transaction: %v", err)
+		return fmt.Errorf("ERR: begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err = s.setStatus(tx, to, by, ""); err != nil {
+		return err
+	}
+
+	before, err := audit.Before(tx, s.auditTarget(), column)
+	if err != nil {
+		return err
+	}
+	now := time.Now().In(config.WarsawLoc)
+	_, err = tx.Exec(fmt.Sprintf(`UPDATE shipments SET %s = ? WHERE id = ?`, column), now.Format("2006-01-02 15:04:05.999999999-07:00"), s.Id)
+	if err != nil {
+		errlog.ERR.Printf("ERR: setting %s of shipment %d: %v\n", column, s.Id, err)
+		return fmt.Errorf("ERR: setting %s of shipment %d: %v\n", column, s.Id, err)
+	}
+	if err = before.After(tx, by); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		errlog.ERR.Printf("ERR: commit transaction: %v", err)
+		return fmt.Errorf("ERR: commit transaction: %v", err)
+	}
+	*t = now
 	return nil
 }
 
+// IsFinished is true for the driven shipments, the invoiced too
 func (s *Shipment) IsFinished() bool {
-	return !s.Started.IsZero() && !s.Finished.IsZero()
+	return s.Status == StatusFinished || s.Status == StatusInvoiced
 }
 
 // not finished though
@@ -918,7 +1231,9 @@ func GetTaskById(db *sql.DB, taskId int) (*TaskSection, error) {
 	query := `SELECT id, type, shipment_id, content, customer_ref, load_ref,
 	load_start_date, load_end_date, unload_ref, unload_start_date, unload_end_date,
 	tank_status, product, weight, volume, temperature, compartment, remark,
-	address, destination_address, doc_id, start, end, current_kilometrage, current_temperature, current_weight, created_at, updated_at, original_address, edit_message_id, edit_status
+	address, destination_address, doc_id, start, end, current_kilometrage, current_temperature, current_weight, created_at, updated_at, original_address, edit_message_id, edit_status,
+	weight_value, weight_unit, weight_limit, volume_value, volume_unit, volume_limit, temperature_value, temperature_unit, temperature_limit,
+	address_name, address_street, address_postcode, address_city, address_country, driver_id, car_id, punctuality, window_delay, arrived, company
 	FROM tasks WHERE id = ?`
 
 	row := db.QueryRow(query, taskId)
@@ -931,6 +1246,12 @@ func GetTaskById(db *sql.DB, taskId int) (*TaskSection, error) {
 		createdAt, updatedAt                       sql.NullString
 		editMessageId                              sql.NullInt32
 		editStatus                                 sql.NullString
+		declared                                   declaredQuantities
+		addressParts                               nullAddressParts
+		credit                                     taskCredit
+		punct                                      taskPunctuality
+		arrival                                    taskArrival
+		company                                    sql.NullString
 	)
 
 	err := row.Scan(
@@ -965,6 +1286,26 @@ func GetTaskById(db *sql.DB, taskId int) (*TaskSection, error) {
 		&originalAddress,
 		&editMessageId,
 		&editStatus,
+		&declared.weight.value,
+		&declared.weight.unit,
+		&declared.weight.limit,
+		&declared.volume.value,
+		&declared.volume.unit,
+		&declared.volume.limit,
+		&declared.temperature.value,
+		&declared.temperature.unit,
+		&declared.temperature.limit,
+		&addressParts.name,
+		&addressParts.street,
+		&addressParts.postcode,
+		&addressParts.city,
+		&addressParts.country,
+		&credit.driver,
+		&credit.car,
+		&punct.value,
+		&punct.delay,
+		&arrival.at,
+		&company,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -973,6 +1314,12 @@ func GetTaskById(db *sql.DB, taskId int) (*TaskSection, error) {
 		return nil, fmt.Errorf("scan task: %v", err)
 	}
 
+	declared.apply(task)
+	addressParts.apply(task)
+	credit.apply(task)
+	punct.apply(task)
+	arrival.apply(task)
+	task.Company = company.String
 	task.LoadStartDate, _ = parseTime(loadStart)
 	task.LoadEndDate, _ = parseTime(loadEnd)
 	task.UnloadStartDate, _ = parseTime(unloadStart)
@@ -1008,7 +1355,8 @@ func GetTaskByEditMessageId(db *sql.DB, taskId int) (*TaskSection, error) {
 	load_start_date, load_end_date, unload_ref, unload_start_date, unload_end_date,
 	tank_status, product, weight, volume, temperature, compartment, remark,
 	address, destination_address, doc_id, start, end, current_kilometrage, current_temperature, current_weight, created_at, updated_at, original_address, edit_message_id,
-	edit_status
+	edit_status, weight_value, weight_unit, weight_limit, volume_value, volume_unit, volume_limit, temperature_value, temperature_unit, temperature_limit,
+	address_name, address_street, address_postcode, address_city, address_country, driver_id, car_id, punctuality, window_delay, arrived, company
 	FROM tasks WHERE edit_message_id = ?`
 
 	row := db.QueryRow(query, taskId)
@@ -1021,6 +1369,12 @@ func GetTaskByEditMessageId(db *sql.DB, taskId int) (*TaskSection, error) {
 		createdAt, updatedAt                       sql.NullString
 		editMessageId                              sql.NullInt32
 		editStatus                                 sql.NullString
+		declared                                   declaredQuantities
+		addressParts                               nullAddressParts
+		credit                                     taskCredit
+		punct                                      taskPunctuality
+		arrival                                    taskArrival
+		company                                    sql.NullString
 	)
 
 	err := row.Scan(
@@ -1055,6 +1409,26 @@ func GetTaskByEditMessageId(db *sql.DB, taskId int) (*TaskSection, error) {
 		&originalAddress,
 		&editMessageId,
 		&editStatus,
+		&declared.weight.value,
+		&declared.weight.unit,
+		&declared.weight.limit,
+		&declared.volume.value,
+		&declared.volume.unit,
+		&declared.volume.limit,
+		&declared.temperature.value,
+		&declared.temperature.unit,
+		&declared.temperature.limit,
+		&addressParts.name,
+		&addressParts.street,
+		&addressParts.postcode,
+		&addressParts.city,
+		&addressParts.country,
+		&credit.driver,
+		&credit.car,
+		&punct.value,
+		&punct.delay,
+		&arrival.at,
+		&company,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -1063,6 +1437,12 @@ func GetTaskByEditMessageId(db *sql.DB, taskId int) (*TaskSection, error) {
 		return nil, fmt.Errorf("scan task: %v", err)
 	}
 
+	declared.apply(task)
+	addressParts.apply(task)
+	credit.apply(task)
+	punct.apply(task)
+	arrival.apply(task)
+	task.Company = company.String
 	task.LoadStartDate, _ = parseTime(loadStart)
 	task.LoadEndDate, _ = parseTime(loadEnd)
 	task.UnloadStartDate, _ = parseTime(unloadStart)
@@ -1099,7 +1479,7 @@ func GetAllTasksByShipmentId(db *sql.DB, shipmentId int64) ([]*TaskSection, erro
 	query := `SELECT id, type, shipment_id, content, customer_ref, load_ref,
 	load_start_date, load_end_date, unload_ref, unload_start_date, unload_end_date,
 	tank_status, product, weight, volume, temperature, compartment, remark,
-	address, destination_address, doc_id, start, end, current_kilometrage, current_temperature, current_weight, original_address, edit_message_id, edit_status FROM tasks WHERE shipment_id = ? ORDER BY id ASC`
+	address, destination_address, doc_id, start, end, current_kilometrage, current_temperature, current_weight, original_address, edit_message_id, edit_status, weight_value, weight_unit, weight_limit, volume_value, volume_unit, volume_limit, temperature_value, temperature_unit, temperature_limit, address_name, address_street, address_postcode, address_city, address_country, driver_id, car_id, punctuality, window_delay, arrived, company FROM tasks WHERE shipment_id = ? ORDER BY position, id`
 
 	rows, err := db.Query(query, shipmentId)
 	if err != nil {
@@ -1117,6 +1497,12 @@ func GetAllTasksByShipmentId(db *sql.DB, shipmentId int64) ([]*TaskSection, erro
 			startTime, endTime, originalAddress        sql.NullString
 			editMessageId                              sql.NullInt32
 			editStatus                                 sql.NullString
+			declared                                   declaredQuantities
+			addressParts                               nullAddressParts
+			credit                                     taskCredit
+			punct                                      taskPunctuality
+			arrival                                    taskArrival
+			company                                    sql.NullString
 		)
 
 		err := rows.Scan(
@@ -1149,11 +1535,37 @@ func GetAllTasksByShipmentId(db *sql.DB, shipmentId int64) ([]*TaskSection, erro
 			&originalAddress,
 			&editMessageId,
 			&editStatus,
+			&declared.weight.value,
+			&declared.weight.unit,
+			&declared.weight.limit,
+			&declared.volume.value,
+			&declared.volume.unit,
+			&declared.volume.limit,
+			&declared.temperature.value,
+			&declared.temperature.unit,
+			&declared.temperature.limit,
+			&addressParts.name,
+			&addressParts.street,
+			&addressParts.postcode,
+			&addressParts.city,
+			&addressParts.country,
+			&credit.driver,
+			&credit.car,
+			&punct.value,
+			&punct.delay,
+			&arrival.at,
+			&company,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("scan task: %v", err)
 		}
 
+		declared.apply(task)
+		addressParts.apply(task)
+		credit.apply(task)
+		punct.apply(task)
+		arrival.apply(task)
+		task.Company = company.String
 		task.LoadStartDate, _ = parseTime(loadStart)
 		task.LoadEndDate, _ = parseTime(loadEnd)
 		task.UnloadStartDate, _ = parseTime(unloadStart)
@@ -1186,135 +1598,382 @@ func GetAllTasksByShipmentId(db *sql.DB, shipmentId int64) ([]*TaskSection, erro
 }
 
 // StartTaskById marks a task as started
-func (t *TaskSection) StartTaskById(db *sql.DB) error {
-	query := `UPDATE tasks SET start = ?, updated_at = ? WHERE id = ?`
-
+func (t *TaskSection) StartTaskById(db *sql.DB, by audit.Actor) error {
 	t.Start = time.Now().In(config.WarsawLoc)
 
-	result, err := db.Exec(query, t.Start.In(config.WarsawLoc).Format(time.RFC3339), time.Now().In(config.WarsawLoc), t.Id)
-	if err != nil {
-		return fmt.Errorf("update task start: %v", err)
-	}
+	return auditedWrite(db, by, t.auditTarget(), []string{"start"}, func(tx *sql.Tx) error {
+		result, err := tx.Exec(`UPDATE tasks SET start = ?, updated_at = ? WHERE id = ?`, t.Start.In(config.WarsawLoc).Format(time.RFC3339), time.Now().In(config.WarsawLoc), t.Id)
+		if err != nil {
+			return fmt.Errorf("update task start: %v", err)
+		}
 
-	rows, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("get rows affected: %v", err)
-	}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("get rows affected: %v", err)
+		}
 
-	if rows == 0 {
-		return fmt.Errorf("task not found")
-	}
+		if rows == 0 {
+			return fmt.Errorf("task not found")
+		}
+		return nil
+	})
+}
 
-	return nil
+func (t *TaskSection) UpdateCurrentKmById(db *sql.DB, by audit.Actor) error {
+	return auditedWrite(db, by, t.auditTarget(), []string{"current_kilometrage"}, func(tx *sql.Tx) error {
+		result, err := tx.Exec(`UPDATE tasks SET current_kilometrage= ? WHERE id = ?`, t.CurrentKilometrage, t.Id)
+		if err != nil {
+			return fmt.Errorf("update km: %v", err)
+		}
+
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("get rows affected: %v", err)
+		}
+
+		if rows == 0 {
+			return fmt.Errorf("task not found")
+		}
+		return nil
+	})
 }
 
-func (t *TaskSection) UpdateCurrentKmById(db *sql.DB) error {
-	query := `UPDATE tasks SET current_kilometrage= ? WHERE id = ?`
+func (t *TaskSection) UpdateCurrentWeightById(db *sql.DB, by audit.Actor) error {
+	return auditedWrite(db, by, t.auditTarget(), []string{"current_weight"}, func(tx *sql.Tx) error {
+		result, err := tx.Exec(`UPDATE tasks SET current_weight= ? WHERE id = ?`, t.CurrentWeight, t.Id)
+		if err != nil {
+			return fmt.Errorf("update kg: %v", err)
+		}
 
-	result, err := db.Exec(query, t.CurrentKilometrage, t.Id)
-	if err != nil {
-		return fmt.Errorf("update km: %v", err)
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("get rows affected: %v", err)
+		}
+
+		if rows == 0 {
+			return fmt.Errorf("task not found")
+		}
+		return nil
+	})
+}
+
+func (t *TaskSection) UpdateCurrentTempById(db *sql.DB, by audit.Actor) error {
+	return auditedWrite(db, by, t.auditTarget(), []string{"current_temperature"}, func(tx *sql.Tx) error {
+		result, err := tx.Exec(`UPDATE tasks SET current_temperature= ? WHERE id = ?`, t.CurrentTemperature, t.Id)
+		if err != nil {
+			return fmt.Errorf("update c: %v", err)
+		}
+
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("get rows affected: %v", err)
+		}
+
+		if rows == 0 {
+			return fmt.Errorf("task not found")
+		}
+		return nil
+	})
+}
+
+// FinishTaskById marks a task as finished
+func (t *TaskSection) FinishTaskById(db *sql.DB, by audit.Actor) error {
+	t.End = time.Now().In(config.WarsawLoc)
+
+	return auditedWrite(db, by, t.auditTarget(), []string{"end"}, func(tx *sql.Tx) error {
+		result, err := tx.Exec(`UPDATE tasks SET end = ?, updated_at = ? WHERE id = ?`, t.End.In(config.WarsawLoc).Format(time.RFC3339), time.Now().In(config.WarsawLoc), t.Id)
+		if err != nil {
+			return fmt.Errorf("update task end: %v", err)
+		}
+
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("get rows affected: %v", err)
+		}
+
+		if rows == 0 {
+			return fmt.Errorf("task not found")
+		}
+		return nil
+	})
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
 	}
+	return t.Format(time.RFC3339)
+}
 
-	rows, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("get rows affected: %v", err)
+func parseTime(timeStr string) (time.Time, error) {
+	if timeStr == "" || timeStr == "0001-01-01T00:00:00Z" {
+		return time.Time{}, nil // Return zero time
 	}
 
-	if rows == 0 {
-		return fmt.Errorf("task not found")
+	formats := []string{
+		"2006-01-02 15:04:05.999999-07:00",
+		time.RFC3339Nano,
+		time.RFC3339,
+		"2006-01-02 15:04:05",
 	}
 
-	return nil
+	for _, format := range formats {
+		t, err := time.Parse(format, timeStr)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unable to parse time: %s", timeStr)
 }
 
-func (t *TaskSection) UpdateCurrentWeightById(db *sql.DB) error {
-	query := `UPDATE tasks SET current_weight= ? WHERE id = ?`
+// declaredQuantitiesSet goes with declaredQuantityArgs, the order of the columns is the same as in declaredQuantities
+const declaredQuantitiesSet = `weight_value = ?, weight_unit = ?, weight_limit = ?,
+	volume_value = ?, volume_unit = ?, volume_limit = ?,
+	temperature_value = ?, temperature_unit = ?, temperature_limit = ?`
 
-	result, err := db.Exec(query, t.CurrentWeight, t.Id)
-	if err != nil {
-		return fmt.Errorf("update kg: %v", err)
-	}
+type nullQuantity struct {
+	value       sql.NullFloat64
+	unit, limit sql.NullString
+}
 
-	rows, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("get rows affected: %v", err)
+func (n nullQuantity) quantity() Quantity {
+	if !n.value.Valid || n.unit.String == "" {
+		return Quantity{}
 	}
+	return Quantity{Value: n.value.Float64, Unit: Unit(n.unit.String), Limit: n.limit.String}
+}
 
-	if rows == 0 {
-		return fmt.Errorf("task not found")
-	}
+// declaredQuantities is scanned from the *_value, *_unit and *_limit columns of tasks
+type declaredQuantities struct {
+	weight, volume, temperature nullQuantity
+}
 
-	return nil
+func (d declaredQuantities) apply(t *TaskSection) {
+	t.DeclaredWeight = d.weight.quantity()
+	t.DeclaredVolume = d.volume.quantity()
+	t.DeclaredTemperature = d.temperature.quantity()
 }
 
-func (t *TaskSection) UpdateCurrentTempById(db *sql.DB) error {
-	query := `UPDATE tasks SET current_temperature= ? WHERE id = ?`
+func quantityArgs(q Quantity) []any {
+	if q.IsZero() {
+		return []any{nil, nil, nil}
+	}
+	return []any{q.Value, string(q.Unit), q.Limit}
+}
 
-	result, err := db.Exec(query, t.CurrentTemperature, t.Id)
+func (t *TaskSection) declaredQuantityArgs() []any {
+	return slices.Concat(quantityArgs(t.DeclaredWeight), quantityArgs(t.DeclaredVolume), quantityArgs(t.DeclaredTemperature))
+}
+
+// BackfillDeclaredQuantities reads the numbers out of the weight, volume and temperature text of the tasks stored before
+// the numeric columns existed. The ones that still can not be read stay NULL
+func BackfillDeclaredQuantities(db *sql.DB) (int, error) {
+	rows, err := db.Query(`SELECT id, COALESCE(weight, ''), COALESCE(volume, ''), COALESCE(temperature, '') FROM tasks
+		WHERE weight_unit IS NULL AND volume_unit IS NULL AND temperature_unit IS NULL
+		AND (COALESCE(weight, '') != '' OR COALESCE(volume, '') != '' OR COALESCE(temperature, '') != '')`)
 	if err != nil {
-		return fmt.Errorf("update c: %v", err)
+		errlog.ERR.Printf("ERR: querying tasks without declared quantities: %v\n", err)
+		return 0, fmt.Errorf("ERR: querying tasks without declared quantities: %v", err)
 	}
 
-	rows, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("get rows affected: %v", err)
+	tasks := make([]*TaskSection, 0)
+	for rows.Next() {
+		t := new(TaskSection)
+		if err = rows.Scan(&t.Id, &t.Weight, &t.Volume, &t.Temperature); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("ERR: scanning task for declared quantities: %v", err)
+		}
+		t.DeclaredWeight, _ = ParseWeight(t.Weight)
+		t.DeclaredVolume, _ = ParseVolume(t.Volume)
+		t.DeclaredTemperature, _ = ParseTemperature(t.Temperature)
+		if !t.DeclaredWeight.IsZero() || !t.DeclaredVolume.IsZero() || !t.DeclaredTemperature.IsZero() {
+			tasks = append(tasks, t)
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, fmt.Errorf("ERR: iterating tasks for declared quantities: %v", err)
 	}
 
-	if rows == 0 {
-		return fmt.Errorf("task not found")
+	for _, t := range tasks {
+		_, err = db.Exec(`UPDATE tasks SET `+declaredQuantitiesSet+` WHERE id = ?`, append(t.declaredQuantityArgs(), t.Id)...)
+		if err != nil {
+			errlog.ERR.Printf("ERR: storing declared quantities of task %d: %v\n", t.Id, err)
+			return 0, fmt.Errorf("ERR: storing declared quantities of task %d: %v", t.Id, err)
+		}
 	}
 
-	return nil
+	return len(tasks), nil
 }
 
-// FinishTaskById marks a task as finished
-func (t *TaskSection) FinishTaskById(db *sql.DB) error {
-	query := `UPDATE tasks SET end = ?, updated_at = ? WHERE id = ?`
+// addressPartsSet goes with addressPartsArgs
+const addressPartsSet = `address_name = ?, address_street = ?, address_postcode = ?, address_city = ?, address_country = ?`
 
-	t.End = time.Now().In(config.WarsawLoc)
+type nullAddressParts struct {
+	name, street, postcode, city, country sql.NullString
+}
 
-	result, err := db.Exec(query, t.End.In(config.WarsawLoc).Format(time.RFC3339), time.Now().In(config.WarsawLoc), t.Id)
+func (n nullAddressParts) apply(t *TaskSection) {
+	t.AddressParts = AddressParts{
+		Name:     n.name.String,
+		Street:   n.street.String,
+		Postcode: n.postcode.String,
+		City:     n.city.String,
+		Country:  n.country.String,
+	}
+}
+
+// addressPartsArgs keeps NULL for the addresses that could not be split, so they can be told apart from the empty parts
+func addressPartsArgs(a AddressParts) []any {
+	if a.IsZero() {
+		return []any{nil, nil, nil, nil, nil}
+	}
+	return []any{a.Name, a.Street, a.Postcode, a.City, a.Country}
+}
+
+func updateAddressParts(exec audit.Executor, taskId int64, address string) error {
+	parts, _ := ParseAddress(address)
+	_, err := exec.Exec(`UPDATE tasks SET `+addressPartsSet+` WHERE id = ?`, append(addressPartsArgs(parts), taskId)...)
 	if err != nil {
-		return fmt.Errorf("update task end: %v", err)
+		return fmt.Errorf("ERR: storing address parts of task %d: %v", taskId, err)
 	}
+	return nil
+}
 
-	rows, err := result.RowsAffected()
+// BackfillAddressParts splits the addresses of the tasks stored before the address columns existed
+func BackfillAddressParts(db *sql.DB) (int, error) {
+	rows, err := db.Query(`SELECT id, address FROM tasks WHERE address_country IS NULL AND COALESCE(address, '') != ''`)
 	if err != nil {
-		return fmt.Errorf("get rows affected: %v", err)
+		errlog.ERR.Printf("ERR: querying tasks without address parts: %v\n", err)
+		return 0, fmt.Errorf("ERR: querying tasks without address parts: %v", err)
 	}
 
-	if rows == 0 {
-		return fmt.Errorf("task not found")
+	addresses := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var address string
+		if err = rows.Scan(&id, &address); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("ERR: scanning task for address parts: %v", err)
+		}
+		if _, ok := ParseAddress(address); ok {
+			addresses[id] = address
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, fmt.Errorf("ERR: iterating tasks for address parts: %v", err)
 	}
 
-	return nil
+	for id, address := range addresses {
+		if err = updateAddressParts(db, id, address); err != nil {
+			errlog.ERR.Printf("%v\n", err)
+			return 0, err
+		}
+	}
+
+	return len(addresses), nil
 }
 
-func formatTime(t time.Time) string {
-	if t.IsZero() {
-		return ""
+// BackfillTaskCompanies reads the "in order of" out of the text of the tasks stored before the company column existed.
+// The tasks whose text has none stay NULL
+func BackfillTaskCompanies(db *sql.DB) (int, error) {
+	rows, err := db.Query(`SELECT id, content FROM tasks WHERE company IS NULL AND COALESCE(content, '') != ''`)
+	if err != nil {
+		errlog.ERR.Printf("ERR: querying tasks without company: %v\n", err)
+		return 0, fmt.Errorf("ERR: querying tasks without company: %v", err)
 	}
-	return t.Format(time.RFC3339)
+
+	companies := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		t := new(TaskSection)
+		if err = rows.Scan(&id, &t.Content); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("ERR: scanning task for company: %v", err)
+		}
+		if company, ok := t.findCompany(); ok && company != "" {
+			companies[id] = company
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, fmt.Errorf("ERR: iterating tasks for company: %v", err)
+	}
+
+	for id, company := range companies {
+		if _, err = db.Exec(`UPDATE tasks SET company = ? WHERE id = ?`, company, id); err != nil {
+			errlog.ERR.Printf("ERR: storing company of task %d: %v\n", id, err)
+			return 0, fmt.Errorf("ERR: storing company of task %d: %v", id, err)
+		}
+	}
+
+	return len(companies), nil
 }
 
-func parseTime(timeStr string) (time.Time, error) {
-	if timeStr == "" || timeStr == "0001-01-01T00:00:00Z" {
-		return time.Time{}, nil // Return zero time
+// BackfillWindowTimezones fixes the windows stored before they were read in the timezone of the site.
+// Those were saved as UTC with the wall clock of the document, so 06:00 in Lisbon became 06:00Z; the wall clock
+// is kept and put into the timezone of the site. Windows with another offset were already set right (from the editor)
+func BackfillWindowTimezones(db *sql.DB) (int, error) {
+	rows, err := db.Query(`
+		SELECT id, COALESCE(NULLIF(original_address, ''), address, ''),
+		       load_start_date, load_end_date, unload_start_date, unload_end_date
+		FROM tasks WHERE window_timezone IS NULL`)
+	if err != nil {
+		errlog.ERR.Printf("ERR: querying tasks without window timezone: %v\n", err)
+		return 0, fmt.Errorf("ERR: querying tasks without window timezone: %v", err)
 	}
 
-	formats := []string{
-		"2006-01-02 15:04:05.999999-07:00",
-		time.RFC3339Nano,
-		time.RFC3339,
-		"2006-01-02 15:04:05",
+	type taskWindows struct {
+		site    *time.Location
+		windows [4]sql.NullString
+	}
+	tasks := make(map[int64]*taskWindows)
+	for rows.Next() {
+		var id int64
+		var address string
+		w := new(taskWindows)
+		if err = rows.Scan(&id, &address, &w.windows[0], &w.windows[1], &w.windows[2], &w.windows[3]); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("ERR: scanning task for window timezone: %v", err)
+		}
+		w.site = AddressLocation(address)
+		tasks[id] = w
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, fmt.Errorf("ERR: iterating tasks for window timezone: %v", err)
 	}
 
-	for _, format := range formats {
-		t, err := time.Parse(format, timeStr)
-		if err == nil {
-			return t, nil
+	for id, w := range tasks {
+		args := make([]any, 0, 6)
+		for _, window := range w.windows {
+			args = append(args, nullTime(siteWallClock(window, w.site)))
+		}
+		args = append(args, w.site.String(), id)
+
+		_, err = db.Exec(`
+			UPDATE tasks SET load_start_date = ?, load_end_date = ?, unload_start_date = ?, unload_end_date = ?, window_timezone = ?
+			WHERE id = ?`, args...)
+		if err != nil {
+			errlog.ERR.Printf("ERR: storing window timezone of task %d: %v\n", id, err)
+			return 0, fmt.Errorf("ERR: storing window timezone of task %d: %v", id, err)
 		}
 	}
-	return time.Time{}, fmt.Errorf("unable to parse time: %s", timeStr)
+
+	return len(tasks), nil
+}
+
+func siteWallClock(stored sql.NullString, site *time.Location) *time.Time {
+	if !stored.Valid || stored.String == "" {
+		return nil
+	}
+	t, err := parseTimeString(stored.String)
+	if err != nil || t.IsZero() {
+		return nil
+	}
+	if _, offset := t.Zone(); offset == 0 {
+		t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), site)
+	}
+	return &t
 }
@@ -0,0 +1,73 @@
+package parser_test
+
+import (
+	"database/sql"
+	"log"
+	"path/filepath"
+	"testing"
+
+	"logistictbot/audit"
+	"logistictbot/db"
+	"logistictbot/errlog"
+	"logistictbot/parser"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// openTestDB is a new database with the tables of the shipments and their tasks, the search index is left to the tests
+// built with fts5
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	// main points them at the log bot, the tests log what goes wrong next to their own output
+	for _, m := range []*errlog.ErrMonitor{errlog.ERR, errlog.WARN, errlog.INFO} {
+		if m.Logger == nil {
+			m.Logger = log.Default()
+		}
+	}
+
+	s, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	for _, check := range []func(db.DBExecutor) error{
+		db.CheckFilesTable, db.CheckCleaningStationsTable, db.CheckShipmentsTable, db.CheckShipmentDriversTable, db.CheckAuditLogTable,
+		db.CheckShipmentStatusHistoryTable, db.CheckTasksTable, db.CheckTaskCompartmentsTable, db.CheckTaskCleaningsTable, db.CheckTaskDocsTable,
+	} {
+		if err = check(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// storeTask upserts on the type of the task, CheckTasksTable does not make the index for it
+	mustExec(t, s, `CREATE UNIQUE INDEX IF NOT EXISTS idx_tasks_shipment_type ON tasks(shipment_id, type)`)
+	return s
+}
+
+// storeTestShipment stores a shipment with a load and an unload the way a parsed document is stored
+func storeTestShipment(t *testing.T, s *sql.DB, id int64, tasks ...*parser.TaskSection) *parser.Shipment {
+	t.Helper()
+	shipment := testShipment(id, tasks...)
+	if err := shipment.StoreShipment(s, audit.System); err != nil {
+		t.Fatal(err)
+	}
+	return shipment
+}
+
+// testShipment is what the parser gives for a document with the tasks, a load and an unload when none are given
+func testShipment(id int64, tasks ...*parser.TaskSection) *parser.Shipment {
+	if len(tasks) == 0 {
+		tasks = []*parser.TaskSection{
+			{Type: parser.TaskLoad, Address: "BASF SE, CARL-BOSCH-STRASSE 38, DE-67056 LUDWIGSHAFEN", Product: "METHANOL"},
+			{Type: parser.TaskUnload, Address: "INEOS KÖLN GMBH, DE-50769 KÖLN", Product: "METHANOL"},
+		}
+	}
+	return &parser.Shipment{Id: id, DocLang: parser.German, InstructionType: parser.InstructionType("x"), CarId: "CAR1", Tasks: tasks}
+}
+
+func mustExec(t *testing.T, s *sql.DB, query string, args ...any) {
+	t.Helper()
+	if _, err := s.Exec(query, args...); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+}
@@ -0,0 +1,155 @@
+package parser
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"logistictbot/audit"
+	"logistictbot/config"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultFreeTime is the free time of the sites and customers that freetimes.json does not name, or when there is no file
+const defaultFreeTime = 2 * time.Hour
+
+// FreeTimes is freetimes.json, how long the truck can wait on the site before the customer pays for the waiting.
+// A site rule wins over a customer one, the first rule that matches is used
+type FreeTimes struct {
+	DefaultMinutes *int           `json:"default_minutes"`
+	Customers      []FreeTimeRule `json:"customers"` // matched against the company of the task
+	Sites          []FreeTimeRule `json:"sites"`     // matched against the address of the task
+}
+
+type FreeTimeRule struct {
+	Match   string `json:"match"` // a part of the company or the address, the case does not matter
+	Minutes int    `json:"minutes"`
+}
+
+var (
+	freeTimesMu sync.RWMutex
+	freeTimes   FreeTimes
+)
+
+// LoadFreeTimes reads the free times of the customers and the sites instead of the previous ones.
+// A file that does not exist means every site has the default free time
+func LoadFreeTimes(file string) error {
+	data, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		setFreeTimes(FreeTimes{})
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("ERR: reading %s: %v", file, err)
+	}
+
+	var ft FreeTimes
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(&ft); err != nil {
+		return fmt.Errorf("ERR: decoding %s: %v", file, err)
+	}
+	if err = ft.validate(); err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+
+	setFreeTimes(ft)
+	return nil
+}
+
+func setFreeTimes(ft FreeTimes) {
+	freeTimesMu.Lock()
+	defer freeTimesMu.Unlock()
+
+	freeTimes = ft
+}
+
+func (ft *FreeTimes) validate() error {
+	var errs []error
+	if ft.DefaultMinutes != nil && *ft.DefaultMinutes < 0 {
+		errs = append(errs, fmt.Errorf("default_minutes is negative"))
+	}
+	for kind, rules := range map[string][]FreeTimeRule{"customers": ft.Customers, "sites": ft.Sites} {
+		for i, r := range rules {
+			if strings.TrimSpace(r.Match) == "" {
+				errs = append(errs, fmt.Errorf("%s[%d]: match is not set", kind, i))
+			}
+			if r.Minutes < 0 {
+				errs = append(errs, fmt.Errorf("%s[%d]: minutes is negative", kind, i))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func matchFreeTime(rules []FreeTimeRule, value string) (time.Duration, bool) {
+	value = strings.ToLower(value)
+	for _, r := range rules {
+		if value != "" && strings.Contains(value, strings.ToLower(strings.TrimSpace(r.Match))) {
+			return time.Duration(r.Minutes) * time.Minute, true
+		}
+	}
+	return 0, false
+}
+
+// FreeTime is how long the truck waits on the site of the task for free, by the site, then by the customer
+func (t *TaskSection) FreeTime() time.Duration {
+	freeTimesMu.RLock()
+	defer freeTimesMu.RUnlock()
+
+	if free, ok := matchFreeTime(freeTimes.Sites, t.Address); ok {
+		return free
+	}
+	if free, ok := matchFreeTime(freeTimes.Customers, t.Company); ok {
+		return free
+	}
+	if freeTimes.DefaultMinutes != nil {
+		return time.Duration(*freeTimes.DefaultMinutes) * time.Minute
+	}
+	return defaultFreeTime
+}
+
+// Demurrage is how long the truck was on the site of the task and how much of it is beyond the free time, which the
+// customer pays for. The waiting counts from the arrival to the end of the task, but not before the window opens,
+// the truck that came early waits on its own. ok is false for the cleaning, and when the driver did not say he arrived
+// or the task is not finished
+func (t *TaskSection) Demurrage() (waiting, billable time.Duration, ok bool) {
+	if t.Type == TaskCleaning || t.Arrived.IsZero() || !t.IsFinished() {
+		return 0, 0, false
+	}
+
+	from := t.Arrived
+	if start, _ := t.Window(); start.After(from) && start.Before(t.End) {
+		from = start
+	}
+	waiting = t.End.Sub(from)
+	if waiting < 0 {
+		waiting = 0
+	}
+	return waiting, max(waiting-t.FreeTime(), 0), true
+}
+
+// MarkArrived stores when the driver came to the site of the task
+func (t *TaskSection) MarkArrived(db *sql.DB, by audit.Actor) error {
+	return auditedWrite(db, by, t.auditTarget(), []string{"arrived"}, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`UPDATE tasks SET arrived = ?, updated_at = datetime('now') WHERE id = ?`,
+			t.Arrived.In(config.WarsawLoc).Format(time.RFC3339), t.Id)
+		return err
+	})
+}
+
+// taskArrival is the arrived column, NULL while the driver did not say he is on the site
+type taskArrival struct {
+	at sql.NullString
+}
+
+func (a taskArrival) apply(t *TaskSection) {
+	if a.at.Valid {
+		t.Arrived, _ = parseTimeString(a.at.String)
+	}
+}
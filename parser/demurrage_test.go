@@ -0,0 +1,44 @@
+package parser
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDemurrage(t *testing.T) {
+	at := func(hour, minute int) time.Time { return time.Date(2025, 5, 6, hour, minute, 0, 0, time.UTC) }
+	threeHours := 180
+	setFreeTimes(FreeTimes{
+		DefaultMinutes: &threeHours,
+		Customers:      []FreeTimeRule{{Match: "Hoyer", Minutes: 60}},
+		Sites:          []FreeTimeRule{{Match: "ludwigshafen", Minutes: 240}},
+	})
+	defer setFreeTimes(FreeTimes{})
+
+	tests := []struct {
+		name         string
+		task         TaskSection
+		wantFree     time.Duration
+		wantWaiting  time.Duration
+		wantBillable time.Duration
+		wantOk       bool
+	}{
+		{"default free time", TaskSection{Type: TaskLoad, Arrived: at(6, 0), Start: at(8, 0), End: at(10, 0)}, 3 * time.Hour, 4 * time.Hour, time.Hour, true},
+		{"customer free time", TaskSection{Type: TaskUnload, Company: "HOYER GmbH", Arrived: at(6, 0), Start: at(7, 0), End: at(8, 30)}, time.Hour, 150 * time.Minute, 90 * time.Minute, true},
+		{"site wins over customer", TaskSection{Type: TaskLoad, Company: "Hoyer", Address: "BASF, Ludwigshafen", Arrived: at(6, 0), Start: at(7, 0), End: at(9, 0)}, 4 * time.Hour, 3 * time.Hour, 0, true},
+		{"early arrival waits from the window", TaskSection{Type: TaskLoad, LoadStartDate: at(8, 0), LoadEndDate: at(10, 0), Arrived: at(5, 0), Start: at(8, 30), End: at(12, 0)}, 3 * time.Hour, 4 * time.Hour, time.Hour, true},
+		{"no arrival", TaskSection{Type: TaskLoad, Start: at(7, 0), End: at(9, 0)}, 3 * time.Hour, 0, 0, false},
+		{"not finished", TaskSection{Type: TaskLoad, Arrived: at(6, 0), Start: at(7, 0)}, 3 * time.Hour, 0, 0, false},
+		{"cleaning", TaskSection{Type: TaskCleaning, Arrived: at(6, 0), Start: at(7, 0), End: at(9, 0)}, 3 * time.Hour, 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		if free := tt.task.FreeTime(); free != tt.wantFree {
+			t.Errorf("%s: free time %v, want %v", tt.name, free, tt.wantFree)
+		}
+		waiting, billable, ok := tt.task.Demurrage()
+		if waiting != tt.wantWaiting || billable != tt.wantBillable || ok != tt.wantOk {
+			t.Errorf("%s: got %v %v %v, want %v %v %v", tt.name, waiting, billable, ok, tt.wantWaiting, tt.wantBillable, tt.wantOk)
+		}
+	}
+}
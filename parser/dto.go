@@ -9,6 +9,8 @@ import (
 type FlexTime struct {
 	time.Time
 	Valid bool
+
+	floating bool // sent without an offset, the wall clock was read as UTC
 }
 
 var validTaskTypes = map[string]bool{
@@ -67,6 +69,7 @@ func (ft *FlexTime) UnmarshalJSON(data []byte) error {
 		if err == nil {
 			ft.Time = t
 			ft.Valid = true
+			ft.floating = f != time.RFC3339
 			return nil
 		}
 		lastErr = err
@@ -81,6 +84,15 @@ func (ft FlexTime) MarshalJSON() ([]byte, error) {
 	return json.Marshal(ft.Time.Format(time.RFC3339))
 }
 
+// At puts a time sent without an offset into loc, keeping its wall clock. Times with an offset are left as they are
+func (ft FlexTime) At(loc *time.Location) FlexTime {
+	if !ft.Valid || !ft.floating {
+		return ft
+	}
+	t := ft.Time
+	return FlexTime{Time: time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc), Valid: true}
+}
+
 func (ft FlexTime) Ptr() *time.Time {
 	if !ft.Valid {
 		return nil
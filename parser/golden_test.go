@@ -0,0 +1,190 @@
+package parser
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// go test ./parser -run TestGoldenCorpus -update rewrites the expected json after an intended change of the parser,
+// check the diff of testdata/golden before committing it
+var updateGolden = flag.Bool("update", false, "rewrite the expected json files in testdata/golden")
+
+const goldenDir = "testdata/golden"
+
+// goldenShipment is what the parser gives back without the raw lines and the things set later by the bot (ids, drivers, timestamps)
+type goldenShipment struct {
+	Parser          string          `json:"parser"`
+	Id              int64           `json:"id"`
+	DocLang         Language        `json:"doc_lang"`
+	InstructionType InstructionType `json:"instruction_type"`
+	CarId           string          `json:"car_id"`
+	DriverName      string          `json:"driver_name"`
+	Container       string          `json:"container"`
+	Chassis         string          `json:"chassis"`
+	Tankdetails     string          `json:"tankdetails"`
+	GeneralRemark   string          `json:"general_remark"`
+	Tasks           []goldenTask    `json:"tasks"`
+}
+
+type goldenTask struct {
+	Type              string              `json:"type"`
+	Address           string              `json:"address"`
+	AddressParts      AddressParts        `json:"address_parts"`
+	Company           string              `json:"company"`
+	TankStatus        string              `json:"tank_status"`
+	CustomerReference string              `json:"customer_reference"`
+	LoadReference     string              `json:"load_reference"`
+	UnloadReference   string              `json:"unload_reference"`
+	LoadStartDate     string              `json:"load_start_date"`
+	LoadEndDate       string              `json:"load_end_date"`
+	UnloadStartDate   string              `json:"unload_start_date"`
+	UnloadEndDate     string              `json:"unload_end_date"`
+	Product           string              `json:"product"`
+	Weight            string              `json:"weight"`
+	Volume            string              `json:"volume"`
+	Temperature       string              `json:"temperature"`
+	DeclaredWeight    string              `json:"declared_weight"`
+	DeclaredVolume    string              `json:"declared_volume"`
+	DeclaredTemp      string              `json:"declared_temperature"`
+	Compartment       int                 `json:"compartment"`
+	Compartments      []goldenCompartment `json:"compartments,omitempty"`
+	Remark            string              `json:"remark"`
+}
+
+type goldenCompartment struct {
+	Number         int    `json:"number"`
+	Product        string `json:"product"`
+	Weight         string `json:"weight"`
+	Volume         string `json:"volume"`
+	Temperature    string `json:"temperature"`
+	DeclaredWeight string `json:"declared_weight"`
+	DeclaredVolume string `json:"declared_volume"`
+	DeclaredTemp   string `json:"declared_temperature"`
+}
+
+func goldenTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("2006-01-02 15:04 -07:00")
+}
+
+func newGoldenShipment(parserName string, s *Shipment) goldenShipment {
+	g := goldenShipment{
+		Parser:          parserName,
+		Id:              s.Id,
+		DocLang:         s.DocLang,
+		InstructionType: s.InstructionType,
+		CarId:           s.CarId,
+		DriverName:      s.DriverName,
+		Container:       s.Container,
+		Chassis:         s.Chassis,
+		Tankdetails:     s.Tankdetails,
+		GeneralRemark:   s.GeneralRemark,
+		Tasks:           make([]goldenTask, 0, len(s.Tasks)),
+	}
+
+	for _, t := range s.Tasks {
+		var compartments []goldenCompartment
+		for _, c := range t.Compartments {
+			compartments = append(compartments, goldenCompartment{
+				Number:         c.Number,
+				Product:        c.Product,
+				Weight:         c.Weight,
+				Volume:         c.Volume,
+				Temperature:    c.Temperature,
+				DeclaredWeight: c.DeclaredWeight.String(),
+				DeclaredVolume: c.DeclaredVolume.String(),
+				DeclaredTemp:   c.DeclaredTemperature.String(),
+			})
+		}
+		g.Tasks = append(g.Tasks, goldenTask{
+			Type:              t.Type,
+			Address:           t.Address,
+			AddressParts:      t.AddressParts,
+			Company:           t.Company,
+			TankStatus:        t.TankStatus,
+			CustomerReference: t.CustomerReference,
+			LoadReference:     t.LoadReference,
+			UnloadReference:   t.UnloadReference,
+			LoadStartDate:     goldenTime(t.LoadStartDate),
+			LoadEndDate:       goldenTime(t.LoadEndDate),
+			UnloadStartDate:   goldenTime(t.UnloadStartDate),
+			UnloadEndDate:     goldenTime(t.UnloadEndDate),
+			Product:           t.Product,
+			Weight:            t.Weight,
+			Volume:            t.Volume,
+			Temperature:       t.Temperature,
+			DeclaredWeight:    t.DeclaredWeight.String(),
+			DeclaredVolume:    t.DeclaredVolume.String(),
+			DeclaredTemp:      t.DeclaredTemperature.String(),
+			Compartment:       t.Compartment,
+			Compartments:      compartments,
+			Remark:            t.Remark,
+		})
+	}
+
+	return g
+}
+
+// TestGoldenCorpus runs every pdftotext-style document in testdata/golden through the parser registry
+// and compares the result with the json next to it
+func TestGoldenCorpus(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join(goldenDir, "*.txt"))
+	if err != nil {
+		t.Fatalf("listing golden inputs: %v", err)
+	}
+	if len(inputs) == 0 {
+		t.Fatalf("no inputs found in %s", goldenDir)
+	}
+
+	for _, input := range inputs {
+		name := strings.TrimSuffix(filepath.Base(input), ".txt")
+		t.Run(name, func(t *testing.T) {
+			docText, err := os.ReadFile(input)
+			if err != nil {
+				t.Fatalf("reading %s: %v", input, err)
+			}
+
+			p, err := DetectParser(string(docText))
+			if err != nil {
+				t.Fatalf("DetectParser: %v", err)
+			}
+			shipment, err := p.Parse(string(docText))
+			if err != nil {
+				t.Fatalf("%s parser: %v", p.Name(), err)
+			}
+
+			// the text is kept html escaped for the cards, the json shows it the way it is stored
+			var out strings.Builder
+			enc := json.NewEncoder(&out)
+			enc.SetEscapeHTML(false)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(newGoldenShipment(p.Name(), shipment)); err != nil {
+				t.Fatalf("marshalling result: %v", err)
+			}
+			got := []byte(out.String())
+
+			goldenPath := filepath.Join(goldenDir, name+".json")
+			if *updateGolden {
+				if err := os.WriteFile(goldenPath, got, 0644); err != nil {
+					t.Fatalf("writing %s: %v", goldenPath, err)
+				}
+				return
+			}
+
+			want, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatalf("reading %s (run with -update to create it): %v", goldenPath, err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("parser output differs from %s\n--- got ---\n%s\n--- want ---\n%s", goldenPath, got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package parser
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"logistictbot/audit"
+	"logistictbot/errlog"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// A shipment can change its driver and car on the way (the truck broke down). The tasks finished before that stay
+// credited to who did them: their driver_id and car_id are set when they are begun (see SetTaskPerformer), or at the
+// handover for the ones from before. Tasks without them are the shipment's
+
+var ErrNothingToHandOver = errors.New("the shipment has no unfinished tasks to hand over")
+
+type taskCredit struct {
+	driver, car sql.NullString
+}
+
+func (c taskCredit) apply(t *TaskSection) {
+	if c.driver.Valid {
+		t.DriverId, _ = uuid.FromString(c.driver.String)
+	}
+	if c.car.Valid {
+		t.CarId = c.car.String
+	}
+}
+
+// TaskDriver is the driver the task is credited to
+func (s *Shipment) TaskDriver(t *TaskSection) uuid.UUID {
+	if !t.DriverId.IsNil() {
+		return t.DriverId
+	}
+	return s.DriverId
+}
+
+// TaskCar is the car the task was driven with
+func (s *Shipment) TaskCar(t *TaskSection) string {
+	if t.CarId != "" {
+		return t.CarId
+	}
+	return s.CarId
+}
+
+// UnfinishedTasks are the tasks that are left to do, the ones a handover moves
+func (s *Shipment) UnfinishedTasks() []*TaskSection {
+	tasks := make([]*TaskSection, 0, len(s.Tasks))
+	for _, t := range s.Tasks {
+		if !t.IsFinished() {
+			tasks = append(tasks, t)
+		}
+	}
+	return tasks
+}
+
+// HandOver gives the unfinished tasks of the shipment to another driver and car. The finished ones are credited to the
+// driver and the car the shipment had, the started ones start over. s has to be loaded with its tasks (GetShipment)
+func (s *Shipment) HandOver(db *sql.DB, driverId uuid.UUID, carId string, by audit.Actor) error {
+	if s.IsClosed() {
+		return fmt.Errorf("%w: shipment %d is %s", ErrStatusTransition, s.Id, s.Status)
+	}
+	if len(s.UnfinishedTasks()) == 0 {
+		return ErrNothingToHandOver
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		errlog.ERR.Printf("ERR: begin transaction: %v", err)
+		return fmt.Errorf("ERR: begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	snapshots := make([]*audit.Snapshot, 0, len(s.Tasks)+1)
+	for _, t := range s.Tasks {
+		before, err := audit.Before(tx, t.auditTarget(), "driver_id", "car_id", "start")
+		if err != nil {
+			return err
+		}
+		snapshots = append(snapshots, before)
+	}
+	before, err := audit.Before(tx, s.auditTarget(), "driver_id", "car_id")
+	if err != nil {
+		return err
+	}
+	snapshots = append(snapshots, before)
+
+	_, err = tx.Exec(`
+		UPDATE tasks SET driver_id = ?, car_id = ?
+		WHERE shipment_id = ? AND driver_id IS NULL AND COALESCE(end, '') != ''`,
+		s.DriverId.String(), s.CarId, s.Id)
+	if err != nil {
+		errlog.ERR.Printf("ERR: crediting the finished tasks of shipment %d: %v\n", s.Id, err)
+		return fmt.Errorf("ERR: crediting the finished tasks of shipment %d: %v", s.Id, err)
+	}
+
+	_, err = tx.Exec(`UPDATE tasks SET start = NULL, driver_id = NULL, car_id = NULL WHERE shipment_id = ? AND COALESCE(end, '') = ''`, s.Id)
+	if err != nil {
+		errlog.ERR.Printf("ERR: resetting the started tasks of shipment %d: %v\n", s.Id, err)
+		return fmt.Errorf("ERR: resetting the started tasks of shipment %d: %v", s.Id, err)
+	}
+
+	// the co-drivers stay in the old truck
+	if _, err = tx.Exec(`DELETE FROM shipment_drivers WHERE shipment_id = ?`, s.Id); err != nil {
+		errlog.ERR.Printf("ERR: removing the co-drivers of shipment %d: %v\n", s.Id, err)
+		return fmt.Errorf("ERR: removing the co-drivers of shipment %d: %v", s.Id, err)
+	}
+
+	now := time.Now()
+	_, err = tx.Exec(`UPDATE shipments SET driver_id = ?, car_id = ?, updated_at = ? WHERE id = ?`, driverId.String(), carId, now, s.Id)
+	if err != nil {
+		errlog.ERR.Printf("ERR: handing over shipment %d: %v\n", s.Id, err)
+		return fmt.Errorf("ERR: handing over shipment %d: %v", s.Id, err)
+	}
+
+	for _, before := range snapshots {
+		if err = before.After(tx, by); err != nil {
+			return err
+		}
+	}
+	for _, coDriver := range s.CoDrivers {
+		if err = audit.Record(tx, by, coDriverTarget(s.Id, coDriver), audit.Change{Field: "co_driver", Old: coDriver}); err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		errlog.ERR.Printf("ERR: commit transaction: %v", err)
+		return fmt.Errorf("ERR: commit transaction: %v", err)
+	}
+
+	for _, t := range s.Tasks {
+		if t.IsFinished() {
+			if t.DriverId.IsNil() {
+				t.DriverId, t.CarId = s.DriverId, s.CarId
+			}
+			continue
+		}
+		t.Start, t.DriverId, t.CarId = time.Time{}, uuid.Nil, ""
+	}
+	s.DriverId, s.CarId, s.UpdatedAt, s.CoDrivers = driverId, carId, now, nil
+	return nil
+}
+
+// Assign gives the draft shipment to the driver and the car, it is then assigned. The shipments the manager fixes in
+// the editor before sending them are stored as drafts without a driver, until the manager accepts them
+func (s *Shipment) Assign(db *sql.DB, driverId uuid.UUID, carId string, by audit.Actor) error {
+	tx, err := db.Begin()
+	if err != nil {
+		errlog.ERR.Printf("ERR: begin transaction: %v", err)
+		return fmt.Errorf("ERR: begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	before, err := audit.Before(tx, s.auditTarget(), "driver_id", "car_id")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE shipments SET driver_id = ?, car_id = ?, updated_at = ? WHERE id = ?`, driverId.String(), carId, time.Now(), s.Id)
+	if err != nil {
+		errlog.ERR.Printf("ERR: assigning shipment %d: %v\n", s.Id, err)
+		return fmt.Errorf("ERR: assigning shipment %d: %v", s.Id, err)
+	}
+	if err = before.After(tx, by); err != nil {
+		return err
+	}
+	if err = s.setStatus(tx, StatusAssigned, by, ""); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		errlog.ERR.Printf("ERR: commit transaction: %v", err)
+		return fmt.Errorf("ERR: commit transaction: %v", err)
+	}
+	s.DriverId, s.CarId = driverId, carId
+	return nil
+}
@@ -0,0 +1,34 @@
+package parser
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+func TestTaskCredit(t *testing.T) {
+	oldDriver, newDriver := uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+	done := &TaskSection{Id: 1, Type: TaskLoad, Start: time.Now().Add(-time.Hour), End: time.Now(), DriverId: oldDriver, CarId: "OLD"}
+	started := &TaskSection{Id: 2, Type: TaskUnload, Start: time.Now()}
+	todo := &TaskSection{Id: 3, Type: TaskCleaning}
+	s := &Shipment{DriverId: newDriver, CarId: "NEW", Tasks: []*TaskSection{done, started, todo}}
+
+	if got := s.TaskDriver(done); got != oldDriver {
+		t.Errorf("the finished task should stay with the old driver, got %s", got)
+	}
+	if got := s.TaskCar(done); got != "OLD" {
+		t.Errorf("the finished task should stay with the old car, got %s", got)
+	}
+	if got := s.TaskDriver(todo); got != newDriver {
+		t.Errorf("the task left should be the shipment's driver, got %s", got)
+	}
+	if got := s.TaskCar(started); got != "NEW" {
+		t.Errorf("the task left should be the shipment's car, got %s", got)
+	}
+
+	left := s.UnfinishedTasks()
+	if len(left) != 2 || left[0].Id != 2 || left[1].Id != 3 {
+		t.Errorf("unfinished tasks should be 2 and 3 in order, got %v", left)
+	}
+}
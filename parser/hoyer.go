@@ -0,0 +1,53 @@
+package parser
+
+import (
+	"strings"
+)
+
+const HoyerParserName = "hoyer"
+
+// HoyerParser reads the "LADE/ENTLADE ANWEISUNG", "INSTRUCTIONS DE ..." and "... INSTRUCTION" documents sent by Hoyer
+type HoyerParser struct{}
+
+func init() {
+	RegisterParser(HoyerParser{})
+}
+
+func (HoyerParser) Name() string {
+	return HoyerParserName
+}
+
+// Detect wants the layout of the document, the instruction header and the shipment line. "Hoyer" in the text is not enough,
+// it is the customer or the consignor in the cells of an imported spreadsheet too
+func (HoyerParser) Detect(docText string) bool {
+	hasShipmentLine := false
+	for line := range strings.SplitSeq(docText, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "Shipment") {
+			hasShipmentLine = true
+			break
+		}
+	}
+	if !hasShipmentLine {
+		return false
+	}
+
+	_, found := new(Shipment).IdentifyInstructionForDoc(docText)
+	return found
+}
+
+func (HoyerParser) Parse(docText string) (*Shipment, error) {
+	details := new(Shipment)
+	after, _ := details.IdentifyInstructionForDoc(docText)
+	after, _ = details.IdentifyShipmentIdForDoc(after)
+	// the details always come after the shipment id, starting from it keeps the split french header
+	// ("INSTRUCTIONS DE" / "DÉCHARGEMENT") from being taken as the first task
+	after, _ = details.IdentifyDeliveryDetails(after)
+
+	sections := details.ExtractTaskSections(after)
+	for _, section := range sections {
+		section.ParseTaskDetails()
+	}
+	details.Tasks = sections
+
+	return details, nil
+}
@@ -0,0 +1,301 @@
+package parser
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// the dictionaries in keywords/ are compiled in as the defaults, so the parser works even without the directory next to the binary.
+// LoadKeywords replaces them with the files from disk, on start and from the dev menu
+//
+//go:embed keywords/*.json
+var defaultKeywordsFS embed.FS
+
+// instructionDictionary describes the header of the document: "ANWEISUNG" + "ENTLADE", "INSTRUCTIONS DE" + "CHARGEMENT"
+type instructionDictionary struct {
+	Keyword string   `json:"keyword"`
+	Types   []string `json:"types"`
+}
+
+// keywordDictionary is one keywords/<language>.json. Every keyword is lowercase, the parser uppercases it where the documents do.
+// Languages without own instruction headers (pl) only add task and detail keywords
+type keywordDictionary struct {
+	Language    Language               `json:"language"`
+	Instruction *instructionDictionary `json:"instruction,omitempty"`
+	Tasks       map[string][]string    `json:"tasks"`
+	Details     map[string][]string    `json:"details"`
+
+	file string
+}
+
+var keywordTaskTypes = []string{TaskUnload, TaskLoad, TaskCollect, TaskDropoff, TaskCleaning}
+
+var keywordDetailFields = []string{
+	Company, Truck, Driver, Container, Chassis, Tankdetails,
+	CustomerReference, UnloadReference, LoadReference, LoadDate, UnloadDate,
+	Product, Remark, Weight, Volume, Temperature, Compartment, Destination, GenerellerHinweis, TankStatus,
+}
+
+var (
+	// keywordsMu guards everything built from the dictionaries, parsing holds the read lock (see registry.go)
+	keywordsMu sync.RWMutex
+
+	instructionDictionaries []keywordDictionary
+	validLanguages          map[Language]bool
+	validInstructionTypes   map[InstructionType]bool
+)
+
+func init() {
+	dictionaries, err := readKeywordDictionaries(defaultKeywordsFS, "keywords")
+	if err != nil {
+		log.Fatalf("ERR: reading the compiled in keyword dictionaries: %v", err)
+	}
+	if err = applyKeywordDictionaries(dictionaries); err != nil {
+		log.Fatalf("ERR: compiled in keyword dictionaries: %v", err)
+	}
+}
+
+// LoadKeywords reads every *.json in dir, checks them for conflicts and only then swaps them with the ones in use.
+// On any error the parser keeps working with the previous dictionaries
+func LoadKeywords(dir string) ([]Language, error) {
+	dictionaries, err := readKeywordDictionaries(os.DirFS(dir), ".")
+	if err != nil {
+		return nil, err
+	}
+
+	if err = applyKeywordDictionaries(dictionaries); err != nil {
+		return nil, err
+	}
+
+	languages := make([]Language, 0, len(dictionaries))
+	for _, d := range dictionaries {
+		languages = append(languages, d.Language)
+	}
+	return languages, nil
+}
+
+func readKeywordDictionaries(fsys fs.FS, dir string) ([]keywordDictionary, error) {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("ERR: listing keyword dictionaries: %v", err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("ERR: no keyword dictionaries (*.json) found")
+	}
+
+	dictionaries := make([]keywordDictionary, 0, len(files))
+	for _, file := range files {
+		f, err := fsys.Open(file)
+		if err != nil {
+			return nil, fmt.Errorf("ERR: opening %s: %v", file, err)
+		}
+
+		var d keywordDictionary
+		decoder := json.NewDecoder(f)
+		// a typo in a field name would otherwise silently drop a whole group of keywords
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&d)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("ERR: decoding %s: %v", file, err)
+		}
+
+		d.file = file
+		dictionaries = append(dictionaries, d)
+	}
+
+	return dictionaries, nil
+}
+
+type keywordOwner struct {
+	group    string
+	language Language
+}
+
+func (o keywordOwner) String() string {
+	return fmt.Sprintf("%s (%s)", o.group, o.language)
+}
+
+// validateKeywordDictionaries collects every problem instead of stopping at the first one, so a broken file can be fixed in one go.
+// The same keyword may appear in several languages as long as it means the same thing ("volume" in en and fr)
+func validateKeywordDictionaries(dictionaries []keywordDictionary) error {
+	var errs []error
+	conflict := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	checkKeyword := func(d keywordDictionary, group, keyword string) bool {
+		if keyword == "" || keyword != strings.ToLower(strings.TrimSpace(keyword)) {
+			conflict("%s: %s: %q has to be lowercase and without spaces around it", d.file, group, keyword)
+			return false
+		}
+		return true
+	}
+
+	languages := make(map[Language]string)
+	instructionKeywords := make(map[string]Language)
+	owners := make(map[string]keywordOwner)
+
+	own := func(d keywordDictionary, group, keyword string) {
+		owner := keywordOwner{group: group, language: d.Language}
+		if existing, ok := owners[keyword]; ok && existing.group != group {
+			conflict("%s: %q is a %s keyword, but already a %s keyword", d.file, keyword, owner, existing)
+			return
+		}
+		owners[keyword] = owner
+	}
+
+	for _, d := range dictionaries {
+		if d.Language == "" {
+			conflict("%s: language is not set", d.file)
+			continue
+		}
+		if file, ok := languages[d.Language]; ok {
+			conflict("%s: language %q is already in %s", d.file, d.Language, file)
+			continue
+		}
+		languages[d.Language] = d.file
+
+		if d.Instruction != nil {
+			if checkKeyword(d, "instruction", d.Instruction.Keyword) {
+				if other, ok := instructionKeywords[d.Instruction.Keyword]; ok {
+					conflict("%s: instruction keyword %q is already used by %s", d.file, d.Instruction.Keyword, other)
+				}
+				instructionKeywords[d.Instruction.Keyword] = d.Language
+			}
+			if len(d.Instruction.Types) == 0 {
+				conflict("%s: instruction %q has no types", d.file, d.Instruction.Keyword)
+			}
+			for _, t := range d.Instruction.Types {
+				checkKeyword(d, "instruction type", t)
+			}
+		}
+
+		for _, taskType := range sortedKeys(d.Tasks) {
+			if !slices.Contains(keywordTaskTypes, taskType) {
+				conflict("%s: unknown task type %q, known are %s", d.file, taskType, strings.Join(keywordTaskTypes, ", "))
+				continue
+			}
+			for _, keyword := range d.Tasks[taskType] {
+				if checkKeyword(d, "task "+taskType, keyword) {
+					own(d, "task "+taskType, keyword)
+				}
+			}
+		}
+
+		for _, field := range sortedKeys(d.Details) {
+			if !slices.Contains(keywordDetailFields, field) {
+				conflict("%s: unknown field %q, known are %s", d.file, field, strings.Join(keywordDetailFields, ", "))
+				continue
+			}
+			for _, keyword := range d.Details[field] {
+				if checkKeyword(d, "field "+field, keyword) {
+					own(d, "field "+field, keyword)
+				}
+			}
+		}
+	}
+
+	// the task of a line is found by the keyword it starts with, so a task keyword can not start with a keyword of another task type
+	taskKeywords := make([]string, 0)
+	for keyword, owner := range owners {
+		if strings.HasPrefix(owner.group, "task ") {
+			taskKeywords = append(taskKeywords, keyword)
+		}
+	}
+	sort.Strings(taskKeywords)
+	for _, short := range taskKeywords {
+		for _, long := range taskKeywords {
+			if short != long && strings.HasPrefix(long, short) && owners[short].group != owners[long].group {
+				conflict("%q is a %s keyword and starts with %q, which is a %s keyword", long, owners[long], short, owners[short])
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// applyKeywordDictionaries merges the languages into the maps the parser reads and swaps them in one go
+func applyKeywordDictionaries(dictionaries []keywordDictionary) error {
+	if err := validateKeywordDictionaries(dictionaries); err != nil {
+		return err
+	}
+
+	sort.Slice(dictionaries, func(i, j int) bool { return dictionaries[i].Language < dictionaries[j].Language })
+
+	tasks := make(map[string][]string)
+	details := make(map[string][]string)
+	instructions := make([]keywordDictionary, 0)
+	languages := make(map[Language]bool)
+	instructionTypes := make(map[InstructionType]bool)
+
+	for _, d := range dictionaries {
+		languages[d.Language] = true
+
+		for taskType, keywords := range d.Tasks {
+			tasks[taskType] = appendUnique(tasks[taskType], keywords...)
+		}
+		for field, keywords := range d.Details {
+			details[field] = appendUnique(details[field], keywords...)
+		}
+
+		if d.Instruction == nil {
+			continue
+		}
+		instructions = append(instructions, d)
+		details[Instruction] = appendUnique(details[Instruction], d.Instruction.Keyword)
+
+		keyword := strings.ToUpper(d.Instruction.Keyword)
+		for _, t := range d.Instruction.Types {
+			t = strings.ToUpper(t)
+			instructionTypes[InstructionType(keyword+" "+t)] = true
+			instructionTypes[InstructionType(t+" "+keyword)] = true
+		}
+	}
+
+	allTasks := make([]string, 0)
+	for _, taskType := range keywordTaskTypes {
+		allTasks = append(allTasks, tasks[taskType]...)
+	}
+	details[Address] = allTasks
+
+	keywordsMu.Lock()
+	defer keywordsMu.Unlock()
+
+	TaskKeywords = tasks
+	DetailsKeywords = details
+	AllTaskKeywords = allTasks
+	instructionDictionaries = instructions
+	validLanguages = languages
+	validInstructionTypes = instructionTypes
+
+	return nil
+}
+
+func appendUnique(list []string, values ...string) []string {
+	for _, v := range values {
+		if !slices.Contains(list, v) {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,91 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateKeywordDictionaries(t *testing.T) {
+	base := func() []keywordDictionary {
+		return []keywordDictionary{
+			{
+				Language:    German,
+				Instruction: &instructionDictionary{Keyword: "anweisung", Types: []string{"lade", "entlade"}},
+				Tasks:       map[string][]string{TaskLoad: {"laden"}, TaskUnload: {"entladen"}},
+				Details:     map[string][]string{Volume: {"volumen"}},
+				file:        "de.json",
+			},
+			{
+				Language: English,
+				Tasks:    map[string][]string{TaskLoad: {"load"}, TaskUnload: {"unload"}},
+				Details:  map[string][]string{Volume: {"volume"}},
+				file:     "en.json",
+			},
+		}
+	}
+
+	if err := validateKeywordDictionaries(base()); err != nil {
+		t.Fatalf("valid dictionaries rejected: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(d []keywordDictionary)
+		want   string
+	}{
+		{"same keyword under two tasks", func(d []keywordDictionary) { d[1].Tasks[TaskCollect] = []string{"laden"} }, `"laden" is a task collect`},
+		{"task keyword used as a field", func(d []keywordDictionary) { d[1].Details[Product] = []string{"unload"} }, `"unload" is a field product`},
+		{"task keyword starts with another task", func(d []keywordDictionary) { d[1].Tasks[TaskCleaning] = []string{"loading bay cleaning"} }, `starts with "load"`},
+		{"unknown task type", func(d []keywordDictionary) { d[0].Tasks["unloda"] = []string{"abladen"} }, `unknown task type "unloda"`},
+		{"unknown field", func(d []keywordDictionary) { d[0].Details["colour"] = []string{"farbe"} }, `unknown field "colour"`},
+		{"uppercase keyword", func(d []keywordDictionary) { d[0].Details[Volume] = []string{"Volumen"} }, "has to be lowercase"},
+		{"same language twice", func(d []keywordDictionary) { d[1].Language = German }, `language "de" is already in de.json`},
+		{"same instruction keyword", func(d []keywordDictionary) {
+			d[1].Instruction = &instructionDictionary{Keyword: "anweisung", Types: []string{"load"}}
+		}, `instruction keyword "anweisung" is already used by de`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := base()
+			tt.change(d)
+
+			err := validateKeywordDictionaries(d)
+			if err == nil {
+				t.Fatalf("conflict not found")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want it to mention %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadKeywords(t *testing.T) {
+	languages, err := LoadKeywords("keywords")
+	if err != nil {
+		t.Fatalf("LoadKeywords: %v", err)
+	}
+	if len(languages) != 4 {
+		t.Errorf("loaded languages %v, want de, en, fr and pl", languages)
+	}
+
+	for _, it := range []InstructionType{"ANWEISUNG ENTLADE", "ENTLADE ANWEISUNG", "INSTRUCTIONS DE DÉCHARGEMENT", "INSTRUCTION SHUNT"} {
+		if !it.IsValid() {
+			t.Errorf("%q is not valid", it)
+		}
+	}
+	if InstructionType("ANWEISUNG LOAD").IsValid() {
+		t.Errorf("a type from another language is valid")
+	}
+	if !Language(Polish).IsValid() || Language("nl").IsValid() {
+		t.Errorf("languages are not taken from the dictionaries")
+	}
+
+	if _, err = LoadKeywords(t.TempDir()); err == nil {
+		t.Errorf("an empty directory replaced the dictionaries")
+	}
+	if len(TaskKeywords[TaskLoad]) == 0 {
+		t.Errorf("a failed load left the parser without keywords")
+	}
+}
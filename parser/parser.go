@@ -5,10 +5,11 @@ import (
 	"html"
 	"log"
 	"regexp"
-	"slices"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 const (
@@ -26,10 +27,7 @@ const (
 	Chassis     = "chassis"
 	Tankdetails = "tankdetails"
 
-	Instruction                   = "instruction"
-	InstructionDescriptionGerman  = "instruction description de"
-	InstructionDescriptionEnglish = "instruction description en"
-	InstructionDescriptionFrench  = "instruction description fr"
+	Instruction = "instruction"
 
 	CustomerReference = "customer reference"
 	UnloadReference   = "unload reference"
@@ -49,70 +47,13 @@ const (
 	TankStatus        = "tank status"
 )
 
-var TaskKeywords = map[string][]string{
-	TaskUnload:   {"unload", "entladen", "rozładunek", "déchargement"},
-	TaskLoad:     {"load", "laden", "załadunek", "prise en charge", "chargement"},
-	TaskCollect:  {"collect", "aufnehmen", "aufnehmer bei", "odbiór", "collecte"},
-	TaskDropoff:  {"drop off", "absatteln", "absetzen", "odstawienie", "odczepienie", "dépose", "dételage", "décroche", "decouple"},
-	TaskCleaning: {"cleaning", "reinigen", "czyszczenie", "nettoyage"},
-}
-
-var DetailsKeywords = map[string][]string{
-	Address: AllTaskKeywords,
-	Company: {"im auftrag von", "pour le compte de", "in order of"},
-
-	Instruction:                   {"instructions de", "anweisung", "instruction"},
-	InstructionDescriptionGerman:  {"lade", "entlade", "umfuhr", "absetz"},
-	InstructionDescriptionEnglish: {"load", "unload", "transfer", "shunt", "drop"},
-	InstructionDescriptionFrench:  {"chargement", "déchargement", "shunt"},
-
-	Truck:       {"truck", "n° camion"},
-	Driver:      {"fahrer", "chauffeur", "driver"},
-	Chassis:     {"chassis"},
-	Container:   {"container", "tank", "conteneur"},
-	Tankdetails: {"tankdetails", "détails du conteneur"},
-
-	CustomerReference: {"customer reference", "référence client", "kundenreferenz"},
-	UnloadReference:   {"entladereferenz", "unload reference", "référence de livraison"},
-	LoadReference:     {"ladereferenz", "load reference", "référence de chargement"},
-
-	UnloadDate: {"unload date", "date de livraison", "entladedatum"},
-	LoadDate:   {"load date", "date de chargement", "ladedatum"},
-
-	Product:           {"product", "produit", "produkt"},
-	Remark:            {"hinweis", "remark", "commentaires"},
-	Weight:            {"poids", "weight", "gewicht"},
-	Volume:            {"volume", "volumen"},
-	Temperature:       {"temp", "temperatur", "temperature", "température", "tempér"},
-	Compartment:       {"compartiment", "compartment", "kammer"},
-	Destination:       {"destination"},
-	GenerellerHinweis: {"genereller hinweis", "general remark", "commentaires généraux"},
-	TankStatus:        {"tank status", "etat du conteneur"},
-}
-
-var AllTaskKeywords []string
-
-func init() {
-	AllTaskKeywords = slices.Concat(
-		TaskKeywords[TaskUnload],
-		TaskKeywords[TaskLoad],
-		TaskKeywords[TaskCollect],
-		TaskKeywords[TaskDropoff],
-		TaskKeywords[TaskCleaning],
-	)
-}
-
-func identifyShipmentId(line string) (shipmentId string, found bool) {
-	if a, f := strings.CutPrefix(line, "Shipment"); f {
-		a = strings.TrimSpace(a)
-		a, _ = strings.CutPrefix(a, ":")
-		if b, f := strings.CutSuffix(a, "Hoyer GmbH"); f {
-			a = b
-		}
-		return strings.TrimSpace(a), f
-	}
-	return "", false
-}
+// TaskKeywords, DetailsKeywords and AllTaskKeywords are built from the dictionaries in keywords/ (see LoadKeywords),
+// they are replaced as a whole on reload and must not be changed in place
+var (
+	TaskKeywords    map[string][]string
+	DetailsKeywords map[string][]string
+	AllTaskKeywords []string
+)
 
 func esc(s string) string {
 	return html.EscapeString(s)
@@ -168,165 +109,77 @@ func (s *Shipment) IdentifyShipmentIdForDoc(docText string) (after string, found
 
 func (s *Shipment) IdentifyInstructionForDoc(docText string) (after string, found bool) {
 	lines := strings.Split(docText, "\n")
-	var language Language
-	var instructionKeyword string
-
-	for lineNumber := 0; lineNumber < 2; lineNumber++ {
-		for _, keyword := range DetailsKeywords[Instruction] {
-			if strings.Contains(lines[lineNumber], strings.ToUpper(keyword)) {
-				switch keyword {
-				case DetailsKeywords[Instruction][0]: // FRENCH: "instructions de"
-					language = French
-					instructionKeyword = DetailsKeywords[Instruction][0]
-				case DetailsKeywords[Instruction][1]: // GERMAN: "anweisung"
-					language = German
-					instructionKeyword = DetailsKeywords[Instruction][1]
-				case DetailsKeywords[Instruction][2]: // ENGLISH: "instruction"
-					if keyword == "instruction" && strings.Contains(lines[lineNumber], strings.ToUpper("INSTRUCTIONS DE")) {
-						continue
-					}
-					language = English
-					instructionKeyword = DetailsKeywords[Instruction][2]
-				default:
-					return docText, false
-				}
-			}
-		}
-
-		switch language {
-
-		case French:
-			for _, frenchKeyword := range DetailsKeywords[InstructionDescriptionFrench] {
-				frenchKeyword = strings.ToUpper(frenchKeyword)
-				if !strings.Contains(lines[lineNumber], frenchKeyword) {
-					continue
-				} else if strings.Contains(lines[lineNumber], "DÉCHARGEMENT") && frenchKeyword == "CHARGEMENT" {
-					continue
-				}
-				s.InstructionType = InstructionType(strings.Join([]string{strings.ToUpper(instructionKeyword), frenchKeyword}, " "))
-				s.DocLang = language
-
-				if lineNumber == 0 {
-					after = strings.Join(lines[1:], "\n")
-				}
-				return after, true
-			}
-			if lineNumber == 0 {
-				after = strings.Join(lines[2:], "\n")
-				continue
-			}
-			log.Println("PARSER ERR: french: not included in the dictionary")
-
-			return docText, false
-		case German:
-			for _, germanKeyword := range DetailsKeywords[InstructionDescriptionGerman] {
-
-				germanKeyword = strings.ToUpper(germanKeyword)
-				if !strings.Contains(lines[lineNumber], germanKeyword) {
-					continue
-				} else if strings.Contains(lines[lineNumber], "ENTLADE") && germanKeyword == "LADE" {
-					continue
-				}
-				s.InstructionType = InstructionType(strings.Join([]string{strings.ToUpper(instructionKeyword), germanKeyword}, " "))
-				s.DocLang = language
+	var dictionary *keywordDictionary
 
-				after = strings.Join(lines[1:], "\n")
-				return after, true
-			}
-			log.Println("PARSER ERR: german: not included in the dictionary")
-			return docText, false
-		case English:
-			for _, englishKeyword := range DetailsKeywords[InstructionDescriptionEnglish] {
-
-				englishKeyword = strings.ToUpper(englishKeyword)
-				if !strings.Contains(lines[lineNumber], englishKeyword) {
-					continue
-				} else if strings.Contains(lines[lineNumber], "UNLOAD") && englishKeyword == "LOAD" {
-					continue
-				}
-				s.InstructionType = InstructionType(strings.Join([]string{strings.ToUpper(instructionKeyword), englishKeyword}, " "))
-				s.DocLang = language
+	for lineNumber := 0; lineNumber < 2 && lineNumber < len(lines); lineNumber++ {
+		if d, ok := matchInstructionKeyword(lines[lineNumber]); ok {
+			dictionary = d
+		}
+		if dictionary == nil {
+			continue
+		}
 
-				after = strings.Join(lines[1:], "\n")
-				return docText, true
-			}
-			log.Println("PARSER ERR: english: not included in the dictionary")
-			return docText, false
-		default:
+		if description, ok := matchInstructionType(lines[lineNumber], dictionary.Instruction); ok {
+			s.InstructionType = InstructionType(strings.ToUpper(dictionary.Instruction.Keyword) + " " + description)
+			s.DocLang = dictionary.Language
+			return strings.Join(lines[lineNumber+1:], "\n"), true
+		}
+		// "INSTRUCTIONS DE" / "DÉCHARGEMENT", the type is on the next line
+		if lineNumber == 0 {
 			continue
 		}
 
+		log.Printf("PARSER ERR: %s: not included in the dictionary\n", dictionary.Language)
+		return docText, false
 	}
 	return docText, false
 }
 
-func identifyInstruction(line string, isNextLine bool) (instructionType string, language Language, found bool) {
-
-	for _, instructionKeyword := range DetailsKeywords[Instruction] {
-		if strings.Contains(line, strings.ToUpper(instructionKeyword)) {
-			switch instructionKeyword {
-			case DetailsKeywords[Instruction][0]: // FRENCH: "instructions de"
-				language = French
-			case DetailsKeywords[Instruction][1]: // GERMAN: "anweisung"
-				language = German
-			case DetailsKeywords[Instruction][2]: // ENGLISH: "instruction"
-				language = English
-			default:
-				return "", "", false
-			}
-		} else if isNextLine {
-			language = French
+// matchInstructionKeyword finds the language of the instruction header. The longest keyword wins,
+// "INSTRUCTIONS DE CHARGEMENT" contains the english "INSTRUCTION" as well
+func matchInstructionKeyword(line string) (*keywordDictionary, bool) {
+	var match *keywordDictionary
+	for i, d := range instructionDictionaries {
+		keyword := strings.ToUpper(d.Instruction.Keyword)
+		if strings.Contains(line, keyword) && (match == nil || len(keyword) > len(match.Instruction.Keyword)) {
+			match = &instructionDictionaries[i]
 		}
+	}
+	return match, match != nil
+}
 
-		switch language {
-
-		case French:
-			for _, frenchKeyword := range DetailsKeywords[InstructionDescriptionFrench] {
-				frenchKeyword = strings.ToUpper(frenchKeyword)
-				if !strings.Contains(line, frenchKeyword) {
-					continue
-				} else if strings.Contains(line, "DÉCHARGEMENT") && frenchKeyword == "CHARGEMENT" {
-					continue
-				}
-				return strings.Join([]string{instructionKeyword, frenchKeyword}, " "), language, true
-			}
+// matchInstructionType gives the uppercased type from the header line, again the longest one, so "ENTLADE" is not read as "LADE"
+func matchInstructionType(line string, instruction *instructionDictionary) (string, bool) {
+	longest := ""
+	for _, t := range instruction.Types {
+		t = strings.ToUpper(t)
+		if strings.Contains(line, t) && len(t) > len(longest) {
+			longest = t
+		}
+	}
+	return longest, longest != ""
+}
 
-			if isNextLine {
-				log.Println("PARSER ERR: french: not included in the dictionary")
-				return "", "", false
-			}
-			return "nextline", language, true
-		case German:
-			for _, germanKeyword := range DetailsKeywords[InstructionDescriptionGerman] {
+// identifyInstruction recognises the instruction header inside the text, so it is not taken as a part of a task.
+// pending is the language of the previous line, when the header was split in two ("nextline")
+func identifyInstruction(line string, pending *keywordDictionary) (instructionType string, dictionary *keywordDictionary, found bool) {
+	dictionary, ok := matchInstructionKeyword(line)
+	if !ok {
+		if pending == nil {
+			return "", nil, false
+		}
+		dictionary = pending
+	}
 
-				germanKeyword = strings.ToUpper(germanKeyword)
-				if !strings.Contains(line, germanKeyword) {
-					continue
-				} else if strings.Contains(line, "ENTLADE") && germanKeyword == "LADE" {
-					continue
-				}
-				return strings.Join([]string{germanKeyword, instructionKeyword}, " "), language, true
-			}
-			log.Println("PARSER ERR: german: not included in the dictionary")
-			return "", "", false
-		case English:
-			for _, englishKeyword := range DetailsKeywords[InstructionDescriptionEnglish] {
+	if description, ok := matchInstructionType(line, dictionary.Instruction); ok {
+		return description + " " + strings.ToUpper(dictionary.Instruction.Keyword), dictionary, true
+	}
 
-				englishKeyword = strings.ToUpper(englishKeyword)
-				if !strings.Contains(line, englishKeyword) {
-					continue
-				} else if strings.Contains(line, "UNLOAD") && englishKeyword == "LOAD" {
-					continue
-				}
-				return strings.Join([]string{englishKeyword, instructionKeyword}, " "), language, true
-			}
-			log.Println("PARSER ERR: english: not included in the dictionary")
-			return "", "", false
-		default:
-			continue
-		}
+	if pending != nil {
+		log.Printf("PARSER ERR: %s: not included in the dictionary\n", dictionary.Language)
+		return "", nil, false
 	}
-	return "", "", false
+	return "nextline", dictionary, true
 }
 
 func (s *Shipment) IdentifyDeliveryDetails(docText string) (after string, found bool) {
@@ -379,51 +232,34 @@ func (s *Shipment) IdentifyDeliveryDetails(docText string) (after string, found
 		}
 
 		if len(s.CarId) == 0 {
-			for _, truckKeyword := range DetailsKeywords[Truck] {
-				if a, f := strings.CutPrefix(lineLower, truckKeyword); f {
-					s.CarId = extractUntilMultipleSpaces(strings.TrimSpace(strings.ToUpper(a)))
-					found = true
-					break
-				}
+			if a, f := cutLongestPrefix(lineLower, DetailsKeywords[Truck]); f {
+				s.CarId = extractUntilMultipleSpaces(strings.TrimSpace(strings.ToUpper(a)))
+				found = true
 			}
 		}
 		if len(s.DriverName) == 0 {
-			for _, driverKeyword := range DetailsKeywords[Driver] {
-				if a, f := strings.CutPrefix(lineLower, driverKeyword); f {
-					s.DriverName = extractUntilMultipleSpaces(strings.TrimSpace(strings.ToUpper(a)))
-					found = true
-					break
-				}
+			if a, f := cutLongestPrefix(lineLower, DetailsKeywords[Driver]); f {
+				s.DriverName = extractUntilMultipleSpaces(strings.TrimSpace(strings.ToUpper(a)))
+				found = true
 			}
 		}
 		if len(s.Chassis) == 0 {
-			for _, chassis := range DetailsKeywords[Chassis] {
-				if a, f := strings.CutPrefix(lineLower, chassis); f {
-					s.Chassis = extractUntilMultipleSpaces(strings.TrimSpace(strings.ToUpper(a)))
-					found = true
-					break
-				}
+			if a, f := cutLongestPrefix(lineLower, DetailsKeywords[Chassis]); f {
+				s.Chassis = extractUntilMultipleSpaces(strings.TrimSpace(strings.ToUpper(a)))
+				found = true
 			}
 		}
 		if len(s.Container) == 0 {
-			for _, containerKeyword := range DetailsKeywords[Container] {
-				if a, f := strings.CutPrefix(lineLower, containerKeyword); f {
-					if strings.Contains(lineLower, "status") || strings.Contains(lineLower, "etat du") {
-						continue
-					}
-					s.Container = extractUntilMultipleSpaces(strings.TrimSpace(strings.ToUpper(a)))
-					found = true
-					break
-				}
+			a, f := cutLongestPrefix(lineLower, DetailsKeywords[Container])
+			if f && !strings.Contains(lineLower, "status") && !strings.Contains(lineLower, "etat du") {
+				s.Container = extractUntilMultipleSpaces(strings.TrimSpace(strings.ToUpper(a)))
+				found = true
 			}
 		}
 		if len(s.Tankdetails) == 0 {
-			for _, tankDetailsKeyword := range DetailsKeywords[Tankdetails] {
-				if a, f := strings.CutPrefix(lineLower, tankDetailsKeyword); f {
-					s.Tankdetails = extractUntilMultipleSpaces(strings.TrimSpace(a))
-					found = true
-					break
-				}
+			if a, f := cutLongestPrefix(lineLower, DetailsKeywords[Tankdetails]); f {
+				s.Tankdetails = extractUntilMultipleSpaces(strings.TrimSpace(a))
+				found = true
 			}
 		}
 		if !kgFound && len(s.Tankdetails) > 0 && strings.Contains(strings.ToLower(line), "kg") {
@@ -435,13 +271,10 @@ func (s *Shipment) IdentifyDeliveryDetails(docText string) (after string, found
 			}
 		}
 		if len(s.GeneralRemark) == 0 {
-			for _, generalRemark := range DetailsKeywords[GenerellerHinweis] {
-				if a, f := strings.CutPrefix(lineLower, generalRemark); f {
-					s.GeneralRemark = strings.TrimSpace(a)
-					generalRemarkStartIdx = i
-					found = true
-					break
-				}
+			if a, f := cutLongestPrefix(lineLower, DetailsKeywords[GenerellerHinweis]); f {
+				s.GeneralRemark = strings.TrimSpace(a)
+				generalRemarkStartIdx = i
+				found = true
 			}
 		}
 	}
@@ -454,6 +287,38 @@ func (s *Shipment) IdentifyDeliveryDetails(docText string) (after string, found
 	return after, found
 }
 
+// cutLongestPrefix works like strings.CutPrefix, but with the longest of the keywords the line starts with
+func cutLongestPrefix(line string, keywords []string) (after string, found bool) {
+	longest := ""
+	for _, keyword := range keywords {
+		if strings.HasPrefix(line, keyword) && len(keyword) > len(longest) {
+			longest = keyword
+		}
+	}
+	if longest == "" {
+		return line, false
+	}
+	return line[len(longest):], true
+}
+
+func upperKeywords(keywords []string) []string {
+	upper := make([]string, 0, len(keywords))
+	for _, keyword := range keywords {
+		upper = append(upper, strings.ToUpper(keyword))
+	}
+	return upper
+}
+
+// capitalizedKeywords is for the fields that are only recognised when written like a label ("Remark", not "remark")
+func capitalizedKeywords(keywords []string) []string {
+	capitalized := make([]string, 0, len(keywords))
+	for _, keyword := range keywords {
+		r, size := utf8.DecodeRuneInString(keyword)
+		capitalized = append(capitalized, string(unicode.ToUpper(r))+keyword[size:])
+	}
+	return capitalized
+}
+
 func extractUntilMultipleSpaces(text string) string {
 	re := regexp.MustCompile(`\s{2,}`)
 	loc := re.FindStringIndex(text)
@@ -482,17 +347,13 @@ func identifyTaskTypes(line string) (taskType string, found bool) {
 
 func (t *TaskSection) findAddress() (string, bool) {
 	addressLines := make([]string, 0)
-	for i := 0; i < 3; i++ {
+	for i := 0; i < 3 && i < len(t.Lines); i++ {
 		line := strings.TrimSpace(t.Lines[i])
 
 		if i == 0 {
-			for _, keyword := range TaskKeywords[t.Type] {
-				keywordUpper := strings.ToUpper(keyword)
-
-				if strings.HasPrefix(line, keywordUpper) {
-					line = strings.TrimSpace(line[len(keyword):])
-					break
-				}
+			// "COLLECTE" would leave the "E" in the address if "COLLECT" was cut
+			if a, f := cutLongestPrefix(line, upperKeywords(TaskKeywords[t.Type])); f {
+				line = strings.TrimSpace(a)
 			}
 		}
 		addressLines = append(addressLines, strings.TrimSpace(line))
@@ -524,127 +385,114 @@ func (t *TaskSection) getTaskDetails() bool {
 
 	if len(t.Lines) > 0 {
 		var isProduct, isRemark bool
+		// the remark can go over several lines, they are kept as lines
+		var remark []string
+		site := t.SiteLocation()
+		blocks := hasCompartmentBlocks(t.Lines)
+		var compartment *TaskCompartment
 
 		for _, line := range t.Lines {
 			normLine := line
 			line = strings.ToLower(line)
-			for _, tankStatusKeywords := range DetailsKeywords[TankStatus] {
-				if a, f := strings.CutPrefix(line, tankStatusKeywords); f {
-					t.TankStatus = strings.ToUpper(strings.TrimSpace(a))
-				}
+			// below a compartment of the blocks the product, weight, volume and temperature are of that compartment
+			product, weight, volume, temperature := &t.Product, &t.Weight, &t.Volume, &t.Temperature
+			if compartment != nil {
+				product, weight, volume, temperature = &compartment.Product, &compartment.Weight, &compartment.Volume, &compartment.Temperature
+			}
+			// the dictionaries are merged from every language, so the order of the keywords means nothing
+			// and the longest one the line starts with wins ("volumen" over "volume")
+			if a, f := cutLongestPrefix(line, DetailsKeywords[TankStatus]); f {
+				t.TankStatus = strings.ToUpper(strings.TrimSpace(a))
 			}
 
-			for _, customerRef := range DetailsKeywords[CustomerReference] {
-				if a, f := strings.CutPrefix(line, customerRef); f {
-					t.CustomerReference = strings.ToUpper(strings.TrimSpace(a))
-				}
+			if a, f := cutLongestPrefix(line, DetailsKeywords[CustomerReference]); f {
+				t.CustomerReference = strings.ToUpper(strings.TrimSpace(a))
 			}
 
-			for _, loadDate := range DetailsKeywords[LoadDate] {
-				if a, f := strings.CutPrefix(line, loadDate); f {
-					start, end, err := parseTimeRange(strings.TrimSpace(a))
-					if err != nil {
-						log.Fatalf("ERR: parsing time range for load in doc with shipment id: %v; ERR: %v\n", t.ShipmentId, err)
-						continue
-					}
+			if a, f := cutLongestPrefix(line, DetailsKeywords[LoadDate]); f {
+				start, end, err := parseTimeRange(strings.TrimSpace(a), site)
+				if err != nil {
+					// the load date stays empty, the parse report shows it as missing to the manager
+					log.Printf("err parsing time range for load in doc with shipment id: %v; ERR: %v\n", t.ShipmentId, err)
+				} else {
 					t.LoadStartDate = start
 					t.LoadEndDate = end
 				}
 			}
 
-			for _, unloadDate := range DetailsKeywords[UnloadDate] {
-				if a, f := strings.CutPrefix(line, unloadDate); f {
-					start, end, err := parseTimeRange(strings.TrimSpace(a))
-					if err != nil {
-						log.Printf("err parsing time range for load in doc with shipment id: %v; ERR: %v\n", t.ShipmentId, err)
-						continue
-					}
+			if a, f := cutLongestPrefix(line, DetailsKeywords[UnloadDate]); f {
+				start, end, err := parseTimeRange(strings.TrimSpace(a), site)
+				if err != nil {
+					log.Printf("err parsing time range for unload in doc with shipment id: %v; ERR: %v\n", t.ShipmentId, err)
+				} else {
 					t.UnloadStartDate = start
 					t.UnloadEndDate = end
 				}
 			}
 
-			for _, loadRef := range DetailsKeywords[LoadReference] {
-				if a, f := strings.CutPrefix(line, loadRef); f {
-					t.LoadReference = strings.TrimSpace(strings.ToUpper(a))
-				}
+			if a, f := cutLongestPrefix(line, DetailsKeywords[LoadReference]); f {
+				t.LoadReference = strings.TrimSpace(strings.ToUpper(a))
 			}
 
-			for _, unloadRef := range DetailsKeywords[UnloadReference] {
-				if a, f := strings.CutPrefix(line, unloadRef); f {
-					t.UnloadReference = strings.TrimSpace(strings.ToUpper(a))
-				}
+			if a, f := cutLongestPrefix(line, DetailsKeywords[UnloadReference]); f {
+				t.UnloadReference = strings.TrimSpace(strings.ToUpper(a))
 			}
 
-			for _, product := range DetailsKeywords[Product] {
-				if a, f := strings.CutPrefix(line, product); f {
-					t.Product = strings.TrimSpace(a) + ", "
-					isProduct = true
-					break
-				} else if isProduct && len(t.Product) > 0 {
-					if string(line[0]) != " " {
-						isProduct = false
-						break
-					}
-					t.Product += strings.TrimSpace(line) + ", "
-					break
+			if a, f := cutLongestPrefix(line, DetailsKeywords[Product]); f {
+				*product = strings.TrimSpace(a) + ", "
+				isProduct = true
+			} else if isProduct && len(*product) > 0 {
+				if string(line[0]) != " " {
+					isProduct = false
+				} else {
+					*product += strings.TrimSpace(line) + ", "
 				}
 			}
 
 			if !isProduct {
-				t.Product = strings.ToUpper(strings.TrimSuffix(t.Product, ", "))
+				*product = strings.ToUpper(strings.TrimSuffix(*product, ", "))
 			}
 
-			for _, weight := range DetailsKeywords[Weight] {
-				if a, f := strings.CutPrefix(line, weight); f {
-					t.Weight = strings.TrimSpace(a)
-				}
+			if a, f := cutLongestPrefix(line, DetailsKeywords[Weight]); f {
+				*weight = strings.TrimSpace(a)
 			}
 
-			for _, volume := range DetailsKeywords[Volume] {
-				if a, f := strings.CutPrefix(line, volume); f {
-					t.Volume = strings.TrimSpace(a)
-				}
+			if a, f := cutLongestPrefix(line, DetailsKeywords[Volume]); f {
+				*volume = strings.TrimSpace(a)
 			}
 
-			for _, comp := range DetailsKeywords[Compartment] {
-				if a, f := strings.CutPrefix(line, comp); f {
-					compartment, err := strconv.Atoi(strings.TrimSpace(a))
-					if err != nil {
-						log.Printf("err parsing the compartment number for task %s in %d; ERR: %v\n", t.Type, t.ShipmentId, err)
-						continue
-					}
-					t.Compartment = compartment
+			if a, f := cutLongestPrefix(line, DetailsKeywords[Compartment]); f {
+				number, err := strconv.Atoi(strings.TrimSpace(a))
+				if err != nil {
+					log.Printf("err parsing the compartment number for task %s in %d; ERR: %v\n", t.Type, t.ShipmentId, err)
+				} else if blocks {
+					compartment = &TaskCompartment{Number: number}
+					t.Compartments = append(t.Compartments, compartment)
+				} else {
+					t.Compartment = number
 				}
 			}
 
-			for _, temp := range DetailsKeywords[Temperature] {
-				if a, f := strings.CutPrefix(line, temp); f {
-					t.Temperature = strings.TrimSpace(a)
-				}
+			if a, f := cutLongestPrefix(line, DetailsKeywords[Temperature]); f {
+				*temperature = strings.TrimSpace(a)
 			}
 
-			for _, remark := range DetailsKeywords[Remark] {
-				remark = strings.ToUpper(string(remark[0])) + remark[1:]
-				if a, f := strings.CutPrefix(normLine, remark); f {
-					if len(t.Remark) == 0 {
-						t.Remark = strings.TrimSpace(a) + " -\n"
-						isRemark = true
-					} else {
-						isRemark = false
-					}
-					break
-				} else if isRemark && len(t.Remark) > 0 {
-					if len(normLine) > 0 && normLine[0] != ' ' {
-						isRemark = false
-						break
-					}
-					t.Remark += strings.TrimSpace(normLine) + " -\n"
-					break
+			if a, f := cutLongestPrefix(normLine, capitalizedKeywords(DetailsKeywords[Remark])); f {
+				if remark == nil {
+					remark = []string{strings.TrimSpace(a)}
+					isRemark = true
+				} else {
+					isRemark = false
+				}
+			} else if isRemark {
+				if len(normLine) > 0 && normLine[0] != ' ' {
+					isRemark = false
+				} else if l := strings.TrimSpace(normLine); l != "" {
+					remark = append(remark, l)
 				}
 			}
-
 		}
+		t.Remark = strings.TrimSpace(strings.Join(remark, "\n"))
 	}
 
 	t.TankStatus = esc(t.TankStatus)
@@ -657,10 +505,18 @@ func (t *TaskSection) getTaskDetails() bool {
 	t.Remark = esc(t.Remark)
 	t.Product = esc(t.Product)
 
-	return false
+	t.DeclaredWeight, _ = ParseWeight(t.Weight)
+	t.DeclaredVolume, _ = ParseVolume(t.Volume)
+	t.DeclaredTemperature, _ = ParseTemperature(t.Temperature)
+	t.finishCompartments()
+
+	return t.CustomerReference != "" || t.LoadReference != "" || t.UnloadReference != "" ||
+		!t.LoadStartDate.IsZero() || !t.UnloadStartDate.IsZero() || t.Product != ""
 }
 
-func parseTimeRange(dateStr string) (time.Time, time.Time, error) {
+// parseTimeRange reads "03/11/2025 06:00 - 14:00" as the local time of the site, so the window is an absolute instant
+// no matter where it is shown later
+func parseTimeRange(dateStr string, loc *time.Location) (time.Time, time.Time, error) {
 	// Split on " - " to get start and end
 	parts := strings.Split(dateStr, " - ")
 	if len(parts) != 2 {
@@ -669,13 +525,13 @@ func parseTimeRange(dateStr string) (time.Time, time.Time, error) {
 
 	layout := "02/01/2006 15:04"
 
-	startTime, err := time.Parse(layout, parts[0])
+	startTime, err := time.ParseInLocation(layout, parts[0], loc)
 	if err != nil {
 		return time.Time{}, time.Time{}, err
 	}
 
 	endTimeStr := parts[0][:11] + parts[1] // "03/11/2025 " + "14:00"
-	endTime, err := time.Parse(layout, endTimeStr)
+	endTime, err := time.ParseInLocation(layout, endTimeStr, loc)
 	if err != nil {
 		return time.Time{}, time.Time{}, err
 	}
@@ -1,6 +1,12 @@
 package parser
 
-import "testing"
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
 
 func TestIdentifyShipmentIdForDoc(t *testing.T) {
 	tests := []struct {
@@ -103,3 +109,210 @@ func TestIdentifyShipmentIdForDoc_RealFiles(t *testing.T) {
 		})
 	}
 }
+
+func TestDetectParser(t *testing.T) {
+	tests := []struct {
+		name       string
+		docText    string
+		wantParser string
+		wantErr    error
+	}{
+		{
+			name: "hoyer german layout",
+			docText: "ABSETZ ANWEISUNG\n" +
+				"Shipment:            4333942                                                                    Hoyer GmbH\n" +
+				"Truck                790133 LU454TW\n",
+			wantParser: HoyerParserName,
+		},
+		{
+			name: "hoyer layout without the company name",
+			docText: "UNLOAD INSTRUCTION\n" +
+				"Shipment :\n" +
+				"4541323\n",
+			wantParser: HoyerParserName,
+		},
+		{
+			name:    "hoyer as a customer in a spreadsheet",
+			docText: "Customer\tLoad address\tUnload address\nHoyer GmbH\tLudwigshafen\tHamburg\n",
+			wantErr: ErrNoParser,
+		},
+		{
+			name:    "hoyer mentioned in another document",
+			docText: "INVOICE\nHoyer GmbH\nTotal: 100 EUR\n",
+			wantErr: ErrNoParser,
+		},
+		{
+			name:    "unknown document",
+			docText: "INVOICE\nTotal: 100 EUR\n",
+			wantErr: ErrNoParser,
+		},
+		{
+			name:    "empty document",
+			docText: "",
+			wantErr: ErrNoParser,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := DetectParser(tt.docText)
+			if err != tt.wantErr {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && p.Name() != tt.wantParser {
+				t.Errorf("parser = %s, want %s", p.Name(), tt.wantParser)
+			}
+		})
+	}
+}
+
+func TestNewParseReport(t *testing.T) {
+	header := "LADE ANWEISUNG\n" +
+		"Shipment:            4333942                                                Hoyer GmbH\n" +
+		"Truck                790133 LU454TW\n" +
+		"Container            HOYU1234567\n"
+	task := "LADEN    ACME CHEMICALS\n" +
+		"         HAUPTSTRASSE 1\n" +
+		"         DE-12345 BERLIN\n" +
+		"Ladereferenz       REF1\n" +
+		"Ladedatum          03/11/2025 08:00 - 14:00\n"
+
+	tests := []struct {
+		name        string
+		docText     string
+		wantMissing []MissingField
+		wantUnused  []string
+	}{
+		{
+			name:       "everything required is there",
+			docText:    header + task + "Produkt            ETHANOL\n" + "Gewicht            20000 kg\n" + "Something nobody expected\n",
+			wantUnused: []string{"Something nobody expected"},
+		},
+		{
+			name:        "load without a product",
+			docText:     header + task,
+			wantMissing: []MissingField{{Field: Product, Task: TaskLoad}},
+		},
+		{
+			name:        "load time range that can not be read",
+			docText:     strings.Replace(header+task, "03/11/2025 08:00 - 14:00", "morgen früh", 1) + "Produkt            ETHANOL\n",
+			wantMissing: []MissingField{{Field: LoadDate, Task: TaskLoad}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, r, err := ParseDocTextWithReport(tt.docText)
+			if err != nil {
+				t.Fatalf("ParseDocTextWithReport failed: %v", err)
+			}
+			if r.Parser != HoyerParserName {
+				t.Errorf("parser = %s, want %s", r.Parser, HoyerParserName)
+			}
+			if s.Id != 4333942 {
+				t.Errorf("Id = %d, want 4333942", s.Id)
+			}
+			if !slices.Equal(r.Missing, tt.wantMissing) {
+				t.Errorf("missing = %+v, want %+v", r.Missing, tt.wantMissing)
+			}
+			if !slices.Equal(r.UnusedLines, tt.wantUnused) {
+				t.Errorf("unused = %q, want %q", r.UnusedLines, tt.wantUnused)
+			}
+
+			var truckKeyword string
+			for _, m := range r.Matched {
+				if m.Field == Truck {
+					truckKeyword = m.Keyword
+				}
+			}
+			if truckKeyword != "truck" {
+				t.Errorf("truck matched keyword = %q, want %q", truckKeyword, "truck")
+			}
+		})
+	}
+}
+
+func TestDiffShipments(t *testing.T) {
+	stored := &Shipment{
+		Id:            4333942,
+		ShipmentDocId: 12,
+		Container:     "HOYU 123456-7",
+		Tasks: []*TaskSection{
+			{
+				Id:                 1,
+				Type:               TaskLoad,
+				Address:            "ORLEN STATION, WARSZAWA",
+				OriginalAddress:    "BASF SE, CARL-BOSCH-STRASSE 38, DE-67056 LUDWIGSHAFEN",
+				Product:            "ETHANOL 96%",
+				CurrentWeight:      24100,
+				CurrentKilometrage: 120033,
+			},
+			{Id: 2, Type: TaskDropoff, Address: "HOYER DEPOT DUISBURG"},
+		},
+	}
+	parsed := &Shipment{
+		Id:        4333942,
+		Container: "HOYU 123456-7",
+		Tasks: []*TaskSection{
+			{
+				Type:    TaskLoad,
+				Address: "BASF SE, CARL-BOSCH-STRASSE 38, DE-67056 LUDWIGSHAFEN",
+				Product: "ETHANOL 96%, UN 1170, KLASSE 3",
+			},
+			{Type: TaskCleaning, Address: "TANKREINIGUNG BREMEN"},
+		},
+	}
+
+	result := diffShipments(stored, parsed)
+
+	wantDiffs := []string{"1/product"}
+	gotDiffs := make([]string, 0)
+	for _, d := range result.Diffs {
+		gotDiffs = append(gotDiffs, fmt.Sprintf("%d/%s", d.TaskId, d.Field))
+	}
+	if !slices.Equal(gotDiffs, wantDiffs) {
+		t.Errorf("diffs = %v, want %v", gotDiffs, wantDiffs)
+	}
+	if !slices.Equal(result.NewTasks, []string{TaskCleaning}) {
+		t.Errorf("new tasks = %v, want [%s]", result.NewTasks, TaskCleaning)
+	}
+	if !slices.Equal(result.MissingTasks, []string{TaskDropoff}) {
+		t.Errorf("missing tasks = %v, want [%s]", result.MissingTasks, TaskDropoff)
+	}
+	if !isReparseColumn(false, "product") || isReparseColumn(false, "current_weight") || isReparseColumn(true, "driver_id") {
+		t.Errorf("isReparseColumn lets through columns it should not")
+	}
+}
+
+func TestParseTimeRangeInSiteTimezone(t *testing.T) {
+	tests := []struct {
+		address   string
+		wantStart string // UTC
+	}{
+		{"LEIXOES TERMINAL, AV. DA LIBERDADE 1, PT-4450-001 MATOSINHOS", "2025-11-03T06:00:00Z"},
+		{"GALP, RUA DE SANTA MARIA 5, 4450-001 MATOSINHOS", "2025-11-03T06:00:00Z"},
+		{"SEAL SANDS, MIDDLESBROUGH TS2 1UB, GB", "2025-11-03T06:00:00Z"},
+		{"CHEMICAL TERMINAL, DOCK ROAD, GB-E16 2EW LONDON", "2025-11-03T06:00:00Z"},
+		{"SEAL SANDS, MIDDLESBROUGH TS2 1UB, UNITED KINGDOM", "2025-11-03T06:00:00Z"},
+		{"HULL TERMINAL, QUEEN ELIZABETH DOCK, HULL, UK", "2025-11-03T06:00:00Z"},
+		{"RINGASKIDDY PORT, CORK, IRELAND", "2025-11-03T06:00:00Z"},
+		{"BASF SE, CARL-BOSCH-STRASSE 38, DE-67056 LUDWIGSHAFEN", "2025-11-03T05:00:00Z"},
+		{"SOMEWHERE WITHOUT A COUNTRY", "2025-11-03T05:00:00Z"},
+	}
+
+	for _, tt := range tests {
+		task := &TaskSection{Address: tt.address}
+		task.AddressParts, _ = ParseAddress(tt.address)
+
+		start, end, err := parseTimeRange("03/11/2025 06:00 - 14:00", task.SiteLocation())
+		if err != nil {
+			t.Fatalf("parseTimeRange for %q: %v", tt.address, err)
+		}
+		if got := start.UTC().Format(time.RFC3339); got != tt.wantStart {
+			t.Errorf("%q: start = %s, want %s", tt.address, got, tt.wantStart)
+		}
+		if end.Sub(start) != 8*time.Hour {
+			t.Errorf("%q: window is %v long, want 8h", tt.address, end.Sub(start))
+		}
+	}
+}
@@ -0,0 +1,670 @@
+package parser
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+// this is not a full pdf reader, it only knows enough of the format to get the text out of the transport orders:
+// objects are found by scanning the file, so broken xref tables (which happen a lot with the generated docs) do not matter
+
+type (
+	pdfName    string
+	pdfKeyword string
+	pdfString  []byte
+	pdfArray   []any
+	pdfDict    map[pdfName]any
+)
+
+type pdfRef struct {
+	num int
+	gen int
+}
+
+type pdfStream struct {
+	dict pdfDict
+	raw  []byte
+}
+
+var (
+	errPdfEOF       = errors.New("unexpected end of pdf data")
+	errPdfEncrypted = errors.New("pdf is encrypted")
+
+	pdfObjHeader = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+)
+
+func isPdfWhitespace(c byte) bool {
+	switch c {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+	return false
+}
+
+func isPdfDelimiter(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+type pdfLexer struct {
+	data []byte
+	pos  int
+	// refs turns "1 0 R" into pdfRef, content streams do not have them
+	refs bool
+}
+
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if isPdfWhitespace(c) {
+			l.pos++
+			continue
+		}
+		if c == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+			continue
+		}
+		return
+	}
+}
+
+func (l *pdfLexer) readRegular() string {
+	start := l.pos
+	for l.pos < len(l.data) && !isPdfWhitespace(l.data[l.pos]) && !isPdfDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	return string(l.data[start:l.pos])
+}
+
+func (l *pdfLexer) readObject() (any, error) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, errPdfEOF
+	}
+
+	switch c := l.data[l.pos]; c {
+	case '/':
+		l.pos++
+		return pdfName(decodePdfName(l.readRegular())), nil
+	case '(':
+		return l.readLiteralString()
+	case '<':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+			l.pos += 2
+			return l.readDict()
+		}
+		return l.readHexString()
+	case '[':
+		l.pos++
+		return l.readArray()
+	case ']', '>', ')', '{', '}':
+		l.pos++
+		return pdfKeyword(string(c)), nil
+	}
+
+	tok := l.readRegular()
+	if tok == "" {
+		l.pos++
+		return pdfKeyword(""), nil
+	}
+
+	if n, err := strconv.ParseFloat(tok, 64); err == nil {
+		if l.refs && isPdfInt(tok) {
+			save := l.pos
+			l.skipSpace()
+			if gen := l.readRegular(); isPdfInt(gen) {
+				l.skipSpace()
+				if l.readRegular() == "R" {
+					g, _ := strconv.Atoi(gen)
+					return pdfRef{num: int(n), gen: g}, nil
+				}
+			}
+			l.pos = save
+		}
+		return n, nil
+	}
+
+	switch tok {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	return pdfKeyword(tok), nil
+}
+
+func isPdfInt(tok string) bool {
+	if tok == "" {
+		return false
+	}
+	for i := 0; i < len(tok); i++ {
+		if tok[i] < '0' || tok[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func decodePdfName(name string) string {
+	if !bytes.ContainsRune([]byte(name), '#') {
+		return name
+	}
+	var out []byte
+	for i := 0; i < len(name); i++ {
+		if name[i] == '#' && i+2 < len(name) {
+			if b, err := hex.DecodeString(name[i+1 : i+3]); err == nil {
+				out = append(out, b[0])
+				i += 2
+				continue
+			}
+		}
+		out = append(out, name[i])
+	}
+	return string(out)
+}
+
+func (l *pdfLexer) readDict() (pdfDict, error) {
+	dict := make(pdfDict)
+	for {
+		l.skipSpace()
+		if l.pos >= len(l.data) {
+			return dict, errPdfEOF
+		}
+		if bytes.HasPrefix(l.data[l.pos:], []byte(">>")) {
+			l.pos += 2
+			return dict, nil
+		}
+
+		key, err := l.readObject()
+		if err != nil {
+			return dict, err
+		}
+		name, ok := key.(pdfName)
+		if !ok {
+			continue
+		}
+		value, err := l.readObject()
+		if err != nil {
+			return dict, err
+		}
+		dict[name] = value
+	}
+}
+
+func (l *pdfLexer) readArray() (pdfArray, error) {
+	arr := make(pdfArray, 0)
+	for {
+		l.skipSpace()
+		if l.pos >= len(l.data) {
+			return arr, errPdfEOF
+		}
+		if l.data[l.pos] == ']' {
+			l.pos++
+			return arr, nil
+		}
+
+		obj, err := l.readObject()
+		if err != nil {
+			return arr, err
+		}
+		arr = append(arr, obj)
+	}
+}
+
+func (l *pdfLexer) readLiteralString() (pdfString, error) {
+	l.pos++
+	out := make([]byte, 0)
+	depth := 1
+
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+
+		switch c {
+		case '(':
+			depth++
+			out = append(out, c)
+		case ')':
+			depth--
+			if depth == 0 {
+				return out, nil
+			}
+			out = append(out, c)
+		case '\\':
+			if l.pos >= len(l.data) {
+				return out, errPdfEOF
+			}
+			e := l.data[l.pos]
+			l.pos++
+
+			switch e {
+			case 'n':
+				out = append(out, '\n')
+			case 'r':
+				out = append(out, '\r')
+			case 't':
+				out = append(out, '\t')
+			case 'b':
+				out = append(out, '\b')
+			case 'f':
+				out = append(out, '\f')
+			case '\r':
+				// backslash at the end of the line just continues the string
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+			case '\n':
+			case '0', '1', '2', '3', '4', '5', '6', '7':
+				n := int(e - '0')
+				for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+					n = n*8 + int(l.data[l.pos]-'0')
+					l.pos++
+				}
+				out = append(out, byte(n))
+			default:
+				out = append(out, e)
+			}
+		default:
+			out = append(out, c)
+		}
+	}
+
+	return out, errPdfEOF
+}
+
+func (l *pdfLexer) readHexString() (pdfString, error) {
+	l.pos++
+	digits := make([]byte, 0)
+	for l.pos < len(l.data) && l.data[l.pos] != '>' {
+		if c := l.data[l.pos]; !isPdfWhitespace(c) {
+			digits = append(digits, c)
+		}
+		l.pos++
+	}
+	if l.pos >= len(l.data) {
+		return nil, errPdfEOF
+	}
+	l.pos++
+
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, len(digits)/2)
+	if _, err := hex.Decode(out, digits); err != nil {
+		return nil, fmt.Errorf("ERR: bad hex string in pdf: %v", err)
+	}
+	return out, nil
+}
+
+type pdfDocument struct {
+	objects  map[int]any
+	trailers []pdfDict
+}
+
+// openPdf reads every "n g obj" it can find, later definitions win like with the incremental updates
+func openPdf(data []byte) (*pdfDocument, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, "\x00\t\n\f\r "), []byte("%PDF")) {
+		return nil, fmt.Errorf("ERR: not a pdf file")
+	}
+
+	doc := &pdfDocument{objects: make(map[int]any)}
+
+	skipUntil := 0
+	for _, m := range pdfObjHeader.FindAllSubmatchIndex(data, -1) {
+		// "12 0 obj" can also show up inside of binary streams
+		if m[0] < skipUntil {
+			continue
+		}
+		num, err := strconv.Atoi(string(data[m[2]:m[3]]))
+		if err != nil {
+			continue
+		}
+
+		l := &pdfLexer{data: data, pos: m[1], refs: true}
+		obj, err := l.readObject()
+		if err != nil && !errors.Is(err, errPdfEOF) {
+			continue
+		}
+		if dict, ok := obj.(pdfDict); ok {
+			if stream, end, ok := readPdfStream(data, l.pos, dict); ok {
+				obj = stream
+				l.pos = end
+			}
+		}
+
+		doc.objects[num] = obj
+		skipUntil = l.pos
+	}
+
+	for idx := 0; ; {
+		i := bytes.Index(data[idx:], []byte("trailer"))
+		if i < 0 {
+			break
+		}
+		l := &pdfLexer{data: data, pos: idx + i + len("trailer"), refs: true}
+		if obj, err := l.readObject(); err == nil {
+			if dict, ok := obj.(pdfDict); ok {
+				doc.trailers = append(doc.trailers, dict)
+			}
+		}
+		idx += i + len("trailer")
+	}
+
+	for _, obj := range doc.objects {
+		stream, ok := obj.(*pdfStream)
+		if !ok {
+			continue
+		}
+		switch doc.name(stream.dict["Type"]) {
+		case "XRef":
+			doc.trailers = append(doc.trailers, stream.dict)
+		case "ObjStm":
+			doc.loadObjectStream(stream)
+		}
+	}
+
+	for _, trailer := range doc.trailers {
+		if _, ok := trailer["Encrypt"]; ok {
+			return nil, errPdfEncrypted
+		}
+	}
+
+	return doc, nil
+}
+
+func readPdfStream(data []byte, pos int, dict pdfDict) (*pdfStream, int, bool) {
+	l := &pdfLexer{data: data, pos: pos}
+	l.skipSpace()
+	if !bytes.HasPrefix(data[l.pos:], []byte("stream")) {
+		return nil, 0, false
+	}
+
+	start := l.pos + len("stream")
+	if start < len(data) && data[start] == '\r' {
+		start++
+	}
+	if start < len(data) && data[start] == '\n' {
+		start++
+	}
+
+	// /Length is often a reference to an object that comes later, so it is only trusted when endstream is right behind it
+	if length, ok := dict["Length"].(float64); ok && length >= 0 && start+int(length) <= len(data) {
+		end := start + int(length)
+		after := &pdfLexer{data: data, pos: end}
+		after.skipSpace()
+		if bytes.HasPrefix(data[after.pos:], []byte("endstream")) {
+			return &pdfStream{dict: dict, raw: data[start:end]}, after.pos + len("endstream"), true
+		}
+	}
+
+	i := bytes.Index(data[start:], []byte("endstream"))
+	if i < 0 {
+		return &pdfStream{dict: dict, raw: data[start:]}, len(data), true
+	}
+	raw := data[start : start+i]
+	raw = bytes.TrimSuffix(raw, []byte("\n"))
+	raw = bytes.TrimSuffix(raw, []byte("\r"))
+
+	return &pdfStream{dict: dict, raw: raw}, start + i + len("endstream"), true
+}
+
+func (d *pdfDocument) loadObjectStream(stream *pdfStream) {
+	data, err := d.streamData(stream)
+	if err != nil {
+		return
+	}
+	n, _ := d.number(stream.dict["N"])
+	first, _ := d.number(stream.dict["First"])
+	// /First and the offsets come straight from the file, a broken or hostile one must not move the lexer out of the data
+	if first < 0 || first >= float64(len(data)) {
+		return
+	}
+
+	header := &pdfLexer{data: data}
+	for i := 0; i < int(n); i++ {
+		numObj, err := header.readObject()
+		if err != nil {
+			return
+		}
+		offObj, err := header.readObject()
+		if err != nil {
+			return
+		}
+		num, ok1 := numObj.(float64)
+		off, ok2 := offObj.(float64)
+		if !ok1 || !ok2 || off < 0 || first+off >= float64(len(data)) {
+			continue
+		}
+		if _, exists := d.objects[int(num)]; exists {
+			continue
+		}
+
+		l := &pdfLexer{data: data, pos: int(first + off), refs: true}
+		if obj, err := l.readObject(); err == nil {
+			d.objects[int(num)] = obj
+		}
+	}
+}
+
+func (d *pdfDocument) resolve(v any) any {
+	for range 16 {
+		ref, ok := v.(pdfRef)
+		if !ok {
+			return v
+		}
+		v = d.objects[ref.num]
+	}
+	return nil
+}
+
+func (d *pdfDocument) dict(v any) pdfDict {
+	switch t := d.resolve(v).(type) {
+	case pdfDict:
+		return t
+	case *pdfStream:
+		return t.dict
+	}
+	return nil
+}
+
+func (d *pdfDocument) array(v any) pdfArray {
+	if arr, ok := d.resolve(v).(pdfArray); ok {
+		return arr
+	}
+	return nil
+}
+
+func (d *pdfDocument) number(v any) (float64, bool) {
+	n, ok := d.resolve(v).(float64)
+	return n, ok
+}
+
+func (d *pdfDocument) name(v any) pdfName {
+	n, _ := d.resolve(v).(pdfName)
+	return n
+}
+
+func (d *pdfDocument) catalog() pdfDict {
+	for i := len(d.trailers) - 1; i >= 0; i-- {
+		if root := d.dict(d.trailers[i]["Root"]); root != nil {
+			return root
+		}
+	}
+	for _, obj := range d.objects {
+		if dict, ok := obj.(pdfDict); ok && d.name(dict["Type"]) == "Catalog" {
+			return dict
+		}
+	}
+	return nil
+}
+
+type pdfPage struct {
+	dict      pdfDict
+	resources pdfDict
+}
+
+func (d *pdfDocument) pages() []pdfPage {
+	catalog := d.catalog()
+	if catalog == nil {
+		return nil
+	}
+
+	pages := make([]pdfPage, 0)
+	seen := make(map[int]bool)
+
+	var walk func(node any, resources pdfDict, depth int)
+	walk = func(node any, resources pdfDict, depth int) {
+		if ref, ok := node.(pdfRef); ok {
+			if seen[ref.num] {
+				return
+			}
+			seen[ref.num] = true
+		}
+		dict := d.dict(node)
+		if dict == nil || depth > 64 {
+			return
+		}
+		if res := d.dict(dict["Resources"]); res != nil {
+			resources = res
+		}
+
+		if kids := d.array(dict["Kids"]); kids != nil || d.name(dict["Type"]) == "Pages" {
+			for _, kid := range kids {
+				walk(kid, resources, depth+1)
+			}
+			return
+		}
+		pages = append(pages, pdfPage{dict: dict, resources: resources})
+	}
+	walk(catalog["Pages"], nil, 0)
+
+	return pages
+}
+
+// pageContent glues all content streams of the page together, the operators may be split between them
+func (d *pdfDocument) pageContent(p pdfPage) []byte {
+	var content []byte
+
+	contents := d.resolve(p.dict["Contents"])
+	streams := make([]any, 0)
+	switch c := contents.(type) {
+	case *pdfStream:
+		streams = append(streams, c)
+	case pdfArray:
+		streams = append(streams, c...)
+	}
+
+	for _, s := range streams {
+		stream, ok := d.resolve(s).(*pdfStream)
+		if !ok {
+			continue
+		}
+		data, err := d.streamData(stream)
+		if err != nil {
+			continue
+		}
+		content = append(content, data...)
+		content = append(content, '\n')
+	}
+
+	return content
+}
+
+func (d *pdfDocument) streamData(s *pdfStream) ([]byte, error) {
+	filters := make([]pdfName, 0)
+	switch f := d.resolve(s.dict["Filter"]).(type) {
+	case pdfName:
+		filters = append(filters, f)
+	case pdfArray:
+		for _, name := range f {
+			filters = append(filters, d.name(name))
+		}
+	}
+
+	data := s.raw
+	var err error
+	for _, filter := range filters {
+		switch filter {
+		case "FlateDecode", "Fl":
+			data, err = inflatePdf(data)
+		case "ASCIIHexDecode", "AHx":
+			data, err = decodePdfASCIIHex(data)
+		case "ASCII85Decode", "A85":
+			data, err = decodePdfASCII85(data)
+		default:
+			return nil, fmt.Errorf("ERR: unsupported pdf stream filter %s", filter)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return data, nil
+}
+
+func inflatePdf(data []byte) ([]byte, error) {
+	var r io.Reader
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		r = flate.NewReader(bytes.NewReader(data))
+	} else {
+		r = zr
+	}
+
+	out, err := io.ReadAll(r)
+	// a lot of generators cut the checksum or the end of the stream, what was inflated is still fine
+	if err != nil && len(out) == 0 {
+		return nil, fmt.Errorf("ERR: inflating pdf stream: %v", err)
+	}
+	return out, nil
+}
+
+func decodePdfASCIIHex(data []byte) ([]byte, error) {
+	digits := make([]byte, 0, len(data))
+	for _, c := range data {
+		if c == '>' {
+			break
+		}
+		if !isPdfWhitespace(c) {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+
+	out := make([]byte, len(digits)/2)
+	if _, err := hex.Decode(out, digits); err != nil {
+		return nil, fmt.Errorf("ERR: decoding ascii hex pdf stream: %v", err)
+	}
+	return out, nil
+}
+
+func decodePdfASCII85(data []byte) ([]byte, error) {
+	data = bytes.TrimPrefix(bytes.TrimSpace(data), []byte("<~"))
+	if i := bytes.Index(data, []byte("~>")); i >= 0 {
+		data = data[:i]
+	}
+
+	out := make([]byte, 4*len(data)+4)
+	n, _, err := ascii85.Decode(out, data, true)
+	if err != nil {
+		return nil, fmt.Errorf("ERR: decoding ascii85 pdf stream: %v", err)
+	}
+	return out[:n], nil
+}
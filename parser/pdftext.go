@@ -0,0 +1,781 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// ErrNoTextLayer means the pdf has pages but nothing that can be read as text, usually a scan or a photo of the order
+var ErrNoTextLayer = errors.New("the document has no text layer, it is probably a scan or a picture")
+
+// errPdfNoUnicode is returned when there is text, but the fonts do not say which letters their glyphs are
+var errPdfNoUnicode = errors.New("pdf fonts have no unicode mapping")
+
+type pdfCodespace struct {
+	lo, hi []byte
+}
+
+type pdfFont struct {
+	codeLen    int
+	codespaces []pdfCodespace
+	toUnicode  map[uint32]string
+	encoding   *[256]rune
+	// widths are in glyph space, 1000 is the size of the font
+	widths       map[uint32]float64
+	defaultWidth float64
+}
+
+type pdfGlyph struct {
+	text    string
+	width   float64
+	space   bool
+	unknown bool
+}
+
+var defaultPdfFont = &pdfFont{codeLen: 1, encoding: &winAnsiEncoding, defaultWidth: 500}
+
+func (f *pdfFont) nextCode(s []byte) (uint32, int) {
+	for _, cs := range f.codespaces {
+		n := len(cs.lo)
+		if n == 0 || n > len(s) {
+			continue
+		}
+		fits := true
+		for i := 0; i < n; i++ {
+			if s[i] < cs.lo[i] || s[i] > cs.hi[i] {
+				fits = false
+				break
+			}
+		}
+		if fits {
+			return bytesToCode(s[:n]), n
+		}
+	}
+
+	n := min(f.codeLen, len(s))
+	return bytesToCode(s[:n]), n
+}
+
+func bytesToCode(b []byte) uint32 {
+	var code uint32
+	for _, c := range b {
+		code = code<<8 | uint32(c)
+	}
+	return code
+}
+
+func (f *pdfFont) decode(s []byte) []pdfGlyph {
+	glyphs := make([]pdfGlyph, 0, len(s))
+	for len(s) > 0 {
+		code, n := f.nextCode(s)
+		s = s[n:]
+
+		g := pdfGlyph{width: f.defaultWidth / 1000, space: n == 1 && code == 32}
+		if w, ok := f.widths[code]; ok {
+			g.width = w / 1000
+		}
+
+		if text, ok := f.toUnicode[code]; ok {
+			g.text = text
+		} else if n == 1 && f.encoding != nil && f.encoding[code] != 0 {
+			g.text = string(f.encoding[code])
+		} else {
+			g.unknown = true
+		}
+		glyphs = append(glyphs, g)
+	}
+	return glyphs
+}
+
+func (d *pdfDocument) loadFont(v any) *pdfFont {
+	fd := d.dict(v)
+	if fd == nil {
+		return defaultPdfFont
+	}
+
+	font := &pdfFont{codeLen: 1, widths: make(map[uint32]float64)}
+
+	if d.name(fd["Subtype"]) == "Type0" {
+		font.codeLen = 2
+		font.defaultWidth = 1000
+
+		if descendants := d.array(fd["DescendantFonts"]); len(descendants) > 0 {
+			desc := d.dict(descendants[0])
+			if dw, ok := d.number(desc["DW"]); ok {
+				font.defaultWidth = dw
+			}
+			d.loadCIDWidths(font, d.array(desc["W"]))
+		}
+	} else {
+		font.encoding = d.loadSimpleEncoding(fd["Encoding"])
+
+		first, _ := d.number(fd["FirstChar"])
+		for i, w := range d.array(fd["Widths"]) {
+			if width, ok := d.number(w); ok {
+				font.widths[uint32(int(first)+i)] = width
+			}
+		}
+
+		if missing, ok := d.number(d.dict(fd["FontDescriptor"])["MissingWidth"]); ok && missing > 0 {
+			font.defaultWidth = missing
+		} else if strings.Contains(string(d.name(fd["BaseFont"])), "Courier") {
+			font.defaultWidth = 600
+		} else {
+			font.defaultWidth = 500
+		}
+	}
+
+	if stream, ok := d.resolve(fd["ToUnicode"]).(*pdfStream); ok {
+		if data, err := d.streamData(stream); err == nil {
+			font.toUnicode, font.codespaces = parseToUnicodeCMap(data)
+		}
+	}
+
+	return font
+}
+
+// loadCIDWidths reads the W array of composite fonts: "c [w1 w2 ...]" or "cFirst cLast w"
+func (d *pdfDocument) loadCIDWidths(font *pdfFont, w pdfArray) {
+	for i := 0; i < len(w); {
+		first, ok := d.number(w[i])
+		if !ok || i+1 >= len(w) {
+			return
+		}
+
+		if arr, ok := d.resolve(w[i+1]).(pdfArray); ok {
+			for j, width := range arr {
+				if n, ok := d.number(width); ok {
+					font.widths[uint32(int(first)+j)] = n
+				}
+			}
+			i += 2
+			continue
+		}
+
+		if i+2 >= len(w) {
+			return
+		}
+		last, ok1 := d.number(w[i+1])
+		width, ok2 := d.number(w[i+2])
+		if ok1 && ok2 && last-first < 65536 {
+			for c := int(first); c <= int(last); c++ {
+				font.widths[uint32(c)] = width
+			}
+		}
+		i += 3
+	}
+}
+
+func (d *pdfDocument) loadSimpleEncoding(v any) *[256]rune {
+	enc := winAnsiEncoding
+
+	dict := d.dict(v)
+	if dict == nil {
+		return &enc
+	}
+
+	code := 0
+	for _, item := range d.array(dict["Differences"]) {
+		switch t := d.resolve(item).(type) {
+		case float64:
+			code = int(t)
+		case pdfName:
+			if code >= 0 && code < 256 {
+				enc[code] = glyphNameToRune(string(t))
+			}
+			code++
+		}
+	}
+
+	return &enc
+}
+
+func glyphNameToRune(name string) rune {
+	if r, ok := pdfGlyphNames[name]; ok {
+		return r
+	}
+	if len(name) == 1 {
+		return rune(name[0])
+	}
+	for _, prefix := range []string{"uni", "u"} {
+		if hexCode, ok := strings.CutPrefix(name, prefix); ok && len(hexCode) >= 4 && len(hexCode) <= 6 {
+			if n, err := strconv.ParseUint(hexCode[:4], 16, 32); err == nil {
+				return rune(n)
+			}
+		}
+	}
+	return 0
+}
+
+func parseToUnicodeCMap(data []byte) (map[uint32]string, []pdfCodespace) {
+	toUnicode := make(map[uint32]string)
+	codespaces := make([]pdfCodespace, 0)
+
+	l := &pdfLexer{data: data}
+	operands := make([]any, 0)
+	for {
+		obj, err := l.readObject()
+		if err != nil {
+			break
+		}
+		kw, ok := obj.(pdfKeyword)
+		if !ok {
+			operands = append(operands, obj)
+			continue
+		}
+
+		switch kw {
+		case "endcodespacerange":
+			for i := 0; i+1 < len(operands); i += 2 {
+				lo, ok1 := operands[i].(pdfString)
+				hi, ok2 := operands[i+1].(pdfString)
+				if ok1 && ok2 && len(lo) == len(hi) {
+					codespaces = append(codespaces, pdfCodespace{lo: lo, hi: hi})
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok := operands[i].(pdfString)
+				if !ok {
+					continue
+				}
+				if dst, ok := operands[i+1].(pdfString); ok {
+					toUnicode[bytesToCode(src)] = decodeUTF16BE(dst)
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].(pdfString)
+				hi, ok2 := operands[i+1].(pdfString)
+				if !ok1 || !ok2 {
+					continue
+				}
+				first, last := bytesToCode(lo), bytesToCode(hi)
+				if last < first || last-first > 65535 {
+					continue
+				}
+
+				switch dst := operands[i+2].(type) {
+				case pdfString:
+					base := []rune(decodeUTF16BE(dst))
+					if len(base) == 0 {
+						continue
+					}
+					for c := first; c <= last; c++ {
+						r := append([]rune{}, base...)
+						r[len(r)-1] += rune(c - first)
+						toUnicode[c] = string(r)
+					}
+				case pdfArray:
+					for j, item := range dst {
+						if s, ok := item.(pdfString); ok && first+uint32(j) <= last {
+							toUnicode[first+uint32(j)] = decodeUTF16BE(s)
+						}
+					}
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+
+	return toUnicode, codespaces
+}
+
+func decodeUTF16BE(b []byte) string {
+	if len(b)%2 == 1 {
+		return string(b)
+	}
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+	}
+	return string(utf16.Decode(units))
+}
+
+type pdfMatrix [6]float64
+
+var identityPdfMatrix = pdfMatrix{1, 0, 0, 1, 0, 0}
+
+func translatePdfMatrix(tx, ty float64) pdfMatrix {
+	return pdfMatrix{1, 0, 0, 1, tx, ty}
+}
+
+// mul is m × n in the pdf (row vector) convention
+func (m pdfMatrix) mul(n pdfMatrix) pdfMatrix {
+	return pdfMatrix{
+		m[0]*n[0] + m[1]*n[2],
+		m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2],
+		m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4],
+		m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+type pdfTextState struct {
+	font      *pdfFont
+	fontSize  float64
+	charSpace float64
+	wordSpace float64
+	scale     float64
+	leading   float64
+	rise      float64
+}
+
+type pdfGraphicsState struct {
+	ctm  pdfMatrix
+	text pdfTextState
+}
+
+// pdfPlacedGlyph is a glyph on the page in user space, y goes up
+type pdfPlacedGlyph struct {
+	x, y, width, height float64
+	text                string
+}
+
+type pdfContentReader struct {
+	doc     *pdfDocument
+	fonts   map[int]*pdfFont
+	glyphs  []pdfPlacedGlyph
+	known   int
+	unknown int
+}
+
+func newPdfContentReader(doc *pdfDocument) *pdfContentReader {
+	return &pdfContentReader{doc: doc, fonts: make(map[int]*pdfFont)}
+}
+
+func (r *pdfContentReader) font(resources pdfDict, name pdfName) *pdfFont {
+	v := r.doc.dict(resources["Font"])[name]
+	ref, isRef := v.(pdfRef)
+	if isRef {
+		if f, ok := r.fonts[ref.num]; ok {
+			return f
+		}
+	}
+
+	f := r.doc.loadFont(v)
+	if isRef {
+		r.fonts[ref.num] = f
+	}
+	return f
+}
+
+func pdfNumbers(operands []any, n int) ([]float64, bool) {
+	if len(operands) < n {
+		return nil, false
+	}
+	nums := make([]float64, n)
+	for i, op := range operands[len(operands)-n:] {
+		f, ok := op.(float64)
+		if !ok {
+			return nil, false
+		}
+		nums[i] = f
+	}
+	return nums, true
+}
+
+func (r *pdfContentReader) run(content []byte, resources pdfDict, ctm pdfMatrix, depth int) {
+	l := &pdfLexer{data: content}
+	gs := pdfGraphicsState{ctm: ctm, text: pdfTextState{scale: 1}}
+	stack := make([]pdfGraphicsState, 0)
+	tm, tlm := identityPdfMatrix, identityPdfMatrix
+	operands := make([]any, 0)
+
+	nextLine := func() {
+		tlm = translatePdfMatrix(0, -gs.text.leading).mul(tlm)
+		tm = tlm
+	}
+
+	for {
+		obj, err := l.readObject()
+		if err != nil {
+			return
+		}
+		op, ok := obj.(pdfKeyword)
+		if !ok {
+			operands = append(operands, obj)
+			continue
+		}
+
+		switch op {
+		case "q":
+			stack = append(stack, gs)
+		case "Q":
+			if len(stack) > 0 {
+				gs = stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+			}
+		case "cm":
+			if m, ok := pdfNumbers(operands, 6); ok {
+				gs.ctm = pdfMatrix(m).mul(gs.ctm)
+			}
+		case "BT":
+			tm, tlm = identityPdfMatrix, identityPdfMatrix
+		case "Tf":
+			if len(operands) >= 2 {
+				name, _ := operands[len(operands)-2].(pdfName)
+				gs.text.font = r.font(resources, name)
+				gs.text.fontSize, _ = operands[len(operands)-1].(float64)
+			}
+		case "Tc":
+			if n, ok := pdfNumbers(operands, 1); ok {
+				gs.text.charSpace = n[0]
+			}
+		case "Tw":
+			if n, ok := pdfNumbers(operands, 1); ok {
+				gs.text.wordSpace = n[0]
+			}
+		case "Tz":
+			if n, ok := pdfNumbers(operands, 1); ok {
+				gs.text.scale = n[0] / 100
+			}
+		case "TL":
+			if n, ok := pdfNumbers(operands, 1); ok {
+				gs.text.leading = n[0]
+			}
+		case "Ts":
+			if n, ok := pdfNumbers(operands, 1); ok {
+				gs.text.rise = n[0]
+			}
+		case "Td", "TD":
+			if n, ok := pdfNumbers(operands, 2); ok {
+				if op == "TD" {
+					gs.text.leading = -n[1]
+				}
+				tlm = translatePdfMatrix(n[0], n[1]).mul(tlm)
+				tm = tlm
+			}
+		case "Tm":
+			if m, ok := pdfNumbers(operands, 6); ok {
+				tlm = pdfMatrix(m)
+				tm = tlm
+			}
+		case "T*":
+			nextLine()
+		case "Tj", "'", "\"":
+			if op == "\"" {
+				if n, ok := pdfNumbers(operands[:max(len(operands)-1, 0)], 2); ok {
+					gs.text.wordSpace, gs.text.charSpace = n[0], n[1]
+				}
+			}
+			if op != "Tj" {
+				nextLine()
+			}
+			if len(operands) > 0 {
+				if s, ok := operands[len(operands)-1].(pdfString); ok {
+					r.show(&gs, &tm, s)
+				}
+			}
+		case "TJ":
+			if len(operands) == 0 {
+				break
+			}
+			arr, _ := operands[len(operands)-1].(pdfArray)
+			for _, item := range arr {
+				switch t := item.(type) {
+				case pdfString:
+					r.show(&gs, &tm, t)
+				case float64:
+					tm = translatePdfMatrix(-t/1000*gs.text.fontSize*gs.text.scale, 0).mul(tm)
+				}
+			}
+		case "Do":
+			if len(operands) > 0 && depth < 10 {
+				name, _ := operands[len(operands)-1].(pdfName)
+				r.runForm(r.doc.dict(resources["XObject"])[name], resources, gs.ctm, depth)
+			}
+		case "BI":
+			l.skipInlineImage()
+		}
+		operands = operands[:0]
+	}
+}
+
+func (r *pdfContentReader) runForm(v any, resources pdfDict, ctm pdfMatrix, depth int) {
+	form, ok := r.doc.resolve(v).(*pdfStream)
+	if !ok || r.doc.name(form.dict["Subtype"]) != "Form" {
+		return
+	}
+	data, err := r.doc.streamData(form)
+	if err != nil {
+		return
+	}
+
+	m := identityPdfMatrix
+	if arr := r.doc.array(form.dict["Matrix"]); len(arr) == 6 {
+		if nums, ok := pdfNumbers(arr, 6); ok {
+			m = pdfMatrix(nums)
+		}
+	}
+	if res := r.doc.dict(form.dict["Resources"]); res != nil {
+		resources = res
+	}
+
+	r.run(data, resources, m.mul(ctm), depth+1)
+}
+
+func (r *pdfContentReader) show(gs *pdfGraphicsState, tm *pdfMatrix, s pdfString) {
+	font := gs.text.font
+	if font == nil {
+		font = defaultPdfFont
+	}
+	ts := gs.text
+
+	for _, g := range font.decode(s) {
+		size := pdfMatrix{ts.fontSize * ts.scale, 0, 0, ts.fontSize, 0, ts.rise}
+		start := size.mul(*tm).mul(gs.ctm)
+
+		tx := g.width*ts.fontSize + ts.charSpace
+		if g.space {
+			tx += ts.wordSpace
+		}
+		*tm = translatePdfMatrix(tx*ts.scale, 0).mul(*tm)
+		end := size.mul(*tm).mul(gs.ctm)
+
+		if g.unknown {
+			r.unknown++
+			continue
+		}
+		r.known++
+
+		r.glyphs = append(r.glyphs, pdfPlacedGlyph{
+			x:      start[4],
+			y:      start[5],
+			width:  end[4] - start[4],
+			height: math.Hypot(start[2], start[3]),
+			text:   g.text,
+		})
+	}
+}
+
+// skipInlineImage jumps over the binary data between ID and EI, the lexer would choke on it otherwise
+func (l *pdfLexer) skipInlineImage() {
+	for {
+		obj, err := l.readObject()
+		if err != nil {
+			return
+		}
+		if kw, ok := obj.(pdfKeyword); ok && kw == "ID" {
+			break
+		}
+	}
+	l.pos++
+
+	for l.pos+1 < len(l.data) {
+		if l.data[l.pos] == 'E' && l.data[l.pos+1] == 'I' &&
+			(l.pos == 0 || isPdfWhitespace(l.data[l.pos-1])) &&
+			(l.pos+2 >= len(l.data) || isPdfWhitespace(l.data[l.pos+2])) {
+			l.pos += 2
+			return
+		}
+		l.pos++
+	}
+	l.pos = len(l.data)
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	return sorted[len(sorted)/2]
+}
+
+// layoutPage puts the glyphs on a grid of characters the same way pdftotext -layout does,
+// so the columns of the order ("Truck      790133 LU454TW") stay where the keyword parser expects them
+func layoutPage(glyphs []pdfPlacedGlyph) string {
+	visible := make([]pdfPlacedGlyph, 0, len(glyphs))
+	for _, g := range glyphs {
+		if strings.TrimSpace(g.text) != "" {
+			visible = append(visible, g)
+		}
+	}
+	if len(visible) == 0 {
+		return ""
+	}
+
+	widths := make([]float64, 0, len(visible))
+	heights := make([]float64, 0, len(visible))
+	minX := math.Inf(1)
+	for _, g := range visible {
+		if n := len([]rune(g.text)); g.width > 0 {
+			widths = append(widths, g.width/float64(n))
+		}
+		heights = append(heights, g.height)
+		minX = math.Min(minX, g.x)
+	}
+
+	lineHeight := median(heights)
+	if lineHeight <= 0 {
+		lineHeight = 10
+	}
+	charWidth := median(widths)
+	if charWidth <= 0 {
+		charWidth = lineHeight / 2
+	}
+
+	sort.SliceStable(visible, func(i, j int) bool {
+		if visible[i].y != visible[j].y {
+			return visible[i].y > visible[j].y
+		}
+		return visible[i].x < visible[j].x
+	})
+
+	lines := make([][]pdfPlacedGlyph, 0)
+	for _, g := range visible {
+		if n := len(lines); n > 0 && math.Abs(lines[n-1][0].y-g.y) < lineHeight*0.4 {
+			lines[n-1] = append(lines[n-1], g)
+			continue
+		}
+		lines = append(lines, []pdfPlacedGlyph{g})
+	}
+
+	gaps := make([]float64, 0, len(lines))
+	for i := 1; i < len(lines); i++ {
+		gaps = append(gaps, lines[i-1][0].y-lines[i][0].y)
+	}
+	lineGap := median(gaps)
+
+	var text strings.Builder
+	for i, line := range lines {
+		if i > 0 && lineGap > 0 {
+			// bigger vertical gaps become empty lines, like in pdftotext
+			blanks := int(math.Round((lines[i-1][0].y-line[0].y)/lineGap)) - 1
+			for range min(max(blanks, 0), 3) {
+				text.WriteString("\n")
+			}
+		}
+
+		sort.SliceStable(line, func(a, b int) bool { return line[a].x < line[b].x })
+
+		buf := make([]rune, 0)
+		prevX, prevEnd := math.Inf(-1), math.Inf(-1)
+		prevText := ""
+		for _, g := range line {
+			// fake bold is the same glyph printed twice almost at the same place
+			if g.text == prevText && math.Abs(g.x-prevX) < charWidth*0.3 {
+				continue
+			}
+
+			gap := g.x - prevEnd
+			switch {
+			case len(buf) == 0:
+				col := int(math.Round((g.x - minX) / charWidth))
+				for range col {
+					buf = append(buf, ' ')
+				}
+			case gap > g.height*0.5:
+				col := max(int(math.Round((g.x-minX)/charWidth)), len(buf)+1)
+				for len(buf) < col {
+					buf = append(buf, ' ')
+				}
+			case gap > g.height*0.15:
+				buf = append(buf, ' ')
+			}
+
+			buf = append(buf, []rune(g.text)...)
+			prevX, prevEnd, prevText = g.x, g.x+g.width, g.text
+		}
+
+		text.WriteString(strings.TrimRight(string(buf), " "))
+		text.WriteString("\n")
+	}
+
+	return text.String()
+}
+
+// ExtractPdfText is the built-in replacement of pdftotext -layout, it does not need anything installed on the server
+func ExtractPdfText(pdfFilePath string) (string, error) {
+	data, err := os.ReadFile(pdfFilePath)
+	if err != nil {
+		return "", fmt.Errorf("ERR: reading pdf %s: %v", pdfFilePath, err)
+	}
+
+	return extractPdfTextFromBytes(data)
+}
+
+func extractPdfTextFromBytes(data []byte) (docText string, err error) {
+	// the reader trusts a lot of what is written in the file, a document it did not expect must not take the bot down
+	defer func() {
+		if r := recover(); r != nil {
+			docText, err = "", fmt.Errorf("ERR: built-in pdf extractor panicked: %v", r)
+		}
+	}()
+
+	doc, err := openPdf(data)
+	if err != nil {
+		return "", err
+	}
+
+	pages := doc.pages()
+	if len(pages) == 0 {
+		return "", fmt.Errorf("ERR: no pages found in the pdf")
+	}
+
+	reader := newPdfContentReader(doc)
+	pageTexts := make([]string, 0, len(pages))
+	for _, page := range pages {
+		reader.glyphs = reader.glyphs[:0]
+		reader.run(doc.pageContent(page), page.resources, identityPdfMatrix, 0)
+		pageTexts = append(pageTexts, layoutPage(reader.glyphs))
+	}
+
+	if reader.known == 0 && reader.unknown > 0 {
+		return "", errPdfNoUnicode
+	}
+
+	docText = strings.Join(pageTexts, "\f\n")
+	if strings.TrimSpace(docText) == "" {
+		return "", ErrNoTextLayer
+	}
+
+	return docText, nil
+}
+
+var winAnsiEncoding = func() [256]rune {
+	var enc [256]rune
+	for c := 0x20; c < 0x7f; c++ {
+		enc[c] = rune(c)
+	}
+	for c := 0xa0; c <= 0xff; c++ {
+		enc[c] = rune(c)
+	}
+	for c, r := range map[int]rune{
+		0x80: '€', 0x82: '‚', 0x83: 'ƒ', 0x84: '„', 0x85: '…', 0x86: '†', 0x87: '‡', 0x88: 'ˆ',
+		0x89: '‰', 0x8a: 'Š', 0x8b: '‹', 0x8c: 'Œ', 0x8e: 'Ž', 0x91: '‘', 0x92: '’', 0x93: '“',
+		0x94: '”', 0x95: '•', 0x96: '–', 0x97: '—', 0x98: '˜', 0x99: '™', 0x9a: 'š', 0x9b: '›',
+		0x9c: 'œ', 0x9e: 'ž', 0x9f: 'Ÿ',
+	} {
+		enc[c] = r
+	}
+	return enc
+}()
+
+// pdfGlyphNames covers the names used in /Differences of the documents we get, single letters are handled separately
+var pdfGlyphNames = map[string]rune{
+	"space": ' ', "exclam": '!', "quotedbl": '"', "numbersign": '#', "dollar": '$', "percent": '%',
+	"ampersand": '&', "quotesingle": '\'', "parenleft": '(', "parenright": ')', "asterisk": '*', "plus": '+',
+	"comma": ',', "hyphen": '-', "period": '.', "slash": '/', "colon": ':', "semicolon": ';', "less": '<',
+	"equal": '=', "greater": '>', "question": '?', "at": '@', "bracketleft": '[', "backslash": '\\',
+	"bracketright": ']', "asciicircum": '^', "underscore": '_', "grave": '`', "braceleft": '{', "bar": '|',
+	"braceright": '}', "asciitilde": '~', "zero": '0', "one": '1', "two": '2', "three": '3', "four": '4',
+	"five": '5', "six": '6', "seven": '7', "eight": '8', "nine": '9', "degree": '°', "endash": '–',
+	"emdash": '—', "quoteleft": '‘', "quoteright": '’', "quotedblleft": '“', "quotedblright": '”',
+	"bullet": '•', "ellipsis": '…', "Euro": '€', "section": '§', "nbspace": ' ', "periodcentered": '·',
+	"adieresis": 'ä', "Adieresis": 'Ä', "odieresis": 'ö', "Odieresis": 'Ö', "udieresis": 'ü', "Udieresis": 'Ü',
+	"germandbls": 'ß', "eacute": 'é', "Eacute": 'É', "egrave": 'è', "Egrave": 'È', "ecircumflex": 'ê',
+	"agrave": 'à', "acircumflex": 'â', "ccedilla": 'ç', "Ccedilla": 'Ç', "icircumflex": 'î', "ocircumflex": 'ô',
+	"ucircumflex": 'û', "ugrave": 'ù', "aogonek": 'ą', "Aogonek": 'Ą', "eogonek": 'ę', "Eogonek": 'Ę',
+	"lslash": 'ł', "Lslash": 'Ł', "nacute": 'ń', "Nacute": 'Ń', "sacute": 'ś', "Sacute": 'Ś', "zacute": 'ź',
+	"Zacute": 'Ź', "zdotaccent": 'ż', "Zdotaccent": 'Ż', "cacute": 'ć', "Cacute": 'Ć', "oacute": 'ó',
+	"Oacute": 'Ó',
+}
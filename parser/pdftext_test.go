@@ -0,0 +1,165 @@
+package parser
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// buildTestPdf makes a one page pdf with the given content stream and a Helvetica font as /F1
+func buildTestPdf(content string, compress bool) []byte {
+	stream := []byte(content)
+	filter := ""
+	if compress {
+		var b bytes.Buffer
+		w := zlib.NewWriter(&b)
+		w.Write(stream)
+		w.Close()
+		stream = b.Bytes()
+		filter = " /Filter /FlateDecode"
+	}
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] /Resources << /Font << /F1 5 0 R >> >> /Contents 4 0 R >>",
+		fmt.Sprintf("<< /Length %d%s >>\nstream\n%s\nendstream", len(stream), filter, stream),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+	}
+
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.4\n")
+	for i, obj := range objects {
+		fmt.Fprintf(&pdf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	pdf.WriteString("trailer\n<< /Size 6 /Root 1 0 R >>\n%%EOF\n")
+	return pdf.Bytes()
+}
+
+func TestExtractPdfText(t *testing.T) {
+	content := "BT /F1 10 Tf 50 800 Td (LADE ANWEISUNG) Tj ET\n" +
+		"BT /F1 10 Tf 50 780 Td (Truck) Tj 150 0 Td (790133 LU454TW) Tj ET\n" +
+		"BT /F1 10 Tf 50 768 Td [(Con) -20 (tainer)] TJ 150 0 Td (HOYU1234567) Tj ET\n" +
+		"BT /F1 10 Tf 50 740 Td (LADEN) Tj 50 0 Td (ACME CHEMICALS) Tj 0 -12 Td (HAUPTSTRASSE 1) Tj ET\n"
+
+	for _, compress := range []bool{false, true} {
+		t.Run(fmt.Sprintf("compressed=%v", compress), func(t *testing.T) {
+			docText, err := extractPdfTextFromBytes(buildTestPdf(content, compress))
+			if err != nil {
+				t.Fatalf("extractPdfTextFromBytes failed: %v", err)
+			}
+
+			lines := strings.Split(docText, "\n")
+			wantFields := [][]string{
+				{"LADE", "ANWEISUNG"},
+				{"Truck", "790133", "LU454TW"},
+				{"Container", "HOYU1234567"},
+				{"LADEN", "ACME", "CHEMICALS"},
+				{"HAUPTSTRASSE", "1"},
+			}
+
+			nonEmpty := make([]string, 0)
+			for _, line := range lines {
+				if strings.TrimSpace(line) != "" {
+					nonEmpty = append(nonEmpty, line)
+				}
+			}
+			if len(nonEmpty) != len(wantFields) {
+				t.Fatalf("got %d lines, want %d\n--- doc text ---\n%s", len(nonEmpty), len(wantFields), docText)
+			}
+			for i, want := range wantFields {
+				if got := strings.Fields(nonEmpty[i]); strings.Join(got, " ") != strings.Join(want, " ") {
+					t.Errorf("line %d = %q, want fields %q", i, nonEmpty[i], want)
+				}
+			}
+
+			// the columns are what the keyword parser relies on
+			if !strings.Contains(nonEmpty[1], "Truck   ") {
+				t.Errorf("value column collapsed into the keyword: %q", nonEmpty[1])
+			}
+			if strings.IndexFunc(nonEmpty[4], func(r rune) bool { return r != ' ' }) != strings.Index(nonEmpty[3], "ACME") {
+				t.Errorf("address continuation is not aligned with the first address line:\n%s\n%s", nonEmpty[3], nonEmpty[4])
+			}
+		})
+	}
+}
+
+func TestExtractPdfTextNoTextLayer(t *testing.T) {
+	// a scan is just an image drawn over the page
+	content := "q 595 0 0 842 0 0 cm BI /W 1 /H 1 /CS /G /BPC 8 ID \x80 EI Q\n"
+
+	_, err := extractPdfTextFromBytes(buildTestPdf(content, true))
+	if !errors.Is(err, ErrNoTextLayer) {
+		t.Fatalf("err = %v, want %v", err, ErrNoTextLayer)
+	}
+}
+
+func TestReadPdfDocWithPdftotext(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string // of the fake pdftotext
+		want    string
+		wantErr bool
+		noText  bool
+	}{
+		{"read", "echo LADEN", "LADEN\n", false, false},
+		{"damaged but read", "echo LADEN; exit 1", "LADEN\n", false, false},
+		{"damaged and empty", "exit 1", "", true, false},
+		{"other failure", "echo LADEN; exit 3", "", true, false},
+		{"no text layer", "echo", "", true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "pdftotext"), []byte("#!/bin/sh\n"+tt.script+"\n"), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			t.Setenv("PATH", dir)
+
+			got, err := readPdfDocWithPdftotext("doc.pdf")
+			if (err != nil) != tt.wantErr || errors.Is(err, ErrNoTextLayer) != tt.noText || got != tt.want {
+				t.Errorf("got %q, %v; want %q, error %v, no text layer %v", got, err, tt.want, tt.wantErr, tt.noText)
+			}
+		})
+	}
+}
+
+// objStmPdf is a pdf with just an object stream that has the given /First, the header of the stream points at offsets 0 and 5
+func objStmPdf(first string) []byte {
+	return []byte("%PDF-1.5\n1 0 obj\n<< /Type /ObjStm /N 2 /First " + first + " /Length 10 >>\nstream\n1 0 2 5 xx\nendstream\nendobj\n")
+}
+
+func TestOpenPdfBrokenObjectStream(t *testing.T) {
+	for _, first := range []string{"-50", "-1", "10", "1e9"} {
+		t.Run(first, func(t *testing.T) {
+			if _, err := openPdf(objStmPdf(first)); err != nil {
+				t.Fatalf("openPdf failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestExtractPdfTextBrokenObjectStream(t *testing.T) {
+	// this one used to crash the whole bot, now it is just a pdf the built-in extractor can not read
+	_, err := extractPdfTextFromBytes(objStmPdf("-50"))
+	if err == nil {
+		t.Fatal("expected an error for a pdf without pages")
+	}
+}
+
+func FuzzExtractPdfText(f *testing.F) {
+	f.Add(objStmPdf("-50"))
+	f.Add(buildTestPdf("BT /F1 10 Tf 50 800 Td (LADEN) Tj ET\n", false))
+	f.Add(buildTestPdf("BT /F1 10 Tf 50 800 Td (LADEN) Tj ET\n", true))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// errors are fine, only a panic fails
+		extractPdfTextFromBytes(data)
+	})
+}
@@ -0,0 +1,209 @@
+package parser
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"logistictbot/docs"
+	"logistictbot/errlog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PODEnforcement is what happens when the driver ends a task without the proof of delivery the rule asks for
+type PODEnforcement string
+
+const (
+	PODBlock    PODEnforcement = "block"    // the task can not be finished until the files are attached
+	PODEscalate PODEnforcement = "escalate" // the task is finished, the managers of the group are told
+)
+
+// PODRules is podrules.json, what the driver has to attach to the tasks as the proof of delivery
+type PODRules struct {
+	Rules []PODRule `json:"rules"`
+}
+
+// PODRule is the proof of delivery of one task type. A rule of the customer of the task wins over the one for every customer
+type PODRule struct {
+	TaskType  string         `json:"task_type"`
+	Customer  string         `json:"customer"` // a part of the company of the task, the case does not matter. Empty for every customer
+	Documents int            `json:"documents"`
+	Photos    int            `json:"photos"`
+	OnMissing PODEnforcement `json:"on_missing"` // block when not set
+}
+
+var (
+	podRulesMu sync.RWMutex
+	podRules   PODRules
+)
+
+// LoadPODRules reads the proof of delivery rules instead of the previous ones.
+// A file that does not exist means no task needs any files to be finished
+func LoadPODRules(file string) error {
+	data, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		setPODRules(PODRules{})
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("ERR: reading %s: %v", file, err)
+	}
+
+	var rules PODRules
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(&rules); err != nil {
+		return fmt.Errorf("ERR: decoding %s: %v", file, err)
+	}
+	if err = rules.validate(); err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+
+	setPODRules(rules)
+	return nil
+}
+
+func setPODRules(rules PODRules) {
+	podRulesMu.Lock()
+	defer podRulesMu.Unlock()
+
+	for i := range rules.Rules {
+		if rules.Rules[i].OnMissing == "" {
+			rules.Rules[i].OnMissing = PODBlock
+		}
+	}
+	podRules = rules
+}
+
+func (pr *PODRules) validate() error {
+	var errs []error
+	for i, r := range pr.Rules {
+		if !validTaskTypes[r.TaskType] {
+			errs = append(errs, fmt.Errorf("rules[%d]: unknown task_type %q", i, r.TaskType))
+		}
+		if r.Documents < 0 || r.Photos < 0 {
+			errs = append(errs, fmt.Errorf("rules[%d]: documents and photos can not be negative", i))
+		}
+		if r.OnMissing != "" && r.OnMissing != PODBlock && r.OnMissing != PODEscalate {
+			errs = append(errs, fmt.Errorf("rules[%d]: on_missing is %q, should be %q or %q", i, r.OnMissing, PODBlock, PODEscalate))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// PODRule is the proof of delivery rule of the task, ok is false when nothing has to be attached to it
+func (t *TaskSection) PODRule() (rule PODRule, ok bool) {
+	podRulesMu.RLock()
+	defer podRulesMu.RUnlock()
+
+	company := strings.ToLower(t.Company)
+	for _, r := range podRules.Rules {
+		if r.TaskType != t.Type {
+			continue
+		}
+		if r.Customer == "" {
+			if !ok {
+				rule, ok = r, true
+			}
+			continue
+		}
+		if company != "" && strings.Contains(company, strings.ToLower(strings.TrimSpace(r.Customer))) {
+			return r, true
+		}
+	}
+	return rule, ok
+}
+
+// PODStatus is what is attached to the task against what its rule asks for
+type PODStatus struct {
+	Rule      PODRule
+	Documents int
+	Photos    int
+}
+
+func (s PODStatus) MissingDocuments() int {
+	return max(s.Rule.Documents-s.Documents, 0)
+}
+
+func (s PODStatus) MissingPhotos() int {
+	return max(s.Rule.Photos-s.Photos, 0)
+}
+
+func (s PODStatus) Complete() bool {
+	return s.MissingDocuments() == 0 && s.MissingPhotos() == 0
+}
+
+// CheckPOD counts the files attached to the task against its rule, ok is false when the task has no rule
+func (t *TaskSection) CheckPOD(db *sql.DB) (status PODStatus, ok bool, err error) {
+	rule, ok := t.PODRule()
+	if !ok {
+		return PODStatus{}, false, nil
+	}
+
+	documents, photos, err := docs.CountFilesAttachedToTask(db, t.Id)
+	if err != nil {
+		errlog.ERR.Printf("ERR: checking the proof of delivery of task %d: %v\n", t.Id, err)
+		return PODStatus{}, false, fmt.Errorf("ERR: checking the proof of delivery of task %d: %v", t.Id, err)
+	}
+	return PODStatus{Rule: rule, Documents: documents, Photos: photos}, true, nil
+}
+
+// IncompletePOD is a finished task that does not have the files its rule asks for
+type IncompletePOD struct {
+	Task   *TaskSection
+	Status PODStatus
+}
+
+// IncompletePODs are the tasks finished since the time whose proof of delivery is not complete, of the shipments that
+// are not invoiced or cancelled yet
+func IncompletePODs(db *sql.DB, since time.Time) ([]*IncompletePOD, error) {
+	rows, err := db.Query(`
+		SELECT t.id, t.type, t.shipment_id, t.company, t.address, t.end, COALESCE(NULLIF(t.car_id, ''), s.car_id, ''),
+		       COALESCE(SUM(CASE WHEN f.id IS NULL OR (f.filetype = 'image' AND f.signed_by IS NULL) THEN 0 ELSE 1 END), 0),
+		       COALESCE(SUM(CASE WHEN f.filetype = 'image' AND f.signed_by IS NULL THEN 1 ELSE 0 END), 0)
+		FROM tasks t
+		JOIN shipments s ON s.id = t.shipment_id
+		LEFT JOIN task_docs td ON td.task_id = t.id
+		LEFT JOIN files f ON f.id = td.file_id AND f.deleted_at IS NULL
+		WHERE t.start IS NOT NULL AND t.end IS NOT NULL AND datetime(t.end) >= datetime(?)
+		  AND s.status IN (`+sqlStatuses([]ShipmentStatus{StatusInProgress, StatusFinished})+`)
+		GROUP BY t.id
+		ORDER BY t.shipment_id, t.position, t.id`, since.UTC().Format(time.RFC3339))
+	if err != nil {
+		errlog.ERR.Printf("ERR: querying the proof of delivery of the finished tasks: %v\n", err)
+		return nil, fmt.Errorf("ERR: querying the proof of delivery of the finished tasks: %v", err)
+	}
+	defer rows.Close()
+
+	incomplete := make([]*IncompletePOD, 0)
+	for rows.Next() {
+		var (
+			t       = new(TaskSection)
+			end     sql.NullString
+			company sql.NullString
+			status  PODStatus
+		)
+		if err = rows.Scan(&t.Id, &t.Type, &t.ShipmentId, &company, &t.Address, &end, &t.CarId, &status.Documents, &status.Photos); err != nil {
+			return nil, fmt.Errorf("ERR: scanning the proof of delivery of a task: %v", err)
+		}
+		t.Company = company.String
+		if end.Valid {
+			t.End, _ = parseTimeString(end.String)
+		}
+
+		rule, ok := t.PODRule()
+		if !ok {
+			continue
+		}
+		status.Rule = rule
+		if !status.Complete() {
+			incomplete = append(incomplete, &IncompletePOD{Task: t, Status: status})
+		}
+	}
+	return incomplete, rows.Err()
+}
@@ -0,0 +1,39 @@
+package parser
+
+import "testing"
+
+func TestPODRule(t *testing.T) {
+	setPODRules(PODRules{Rules: []PODRule{
+		{TaskType: TaskUnload, Documents: 1, Photos: 2},
+		{TaskType: TaskUnload, Customer: "basf", Documents: 2, Photos: 4, OnMissing: PODEscalate},
+		{TaskType: TaskLoad, Customer: "Hoyer", Photos: 1},
+	}})
+	defer setPODRules(PODRules{})
+
+	tests := []struct {
+		name    string
+		task    TaskSection
+		want    PODRule
+		wantOk  bool
+		docs    int
+		photos  int
+		missing [2]int
+	}{
+		{"every customer", TaskSection{Type: TaskUnload, Company: "DOW"}, PODRule{TaskType: TaskUnload, Documents: 1, Photos: 2, OnMissing: PODBlock}, true, 0, 1, [2]int{1, 1}},
+		{"customer wins", TaskSection{Type: TaskUnload, Company: "BASF SE"}, PODRule{TaskType: TaskUnload, Customer: "basf", Documents: 2, Photos: 4, OnMissing: PODEscalate}, true, 3, 4, [2]int{0, 0}},
+		{"only for the customer", TaskSection{Type: TaskLoad, Company: "DOW"}, PODRule{}, false, 0, 0, [2]int{0, 0}},
+		{"no rule for the type", TaskSection{Type: TaskCleaning}, PODRule{}, false, 0, 0, [2]int{0, 0}},
+	}
+
+	for _, tt := range tests {
+		got, ok := tt.task.PODRule()
+		if got != tt.want || ok != tt.wantOk {
+			t.Errorf("%s: got %+v %v, want %+v %v", tt.name, got, ok, tt.want, tt.wantOk)
+			continue
+		}
+		status := PODStatus{Rule: got, Documents: tt.docs, Photos: tt.photos}
+		if m := [2]int{status.MissingDocuments(), status.MissingPhotos()}; m != tt.missing || status.Complete() != (m == [2]int{}) {
+			t.Errorf("%s: missing %v (complete %v), want %v", tt.name, m, status.Complete(), tt.missing)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package parser
+
+import (
+	"database/sql"
+	"fmt"
+	"logistictbot/audit"
+	"logistictbot/config"
+	"logistictbot/duration"
+	"logistictbot/errlog"
+	"time"
+)
+
+// Punctuality is how the task was finished against its time window
+type Punctuality string
+
+const (
+	PunctualityOnTime Punctuality = "on_time"
+	PunctualityEarly  Punctuality = "early"
+	PunctualityLate   Punctuality = "late"
+)
+
+type taskPunctuality struct {
+	value sql.NullString
+	delay sql.NullInt64
+}
+
+func (p taskPunctuality) apply(t *TaskSection) {
+	t.Punctuality = Punctuality(p.value.String)
+	t.WindowDelay = int(p.delay.Int64)
+}
+
+// Window is when the task should be done: the load window for the loading tasks, the unload one for the others.
+// A window with only one side is that moment, both are zero when the document had no window for the task
+func (t *TaskSection) Window() (start, end time.Time) {
+	start, end = t.LoadStartDate, t.LoadEndDate
+	if t.Type == TaskUnload || (start.IsZero() && end.IsZero()) {
+		start, end = t.UnloadStartDate, t.UnloadEndDate
+	}
+	if start.IsZero() {
+		start = end
+	}
+	if end.IsZero() {
+		end = start
+	}
+	return start, end
+}
+
+// EvaluatePunctuality compares the end of the task with its window. delay is how long it was out of the window,
+// negative when early. ok is false when the task is not finished or has no window
+func (t *TaskSection) EvaluatePunctuality() (p Punctuality, delay time.Duration, ok bool) {
+	start, end := t.Window()
+	if !t.IsFinished() || end.IsZero() {
+		return "", 0, false
+	}
+
+	switch {
+	case t.End.Before(start):
+		return PunctualityEarly, t.End.Sub(start), true
+	case t.End.After(end):
+		return PunctualityLate, t.End.Sub(end), true
+	}
+	return PunctualityOnTime, 0, true
+}
+
+// PunctualityText is the recorded punctuality the way the reports show it, empty when there is none
+func (t *TaskSection) PunctualityText(lang config.LangCode) string {
+	if t.Punctuality == "" {
+		return ""
+	}
+	if t.Punctuality == PunctualityOnTime {
+		return config.Translate(lang, "punctuality:on_time")
+	}
+	off := t.OutOfWindow()
+	return config.Translate(lang, "punctuality:"+string(t.Punctuality), off.Format(duration.ForPresentation))
+}
+
+// OutOfWindow is how long the task was finished before or after its window
+func (t *TaskSection) OutOfWindow() duration.Duration {
+	delay := time.Duration(t.WindowDelay) * time.Minute
+	if delay < 0 {
+		delay = -delay
+	}
+	return duration.Duration{Duration: delay}
+}
+
+// RecordPunctuality stores the punctuality of the finished task for the reports
+func (t *TaskSection) RecordPunctuality(db *sql.DB, by audit.Actor) error {
+	p, delay, ok := t.EvaluatePunctuality()
+	if !ok {
+		return nil
+	}
+
+	err := auditedWrite(db, by, t.auditTarget(), []string{"punctuality", "window_delay"}, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`UPDATE tasks SET punctuality = ?, window_delay = ? WHERE id = ?`, p, int(delay.Minutes()), t.Id)
+		if err != nil {
+			errlog.ERR.Printf("ERR: recording the punctuality of task %d: %v\n", t.Id, err)
+			return fmt.Errorf("ERR: recording the punctuality of task %d: %v", t.Id, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	t.Punctuality, t.WindowDelay = p, int(delay.Minutes())
+	return nil
+}
+
+// timingChanged says if the editor changes the end or the windows of the task, its punctuality is then recorded again
+// and the managers can be told again about its window
+func timingChanged(tx *sql.Tx, taskId int64, end, loadStart, loadEnd, unloadStart, unloadEnd *time.Time) (bool, error) {
+	stored := make([]sql.NullString, 5)
+	err := tx.QueryRow(`SELECT end, load_start_date, load_end_date, unload_start_date, unload_end_date FROM tasks WHERE id = ?`, taskId).
+		Scan(&stored[0], &stored[1], &stored[2], &stored[3], &stored[4])
+	if err != nil {
+		return false, fmt.Errorf("ERR: reading the timing of task %d: %v", taskId, err)
+	}
+
+	for i, t := range []*time.Time{end, loadStart, loadEnd, unloadStart, unloadEnd} {
+		if t == nil || t.IsZero() {
+			if stored[i].Valid && stored[i].String != "" {
+				return true, nil
+			}
+			continue
+		}
+		was, err := parseTimeString(stored[i].String)
+		if !stored[i].Valid || err != nil || !was.Equal(*t) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// windowTasks are the tasks that have a window, with the car that drives them in CarId. The parser stores a missing
+// window as an empty string, not NULL
+func windowTasks(db *sql.DB, where string, args ...any) ([]*TaskSection, error) {
+	rows, err := db.Query(`
+		SELECT t.id, t.type, t.shipment_id, t.address, t.load_start_date, t.load_end_date, t.unload_start_date, t.unload_end_date,
+		       t.start, t.end, COALESCE(NULLIF(t.car_id, ''), s.car_id, '')
+		FROM tasks t
+		JOIN shipments s ON s.id = t.shipment_id
+		WHERE COALESCE(NULLIF(t.load_start_date, ''), NULLIF(t.load_end_date, ''),
+		               NULLIF(t.unload_start_date, ''), NULLIF(t.unload_end_date, '')) IS NOT NULL
+		  AND `+where+`
+		ORDER BY t.shipment_id, t.position, t.id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ERR: querying the tasks with windows: %v", err)
+	}
+	defer rows.Close()
+
+	tasks := make([]*TaskSection, 0)
+	for rows.Next() {
+		var (
+			t                                                  = new(TaskSection)
+			loadStart, loadEnd, unloadStart, unloadEnd, st, en sql.NullString
+		)
+		err = rows.Scan(&t.Id, &t.Type, &t.ShipmentId, &t.Address, &loadStart, &loadEnd, &unloadStart, &unloadEnd, &st, &en, &t.CarId)
+		if err != nil {
+			return nil, fmt.Errorf("ERR: scanning a task with a window: %v", err)
+		}
+		for _, v := range []struct {
+			s  sql.NullString
+			to *time.Time
+		}{{loadStart, &t.LoadStartDate}, {loadEnd, &t.LoadEndDate}, {unloadStart, &t.UnloadStartDate}, {unloadEnd, &t.UnloadEndDate}, {st, &t.Start}, {en, &t.End}} {
+			if v.s.Valid {
+				*v.to, _ = parseTimeString(v.s.String)
+			}
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, rows.Err()
+}
+
+// ClosingWindows are the tasks that are not started while their window closes within lead from now, and the
+// managers were not told about them yet
+func ClosingWindows(db *sql.DB, now time.Time, lead time.Duration) ([]*TaskSection, error) {
+	tasks, err := windowTasks(db, `t.start IS NULL AND t.window_alerted_at IS NULL
+		AND s.status IN (`+sqlStatuses(ActiveStatuses)+`)`)
+	if err != nil {
+		errlog.ERR.Println(err)
+		return nil, err
+	}
+
+	closing := make([]*TaskSection, 0, len(tasks))
+	for _, t := range tasks {
+		_, end := t.Window()
+		if !end.Before(now) && end.Sub(now) <= lead {
+			closing = append(closing, t)
+		}
+	}
+	return closing, nil
+}
+
+// MarkWindowAlerted remembers the managers were told the window of the task is closing
+func MarkWindowAlerted(db *sql.DB, taskId int) error {
+	_, err := db.Exec(`UPDATE tasks SET window_alerted_at = CURRENT_TIMESTAMP WHERE id = ?`, taskId)
+	if err != nil {
+		errlog.ERR.Printf("ERR: marking the window of task %d as alerted: %v\n", taskId, err)
+		return fmt.Errorf("ERR: marking the window of task %d as alerted: %v", taskId, err)
+	}
+	return nil
+}
+
+// UnratedTasks are the finished tasks with a window whose punctuality is not recorded yet
+func UnratedTasks(db *sql.DB) ([]*TaskSection, error) {
+	tasks, err := windowTasks(db, `t.start IS NOT NULL AND t.end IS NOT NULL AND t.punctuality IS NULL`)
+	if err != nil {
+		errlog.ERR.Println(err)
+		return nil, err
+	}
+	return tasks, nil
+}
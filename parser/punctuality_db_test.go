@@ -0,0 +1,55 @@
+package parser_test
+
+import (
+	"logistictbot/audit"
+	"logistictbot/parser"
+	"testing"
+	"time"
+)
+
+func TestUnratedTasks(t *testing.T) {
+	s := openTestDB(t)
+	mustExec(t, s, `INSERT INTO shipments (id, instruction_type, car_id, driver_id, status) VALUES (4334001, 'x', 'CAR1', '', 'in_progress')`)
+	// the parser stores the windows a task does not have as empty strings
+	mustExec(t, s, `INSERT INTO tasks (id, type, shipment_id, address, position, load_start_date, load_end_date, unload_start_date, unload_end_date, start, end)
+		VALUES (1, 'cleaning', 4334001, 'SGS CLEANING, DE-47829 KREFELD', 1, '', '', '', '', '2025-05-06T08:00:00Z', '2025-05-06T09:00:00Z')`)
+	mustExec(t, s, `INSERT INTO tasks (id, type, shipment_id, address, position, load_start_date, load_end_date, unload_start_date, unload_end_date, start, end)
+		VALUES (2, 'load', 4334001, 'BASF SE, DE-67056 LUDWIGSHAFEN', 2, '2025-05-06T10:00:00Z', '2025-05-06T11:00:00Z', '', '', '2025-05-06T10:30:00Z', '2025-05-06T12:00:00Z')`)
+
+	tasks, err := parser.UnratedTasks(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 1 || tasks[0].Id != 2 {
+		t.Fatalf("got %d unrated tasks, want only the load with a window", len(tasks))
+	}
+
+	if err = tasks[0].RecordPunctuality(s, audit.System); err != nil {
+		t.Fatal(err)
+	}
+	if tasks[0].Punctuality != parser.PunctualityLate || tasks[0].WindowDelay != 60 {
+		t.Errorf("recorded %q, %d minutes; want late by 60", tasks[0].Punctuality, tasks[0].WindowDelay)
+	}
+
+	// once recorded, the next pass of the monitor has nothing to do
+	if tasks, err = parser.UnratedTasks(s); err != nil || len(tasks) != 0 {
+		t.Errorf("got %d unrated tasks after recording, %v", len(tasks), err)
+	}
+}
+
+func TestRecordPunctualityWithoutWindow(t *testing.T) {
+	s := openTestDB(t)
+	mustExec(t, s, `INSERT INTO shipments (id, instruction_type, car_id, driver_id, status) VALUES (4334001, 'x', 'CAR1', '', 'in_progress')`)
+	mustExec(t, s, `INSERT INTO tasks (id, type, shipment_id, address, position, load_start_date, load_end_date, unload_start_date, unload_end_date, start, end)
+		VALUES (1, 'dropoff', 4334001, 'HOYER DEPOT, DE-47829 KREFELD', 1, '', '', '', '', '2025-05-06T08:00:00Z', '2025-05-06T09:00:00Z')`)
+
+	task := &parser.TaskSection{Id: 1, Type: parser.TaskDropoff, ShipmentId: 4334001,
+		Start: time.Date(2025, 5, 6, 8, 0, 0, 0, time.UTC), End: time.Date(2025, 5, 6, 9, 0, 0, 0, time.UTC)}
+	if err := task.RecordPunctuality(s, audit.System); err != nil {
+		t.Fatal(err)
+	}
+	// the monitor tells the managers nothing about a task without a recorded punctuality
+	if task.Punctuality != "" {
+		t.Errorf("recorded %q for a task without a window", task.Punctuality)
+	}
+}
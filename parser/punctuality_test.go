@@ -0,0 +1,34 @@
+package parser
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEvaluatePunctuality(t *testing.T) {
+	at := func(hour, minute int) time.Time { return time.Date(2025, 5, 6, hour, minute, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name      string
+		task      TaskSection
+		want      Punctuality
+		wantDelay time.Duration
+		wantOk    bool
+	}{
+		{"load in window", TaskSection{Type: TaskLoad, LoadStartDate: at(8, 0), LoadEndDate: at(10, 0), Start: at(8, 30), End: at(9, 30)}, PunctualityOnTime, 0, true},
+		{"load late", TaskSection{Type: TaskLoad, LoadStartDate: at(8, 0), LoadEndDate: at(10, 0), Start: at(9, 30), End: at(10, 45)}, PunctualityLate, 45 * time.Minute, true},
+		{"load early", TaskSection{Type: TaskLoad, LoadStartDate: at(8, 0), LoadEndDate: at(10, 0), Start: at(6, 0), End: at(7, 30)}, PunctualityEarly, -30 * time.Minute, true},
+		{"unload uses its window", TaskSection{Type: TaskUnload, LoadStartDate: at(1, 0), LoadEndDate: at(2, 0), UnloadStartDate: at(14, 0), UnloadEndDate: at(16, 0), Start: at(14, 0), End: at(15, 0)}, PunctualityOnTime, 0, true},
+		{"only the start of the window", TaskSection{Type: TaskUnload, UnloadStartDate: at(14, 0), Start: at(13, 0), End: at(15, 0)}, PunctualityLate, time.Hour, true},
+		{"collect falls back to the unload window", TaskSection{Type: TaskCollect, UnloadEndDate: at(12, 0), Start: at(11, 0), End: at(12, 20)}, PunctualityLate, 20 * time.Minute, true},
+		{"not finished", TaskSection{Type: TaskLoad, LoadStartDate: at(8, 0), LoadEndDate: at(10, 0), Start: at(9, 0)}, "", 0, false},
+		{"no window", TaskSection{Type: TaskCleaning, Start: at(9, 0), End: at(10, 0)}, "", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, delay, ok := tt.task.EvaluatePunctuality()
+		if got != tt.want || delay != tt.wantDelay || ok != tt.wantOk {
+			t.Errorf("%s: got %q %v %v, want %q %v %v", tt.name, got, delay, ok, tt.want, tt.wantDelay, tt.wantOk)
+		}
+	}
+}
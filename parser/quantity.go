@@ -0,0 +1,219 @@
+package parser
+
+import (
+	"encoding/json"
+	"html"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type Unit string
+
+const (
+	UnitKilogram   Unit = "kg"
+	UnitTonne      Unit = "t"
+	UnitLitre      Unit = "l"
+	UnitCubicMetre Unit = "m3"
+	UnitCelsius    Unit = "°C"
+)
+
+// Quantity is a weight, volume or temperature the way the document declares it, in the unit of the document.
+// Limit is "min" or "max" when the document gives a bound ("max 30 °C") instead of the exact value
+type Quantity struct {
+	Value float64
+	Unit  Unit
+	Limit string
+}
+
+// units the documents write, lowercased and without dots
+var quantityUnits = map[string]Unit{
+	"kg": UnitKilogram, "kgs": UnitKilogram, "kilo": UnitKilogram, "kilogram": UnitKilogram,
+	"t": UnitTonne, "to": UnitTonne, "ton": UnitTonne, "tons": UnitTonne, "tonne": UnitTonne, "tonnes": UnitTonne,
+	"l": UnitLitre, "lt": UnitLitre, "ltr": UnitLitre, "liter": UnitLitre, "litre": UnitLitre, "liters": UnitLitre, "litres": UnitLitre, "litrów": UnitLitre,
+	"m3": UnitCubicMetre, "m³": UnitCubicMetre, "cbm": UnitCubicMetre,
+	"°c": UnitCelsius, "°": UnitCelsius, "c": UnitCelsius, "grad": UnitCelsius, "deg": UnitCelsius,
+}
+
+var quantityLimits = map[string]string{
+	"max": "max", "maximum": "max", "<": "max", "<=": "max", "≤": "max",
+	"min": "min", "minimum": "min", ">": "min", ">=": "min", "≥": "min",
+}
+
+var quantityRe = regexp.MustCompile(`^(?i)(max|maximum|min|minimum|ca|approx|<=|>=|<|>|≤|≥)?\.?\s*([-+]?\d[\d.,' ]*)\s*(°\s*c|°|m³|[a-zśłów0-9]*)`)
+
+// rangeRe is the second value of a range ("15 - 20 °C", "20 to 24 t"), what comes after the number quantityRe matched first
+var rangeRe = regexp.MustCompile(`^(?i)\s*(°\s*c|°|m³|[a-zśłów0-9]*)?\s*(-|–|—|\.\.|to|bis|do|à)\s*[-+]?\d`)
+
+func (q Quantity) IsZero() bool {
+	return q.Unit == ""
+}
+
+// Kilograms gives the weight in kg, false if it is not a weight
+func (q Quantity) Kilograms() (float64, bool) {
+	switch q.Unit {
+	case UnitKilogram:
+		return q.Value, true
+	case UnitTonne:
+		return q.Value * 1000, true
+	}
+	return 0, false
+}
+
+// Litres gives the volume in litres, false if it is not a volume
+func (q Quantity) Litres() (float64, bool) {
+	switch q.Unit {
+	case UnitLitre:
+		return q.Value, true
+	case UnitCubicMetre:
+		return q.Value * 1000, true
+	}
+	return 0, false
+}
+
+// Celsius gives the temperature, false if it is not a temperature
+func (q Quantity) Celsius() (float64, bool) {
+	if q.Unit == UnitCelsius {
+		return q.Value, true
+	}
+	return 0, false
+}
+
+// Allows says if a measured value fits the declared one: within tolerance of the exact value, or inside the bound of a limit.
+// measured has to be in the base unit (kg, l, °C), the same way the drivers enter it
+func (q Quantity) Allows(measured, tolerance float64) bool {
+	declared, ok := q.baseValue()
+	if !ok {
+		return true
+	}
+
+	switch q.Limit {
+	case "max":
+		return measured <= declared+tolerance
+	case "min":
+		return measured >= declared-tolerance
+	}
+	return math.Abs(measured-declared) <= tolerance
+}
+
+func (q Quantity) baseValue() (float64, bool) {
+	if v, ok := q.Kilograms(); ok {
+		return v, true
+	}
+	if v, ok := q.Litres(); ok {
+		return v, true
+	}
+	return q.Celsius()
+}
+
+func (q Quantity) String() string {
+	if q.IsZero() {
+		return ""
+	}
+
+	value := strconv.FormatFloat(q.Value, 'f', -1, 64) + " " + string(q.Unit)
+	if q.Limit != "" {
+		return q.Limit + " " + value
+	}
+	return value
+}
+
+// MarshalJSON gives null for the quantities that were not in the document or could not be read
+func (q Quantity) MarshalJSON() ([]byte, error) {
+	if q.IsZero() {
+		return []byte("null"), nil
+	}
+
+	type quantity Quantity
+	return json.Marshal(quantity(q))
+}
+
+// ParseWeight reads "24000 kg", "24.000 KG", "24,5 t". A number without a unit is taken as kg
+func ParseWeight(s string) (Quantity, bool) {
+	return parseQuantity(s, UnitKilogram, UnitKilogram, UnitTonne)
+}
+
+// ParseVolume reads "30000 l", "30 m³". A number without a unit is taken as litres
+func ParseVolume(s string) (Quantity, bool) {
+	return parseQuantity(s, UnitLitre, UnitLitre, UnitCubicMetre)
+}
+
+// ParseTemperature reads "15 °c", "max 30 °C", "-5°". A number without a unit is taken as °C.
+// A range ("15 - 20 °C") is not read, there is no single value to compare with
+func ParseTemperature(s string) (Quantity, bool) {
+	return parseQuantity(s, UnitCelsius, UnitCelsius)
+}
+
+func parseQuantity(s string, defaultUnit Unit, allowed ...Unit) (Quantity, bool) {
+	s = strings.TrimSpace(html.UnescapeString(s))
+	m := quantityRe.FindStringSubmatch(s)
+	if m == nil {
+		return Quantity{}, false
+	}
+	if idx := quantityRe.FindStringSubmatchIndex(s); rangeRe.MatchString(s[idx[5]:]) {
+		return Quantity{}, false
+	}
+
+	unit := defaultUnit
+	if rawUnit := strings.ReplaceAll(strings.ToLower(m[3]), " ", ""); rawUnit != "" {
+		var ok bool
+		unit, ok = quantityUnits[rawUnit]
+		if !ok {
+			return Quantity{}, false
+		}
+	}
+	if !containsUnit(allowed, unit) {
+		return Quantity{}, false
+	}
+
+	// nobody writes tonnes or cubic metres to the thousands, "1.500 t" is one and a half
+	value, ok := parseDecimal(m[2], unit != UnitTonne && unit != UnitCubicMetre)
+	if !ok {
+		return Quantity{}, false
+	}
+
+	return Quantity{Value: value, Unit: unit, Limit: quantityLimits[strings.ToLower(m[1])]}, true
+}
+
+func containsUnit(units []Unit, unit Unit) bool {
+	for _, u := range units {
+		if u == unit {
+			return true
+		}
+	}
+	return false
+}
+
+// parseDecimal understands both "24.000,5" and "24,000.5". When there is only one kind of separator,
+// it is a thousands one if it repeats, or has exactly three digits after it ("24.000") and groupsOfThree says
+// that is how the unit is written. Otherwise it is a decimal one ("24,5")
+func parseDecimal(s string, groupsOfThree bool) (float64, bool) {
+	s = strings.NewReplacer(" ", "", "'", "").Replace(strings.TrimSpace(s))
+	s = strings.TrimRight(s, ".,")
+
+	lastDot, lastComma := strings.LastIndex(s, "."), strings.LastIndex(s, ",")
+	switch {
+	case lastDot >= 0 && lastComma >= 0:
+		decimal, thousands := ".", ","
+		if lastComma > lastDot {
+			decimal, thousands = ",", "."
+		}
+		s = strings.ReplaceAll(s, thousands, "")
+		s = strings.Replace(s, decimal, ".", 1)
+	case lastDot >= 0 || lastComma >= 0:
+		sep := "."
+		if lastComma >= 0 {
+			sep = ","
+		}
+		last := strings.LastIndex(s, sep)
+		if strings.Count(s, sep) > 1 || (groupsOfThree && len(s)-last-1 == 3) {
+			s = strings.ReplaceAll(s, sep, "")
+		} else {
+			s = strings.Replace(s, sep, ".", 1)
+		}
+	}
+
+	value, err := strconv.ParseFloat(s, 64)
+	return value, err == nil
+}
@@ -0,0 +1,65 @@
+package parser
+
+import "testing"
+
+func TestParseQuantity(t *testing.T) {
+	tests := []struct {
+		name  string
+		parse func(string) (Quantity, bool)
+		in    string
+		want  Quantity
+		ok    bool
+	}{
+		{"kg", ParseWeight, "24000 kg", Quantity{Value: 24000, Unit: UnitKilogram}, true},
+		{"german thousands", ParseWeight, "24.000 KG", Quantity{Value: 24000, Unit: UnitKilogram}, true},
+		{"decimal tonnes", ParseWeight, "24,5 t", Quantity{Value: 24.5, Unit: UnitTonne}, true},
+		{"both separators", ParseWeight, "1.234,5 kg", Quantity{Value: 1234.5, Unit: UnitKilogram}, true},
+		{"spaced thousands", ParseWeight, "24 000 kg", Quantity{Value: 24000, Unit: UnitKilogram}, true},
+		{"no unit is kg", ParseWeight, "19800", Quantity{Value: 19800, Unit: UnitKilogram}, true},
+		{"volume in a weight", ParseWeight, "30000 l", Quantity{}, false},
+		{"litres", ParseVolume, "30000 l", Quantity{Value: 30000, Unit: UnitLitre}, true},
+		{"cubic metres", ParseVolume, "30 m³", Quantity{Value: 30, Unit: UnitCubicMetre}, true},
+		{"ltr", ParseVolume, "30.000 ltr", Quantity{Value: 30000, Unit: UnitLitre}, true},
+		{"celsius", ParseTemperature, "15 °c", Quantity{Value: 15, Unit: UnitCelsius}, true},
+		{"max", ParseTemperature, "max 30 °C", Quantity{Value: 30, Unit: UnitCelsius, Limit: "max"}, true},
+		{"escaped limit", ParseTemperature, "&lt; 25°", Quantity{Value: 25, Unit: UnitCelsius, Limit: "max"}, true},
+		{"negative", ParseTemperature, "-5,5 C", Quantity{Value: -5.5, Unit: UnitCelsius}, true},
+		{"tonnes with three decimals", ParseWeight, "1.500 t", Quantity{Value: 1.5, Unit: UnitTonne}, true},
+		{"cubic metres with three decimals", ParseVolume, "1,234 m3", Quantity{Value: 1.234, Unit: UnitCubicMetre}, true},
+		{"grouped tonnes", ParseWeight, "1.234.567 t", Quantity{Value: 1234567, Unit: UnitTonne}, true},
+		{"range", ParseTemperature, "15 - 20 °C", Quantity{}, false},
+		{"range without spaces", ParseTemperature, "15-20°C", Quantity{}, false},
+		{"range in words", ParseTemperature, "15 bis 20 °C", Quantity{}, false},
+		{"range with units", ParseTemperature, "15 °C - 20 °C", Quantity{}, false},
+		{"range of tonnes", ParseWeight, "20 to 24 t", Quantity{}, false},
+		{"text", ParseTemperature, "ambient", Quantity{}, false},
+		{"empty", ParseWeight, "", Quantity{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.parse(tt.in)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("parse(%q) = %+v, %v; want %+v, %v", tt.in, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestQuantityAllows(t *testing.T) {
+	tonnes := Quantity{Value: 24, Unit: UnitTonne}
+	if kg, _ := tonnes.Kilograms(); kg != 24000 {
+		t.Errorf("24 t = %v kg", kg)
+	}
+	if !tonnes.Allows(24500, 1200) || tonnes.Allows(20000, 1200) {
+		t.Errorf("24 t with 1200 kg tolerance is compared wrong")
+	}
+
+	max := Quantity{Value: 30, Unit: UnitCelsius, Limit: "max"}
+	if !max.Allows(12, 0) || max.Allows(35, 3) {
+		t.Errorf("max 30 °C is compared wrong")
+	}
+	if !(Quantity{}).Allows(100, 0) {
+		t.Errorf("a missing declaration has to allow anything")
+	}
+}
@@ -0,0 +1,153 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// DocumentParser is implemented by every principal whose transport orders we can read.
+// Detect should be cheap and only look at the layout (headers, company names), Parse does the actual work.
+type DocumentParser interface {
+	Name() string
+	Detect(docText string) bool
+	Parse(docText string) (*Shipment, error)
+}
+
+// Reporter is implemented by the parsers that know better than NewParseReport where their fields came from,
+// like the spreadsheet imports that have columns instead of keywords
+type Reporter interface {
+	Report(docText string, s *Shipment) *ParseReport
+}
+
+var (
+	ErrNoParser = errors.New("none of the registered parsers recognise this document")
+
+	parsers   = make([]DocumentParser, 0)
+	parsersMu sync.RWMutex
+)
+
+// RegisterParser adds a parser to the registry. Parsers are tried in the order they were registered,
+// so the more specific ones should be registered first
+func RegisterParser(p DocumentParser) {
+	parsersMu.Lock()
+	defer parsersMu.Unlock()
+
+	for i, existing := range parsers {
+		if existing.Name() == p.Name() {
+			parsers[i] = p
+			return
+		}
+	}
+	parsers = append(parsers, p)
+}
+
+// registerParserFirst puts the parser before every one registered so far. The imports go there, they only take the
+// spreadsheets with their exact header row, while the layout of the built-in parsers can show up in the cells too
+func registerParserFirst(p DocumentParser) {
+	parsersMu.Lock()
+	defer parsersMu.Unlock()
+
+	for i, existing := range parsers {
+		if existing.Name() == p.Name() {
+			parsers = append(parsers[:i], parsers[i+1:]...)
+			break
+		}
+	}
+	parsers = append([]DocumentParser{p}, parsers...)
+}
+
+// UnregisterParser removes a parser from the registry, it is used when the import mappings are reloaded
+func UnregisterParser(name string) {
+	parsersMu.Lock()
+	defer parsersMu.Unlock()
+
+	for i, existing := range parsers {
+		if existing.Name() == name {
+			parsers = append(parsers[:i], parsers[i+1:]...)
+			return
+		}
+	}
+}
+
+func GetParserByName(name string) (DocumentParser, bool) {
+	parsersMu.RLock()
+	defer parsersMu.RUnlock()
+
+	for _, p := range parsers {
+		if p.Name() == name {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// DetectParser returns the first registered parser that claims the document
+func DetectParser(docText string) (DocumentParser, error) {
+	keywordsMu.RLock()
+	defer keywordsMu.RUnlock()
+
+	return detectParser(docText)
+}
+
+// detectParser expects keywordsMu to be held, so a reload of the dictionaries can not happen in the middle of a document
+func detectParser(docText string) (DocumentParser, error) {
+	parsersMu.RLock()
+	defer parsersMu.RUnlock()
+
+	for _, p := range parsers {
+		if p.Detect(docText) {
+			return p, nil
+		}
+	}
+	return nil, ErrNoParser
+}
+
+// ParseDocText picks the parser for the document and runs it
+func ParseDocText(docText string) (*Shipment, error) {
+	keywordsMu.RLock()
+	defer keywordsMu.RUnlock()
+
+	p, err := detectParser(docText)
+	if err != nil {
+		return nil, err
+	}
+
+	shipment, err := p.Parse(docText)
+	if err != nil {
+		return nil, fmt.Errorf("ERR: %s parser: %v", p.Name(), err)
+	}
+
+	return shipment, nil
+}
+
+// ParseDocTextWithReport does the same as ParseDocText, but also says what exactly the parser managed to recognise
+func ParseDocTextWithReport(docText string) (*Shipment, *ParseReport, error) {
+	keywordsMu.RLock()
+	defer keywordsMu.RUnlock()
+
+	p, err := detectParser(docText)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	shipment, err := p.Parse(docText)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ERR: %s parser: %v", p.Name(), err)
+	}
+
+	if reporter, ok := p.(Reporter); ok {
+		return shipment, reporter.Report(docText, shipment), nil
+	}
+	return shipment, NewParseReport(p.Name(), docText, shipment), nil
+}
+
+// DetectParserForFile extracts the text of the pdf or the spreadsheet and tells which parser is going to handle it
+func DetectParserForFile(pdfFilePath string) (DocumentParser, error) {
+	docText, err := ReadDocText(pdfFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("ERR: failed reading doc %s: %w", pdfFilePath, err)
+	}
+
+	return DetectParser(docText)
+}
@@ -0,0 +1,422 @@
+package parser
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"logistictbot/audit"
+	"logistictbot/docs"
+	"logistictbot/errlog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrNoDiff = errors.New("the field is already the same as in the document")
+
+// FieldDiff is one value that the current parser reads differently from what is stored. TaskId is 0 for the fields of the shipment itself
+type FieldDiff struct {
+	TaskId   int
+	TaskType string
+	Field    string
+	Stored   string
+	Parsed   string
+
+	value any
+}
+
+// ReparseResult compares the stored shipment with what the current parser reads from the same document.
+// Tasks that appeared or disappeared are only reported, adding or removing tasks of a running shipment is up to the manager
+type ReparseResult struct {
+	ShipmentId   int64
+	DocId        int
+	Diffs        []FieldDiff
+	NewTasks     []string
+	MissingTasks []string
+	KeptTasks    []string // only set by ApplyAmendment: missing from the document, but already started by the driver
+}
+
+func (r *ReparseResult) HasChanges() bool {
+	return len(r.Diffs) > 0 || len(r.NewTasks) > 0 || len(r.MissingTasks) > 0
+}
+
+// reparseField maps a column to the value the parser gives for it. Driver entered values (Current*), start/end and edit state are never here
+type reparseField struct {
+	column string
+	value  func(t *TaskSection) any
+}
+
+var reparseShipmentFields = []struct {
+	column string
+	value  func(s *Shipment) any
+}{
+	{"document_language", func(s *Shipment) any { return string(s.DocLang) }},
+	{"instruction_type", func(s *Shipment) any { return string(s.InstructionType) }},
+	{"container", func(s *Shipment) any { return s.Container }},
+	{"chassis", func(s *Shipment) any { return s.Chassis }},
+	{"tankdetails", func(s *Shipment) any { return s.Tankdetails }},
+	{"generalremark", func(s *Shipment) any { return s.GeneralRemark }},
+}
+
+var reparseTaskFields = []reparseField{
+	{"customer_ref", func(t *TaskSection) any { return t.CustomerReference }},
+	{"load_ref", func(t *TaskSection) any { return t.LoadReference }},
+	{"load_start_date", func(t *TaskSection) any { return formatTime(t.LoadStartDate) }},
+	{"load_end_date", func(t *TaskSection) any { return formatTime(t.LoadEndDate) }},
+	{"unload_ref", func(t *TaskSection) any { return t.UnloadReference }},
+	{"unload_start_date", func(t *TaskSection) any { return formatTime(t.UnloadStartDate) }},
+	{"unload_end_date", func(t *TaskSection) any { return formatTime(t.UnloadEndDate) }},
+	{"tank_status", func(t *TaskSection) any { return t.TankStatus }},
+	{"product", func(t *TaskSection) any { return t.Product }},
+	{"weight", func(t *TaskSection) any { return t.Weight }},
+	{"volume", func(t *TaskSection) any { return t.Volume }},
+	{"temperature", func(t *TaskSection) any { return t.Temperature }},
+	{"compartment", func(t *TaskSection) any { return t.Compartment }},
+	{"remark", func(t *TaskSection) any { return t.Remark }},
+	{"company", func(t *TaskSection) any { return t.Company }},
+}
+
+func displayReparseValue(v any) string {
+	switch val := v.(type) {
+	case string:
+		if t, err := time.Parse(time.RFC3339, val); err == nil {
+			return t.Format("02/01/2006 15:04")
+		}
+		return val
+	case int:
+		return strconv.Itoa(val)
+	}
+	return fmt.Sprint(v)
+}
+
+// GetReparsableShipmentIds gives all shipments that still have the document they were parsed from
+func GetReparsableShipmentIds(db *sql.DB) ([]int64, error) {
+	rows, err := db.Query(`SELECT id FROM shipments WHERE doc_id IS NOT NULL AND doc_id != 0 ORDER BY id DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("ERR: querying shipments with documents: %v", err)
+	}
+	defer rows.Close()
+
+	ids := make([]int64, 0)
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("ERR: scanning shipment id: %v", err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// ReparseShipment runs the current parser over the stored document of the shipment and compares the result with the db
+func ReparseShipment(db *sql.DB, shipmentId int64) (*ReparseResult, error) {
+	stored, err := GetShipment(db, shipmentId)
+	if err != nil {
+		return nil, fmt.Errorf("ERR: getting shipment %d: %v", shipmentId, err)
+	}
+	if stored.ShipmentDocId == 0 {
+		return nil, fmt.Errorf("ERR: shipment %d has no document linked", shipmentId)
+	}
+
+	f := docs.File{Id: stored.ShipmentDocId}
+	if err = f.GetFile(db); err != nil {
+		return nil, fmt.Errorf("ERR: getting document %d of shipment %d: %v", stored.ShipmentDocId, shipmentId, err)
+	}
+
+	parsed, err := GetSequenceOfTasks(f.Path)
+	if err != nil {
+		return nil, fmt.Errorf("ERR: parsing document %d of shipment %d: %w", f.Id, shipmentId, err)
+	}
+
+	return diffShipments(stored, parsed), nil
+}
+
+func diffShipments(stored, parsed *Shipment) *ReparseResult {
+	result := &ReparseResult{ShipmentId: stored.Id, DocId: stored.ShipmentDocId}
+
+	for _, field := range reparseShipmentFields {
+		storedValue, parsedValue := field.value(stored), field.value(parsed)
+		if storedValue != parsedValue {
+			result.Diffs = append(result.Diffs, FieldDiff{
+				Field:  field.column,
+				Stored: displayReparseValue(storedValue),
+				Parsed: displayReparseValue(parsedValue),
+				value:  parsedValue,
+			})
+		}
+	}
+
+	// there is only one task of every type in a shipment (see mergeDuplicateTasks)
+	storedByType := make(map[string]*TaskSection)
+	for _, t := range stored.Tasks {
+		storedByType[t.Type] = t
+	}
+	parsedTypes := make(map[string]bool)
+
+	for _, p := range parsed.Tasks {
+		parsedTypes[p.Type] = true
+		s, ok := storedByType[p.Type]
+		if !ok {
+			result.NewTasks = append(result.NewTasks, p.Type)
+			continue
+		}
+
+		// once the address was replaced (cleaning station, driver's correction) the parsed one is kept in original_address
+		addressColumn, storedAddress := "address", s.Address
+		if s.OriginalAddress != "" {
+			addressColumn, storedAddress = "original_address", s.OriginalAddress
+		}
+		if storedAddress != p.Address {
+			result.Diffs = append(result.Diffs, FieldDiff{
+				TaskId: s.Id, TaskType: s.Type, Field: addressColumn,
+				Stored: storedAddress, Parsed: p.Address, value: p.Address,
+			})
+		}
+
+		for _, field := range reparseTaskFields {
+			// the count of the listed compartments goes with them
+			if field.column == "compartment" && len(p.Compartments) > 0 {
+				continue
+			}
+			storedValue, parsedValue := field.value(s), field.value(p)
+			if storedValue != parsedValue {
+				result.Diffs = append(result.Diffs, FieldDiff{
+					TaskId: s.Id, TaskType: s.Type, Field: field.column,
+					Stored: displayReparseValue(storedValue), Parsed: displayReparseValue(parsedValue), value: parsedValue,
+				})
+			}
+		}
+
+		if storedList, parsedList := compartmentsText(comparedCompartments(s.Compartments, p.Compartments)), compartmentsText(p.Compartments); storedList != parsedList {
+			result.Diffs = append(result.Diffs, FieldDiff{
+				TaskId: s.Id, TaskType: s.Type, Field: compartmentsField,
+				Stored: storedList, Parsed: parsedList, value: p.Compartments,
+			})
+		}
+	}
+
+	for _, t := range stored.Tasks {
+		if !parsedTypes[t.Type] {
+			result.MissingTasks = append(result.MissingTasks, t.Type)
+		}
+	}
+
+	return result
+}
+
+// ApplyReparseDiff parses the document again and writes only the chosen field, so the dev can go field by field.
+// field is checked against the known columns, the ones typed by drivers can not be touched from here
+func ApplyReparseDiff(db *sql.DB, shipmentId int64, taskId int, field string, by audit.Actor) (*FieldDiff, error) {
+	result, err := ReparseShipment(db, shipmentId)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, diff := range result.Diffs {
+		if diff.TaskId != taskId || diff.Field != field {
+			continue
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			errlog.ERR.Printf("ERR: begin transaction: %v", err)
+			return nil, fmt.Errorf("ERR: begin transaction: %v", err)
+		}
+		defer tx.Rollback()
+
+		if err = applyFieldDiff(tx, shipmentId, diff, by); err != nil {
+			return nil, err
+		}
+		return &diff, tx.Commit()
+	}
+
+	return nil, ErrNoDiff
+}
+
+// ApplyAllReparseDiffs writes every field diff of the shipment in one transaction
+func ApplyAllReparseDiffs(db *sql.DB, shipmentId int64, by audit.Actor) (*ReparseResult, error) {
+	result, err := ReparseShipment(db, shipmentId)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		errlog.ERR.Printf("ERR: begin transaction: %v", err)
+		return nil, fmt.Errorf("ERR: begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	for _, diff := range result.Diffs {
+		if err = applyFieldDiff(tx, shipmentId, diff, by); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, tx.Commit()
+}
+
+func applyFieldDiff(exec *sql.Tx, shipmentId int64, diff FieldDiff, by audit.Actor) error {
+	if !isReparseColumn(diff.TaskId == 0, diff.Field) {
+		return fmt.Errorf("ERR: %s can not be changed by reparsing", diff.Field)
+	}
+	if diff.Field == compartmentsField {
+		return applyCompartmentsDiff(exec, shipmentId, diff, by)
+	}
+
+	target := audit.Target{Entity: audit.EntityShipment, Id: shipmentId, ShipmentId: shipmentId}
+	if diff.TaskId != 0 {
+		target = audit.Target{Entity: audit.EntityTask, Id: diff.TaskId, ShipmentId: shipmentId}
+	}
+	columns := []string{diff.Field}
+	if diff.TaskId != 0 && windowColumns[diff.Field] {
+		columns = append(columns, "punctuality")
+	}
+	before, err := audit.Before(exec, target, columns...)
+	if err != nil {
+		return err
+	}
+
+	if diff.TaskId == 0 {
+		_, err = exec.Exec(fmt.Sprintf(`UPDATE shipments SET %s = ?, updated_at = ? WHERE id = ?`, diff.Field), diff.value, time.Now(), shipmentId)
+	} else {
+		_, err = exec.Exec(fmt.Sprintf(`UPDATE tasks SET %s = ?, updated_at = ? WHERE id = ? AND shipment_id = ?`, diff.Field), diff.value, time.Now(), diff.TaskId, shipmentId)
+	}
+	if err != nil {
+		errlog.ERR.Printf("ERR: applying reparsed %s of shipment %d (task %d): %v\n", diff.Field, shipmentId, diff.TaskId, err)
+		return fmt.Errorf("ERR: applying reparsed %s of shipment %d (task %d): %v", diff.Field, shipmentId, diff.TaskId, err)
+	}
+
+	if diff.TaskId != 0 && diff.Field == "address" {
+		if err = updateAddressParts(exec, int64(diff.TaskId), diff.Parsed); err != nil {
+			errlog.ERR.Printf("%v\n", err)
+			return err
+		}
+	}
+
+	// a moved window is rated and alerted again, like after the editor changes it (see timingChanged)
+	if diff.TaskId != 0 && windowColumns[diff.Field] {
+		if err = resetWindow(exec, int64(diff.TaskId)); err != nil {
+			return err
+		}
+	}
+
+	// the numeric columns follow their text
+	if parse, ok := declaredQuantityParsers[diff.Field]; diff.TaskId != 0 && ok {
+		q, _ := parse(diff.Parsed)
+		_, err = exec.Exec(fmt.Sprintf(`UPDATE tasks SET %[1]s_value = ?, %[1]s_unit = ?, %[1]s_limit = ? WHERE id = ?`, diff.Field),
+			append(quantityArgs(q), diff.TaskId)...)
+		if err != nil {
+			errlog.ERR.Printf("ERR: applying reparsed %s quantity of task %d: %v\n", diff.Field, diff.TaskId, err)
+			return fmt.Errorf("ERR: applying reparsed %s quantity of task %d: %v", diff.Field, diff.TaskId, err)
+		}
+	}
+	return before.After(exec, by)
+}
+
+var windowColumns = map[string]bool{"load_start_date": true, "load_end_date": true, "unload_start_date": true, "unload_end_date": true}
+
+// resetWindow takes the timezone of the window from the site of the task again and forgets its punctuality and alert
+func resetWindow(exec audit.Executor, taskId int64) error {
+	rows, err := exec.Query(`SELECT COALESCE(NULLIF(original_address, ''), address, '') FROM tasks WHERE id = ?`, taskId)
+	if err != nil {
+		errlog.ERR.Printf("ERR: getting the site of task %d: %v\n", taskId, err)
+		return fmt.Errorf("ERR: getting the site of task %d: %v", taskId, err)
+	}
+	var address string
+	for rows.Next() {
+		err = rows.Scan(&address)
+	}
+	rows.Close()
+	if err != nil {
+		return fmt.Errorf("ERR: scanning the site of task %d: %v", taskId, err)
+	}
+
+	_, err = exec.Exec(`UPDATE tasks SET window_timezone = ?, punctuality = NULL, window_delay = NULL, window_alerted_at = NULL WHERE id = ?`,
+		AddressLocation(address).String(), taskId)
+	if err != nil {
+		errlog.ERR.Printf("ERR: resetting the window of task %d: %v\n", taskId, err)
+		return fmt.Errorf("ERR: resetting the window of task %d: %v", taskId, err)
+	}
+	return nil
+}
+
+var declaredQuantityParsers = map[string]func(string) (Quantity, bool){
+	"weight":      ParseWeight,
+	"volume":      ParseVolume,
+	"temperature": ParseTemperature,
+}
+
+func isReparseColumn(shipmentLevel bool, column string) bool {
+	if shipmentLevel {
+		for _, f := range reparseShipmentFields {
+			if f.column == column {
+				return true
+			}
+		}
+		return false
+	}
+
+	if column == "address" || column == "original_address" || column == compartmentsField {
+		return true
+	}
+	for _, f := range reparseTaskFields {
+		if f.column == column {
+			return true
+		}
+	}
+	return false
+}
+
+// compartmentsField is the diff of the compartments listed in the document, they are rows of task_compartments and not a column
+const compartmentsField = "compartments"
+
+// compartmentsText is what the document declares for the compartments, one after the other
+func compartmentsText(compartments []*TaskCompartment) string {
+	parts := make([]string, 0, len(compartments))
+	for _, c := range compartments {
+		parts = append(parts, fmt.Sprintf("%d: %s", c.Number, c.summary()))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// comparedCompartments are the stored compartments that are compared with the document. The ones it does not list anymore,
+// but the driver already measured something in, are kept (see storeCompartments), they are no difference
+func comparedCompartments(stored, parsed []*TaskCompartment) []*TaskCompartment {
+	compared := make([]*TaskCompartment, 0, len(stored))
+	for _, c := range stored {
+		listed := slices.ContainsFunc(parsed, func(p *TaskCompartment) bool { return p.Number == c.Number })
+		if listed || (c.ActualWeight == nil && c.ActualTemperature == nil) {
+			compared = append(compared, c)
+		}
+	}
+	return compared
+}
+
+// applyCompartmentsDiff writes the compartments of the document and their count, what the driver measured stays
+func applyCompartmentsDiff(tx *sql.Tx, shipmentId int64, diff FieldDiff, by audit.Actor) error {
+	compartments, _ := diff.value.([]*TaskCompartment)
+	task := &TaskSection{Id: diff.TaskId, ShipmentId: shipmentId, Compartments: compartments}
+	target := audit.Target{Entity: audit.EntityTask, Id: diff.TaskId, ShipmentId: shipmentId}
+
+	before, err := audit.Before(tx, target, "compartment")
+	if err != nil {
+		return err
+	}
+	if err = storeCompartments(tx, task); err != nil {
+		return err
+	}
+	if len(compartments) > 0 {
+		_, err = tx.Exec(`UPDATE tasks SET compartment = ?, updated_at = ? WHERE id = ? AND shipment_id = ?`, len(compartments), time.Now(), diff.TaskId, shipmentId)
+		if err != nil {
+			errlog.ERR.Printf("ERR: applying reparsed compartment count of task %d: %v\n", diff.TaskId, err)
+			return fmt.Errorf("ERR: applying reparsed compartment count of task %d: %v", diff.TaskId, err)
+		}
+	}
+	if err = before.After(tx, by); err != nil {
+		return err
+	}
+	return audit.Record(tx, by, target, audit.Change{Field: compartmentsField, Old: diff.Stored, New: diff.Parsed})
+}
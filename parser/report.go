@@ -0,0 +1,261 @@
+package parser
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+)
+
+// ShipmentIdField is not part of DetailsKeywords, the id is always taken from the "Shipment" line
+const ShipmentIdField = "shipment id"
+
+// FieldMatch shows which entry of DetailsKeywords produced a value. Task is empty for the fields of the shipment itself
+type FieldMatch struct {
+	Field   string `json:"field"`
+	Keyword string `json:"keyword"`
+	Value   string `json:"value"`
+	Task    string `json:"task,omitempty"`
+}
+
+type MissingField struct {
+	Field string `json:"field"`
+	Task  string `json:"task,omitempty"`
+}
+
+// ParseReport is shown to the manager before the shipment is stored, so half-parsed documents do not go to the drivers silently
+type ParseReport struct {
+	Parser      string         `json:"parser"`
+	Matched     []FieldMatch   `json:"matched"`
+	Missing     []MissingField `json:"missing"`
+	UnusedLines []string       `json:"unused_lines"`
+}
+
+var (
+	shipmentReportFields   = []string{Instruction, Truck, Driver, Container, Chassis, Tankdetails, GenerellerHinweis}
+	requiredShipmentFields = []string{ShipmentIdField, Instruction, Truck, Container}
+
+	taskReportFields = []string{
+		Company, TankStatus, CustomerReference, LoadReference, UnloadReference, LoadDate, UnloadDate,
+		Product, Weight, Volume, Temperature, Compartment, Remark,
+	}
+	requiredTaskFields = map[string][]string{
+		TaskLoad:     {Address, LoadReference, LoadDate, Product},
+		TaskUnload:   {Address, UnloadReference, UnloadDate},
+		TaskCollect:  {Address},
+		TaskDropoff:  {Address},
+		TaskCleaning: {Address},
+	}
+)
+
+func (r *ParseReport) IsComplete() bool {
+	return len(r.Missing) == 0
+}
+
+// NewParseReport goes over the document once more and compares it with what the parser gave back
+func NewParseReport(parserName, docText string, s *Shipment) *ParseReport {
+	r := &ParseReport{Parser: parserName}
+	used := make(map[string]bool)
+
+	lines := strings.Split(docText, "\n")
+
+	if s.Id != 0 {
+		r.Matched = append(r.Matched, FieldMatch{Field: ShipmentIdField, Keyword: "shipment", Value: strconv.FormatInt(s.Id, 10)})
+		idStr := strconv.FormatInt(s.Id, 10)
+		for _, line := range lines {
+			trimmed := strings.TrimSpace(line)
+			if strings.HasPrefix(trimmed, "Shipment") || strings.HasPrefix(trimmed, idStr) {
+				used[trimmed] = true
+			}
+		}
+	}
+
+	for _, field := range shipmentReportFields {
+		value := s.detailValue(field)
+		if value == "" {
+			continue
+		}
+		keyword := ""
+		for _, line := range lines {
+			if kw, ok := matchKeyword(field, line); ok {
+				if keyword == "" {
+					keyword = kw
+				}
+				used[strings.TrimSpace(line)] = true
+			}
+		}
+		r.Matched = append(r.Matched, FieldMatch{Field: field, Keyword: keyword, Value: value})
+	}
+
+	for _, field := range requiredShipmentFields {
+		if field == ShipmentIdField {
+			if s.Id == 0 {
+				r.Missing = append(r.Missing, MissingField{Field: field})
+			}
+			continue
+		}
+		if s.detailValue(field) == "" {
+			r.Missing = append(r.Missing, MissingField{Field: field})
+		}
+	}
+
+	if len(s.Tasks) == 0 {
+		r.Missing = append(r.Missing, MissingField{Field: "tasks"})
+	}
+
+	for _, t := range s.Tasks {
+		for i, line := range t.Lines {
+			// findAddress always takes the first three lines of the task
+			if i < 3 {
+				used[strings.TrimSpace(line)] = true
+			}
+		}
+
+		if t.Address != "" {
+			keyword := ""
+			if len(t.Lines) > 0 {
+				for _, kw := range TaskKeywords[t.Type] {
+					if strings.HasPrefix(strings.TrimSpace(t.Lines[0]), strings.ToUpper(kw)) {
+						keyword = kw
+						break
+					}
+				}
+			}
+			r.Matched = append(r.Matched, FieldMatch{Field: Address, Keyword: keyword, Value: t.Address, Task: t.Type})
+		}
+
+		for _, field := range taskReportFields {
+			value := t.detailValue(field)
+			keyword := ""
+			for _, line := range t.Lines {
+				if kw, ok := matchKeyword(field, line); ok {
+					if keyword == "" {
+						keyword = kw
+					}
+					used[strings.TrimSpace(line)] = true
+				}
+			}
+			if value != "" {
+				r.Matched = append(r.Matched, FieldMatch{Field: field, Keyword: keyword, Value: value, Task: t.Type})
+			}
+		}
+
+		for _, field := range requiredTaskFields[t.Type] {
+			if t.detailValue(field) == "" {
+				r.Missing = append(r.Missing, MissingField{Field: field, Task: t.Type})
+			}
+		}
+	}
+
+	// continuation lines of multi-line values (product, remarks) are used as well
+	multiline := strings.ToLower(html.UnescapeString(s.GeneralRemark))
+	for _, t := range s.Tasks {
+		multiline += "\n" + strings.ToLower(html.UnescapeString(t.Product+"\n"+t.Remark))
+	}
+
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || used[trimmed] {
+			continue
+		}
+		// instruction header is always in the first two lines
+		if i < 2 && s.InstructionType != "" {
+			continue
+		}
+		if strings.Contains(multiline, strings.ToLower(trimmed)) {
+			continue
+		}
+		r.UnusedLines = append(r.UnusedLines, trimmed)
+	}
+
+	return r
+}
+
+// matchKeyword checks the line the same way the parser does: lowercased, keyword at the very beginning
+func matchKeyword(field, line string) (string, bool) {
+	lower := strings.ToLower(line)
+	if field == Instruction {
+		for _, kw := range DetailsKeywords[Instruction] {
+			if strings.Contains(line, strings.ToUpper(kw)) {
+				return kw, true
+			}
+		}
+		return "", false
+	}
+
+	for _, kw := range DetailsKeywords[field] {
+		if field == Company {
+			if strings.Contains(lower, kw) {
+				return kw, true
+			}
+			continue
+		}
+		if strings.HasPrefix(lower, kw) {
+			return kw, true
+		}
+	}
+	return "", false
+}
+
+func (s *Shipment) detailValue(field string) string {
+	switch field {
+	case Instruction:
+		return string(s.InstructionType)
+	case Truck:
+		return s.CarId
+	case Driver:
+		return s.DriverName
+	case Container:
+		return s.Container
+	case Chassis:
+		return s.Chassis
+	case Tankdetails:
+		return s.Tankdetails
+	case GenerellerHinweis:
+		return strings.TrimSpace(s.GeneralRemark)
+	}
+	return ""
+}
+
+func (t *TaskSection) detailValue(field string) string {
+	switch field {
+	case Address:
+		return t.Address
+	case Company:
+		return t.Company
+	case TankStatus:
+		return t.TankStatus
+	case CustomerReference:
+		return t.CustomerReference
+	case LoadReference:
+		return t.LoadReference
+	case UnloadReference:
+		return t.UnloadReference
+	case LoadDate:
+		if t.LoadStartDate.IsZero() {
+			return ""
+		}
+		return fmt.Sprintf("%s - %s", t.LoadStartDate.Format("02/01/2006 15:04"), t.LoadEndDate.Format("15:04"))
+	case UnloadDate:
+		if t.UnloadStartDate.IsZero() {
+			return ""
+		}
+		return fmt.Sprintf("%s - %s", t.UnloadStartDate.Format("02/01/2006 15:04"), t.UnloadEndDate.Format("15:04"))
+	case Product:
+		return t.Product
+	case Weight:
+		return t.Weight
+	case Volume:
+		return t.Volume
+	case Temperature:
+		return t.Temperature
+	case Compartment:
+		if t.Compartment == 0 {
+			return ""
+		}
+		return strconv.Itoa(t.Compartment)
+	case Remark:
+		return strings.TrimSpace(t.Remark)
+	}
+	return ""
+}
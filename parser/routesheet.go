@@ -0,0 +1,130 @@
+package parser
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"io"
+	"logistictbot/config"
+	"time"
+)
+
+// The route sheet is the paper version of the shipment for the drivers, a printable html page (A4 landscape)
+// with a row per task and empty columns to write the arrival, the departure and the signature by hand
+
+//go:embed templates/routesheet.html
+var routeSheetFS embed.FS
+
+type routeSheetTask struct {
+	Title       string
+	Company     string
+	Address     string
+	Destination string
+	References  []string
+	WindowStart string
+	WindowEnd   string
+	Product     string
+	Quantities  []string
+	TankStatus  string
+	Compartment int
+	Remark      string
+}
+
+type routeSheet struct {
+	Lang     config.LangCode
+	Shipment *Shipment
+	Tasks    []routeSheetTask
+	Printed  string
+	Zone     string
+}
+
+// RenderRouteSheet writes the route sheet of the shipment in lang, the windows are shown in loc
+func RenderRouteSheet(w io.Writer, s *Shipment, lang config.LangCode, loc *time.Location) error {
+	tmpl, err := template.New("routesheet.html").Funcs(template.FuncMap{
+		"t":   func(key string) string { return config.Translate(lang, "sheet:"+key) },
+		"inc": func(i int) int { return i + 1 },
+	}).ParseFS(routeSheetFS, "templates/routesheet.html")
+	if err != nil {
+		return fmt.Errorf("ERR: parsing the route sheet template: %v", err)
+	}
+
+	sheet := routeSheet{
+		Lang:     lang,
+		Shipment: s,
+		Printed:  time.Now().In(loc).Format("02.01.2006 15:04"),
+		Zone:     loc.String(),
+	}
+	for _, t := range s.Tasks {
+		sheet.Tasks = append(sheet.Tasks, newRouteSheetTask(t, lang, loc))
+	}
+
+	if err = tmpl.Execute(w, sheet); err != nil {
+		return fmt.Errorf("ERR: rendering the route sheet of shipment %d: %v", s.Id, err)
+	}
+	return nil
+}
+
+// RouteSheet is RenderRouteSheet into bytes, for sending it as a document
+func RouteSheet(s *Shipment, lang config.LangCode, loc *time.Location) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := RenderRouteSheet(&buf, s, lang, loc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func newRouteSheetTask(t *TaskSection, lang config.LangCode, loc *time.Location) routeSheetTask {
+	row := routeSheetTask{
+		Title:       TaskTypeTitle(lang, t.Type),
+		Company:     t.Company,
+		Address:     t.Address,
+		Destination: t.DestinationAddress,
+		Product:     t.Product,
+		TankStatus:  t.TankStatus,
+		Compartment: t.Compartment,
+		Remark:      t.Remark,
+	}
+
+	references := []struct {
+		key, value string
+	}{
+		{"customer_ref", t.CustomerReference},
+		{"load_ref", t.LoadReference},
+		{"unload_ref", t.UnloadReference},
+	}
+	for _, ref := range references {
+		if ref.value != "" {
+			row.References = append(row.References, fmt.Sprintf("%s: %s", config.Translate(lang, "sheet:"+ref.key), ref.value))
+		}
+	}
+
+	start, end := t.LoadStartDate, t.LoadEndDate
+	if t.Type == TaskUnload || (start.IsZero() && !t.UnloadStartDate.IsZero()) {
+		start, end = t.UnloadStartDate, t.UnloadEndDate
+	}
+	row.WindowStart = routeSheetTime(start, loc)
+	row.WindowEnd = routeSheetTime(end, loc)
+
+	quantities := []struct {
+		key, value string
+	}{
+		{"weight", t.Weight},
+		{"volume", t.Volume},
+		{"temperature", t.Temperature},
+	}
+	for _, q := range quantities {
+		if q.value != "" {
+			row.Quantities = append(row.Quantities, fmt.Sprintf("%s: %s", config.Translate(lang, "sheet:"+q.key), q.value))
+		}
+	}
+
+	return row
+}
+
+func routeSheetTime(t time.Time, loc *time.Location) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.In(loc).Format("02.01.2006 15:04")
+}
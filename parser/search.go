@@ -0,0 +1,101 @@
+package parser
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"logistictbot/errlog"
+	"strings"
+	"unicode"
+)
+
+// ErrSearchUnavailable is when there is no search index, the bot was built without the fts5 of sqlite (see db.CheckSearchTables)
+var ErrSearchUnavailable = errors.New("the search index is not there, build the bot with -tags sqlite_fts5")
+
+// the snippet of the hit has the matched words between these, Highlight puts the markup in their place
+const (
+	snippetOpen  = "\x02"
+	snippetClose = "\x03"
+)
+
+// SearchHit is a shipment, or a task of it, that matched the search. The better the match, the lower the Rank
+type SearchHit struct {
+	ShipmentId int64
+	TaskId     int    `json:",omitempty"` // 0 when it is the shipment itself that matched
+	TaskType   string `json:",omitempty"`
+	Rank       float64
+	snippet    string
+}
+
+// Highlight is the text around the match escaped for html, with the matched words between open and close
+func (h *SearchHit) Highlight(open, close string) string {
+	return strings.NewReplacer(snippetOpen, open, snippetClose, close).Replace(html.EscapeString(h.snippet))
+}
+
+// ftsQuery makes what the manager wrote an fts5 query: every word has to be there, and may be the start of a longer one
+// (a part of a container number). The words are quoted, so the dashes and the quotes of the references are not the syntax of fts5
+func ftsQuery(text string) string {
+	words := make([]string, 0)
+	for _, w := range strings.Fields(text) {
+		if !strings.ContainsFunc(w, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) {
+			continue
+		}
+		words = append(words, `"`+strings.ReplaceAll(w, `"`, `""`)+`"*`)
+	}
+	return strings.Join(words, " ")
+}
+
+// Search looks for the text in the references, container, products, addresses and remarks of the shipments and their
+// tasks, the best matches first. The references and the container weigh the most
+func Search(db *sql.DB, text string, limit int) ([]*SearchHit, error) {
+	query := ftsQuery(text)
+	if query == "" {
+		return []*SearchHit{}, nil
+	}
+
+	// the tables stay in the db when the bot is built again without fts5, but can not be read then
+	var indexes int
+	err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name IN ('shipments_fts', 'tasks_fts')
+		AND sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&indexes)
+	if err != nil {
+		return nil, fmt.Errorf("ERR: checking the search index: %v", err)
+	}
+	if indexes != 2 {
+		return nil, ErrSearchUnavailable
+	}
+
+	rows, err := db.Query(`
+		SELECT rowid, 0, '', snippet(shipments_fts, -1, ?, ?, '…', 10),
+		       bm25(shipments_fts, 10.0, 10.0, 5.0, 2.0, 1.0, 5.0) AS rank
+		FROM shipments_fts
+		WHERE shipments_fts MATCH ?
+		UNION ALL
+		SELECT t.shipment_id, t.id, t.type, snippet(tasks_fts, -1, ?, ?, '…', 10),
+		       bm25(tasks_fts, 10.0, 10.0, 10.0, 4.0, 3.0, 2.0, 2.0, 1.0) AS rank
+		FROM tasks_fts
+		JOIN tasks t ON t.id = tasks_fts.rowid
+		WHERE tasks_fts MATCH ?
+		ORDER BY rank
+		LIMIT ?`,
+		snippetOpen, snippetClose, query, snippetOpen, snippetClose, query, limit)
+	if err != nil {
+		errlog.ERR.Printf("ERR: searching for %q: %v\n", text, err)
+		return nil, fmt.Errorf("ERR: searching for %q: %v", text, err)
+	}
+	defer rows.Close()
+
+	hits := make([]*SearchHit, 0)
+	for rows.Next() {
+		var (
+			h        = new(SearchHit)
+			taskType sql.NullString
+		)
+		if err = rows.Scan(&h.ShipmentId, &h.TaskId, &taskType, &h.snippet, &h.Rank); err != nil {
+			return nil, fmt.Errorf("ERR: scanning a search hit: %v", err)
+		}
+		h.TaskType = taskType.String
+		hits = append(hits, h)
+	}
+	return hits, rows.Err()
+}
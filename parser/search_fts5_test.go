@@ -0,0 +1,82 @@
+//go:build sqlite_fts5
+
+package parser_test
+
+import (
+	"database/sql"
+	"testing"
+
+	"logistictbot/db"
+	"logistictbot/parser"
+)
+
+func openSearchDB(t *testing.T) *sql.DB {
+	t.Helper()
+	s := openTestDB(t)
+	if err := db.CheckSearchTables(s); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSearch(t *testing.T) {
+	s := openSearchDB(t)
+	mustExec(t, s, `INSERT INTO shipments (id, instruction_type, car_id, driver_id, container) VALUES (4334001, 'x', 'CAR1', '', 'HOYU 654321-0')`)
+	mustExec(t, s, `INSERT INTO shipments (id, instruction_type, car_id, driver_id, container) VALUES (4334002, 'x', 'CAR2', '', 'HOYU 111111-1')`)
+	mustExec(t, s, `INSERT INTO tasks (id, type, shipment_id, unload_ref, product, address) VALUES (1, 'unload', 4334001, 'ELR-55120', 'METHANOL', 'INEOS KÖLN GMBH, DE-50769 KÖLN')`)
+	mustExec(t, s, `INSERT INTO tasks (id, type, shipment_id, load_ref, product, address) VALUES (2, 'load', 4334002, 'LR-1', 'ETHANOL', 'BASF SE, DE-67056 LUDWIGSHAFEN')`)
+
+	tests := []struct {
+		name       string
+		text       string
+		wantShip   []int64
+		wantTaskId int // of the first hit
+	}{
+		{"start of the container number", "654321", []int64{4334001}, 0},
+		{"reference of the task", "elr-55120", []int64{4334001}, 1},
+		{"without the diacritics", "koln methanol", []int64{4334001}, 1},
+		{"every word has to be there", "basf methanol", nil, 0},
+		{"nothing to search for", " - ", nil, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits, err := parser.Search(s, tt.text, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(hits) != len(tt.wantShip) {
+				t.Fatalf("got %d hits, want %d", len(hits), len(tt.wantShip))
+			}
+			for i, h := range hits {
+				if h.ShipmentId != tt.wantShip[i] {
+					t.Errorf("hit %d is shipment %d, want %d", i, h.ShipmentId, tt.wantShip[i])
+				}
+			}
+			if len(hits) > 0 && hits[0].TaskId != tt.wantTaskId {
+				t.Errorf("first hit is task %d, want %d", hits[0].TaskId, tt.wantTaskId)
+			}
+		})
+	}
+
+	// the triggers keep the index up to date
+	mustExec(t, s, `UPDATE tasks SET product = 'ACETONE' WHERE id = 2`)
+	mustExec(t, s, `DELETE FROM tasks WHERE id = 1`)
+	for text, want := range map[string]int{"acetone": 1, "ethanol": 0, "elr-55120": 0} {
+		hits, err := parser.Search(s, text, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(hits) != want {
+			t.Errorf("%q after the changes: got %d hits, want %d", text, len(hits), want)
+		}
+	}
+
+	hits, err := parser.Search(s, "acetone", 10)
+	if err != nil || len(hits) != 1 {
+		t.Fatalf("acetone: %v, %v", hits, err)
+	}
+	if got := hits[0].Highlight("<b>", "</b>"); got != "<b>ACETONE</b>" {
+		t.Errorf("highlight = %q", got)
+	}
+}
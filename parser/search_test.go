@@ -0,0 +1,22 @@
+package parser
+
+import "testing"
+
+func TestFTSQuery(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"MSCU1234567", `"MSCU1234567"*`},
+		{"  basf   ludwigshafen ", `"basf"* "ludwigshafen"*`},
+		{`REF-12/3 "quoted"`, `"REF-12/3"* """quoted"""*`},
+		{"- NOT ( )", `"NOT"*`},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := ftsQuery(tt.text); got != tt.want {
+			t.Errorf("ftsQuery(%q) = %s, want %s", tt.text, got, tt.want)
+		}
+	}
+}
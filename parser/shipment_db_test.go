@@ -0,0 +1,98 @@
+package parser_test
+
+import (
+	"errors"
+	"logistictbot/audit"
+	"logistictbot/db"
+	"logistictbot/parser"
+	"testing"
+
+	"github.com/gofrs/uuid"
+)
+
+func TestDeleteShipmentWithForeignKeys(t *testing.T) {
+	s := openTestDB(t)
+	// with the foreign keys on, the co-drivers need the tables they reference
+	for _, check := range []func(db.DBExecutor) error{db.CheckUsersTable, db.CheckCarsTable, db.CheckDriversTable} {
+		if err := check(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cleaning := &parser.TaskSection{Type: parser.TaskCleaning, Address: "TANKREINIGUNG, DE-67063 LUDWIGSHAFEN"}
+	shipment := storeTestShipment(t, s, 4334008, compartmentLoad("METHANOL", "ETHANOL"), cleaning)
+
+	mustExec(t, s, `INSERT INTO shipment_drivers (shipment_id, driver_id) VALUES (4334008, '6f1c2f2e-8a4e-4a57-9a43-0a4d3d6e2b11')`)
+	mustExec(t, s, `INSERT INTO task_cleanings (task_id, ecd_number) SELECT id, 'ECD-1' FROM tasks WHERE shipment_id = 4334008 AND type = 'cleaning'`)
+	mustExec(t, s, `INSERT INTO files (id, name, original_name, path, filetype, mimetype) VALUES (1, 'cmr.pdf', 'cmr.pdf', '/tmp/cmr.pdf', 'document', 'application/pdf')`)
+	mustExec(t, s, `INSERT INTO task_docs (file_id, task_id) SELECT 1, id FROM tasks WHERE shipment_id = 4334008 AND type = 'load'`)
+
+	// main turns them on, the pragma is per connection
+	s.SetMaxOpenConns(1)
+	mustExec(t, s, `PRAGMA foreign_keys = ON`)
+	var on bool
+	if err := s.QueryRow(`PRAGMA foreign_keys`).Scan(&on); err != nil || !on {
+		t.Fatalf("foreign keys are not on: %v", err)
+	}
+
+	if err := shipment.DeleteShipment(s, audit.System); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"shipments", "tasks", "shipment_status_history", "shipment_drivers", "task_compartments", "task_cleanings", "task_docs"} {
+		var n int
+		if err := s.QueryRow(`SELECT COUNT(*) FROM ` + table).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		if n != 0 {
+			t.Errorf("%d rows of %s are left", n, table)
+		}
+	}
+
+	// the document sent again starts a new history, stored without the truck and the driver it references
+	mustExec(t, s, `PRAGMA foreign_keys = OFF`)
+	storeTestShipment(t, s, 4334008)
+	history, err := parser.GetStatusHistory(s, 4334008)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 {
+		t.Errorf("got %d status changes, want only the one of the new shipment", len(history))
+	}
+}
+
+func TestAssignDraft(t *testing.T) {
+	s := openTestDB(t)
+	// stored for fixing in the editor, not given to the driver yet
+	draft := testShipment(4334009)
+	draft.CarId = ""
+	if err := draft.StoreShipment(s, audit.System); err != nil {
+		t.Fatal(err)
+	}
+	if draft.Status != parser.StatusDraft {
+		t.Fatalf("status = %s, want draft", draft.Status)
+	}
+
+	driverId := uuid.Must(uuid.NewV4())
+	if err := draft.Assign(s, driverId, "CAR2", audit.System); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := parser.GetShipment(s, 4334009)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != parser.StatusAssigned || stored.DriverId != driverId || stored.CarId != "CAR2" {
+		t.Errorf("shipment is %s for %s in %s, want assigned for %s in CAR2", stored.Status, stored.DriverId, stored.CarId, driverId)
+	}
+	history, err := parser.GetStatusHistory(s, 4334009)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[1].From != parser.StatusDraft || history[1].To != parser.StatusAssigned {
+		t.Errorf("history = %+v, want the draft assigned", history)
+	}
+
+	// an assigned shipment is not a draft to assign anymore
+	if err = stored.Assign(s, uuid.Must(uuid.NewV4()), "CAR3", audit.System); !errors.Is(err, parser.ErrStatusTransition) {
+		t.Errorf("assigning it again gave %v, want ErrStatusTransition", err)
+	}
+}
@@ -0,0 +1,658 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ex "github.com/xuri/excelize/v2"
+)
+
+// Spreadsheet orders are turned into text the same way the pdfs are: one row per line, the cells split by a tab.
+// That way they go through the registry, the review, the reparse and the amendments like any other document,
+// the column mappings in importmappings/ are registered as parsers next to the pdf ones
+
+// the columns an import mapping can have on top of the DetailsKeywords fields
+const (
+	ImportTaskType    = "task"         // load, unload ... or any task keyword of the dictionaries
+	ImportReference   = "reference"    // load or unload reference, by the type of the task
+	ImportWindowStart = "window start" // load or unload window, by the type of the task
+	ImportWindowEnd   = "window end"
+	ImportParserName  = "import:" // + sender
+)
+
+var importShipmentFields = []string{ShipmentIdField, Truck, Driver, Container, Chassis, Tankdetails, GenerellerHinweis}
+
+var importTaskFields = []string{
+	ImportTaskType, Address, Company, Destination, TankStatus, CustomerReference, ImportReference, LoadReference, UnloadReference,
+	LoadDate, UnloadDate, ImportWindowStart, ImportWindowEnd, Product, Weight, Volume, Temperature, Compartment, Remark,
+}
+
+var importDateLayouts = []string{
+	"02/01/2006 15:04", "02.01.2006 15:04", "02-01-2006 15:04", "2006-01-02 15:04", "2006-01-02T15:04", "1/2/06 15:04",
+	"02/01/2006", "02.01.2006", "2006-01-02",
+}
+
+// headerList is one header or several ones, the values of several columns are joined with ", " ("Street", "Postcode", "City")
+type headerList []string
+
+func (h *headerList) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*h = headerList{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*h = many
+	return nil
+}
+
+// ImportMapping is one importmappings/<sender>.json, it says which column of the sender's spreadsheet is which field.
+// Every row is one task, the shipment fields are taken from the first row that has them.
+// testdata/importmappings/example.json is an example, it is not in importmappings/ so it is not registered
+type ImportMapping struct {
+	Sender      string                `json:"sender"`
+	Language    Language              `json:"language"`
+	Instruction string                `json:"instruction"`
+	HeaderRow   int                   `json:"header_row"` // 1 based, 1 if not set
+	DateLayout  string                `json:"date_layout"`
+	Columns     map[string]headerList `json:"columns"`
+
+	file string
+}
+
+var (
+	importMappingsMu sync.Mutex
+	importParsers    []string
+)
+
+// ImportParser reads the spreadsheet orders of one sender through its mapping
+type ImportParser struct {
+	mapping ImportMapping
+}
+
+// IsSpreadsheet says if the file is read as a spreadsheet order instead of a pdf
+func IsSpreadsheet(filePath string) bool {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".xlsx", ".xlsm", ".csv":
+		return true
+	}
+	return false
+}
+
+// ReadDocText gives the text of an order document, whatever format it came in
+func ReadDocText(filePath string) (string, error) {
+	if IsSpreadsheet(filePath) {
+		return ReadSpreadsheetText(filePath)
+	}
+	return ReadPdfDoc(filePath)
+}
+
+// ReadSpreadsheetText reads the first sheet of an xlsx or a whole csv into tab separated lines
+func ReadSpreadsheetText(filePath string) (string, error) {
+	var rows [][]string
+
+	if strings.ToLower(filepath.Ext(filePath)) == ".csv" {
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			return "", fmt.Errorf("ERR: reading %s: %v", filePath, err)
+		}
+		data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+		r := csv.NewReader(bytes.NewReader(data))
+		r.Comma = csvDelimiter(data)
+		r.FieldsPerRecord = -1
+		r.LazyQuotes = true
+		rows, err = r.ReadAll()
+		if err != nil {
+			return "", fmt.Errorf("ERR: reading csv %s: %v", filePath, err)
+		}
+	} else {
+		f, err := ex.OpenFile(filePath)
+		if err != nil {
+			return "", fmt.Errorf("ERR: opening spreadsheet %s: %v", filePath, err)
+		}
+		defer f.Close()
+
+		sheets := f.GetSheetList()
+		if len(sheets) == 0 {
+			return "", fmt.Errorf("ERR: spreadsheet %s has no sheets", filePath)
+		}
+		rows, err = f.GetRows(sheets[0])
+		if err != nil {
+			return "", fmt.Errorf("ERR: reading sheet %s of %s: %v", sheets[0], filePath, err)
+		}
+	}
+
+	var text strings.Builder
+	cleaner := strings.NewReplacer("\t", " ", "\r\n", " ", "\n", " ", "\r", " ")
+	for _, row := range rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cells[i] = strings.TrimSpace(cleaner.Replace(cell))
+		}
+		text.WriteString(strings.Join(cells, "\t"))
+		text.WriteString("\n")
+	}
+	return text.String(), nil
+}
+
+// csvDelimiter picks the one of ; , and tab that the first line has the most of, excel writes ; in most of europe
+func csvDelimiter(data []byte) rune {
+	firstLine, _, _ := bytes.Cut(data, []byte("\n"))
+	best, bestCount := ',', 0
+	for _, d := range []rune{';', ',', '\t'} {
+		if n := bytes.Count(firstLine, []byte(string(d))); n > bestCount {
+			best, bestCount = d, n
+		}
+	}
+	return best
+}
+
+// LoadImportMappings reads every *.json in dir and registers a parser for each of them instead of the previous ones.
+// A directory that does not exist just means there are no spreadsheet senders
+func LoadImportMappings(dir string) ([]string, error) {
+	if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+		setImportParsers(nil)
+		return nil, nil
+	}
+
+	fsys := os.DirFS(dir)
+	files, err := fs.Glob(fsys, "*.json")
+	if err != nil {
+		return nil, fmt.Errorf("ERR: listing import mappings: %v", err)
+	}
+
+	mappings := make([]ImportMapping, 0, len(files))
+	senders := make(map[string]string)
+	var errs []error
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, fmt.Errorf("ERR: reading %s: %v", file, err)
+		}
+
+		var m ImportMapping
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err = decoder.Decode(&m); err != nil {
+			return nil, fmt.Errorf("ERR: decoding %s: %v", file, err)
+		}
+		m.file = path.Join(dir, file)
+
+		if other, ok := senders[m.Sender]; ok {
+			errs = append(errs, fmt.Errorf("%s: sender %q is already in %s", file, m.Sender, other))
+			continue
+		}
+		senders[m.Sender] = file
+
+		if err = m.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", file, err))
+			continue
+		}
+		mappings = append(mappings, m)
+	}
+	if err = errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	setImportParsers(mappings)
+
+	loaded := make([]string, 0, len(mappings))
+	for _, m := range mappings {
+		loaded = append(loaded, m.Sender)
+	}
+	sort.Strings(loaded)
+	return loaded, nil
+}
+
+func setImportParsers(mappings []ImportMapping) {
+	importMappingsMu.Lock()
+	defer importMappingsMu.Unlock()
+
+	for _, name := range importParsers {
+		UnregisterParser(name)
+	}
+	importParsers = importParsers[:0]
+	// every one goes first, so they are put in backwards to keep the order of the mappings
+	for i := len(mappings) - 1; i >= 0; i-- {
+		p := ImportParser{mapping: mappings[i]}
+		registerParserFirst(p)
+		importParsers = append(importParsers, p.Name())
+	}
+}
+
+func (m *ImportMapping) validate() error {
+	var errs []error
+	if m.Sender == "" {
+		errs = append(errs, fmt.Errorf("sender is not set"))
+	}
+	if m.Language == "" {
+		m.Language = English
+	}
+	if !Language(m.Language).IsValid() {
+		errs = append(errs, fmt.Errorf("language %q has no keyword dictionary", m.Language))
+	}
+	if m.HeaderRow == 0 {
+		m.HeaderRow = 1
+	}
+	if m.HeaderRow < 0 {
+		errs = append(errs, fmt.Errorf("header_row has to be 1 or more"))
+	}
+
+	known := append(append([]string{}, importShipmentFields...), importTaskFields...)
+	for _, field := range sortedHeaderKeys(m.Columns) {
+		if !containsString(known, field) {
+			errs = append(errs, fmt.Errorf("unknown field %q, known are %s", field, strings.Join(known, ", ")))
+		}
+		if len(m.Columns[field]) == 0 {
+			errs = append(errs, fmt.Errorf("field %q has no columns", field))
+		}
+	}
+	for _, required := range []string{ShipmentIdField, ImportTaskType, Address} {
+		if len(m.Columns[required]) == 0 {
+			errs = append(errs, fmt.Errorf("the %q column is required", required))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (p ImportParser) Name() string {
+	return ImportParserName + p.mapping.Sender
+}
+
+// Detect takes the spreadsheet if its header row has every column of the mapping
+func (p ImportParser) Detect(docText string) bool {
+	_, ok := p.columnIndexes(docText)
+	return ok
+}
+
+func (p ImportParser) headerCells(docText string) []string {
+	lines := strings.Split(docText, "\n")
+	if len(lines) < p.mapping.HeaderRow {
+		return nil
+	}
+	return strings.Split(lines[p.mapping.HeaderRow-1], "\t")
+}
+
+// columnIndexes maps every field of the mapping to the indexes of its columns in the header row
+func (p ImportParser) columnIndexes(docText string) (map[string][]int, bool) {
+	headers := p.headerCells(docText)
+	if len(headers) < 2 {
+		return nil, false
+	}
+
+	byHeader := make(map[string]int)
+	for i, h := range headers {
+		byHeader[normalizeHeader(h)] = i
+	}
+
+	indexes := make(map[string][]int)
+	for field, columns := range p.mapping.Columns {
+		for _, column := range columns {
+			i, ok := byHeader[normalizeHeader(column)]
+			if !ok {
+				return nil, false
+			}
+			indexes[field] = append(indexes[field], i)
+		}
+	}
+	return indexes, true
+}
+
+func normalizeHeader(h string) string {
+	return strings.Join(strings.Fields(strings.ToLower(h)), " ")
+}
+
+type importRow struct {
+	number int // 1 based, the way the spreadsheet shows it
+	cells  []string
+}
+
+func (p ImportParser) dataRows(docText string) []importRow {
+	rows := make([]importRow, 0)
+	for i, line := range strings.Split(docText, "\n") {
+		if i < p.mapping.HeaderRow || strings.TrimSpace(line) == "" {
+			continue
+		}
+		rows = append(rows, importRow{number: i + 1, cells: strings.Split(line, "\t")})
+	}
+	return rows
+}
+
+func (r importRow) value(indexes map[string][]int, field string) string {
+	values := make([]string, 0, len(indexes[field]))
+	for _, i := range indexes[field] {
+		if i < len(r.cells) && strings.TrimSpace(r.cells[i]) != "" {
+			values = append(values, strings.TrimSpace(r.cells[i]))
+		}
+	}
+	return strings.Join(values, ", ")
+}
+
+func (p ImportParser) Parse(docText string) (*Shipment, error) {
+	indexes, ok := p.columnIndexes(docText)
+	if !ok {
+		return nil, fmt.Errorf("ERR: the header row does not have the columns of %s", p.mapping.file)
+	}
+
+	s := &Shipment{DocLang: p.mapping.Language, InstructionType: InstructionType(p.mapping.Instruction)}
+	if s.InstructionType == "" {
+		s.InstructionType = InstructionType("ORDER " + strings.ToUpper(p.mapping.Sender))
+	}
+
+	seenTypes := make(map[string]int)
+	for _, row := range p.dataRows(docText) {
+		idValue := row.value(indexes, ShipmentIdField)
+		if idValue == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(leadingDigits(idValue), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("ERR: row %d: shipment %q is not a number", row.number, idValue)
+		}
+		if s.Id == 0 {
+			s.Id = id
+		} else if s.Id != id {
+			return nil, fmt.Errorf("ERR: row %d is for shipment %d, but the file is for %d, send one shipment per file", row.number, id, s.Id)
+		}
+
+		for _, field := range importShipmentFields {
+			if v := row.value(indexes, field); v != "" {
+				s.setImportValue(field, v)
+			}
+		}
+
+		t, err := p.parseTaskRow(row, indexes)
+		if err != nil {
+			return nil, err
+		}
+		if first, ok := seenTypes[t.Type]; ok {
+			return nil, fmt.Errorf("ERR: rows %d and %d are both %s, a shipment has one task of a type", first, row.number, t.Type)
+		}
+		seenTypes[t.Type] = row.number
+		t.ShipmentId = s.Id
+		s.Tasks = append(s.Tasks, t)
+	}
+
+	if s.Id == 0 {
+		return nil, fmt.Errorf("ERR: no row has a shipment number")
+	}
+	return s, nil
+}
+
+func (s *Shipment) setImportValue(field, value string) {
+	switch field {
+	case Truck:
+		if s.CarId == "" {
+			s.CarId = strings.ToUpper(value)
+		}
+	case Driver:
+		if s.DriverName == "" {
+			s.DriverName = strings.ToUpper(value)
+		}
+	case Container:
+		if s.Container == "" {
+			s.Container = strings.ToUpper(value)
+		}
+	case Chassis:
+		if s.Chassis == "" {
+			s.Chassis = strings.ToUpper(value)
+		}
+	case Tankdetails:
+		if s.Tankdetails == "" {
+			s.Tankdetails = value
+		}
+	case GenerellerHinweis:
+		if s.GeneralRemark == "" {
+			s.GeneralRemark = value
+		}
+	}
+}
+
+func (p ImportParser) parseTaskRow(row importRow, indexes map[string][]int) (*TaskSection, error) {
+	t := new(TaskSection)
+
+	rawType := row.value(indexes, ImportTaskType)
+	t.Type = importTaskType(rawType)
+	if t.Type == "" {
+		return nil, fmt.Errorf("ERR: row %d: %q is not a known task type", row.number, rawType)
+	}
+
+	headers := make([]string, 0)
+	for _, field := range importTaskFields {
+		v := row.value(indexes, field)
+		if v == "" {
+			continue
+		}
+		headers = append(headers, fmt.Sprintf("%s: %s", field, v))
+
+		switch field {
+		case Address:
+			t.Address = strings.ToUpper(v)
+		case Company:
+			t.Company = strings.ToUpper(v)
+		case Destination:
+			t.DestinationAddress = strings.ToUpper(v)
+		case TankStatus:
+			t.TankStatus = strings.ToUpper(v)
+		case CustomerReference:
+			t.CustomerReference = strings.ToUpper(v)
+		case LoadReference:
+			t.LoadReference = strings.ToUpper(v)
+		case UnloadReference:
+			t.UnloadReference = strings.ToUpper(v)
+		case ImportReference:
+			switch t.Type {
+			case TaskLoad:
+				t.LoadReference = strings.ToUpper(v)
+			case TaskUnload:
+				t.UnloadReference = strings.ToUpper(v)
+			}
+		case Product:
+			t.Product = v
+		case Weight:
+			t.Weight = v
+		case Volume:
+			t.Volume = v
+		case Temperature:
+			t.Temperature = v
+		case Compartment:
+			t.Compartment, _ = strconv.Atoi(leadingDigits(v))
+		case Remark:
+			t.Remark = v
+		}
+	}
+	t.Lines = headers
+	t.Content = strings.Join(headers, "\n")
+
+	t.AddressParts, _ = ParseAddress(t.Address)
+	site := t.SiteLocation()
+
+	if err := p.setImportWindows(t, row, indexes, site); err != nil {
+		return nil, fmt.Errorf("ERR: row %d: %v", row.number, err)
+	}
+
+	t.DeclaredWeight, _ = ParseWeight(t.Weight)
+	t.DeclaredVolume, _ = ParseVolume(t.Volume)
+	t.DeclaredTemperature, _ = ParseTemperature(t.Temperature)
+
+	return t, nil
+}
+
+func (p ImportParser) setImportWindows(t *TaskSection, row importRow, indexes map[string][]int, site *time.Location) error {
+	if v := row.value(indexes, LoadDate); v != "" {
+		start, end, err := parseTimeRange(v, site)
+		if err != nil {
+			return fmt.Errorf("load date %q: %v", v, err)
+		}
+		t.LoadStartDate, t.LoadEndDate = start, end
+	}
+	if v := row.value(indexes, UnloadDate); v != "" {
+		start, end, err := parseTimeRange(v, site)
+		if err != nil {
+			return fmt.Errorf("unload date %q: %v", v, err)
+		}
+		t.UnloadStartDate, t.UnloadEndDate = start, end
+	}
+
+	var start, end time.Time
+	var err error
+	if v := row.value(indexes, ImportWindowStart); v != "" {
+		if start, err = p.parseImportTime(v, site); err != nil {
+			return fmt.Errorf("window start %q: %v", v, err)
+		}
+	}
+	if v := row.value(indexes, ImportWindowEnd); v != "" {
+		if end, err = p.parseImportTime(v, site); err != nil {
+			return fmt.Errorf("window end %q: %v", v, err)
+		}
+	}
+	switch t.Type {
+	case TaskLoad:
+		if !start.IsZero() {
+			t.LoadStartDate, t.LoadEndDate = start, end
+		}
+	case TaskUnload:
+		if !start.IsZero() {
+			t.UnloadStartDate, t.UnloadEndDate = start, end
+		}
+	}
+	return nil
+}
+
+// parseImportTime reads a date in the layout of the mapping or in one of the usual ones, as the local time of the site
+func (p ImportParser) parseImportTime(value string, site *time.Location) (time.Time, error) {
+	layouts := importDateLayouts
+	if p.mapping.DateLayout != "" {
+		layouts = []string{p.mapping.DateLayout}
+	}
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, value, site); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unknown date format")
+}
+
+// importTaskType takes the type itself ("load") or any task keyword of the dictionaries ("laden")
+func importTaskType(value string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if containsString(keywordTaskTypes, value) {
+		return value
+	}
+
+	best, bestLen := "", 0
+	for _, taskType := range keywordTaskTypes {
+		for _, kw := range TaskKeywords[taskType] {
+			if strings.HasPrefix(value, kw) && len(kw) > bestLen {
+				best, bestLen = taskType, len(kw)
+			}
+		}
+	}
+	return best
+}
+
+// Report says which column filled which field, the columns the mapping does not know are listed as unused
+func (p ImportParser) Report(docText string, s *Shipment) *ParseReport {
+	r := &ParseReport{Parser: p.Name()}
+	header := func(field string) string {
+		return strings.Join(p.mapping.Columns[field], " + ")
+	}
+
+	if s.Id != 0 {
+		r.Matched = append(r.Matched, FieldMatch{Field: ShipmentIdField, Keyword: header(ShipmentIdField), Value: strconv.FormatInt(s.Id, 10)})
+	} else {
+		r.Missing = append(r.Missing, MissingField{Field: ShipmentIdField})
+	}
+	for _, field := range importShipmentFields[1:] {
+		if v := s.detailValue(field); v != "" {
+			r.Matched = append(r.Matched, FieldMatch{Field: field, Keyword: header(field), Value: v})
+		}
+	}
+	for _, field := range requiredShipmentFields {
+		if field != ShipmentIdField && s.detailValue(field) == "" {
+			r.Missing = append(r.Missing, MissingField{Field: field})
+		}
+	}
+	if len(s.Tasks) == 0 {
+		r.Missing = append(r.Missing, MissingField{Field: "tasks"})
+	}
+
+	for _, t := range s.Tasks {
+		if t.Address != "" {
+			r.Matched = append(r.Matched, FieldMatch{Field: Address, Keyword: header(Address), Value: t.Address, Task: t.Type})
+		}
+		for _, field := range taskReportFields {
+			if v := t.detailValue(field); v != "" {
+				r.Matched = append(r.Matched, FieldMatch{Field: field, Keyword: p.taskFieldHeader(field, t.Type), Value: v, Task: t.Type})
+			}
+		}
+		for _, field := range requiredTaskFields[t.Type] {
+			if t.detailValue(field) == "" {
+				r.Missing = append(r.Missing, MissingField{Field: field, Task: t.Type})
+			}
+		}
+	}
+
+	mapped := make(map[string]bool)
+	for _, columns := range p.mapping.Columns {
+		for _, c := range columns {
+			mapped[normalizeHeader(c)] = true
+		}
+	}
+	for _, h := range p.headerCells(docText) {
+		if strings.TrimSpace(h) != "" && !mapped[normalizeHeader(h)] {
+			r.UnusedLines = append(r.UnusedLines, "column: "+h)
+		}
+	}
+
+	return r
+}
+
+// taskFieldHeader is the column a report field came from, the reference and window columns are shared by the task types
+func (p ImportParser) taskFieldHeader(field, taskType string) string {
+	if columns := p.mapping.Columns[field]; len(columns) > 0 {
+		return strings.Join(columns, " + ")
+	}
+	switch {
+	case field == LoadReference && taskType == TaskLoad, field == UnloadReference && taskType == TaskUnload:
+		return strings.Join(p.mapping.Columns[ImportReference], " + ")
+	case field == LoadDate && taskType == TaskLoad, field == UnloadDate && taskType == TaskUnload:
+		return strings.Join(append(append([]string{}, p.mapping.Columns[ImportWindowStart]...), p.mapping.Columns[ImportWindowEnd]...), " + ")
+	}
+	return ""
+}
+
+func sortedHeaderKeys(m map[string]headerList) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,158 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	ex "github.com/xuri/excelize/v2"
+)
+
+const exampleOrderCSV = "Order No;Truck;Container;Stop;Company;Street;Postcode;City;Country;Reference;From;Until;Product;Weight;Volume;Temperature;Remark;Internal\n" +
+	"4051234;AB123CD;TKRU1234567;Laden;BASF SE;Carl-Bosch-Strasse 38;67056;Ludwigshafen;DE;L-77;02.03.2026 08:00;02.03.2026 14:00;Ethanol;24.000 kg;30 m3;20 °C;;x\n" +
+	"4051234;;;unload;Vopak;Sloeweg 1;4542 NM;Hoek;NL;U-88;03.03.2026 06:00;03.03.2026 10:00;Ethanol;;;;call before;y\n"
+
+func loadExampleMapping(t *testing.T) {
+	t.Helper()
+	senders, err := LoadImportMappings("testdata/importmappings")
+	if err != nil {
+		t.Fatalf("LoadImportMappings: %v", err)
+	}
+	if len(senders) == 0 || senders[0] != "example" {
+		t.Fatalf("LoadImportMappings gave %v, want the example sender", senders)
+	}
+	t.Cleanup(func() { setImportParsers(nil) })
+}
+
+func TestImportCSVOrder(t *testing.T) {
+	loadExampleMapping(t)
+
+	path := filepath.Join(t.TempDir(), "order.csv")
+	if err := os.WriteFile(path, []byte(exampleOrderCSV), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, report, err := GetSequenceOfTasksWithReport(path)
+	if err != nil {
+		t.Fatalf("GetSequenceOfTasksWithReport: %v", err)
+	}
+	if report.Parser != "import:example" {
+		t.Errorf("parser = %s, want import:example", report.Parser)
+	}
+	if s.Id != 4051234 || s.CarId != "AB123CD" || s.Container != "TKRU1234567" || s.DocLang != English {
+		t.Errorf("shipment = %d %s %s %s", s.Id, s.CarId, s.Container, s.DocLang)
+	}
+	if len(s.Tasks) != 2 {
+		t.Fatalf("got %d tasks, want 2", len(s.Tasks))
+	}
+
+	load, unload := s.Tasks[0], s.Tasks[1]
+	if load.Type != TaskLoad || unload.Type != TaskUnload {
+		t.Errorf("task types = %s, %s", load.Type, unload.Type)
+	}
+	if load.LoadReference != "L-77" || unload.UnloadReference != "U-88" {
+		t.Errorf("references = %q, %q", load.LoadReference, unload.UnloadReference)
+	}
+	if load.AddressParts.Country != CountryDE || unload.AddressParts.Postcode != "4542 NM" {
+		t.Errorf("address parts = %+v, %+v", load.AddressParts, unload.AddressParts)
+	}
+
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+	if want := time.Date(2026, 3, 2, 8, 0, 0, 0, berlin); !load.LoadStartDate.Equal(want) {
+		t.Errorf("load window starts %v, want %v", load.LoadStartDate, want)
+	}
+	if load.DeclaredWeight.IsZero() {
+		t.Errorf("weight %q was not parsed", load.Weight)
+	}
+
+	unused := strings.Join(report.UnusedLines, "|")
+	if !strings.Contains(unused, "Internal") {
+		t.Errorf("the Internal column is not reported as unused: %v", report.UnusedLines)
+	}
+}
+
+func TestImportXLSXOrder(t *testing.T) {
+	loadExampleMapping(t)
+
+	f := ex.NewFile()
+	for i, line := range strings.Split(strings.TrimSpace(exampleOrderCSV), "\n") {
+		cells := strings.Split(line, ";")
+		row := make([]any, len(cells))
+		for j, c := range cells {
+			row[j] = c
+		}
+		cell, _ := ex.CoordinatesToCellName(1, i+1)
+		if err := f.SetSheetRow("Sheet1", cell, &row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := filepath.Join(t.TempDir(), "order.xlsx")
+	if err := f.SaveAs(path); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := GetSequenceOfTasks(path)
+	if err != nil {
+		t.Fatalf("GetSequenceOfTasks: %v", err)
+	}
+	if s.Id != 4051234 || len(s.Tasks) != 2 {
+		t.Errorf("got shipment %d with %d tasks", s.Id, len(s.Tasks))
+	}
+}
+
+func TestImportGoesBeforeHoyer(t *testing.T) {
+	loadExampleMapping(t)
+
+	// the remark of the row is a copy of a Hoyer instruction, its lines end up in the text of the spreadsheet
+	header := strings.ReplaceAll(strings.SplitN(exampleOrderCSV, "\n", 2)[0], ";", "\t")
+	docText := header + "\n" +
+		"4051234\tAB123CD\t\tunload\tHoyer GmbH\tSloeweg 1\t4542 NM\tHoek\tNL\t\t\t\t\t\t\t\tUNLOAD INSTRUCTION\n" +
+		"Shipment: 4051234\t\n"
+	if !(HoyerParser{}).Detect(docText) {
+		t.Fatal("the Hoyer layout of the remark is not detected, the test does not check the order")
+	}
+
+	p, err := DetectParser(docText)
+	if err != nil {
+		t.Fatalf("DetectParser: %v", err)
+	}
+	if p.Name() != "import:example" {
+		t.Errorf("parser = %s, want import:example", p.Name())
+	}
+}
+
+func TestImportRejectsSeveralShipments(t *testing.T) {
+	loadExampleMapping(t)
+
+	text := strings.Replace(exampleOrderCSV, "4051234;;;unload", "4059999;;;unload", 1)
+	path := filepath.Join(t.TempDir(), "orders.csv")
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetSequenceOfTasks(path); err == nil {
+		t.Error("a file with two shipments was accepted")
+	}
+}
+
+func TestImportMappingValidation(t *testing.T) {
+	dir := t.TempDir()
+	bad := `{"sender": "broken", "columns": {"shipment id": "No", "address": "Address", "colour": "Colour"}}`
+	if err := os.WriteFile(filepath.Join(dir, "broken.json"), []byte(bad), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := LoadImportMappings(dir)
+	if err == nil {
+		t.Fatal("a mapping without the task column and with an unknown field was loaded")
+	}
+	for _, want := range []string{`unknown field "colour"`, `"task" column is required`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not say %s", err, want)
+		}
+	}
+	if _, ok := GetParserByName("import:broken"); ok {
+		t.Error("the broken mapping was registered")
+	}
+}
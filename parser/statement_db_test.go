@@ -0,0 +1,48 @@
+package parser_test
+
+import (
+	"logistictbot/parser"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestGroupByMonthCancelled(t *testing.T) {
+	s := openTestDB(t)
+	storeTestShipment(t, s, 4334004)
+	storeTestShipment(t, s, 4334005)
+	storeTestShipment(t, s, 4334006)
+	mustExec(t, s, `UPDATE shipments SET status = 'finished', finished = '2025-05-20 18:00:00+02:00' WHERE id = 4334004`)
+	mustExec(t, s, `UPDATE tasks SET start = '2025-05-20T08:00:00Z', end = '2025-05-20T09:00:00Z' WHERE shipment_id = 4334004`)
+	// cancelled after the load, the unload was not driven
+	mustExec(t, s, `UPDATE shipments SET status = 'cancelled' WHERE id IN (4334005, 4334006)`)
+	mustExec(t, s, `UPDATE tasks SET start = '2025-05-06T08:00:00Z', end = '2025-05-06T09:00:00Z' WHERE shipment_id = 4334005 AND type = 'load'`)
+
+	shipments, err := parser.GroupByMonth(time.May, 2025, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int64
+	for _, shipment := range shipments {
+		ids = append(ids, shipment.Id)
+	}
+	if want := []int64{4334005, 4334004}; !slices.Equal(ids, want) {
+		t.Fatalf("shipments = %v, want %v, the cancelled one without a finished task is not driven", ids, want)
+	}
+	if cancelled := shipments[0]; len(cancelled.Tasks) != 1 || cancelled.Tasks[0].Type != parser.TaskLoad {
+		t.Errorf("the cancelled shipment has %d tasks on the statement, want only the finished load", len(cancelled.Tasks))
+	}
+	if len(shipments[1].Tasks) != 2 {
+		t.Errorf("the finished shipment has %d tasks on the statement, want 2", len(shipments[1].Tasks))
+	}
+
+	// a month with only a cancelled shipment has a statement too
+	mustExec(t, s, `UPDATE tasks SET end = '2025-04-30T09:00:00Z' WHERE shipment_id = 4334005 AND type = 'load'`)
+	months, err := parser.GetAvailableMonths(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []parser.MonthYear{{Year: 2025, Month: time.May}, {Year: 2025, Month: time.April}}; !slices.Equal(months, want) {
+		t.Errorf("months = %v, want %v", months, want)
+	}
+}
@@ -0,0 +1,218 @@
+package parser
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"logistictbot/audit"
+	"logistictbot/config"
+	"logistictbot/errlog"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ShipmentStatus is where the shipment is in its life, from the stored document to the invoice
+type ShipmentStatus string
+
+const (
+	StatusDraft      ShipmentStatus = "draft"       // stored, but no driver yet
+	StatusAssigned   ShipmentStatus = "assigned"    // sent to the driver
+	StatusAccepted   ShipmentStatus = "accepted"    // the driver accepted it, no task started yet
+	StatusInProgress ShipmentStatus = "in_progress" // the first task was started
+	StatusFinished   ShipmentStatus = "finished"
+	StatusInvoiced   ShipmentStatus = "invoiced"
+	StatusCancelled  ShipmentStatus = "cancelled"
+)
+
+var ShipmentStatuses = []ShipmentStatus{StatusDraft, StatusAssigned, StatusAccepted, StatusInProgress, StatusFinished, StatusInvoiced, StatusCancelled}
+
+// ActiveStatuses are the shipments that still have to be driven, the ones the active lists show
+var ActiveStatuses = []ShipmentStatus{StatusDraft, StatusAssigned, StatusAccepted, StatusInProgress}
+
+// DoneStatuses are the shipments that were driven, the ones that go into the statements
+var DoneStatuses = []ShipmentStatus{StatusFinished, StatusInvoiced}
+
+// sqlStatuses is the list of the statuses for an IN of a query, "'finished', 'invoiced'". The queries take the lists
+// above from here, so a new status can not be in one and missing from the other
+func sqlStatuses(statuses []ShipmentStatus) string {
+	quoted := make([]string, 0, len(statuses))
+	for _, st := range statuses {
+		quoted = append(quoted, "'"+string(st)+"'")
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// statusTransitions is every status a shipment can be moved to from the one it has.
+// finished -> in_progress is the undo of the driver, invoiced and cancelled are final
+var statusTransitions = map[ShipmentStatus][]ShipmentStatus{
+	StatusDraft:      {StatusAssigned, StatusCancelled},
+	StatusAssigned:   {StatusAccepted, StatusDraft, StatusCancelled},
+	StatusAccepted:   {StatusInProgress, StatusFinished, StatusCancelled},
+	StatusInProgress: {StatusFinished, StatusCancelled},
+	StatusFinished:   {StatusInProgress, StatusInvoiced},
+}
+
+var ErrStatusTransition = errors.New("status transition is not allowed")
+
+func (st ShipmentStatus) IsValid() bool {
+	return slices.Contains(ShipmentStatuses, st)
+}
+
+func (st ShipmentStatus) CanTransition(to ShipmentStatus) bool {
+	return slices.Contains(statusTransitions[st], to)
+}
+
+// Transitions are the statuses the shipment can be moved to from st
+func (st ShipmentStatus) Transitions() []ShipmentStatus {
+	return statusTransitions[st]
+}
+
+func (st ShipmentStatus) Title(lang config.LangCode) string {
+	return config.Translate(lang, "status:"+string(st))
+}
+
+// statusFromTimes is the status of a shipment stored before the status column, from what the old columns say
+func statusFromTimes(started, finished, hasDriver bool) ShipmentStatus {
+	switch {
+	case finished:
+		return StatusFinished
+	case started:
+		return StatusInProgress
+	case hasDriver:
+		return StatusAssigned
+	}
+	return StatusDraft
+}
+
+func (s *Shipment) IsActive() bool {
+	return slices.Contains(ActiveStatuses, s.Status)
+}
+
+// IsClosed is true when nothing can be done on the shipment by the driver anymore
+func (s *Shipment) IsClosed() bool {
+	return s.Status == StatusFinished || s.Status == StatusInvoiced || s.Status == StatusCancelled
+}
+
+// StatusChange is a row of shipment_status_history
+type StatusChange struct {
+	Id         int64          `json:"id"`
+	ShipmentId int64          `json:"shipment_id"`
+	From       ShipmentStatus `json:"from"`
+	To         ShipmentStatus `json:"to"`
+	ChangedBy  int64          `json:"changed_by"` // chat id of who did it, 0 when it was the bot itself
+	ChangedAt  time.Time      `json:"changed_at"`
+	Note       string         `json:"note,omitempty"`
+}
+
+// SetStatus moves the shipment to the status to, if it is allowed from the one it has, and writes it into the history.
+// by.ChatId is who the history has it changed by, 0 for the bot
+func (s *Shipment) SetStatus(db *sql.DB, to ShipmentStatus, by audit.Actor, note string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		errlog.ERR.Printf("ERR: begin transaction: %v", err)
+		return fmt.Errorf("ERR: begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err = s.setStatus(tx, to, by, note); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		errlog.ERR.Printf("ERR: commit transaction: %v", err)
+		return fmt.Errorf("ERR: commit transaction: %v", err)
+	}
+	return nil
+}
+
+// setStatus is SetStatus inside of tx, for the changes that also set other columns of the shipment
+func (s *Shipment) setStatus(tx *sql.Tx, to ShipmentStatus, by audit.Actor, note string) error {
+	from := s.Status
+	if !from.CanTransition(to) {
+		return fmt.Errorf("%w: shipment %d from %s to %s", ErrStatusTransition, s.Id, from, to)
+	}
+
+	now := time.Now()
+	// the status in the WHERE, so two changes at the same time can not both go through
+	res, err := tx.Exec(`UPDATE shipments SET status = ?, updated_at = ? WHERE id = ? AND status = ?`, string(to), now, s.Id, string(from))
+	if err != nil {
+		errlog.ERR.Printf("ERR: setting status of shipment %d: %v\n", s.Id, err)
+		return fmt.Errorf("ERR: setting status of shipment %d: %v", s.Id, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: shipment %d is not %s anymore", ErrStatusTransition, s.Id, from)
+	}
+
+	_, err = tx.Exec(`INSERT INTO shipment_status_history (shipment_id, from_status, to_status, changed_by, changed_at, note) VALUES (?, ?, ?, ?, ?, ?)`,
+		s.Id, string(from), string(to), by.ChatId, now, note)
+	if err != nil {
+		errlog.ERR.Printf("ERR: writing status history of shipment %d: %v\n", s.Id, err)
+		return fmt.Errorf("ERR: writing status history of shipment %d: %v", s.Id, err)
+	}
+
+	if err = audit.Record(tx, by, s.auditTarget(), audit.Change{Field: "status", Old: from, New: to}); err != nil {
+		return err
+	}
+
+	s.Status = to
+	s.UpdatedAt = now
+	return nil
+}
+
+// GetStatusHistory is every status change of the shipment, the oldest first
+func GetStatusHistory(db *sql.DB, shipmentId int64) ([]*StatusChange, error) {
+	rows, err := db.Query(`
+		SELECT id, shipment_id, from_status, to_status, changed_by, changed_at, note
+		FROM shipment_status_history
+		WHERE shipment_id = ?
+		ORDER BY changed_at, id`, shipmentId)
+	if err != nil {
+		return nil, fmt.Errorf("ERR: query status history of shipment %d: %v", shipmentId, err)
+	}
+	defer rows.Close()
+
+	history := make([]*StatusChange, 0)
+	for rows.Next() {
+		c := new(StatusChange)
+		var from, note, changedAt sql.NullString
+		var changedBy sql.NullInt64
+		if err = rows.Scan(&c.Id, &c.ShipmentId, &from, &c.To, &changedBy, &changedAt, &note); err != nil {
+			return nil, fmt.Errorf("ERR: scan status change: %v", err)
+		}
+		c.From = ShipmentStatus(from.String)
+		c.ChangedBy = changedBy.Int64
+		c.Note = note.String
+		if changedAt.Valid {
+			c.ChangedAt, _ = parseTimeString(changedAt.String)
+		}
+		history = append(history, c)
+	}
+	return history, rows.Err()
+}
+
+// BackfillShipmentStatuses gives the shipments stored before the status column the status their started and finished say
+func BackfillShipmentStatuses(db *sql.DB) (int, error) {
+	res, err := db.Exec(`
+		UPDATE shipments SET status = CASE
+			WHEN finished IS NOT NULL AND finished != '' THEN 'finished'
+			WHEN started IS NOT NULL AND started != '' THEN 'in_progress'
+			WHEN driver_id IS NOT NULL AND driver_id != '' AND driver_id != '00000000-0000-0000-0000-000000000000' THEN 'assigned'
+			ELSE 'draft'
+		END
+		WHERE status IS NULL OR status = ''`)
+	if err != nil {
+		errlog.ERR.Printf("ERR: backfilling shipment statuses: %v\n", err)
+		return 0, fmt.Errorf("ERR: backfilling shipment statuses: %v", err)
+	}
+
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+func parseShipmentStatus(st sql.NullString, s *Shipment) ShipmentStatus {
+	if status := ShipmentStatus(st.String); st.Valid && status.IsValid() {
+		return status
+	}
+	return statusFromTimes(!s.Started.IsZero(), !s.Finished.IsZero(), !s.DriverId.IsNil())
+}
@@ -0,0 +1,66 @@
+package parser
+
+import "testing"
+
+func TestStatusTransitions(t *testing.T) {
+	tests := []struct {
+		from, to ShipmentStatus
+		want     bool
+	}{
+		{StatusDraft, StatusAssigned, true},
+		{StatusAssigned, StatusAccepted, true},
+		{StatusAccepted, StatusInProgress, true},
+		{StatusAccepted, StatusFinished, true},
+		{StatusInProgress, StatusFinished, true},
+		{StatusFinished, StatusInProgress, true},
+		{StatusFinished, StatusInvoiced, true},
+		{StatusInProgress, StatusCancelled, true},
+		{StatusAssigned, StatusFinished, false},
+		{StatusDraft, StatusInProgress, false},
+		{StatusFinished, StatusCancelled, false},
+		{StatusInvoiced, StatusFinished, false},
+		{StatusCancelled, StatusAssigned, false},
+		{"", StatusAssigned, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.from.CanTransition(tt.to); got != tt.want {
+			t.Errorf("%q -> %q: got %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+
+	for _, st := range ShipmentStatuses {
+		for _, to := range st.Transitions() {
+			if !to.IsValid() {
+				t.Errorf("%q goes to the unknown status %q", st, to)
+			}
+		}
+	}
+}
+
+func TestStatusFromTimes(t *testing.T) {
+	tests := []struct {
+		started, finished, driver bool
+		want                      ShipmentStatus
+	}{
+		{false, false, false, StatusDraft},
+		{false, false, true, StatusAssigned},
+		{true, false, true, StatusInProgress},
+		{true, true, true, StatusFinished},
+	}
+
+	for _, tt := range tests {
+		if got := statusFromTimes(tt.started, tt.finished, tt.driver); got != tt.want {
+			t.Errorf("started %v, finished %v, driver %v: got %q, want %q", tt.started, tt.finished, tt.driver, got, tt.want)
+		}
+	}
+}
+
+func TestSqlStatuses(t *testing.T) {
+	if got, want := sqlStatuses(DoneStatuses), "'finished', 'invoiced'"; got != want {
+		t.Errorf("sqlStatuses(DoneStatuses) = %s, want %s", got, want)
+	}
+	if got, want := sqlStatuses(ActiveStatuses), "'draft', 'assigned', 'accepted', 'in_progress'"; got != want {
+		t.Errorf("sqlStatuses(ActiveStatuses) = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,158 @@
+package parser
+
+import (
+	"database/sql"
+	"fmt"
+	"logistictbot/audit"
+	"logistictbot/errlog"
+	"slices"
+	"time"
+)
+
+// TaskOrder says in which order the driver may start the tasks of a shipment
+type TaskOrder string
+
+const (
+	TaskOrderStrict           TaskOrder = "strict"             // one after another, in the order of the shipment
+	TaskOrderFree             TaskOrder = "free"               // any task at any time
+	TaskOrderLoadBeforeUnload TaskOrder = "load_before_unload" // an unload only after every load is finished
+
+	DefaultTaskOrder = TaskOrderLoadBeforeUnload
+)
+
+var TaskOrders = []TaskOrder{TaskOrderStrict, TaskOrderLoadBeforeUnload, TaskOrderFree}
+
+func (o TaskOrder) IsValid() bool {
+	return slices.Contains(TaskOrders, o)
+}
+
+// OrDefault is the order itself, or DefaultTaskOrder if it is not set or not known
+func (o TaskOrder) OrDefault() TaskOrder {
+	if o.IsValid() {
+		return o
+	}
+	return DefaultTaskOrder
+}
+
+func parseTaskOrder(s sql.NullString) TaskOrder {
+	if !s.Valid {
+		return DefaultTaskOrder
+	}
+	return TaskOrder(s.String).OrDefault()
+}
+
+// TaskBefore gives the task that has to be finished before task can be started, nil when it can be started now.
+// The tasks of s have to be in their order (the way GetShipment loads them)
+func (s *Shipment) TaskBefore(task *TaskSection) *TaskSection {
+	switch s.TaskOrder.OrDefault() {
+	case TaskOrderStrict:
+		for _, t := range s.Tasks {
+			if t.Id == task.Id {
+				return nil
+			}
+			if !t.IsFinished() {
+				return t
+			}
+		}
+	case TaskOrderLoadBeforeUnload:
+		if task.Type != TaskUnload {
+			return nil
+		}
+		for _, t := range s.Tasks {
+			if t.Type == TaskLoad && !t.IsFinished() {
+				return t
+			}
+		}
+	}
+	return nil
+}
+
+// SetTaskOrder changes the order policy of the shipment
+func SetTaskOrder(db *sql.DB, shipmentId int64, order TaskOrder, by audit.Actor) error {
+	if !order.IsValid() {
+		return fmt.Errorf("ERR: unknown task order %q", order)
+	}
+
+	target := audit.Target{Entity: audit.EntityShipment, Id: shipmentId, ShipmentId: shipmentId}
+	return auditedWrite(db, by, target, []string{"task_order"}, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`UPDATE shipments SET task_order = ?, updated_at = ? WHERE id = ?`, string(order), time.Now(), shipmentId)
+		if err != nil {
+			errlog.ERR.Printf("ERR: setting task order of shipment %d: %v\n", shipmentId, err)
+			return fmt.Errorf("ERR: setting task order of shipment %d: %v", shipmentId, err)
+		}
+		return nil
+	})
+}
+
+// MoveTaskUp swaps the task with the one before it and numbers all the tasks of the shipment again from 1
+func MoveTaskUp(db *sql.DB, shipmentId int64, taskId int, by audit.Actor) error {
+	tx, err := db.Begin()
+	if err != nil {
+		errlog.ERR.Printf("ERR: begin transaction: %v", err)
+		return fmt.Errorf("ERR: begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT id FROM tasks WHERE shipment_id = ? ORDER BY position, id`, shipmentId)
+	if err != nil {
+		errlog.ERR.Printf("ERR: getting the tasks of shipment %d to reorder: %v\n", shipmentId, err)
+		return fmt.Errorf("ERR: getting the tasks of shipment %d to reorder: %v", shipmentId, err)
+	}
+	ids := make([]int, 0)
+	for rows.Next() {
+		var id int
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("ERR: scanning task id to reorder: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("ERR: iterating tasks to reorder: %v", err)
+	}
+
+	i := slices.Index(ids, taskId)
+	if i < 0 {
+		return fmt.Errorf("ERR: task %d is not in shipment %d", taskId, shipmentId)
+	}
+	if i > 0 {
+		ids[i-1], ids[i] = ids[i], ids[i-1]
+	}
+
+	for position, id := range ids {
+		before, err := audit.Before(tx, audit.Target{Entity: audit.EntityTask, Id: id, ShipmentId: shipmentId}, "position")
+		if err != nil {
+			return err
+		}
+		if _, err = tx.Exec(`UPDATE tasks SET position = ? WHERE id = ?`, position+1, id); err != nil {
+			errlog.ERR.Printf("ERR: setting position of task %d: %v\n", id, err)
+			return fmt.Errorf("ERR: setting position of task %d: %v", id, err)
+		}
+		if err = before.After(tx, by); err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		errlog.ERR.Printf("ERR: commit transaction: %v", err)
+		return fmt.Errorf("ERR: commit transaction: %v", err)
+	}
+	return nil
+}
+
+// BackfillTaskPositions numbers the tasks stored before the position column existed in the order they were stored
+func BackfillTaskPositions(db *sql.DB) (int, error) {
+	res, err := db.Exec(`
+		UPDATE tasks SET position = (
+			SELECT COUNT(*) FROM tasks t WHERE t.shipment_id = tasks.shipment_id AND t.id <= tasks.id
+		)
+		WHERE position IS NULL`)
+	if err != nil {
+		errlog.ERR.Printf("ERR: backfilling task positions: %v\n", err)
+		return 0, fmt.Errorf("ERR: backfilling task positions: %v", err)
+	}
+
+	n, err := res.RowsAffected()
+	return int(n), err
+}
@@ -0,0 +1,52 @@
+package parser
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTaskBefore(t *testing.T) {
+	done := func(id int, taskType string) *TaskSection {
+		return &TaskSection{Id: id, Type: taskType, Start: time.Now().Add(-time.Hour), End: time.Now()}
+	}
+	todo := func(id int, taskType string) *TaskSection {
+		return &TaskSection{Id: id, Type: taskType}
+	}
+
+	tests := []struct {
+		name  string
+		order TaskOrder
+		tasks []*TaskSection
+		start int
+		want  int // id of the task that has to be finished first, 0 if none
+	}{
+		{"strict first task", TaskOrderStrict, []*TaskSection{todo(1, TaskCollect), todo(2, TaskLoad), todo(3, TaskUnload)}, 1, 0},
+		{"strict skips ahead", TaskOrderStrict, []*TaskSection{done(1, TaskCollect), todo(2, TaskLoad), todo(3, TaskUnload)}, 3, 2},
+		{"strict next one", TaskOrderStrict, []*TaskSection{done(1, TaskCollect), todo(2, TaskLoad), todo(3, TaskUnload)}, 2, 0},
+		{"unload before load", TaskOrderLoadBeforeUnload, []*TaskSection{todo(1, TaskLoad), todo(2, TaskUnload)}, 2, 1},
+		{"unload after load", TaskOrderLoadBeforeUnload, []*TaskSection{done(1, TaskLoad), todo(2, TaskUnload)}, 2, 0},
+		{"cleaning any time", TaskOrderLoadBeforeUnload, []*TaskSection{todo(1, TaskLoad), todo(2, TaskUnload), todo(3, TaskCleaning)}, 3, 0},
+		{"free", TaskOrderFree, []*TaskSection{todo(1, TaskLoad), todo(2, TaskUnload)}, 2, 0},
+		{"not set is load before unload", "", []*TaskSection{todo(1, TaskLoad), todo(2, TaskUnload)}, 2, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Shipment{TaskOrder: tt.order, Tasks: tt.tasks}
+			var task *TaskSection
+			for _, ts := range tt.tasks {
+				if ts.Id == tt.start {
+					task = ts
+				}
+			}
+
+			got := 0
+			if before := s.TaskBefore(task); before != nil {
+				got = before.Id
+			}
+			if got != tt.want {
+				t.Errorf("TaskBefore(%d) = %d, want %d", tt.start, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package parser
+
+import (
+	"database/sql"
+	"fmt"
+	"logistictbot/audit"
+	"logistictbot/errlog"
+	"slices"
+
+	"github.com/gofrs/uuid"
+)
+
+// A double manned truck drives the shipment with more than one driver. shipments.driver_id is the lead, the one the
+// document was sent to, the others are in shipment_drivers. Any of them can begin a task, it is credited to who began it
+
+// HasDriver is true for the lead and the co-drivers of the shipment
+func (s *Shipment) HasDriver(driverId uuid.UUID) bool {
+	return s.DriverId == driverId || slices.Contains(s.CoDrivers, driverId)
+}
+
+// Drivers are the lead and then the co-drivers
+func (s *Shipment) Drivers() []uuid.UUID {
+	drivers := make([]uuid.UUID, 0, len(s.CoDrivers)+1)
+	if !s.DriverId.IsNil() {
+		drivers = append(drivers, s.DriverId)
+	}
+	return append(drivers, s.CoDrivers...)
+}
+
+func AddCoDriver(db *sql.DB, shipmentId int64, driverId uuid.UUID, by audit.Actor) error {
+	res, err := db.Exec(`INSERT OR IGNORE INTO shipment_drivers (shipment_id, driver_id) VALUES (?, ?)`, shipmentId, driverId.String())
+	if err != nil {
+		errlog.ERR.Printf("ERR: adding co-driver %s to shipment %d: %v\n", driverId, shipmentId, err)
+		return fmt.Errorf("ERR: adding co-driver %s to shipment %d: %v", driverId, shipmentId, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil
+	}
+	return audit.Record(db, by, coDriverTarget(shipmentId, driverId), audit.Change{Field: "co_driver", New: driverId})
+}
+
+func RemoveCoDriver(db *sql.DB, shipmentId int64, driverId uuid.UUID, by audit.Actor) error {
+	res, err := db.Exec(`DELETE FROM shipment_drivers WHERE shipment_id = ? AND driver_id = ?`, shipmentId, driverId.String())
+	if err != nil {
+		errlog.ERR.Printf("ERR: removing co-driver %s from shipment %d: %v\n", driverId, shipmentId, err)
+		return fmt.Errorf("ERR: removing co-driver %s from shipment %d: %v", driverId, shipmentId, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil
+	}
+	return audit.Record(db, by, coDriverTarget(shipmentId, driverId), audit.Change{Field: "co_driver", Old: driverId})
+}
+
+// the co-driver changes are on the shipment, and found by the co-driver too
+func coDriverTarget(shipmentId int64, driverId uuid.UUID) audit.Target {
+	return audit.Target{Entity: audit.EntityShipment, Id: shipmentId, ShipmentId: shipmentId, DriverId: driverId.String()}
+}
+
+func loadCoDrivers(tx *sql.Tx, shipmentId int64) ([]uuid.UUID, error) {
+	rows, err := tx.Query(`SELECT driver_id FROM shipment_drivers WHERE shipment_id = ? ORDER BY added_at, driver_id`, shipmentId)
+	if err != nil {
+		return nil, fmt.Errorf("ERR: query co-drivers of shipment %d: %v", shipmentId, err)
+	}
+	defer rows.Close()
+
+	drivers := make([]uuid.UUID, 0)
+	for rows.Next() {
+		var idStr string
+		if err = rows.Scan(&idStr); err != nil {
+			return nil, fmt.Errorf("ERR: scan co-driver: %v", err)
+		}
+		id, err := uuid.FromString(idStr)
+		if err != nil {
+			return nil, fmt.Errorf("ERR: parse co-driver id %q: %v", idStr, err)
+		}
+		drivers = append(drivers, id)
+	}
+	return drivers, rows.Err()
+}
+
+// SetTaskPerformer credits the task to the driver that began it and the truck he drives
+func SetTaskPerformer(db *sql.DB, t *TaskSection, driverId uuid.UUID, carId string, by audit.Actor) error {
+	target := t.auditTarget()
+	target.DriverId = driverId.String()
+	err := auditedWrite(db, by, target, []string{"driver_id", "car_id"}, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`UPDATE tasks SET driver_id = ?, car_id = ? WHERE id = ?`, driverId.String(), carId, t.Id)
+		if err != nil {
+			errlog.ERR.Printf("ERR: setting the driver of task %d: %v\n", t.Id, err)
+			return fmt.Errorf("ERR: setting the driver of task %d: %v", t.Id, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	t.DriverId, t.CarId = driverId, carId
+	return nil
+}
@@ -1,7 +1,10 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
+	"log"
+	"logistictbot/config"
 	"logistictbot/docs"
 	"logistictbot/errlog"
 	"os/exec"
@@ -22,6 +25,7 @@ type Shipment struct {
 	Tasks           []*TaskSection
 	CarId           string
 	DriverId        uuid.UUID
+	CoDrivers       []uuid.UUID // the other drivers of a double manned truck, loaded by GetShipment
 	DriverName      string
 	ShipmentDocId   int
 	Container       string
@@ -32,6 +36,8 @@ type Shipment struct {
 	UpdatedAt       time.Time
 	Started         time.Time
 	Finished        time.Time
+	TaskOrder       TaskOrder
+	Status          ShipmentStatus
 }
 
 type TaskSection struct {
@@ -44,6 +50,14 @@ type TaskSection struct {
 	ShipmentDoc   *docs.File
 	Start         time.Time
 	End           time.Time
+	// who the task is credited to, empty while it is the driver and car of the shipment (see Shipment.HandOver)
+	DriverId uuid.UUID
+	CarId    string
+	// how the task was finished against its window, empty until it is recorded (see RecordPunctuality)
+	Punctuality Punctuality
+	WindowDelay int // minutes out of the window, negative when early
+	// when the driver said he is on the site, zero when he did not (see MarkArrived)
+	Arrived time.Time
 	// things with prefix "Current" usually mean the ones that driver wrote himself
 	CurrentKilometrage int64
 	CurrentTemperature float64
@@ -52,24 +66,33 @@ type TaskSection struct {
 	EditMessageId int
 	EditStatus    EditStatus
 	//TaskDetails
-	CustomerReference  string    `form:"Customer референс"`
-	LoadReference      string    `form:"Load референс"`
-	UnloadReference    string    `form:"Unload референс"`
-	LoadStartDate      time.Time `form:"Очікуванна дата/час початку"`
-	LoadEndDate        time.Time `form:"Очікуванна дата/час закінчення"`
-	UnloadStartDate    time.Time `form:"Очікувана дата/час початку"`
-	UnloadEndDate      time.Time `form:"Очікувана дата/час закінчення"`
-	TankStatus         string    `form:"Статус контейнера"`
-	Product            string    `form:"Продукт перевезення"`
-	Weight             string    `form:"Вага"`
-	Volume             string    `form:"Обʼєм"`
-	Temperature        string    `form:"Температура"`
-	Compartment        int       `form:"Кількість секцій"`
-	Remark             string    `form:"Нотатки"`
-	Company            string    `form:"За дорученням"`
-	Address            string    `form:"Адреса"`
-	DestinationAddress string    `form:"Адреса доставки"`
+	CustomerReference string    `form:"Customer референс"`
+	LoadReference     string    `form:"Load референс"`
+	UnloadReference   string    `form:"Unload референс"`
+	LoadStartDate     time.Time `form:"Очікуванна дата/час початку"`
+	LoadEndDate       time.Time `form:"Очікуванна дата/час закінчення"`
+	UnloadStartDate   time.Time `form:"Очікувана дата/час початку"`
+	UnloadEndDate     time.Time `form:"Очікувана дата/час закінчення"`
+	TankStatus        string    `form:"Статус контейнера"`
+	Product           string    `form:"Продукт перевезення"`
+	Weight            string    `form:"Вага"`
+	Volume            string    `form:"Обʼєм"`
+	Temperature       string    `form:"Температура"`
+	// Weight, Volume and Temperature as numbers with units, zero when the document did not have them or they could not be read
+	DeclaredWeight      Quantity
+	DeclaredVolume      Quantity
+	DeclaredTemperature Quantity
+	Compartment         int `form:"Кількість секцій"`
+	// one per compartment when the document lists them with their own product, weight and temperature (see GetTaskCompartments)
+	Compartments []*TaskCompartment
+	// the ECD of a cleaning task, nil until something of it is known (see GetCleaningRecord)
+	Cleaning           *CleaningRecord
+	Remark             string `form:"Нотатки"`
+	Company            string `form:"За дорученням"`
+	Address            string `form:"Адреса"`
+	DestinationAddress string `form:"Адреса доставки"`
 	OriginalAddress    string
+	AddressParts       AddressParts
 	CreatedAt          time.Time
 	UpdatedAt          time.Time
 }
@@ -83,50 +106,21 @@ var (
 	StatusDone     EditStatus = "done"
 )
 
+// IsValid says if the type is one of the instruction headers from the keyword dictionaries,
+// either the way it is stored ("ANWEISUNG ENTLADE") or the way it is printed in the document ("ENTLADE ANWEISUNG")
 func (it InstructionType) IsValid() bool {
-	switch it {
-
-	case "INSTRUCTIONS DE DÉCHARGEMENT":
-		return true
-	case "INSTRUCTIONS DE CHARGEMENT":
-		return true
-	case "INSTRUCTIONS DE SHUNT":
-		return true
-	case "LADE ANWEISUNG":
-		return true
-	case "ENTLADE ANWEISUNG":
-		return true
-	case "UMFUHR ANWEISUNG":
-		return true
-	case "LOAD INSTRUCTION":
-		return true
-	case "UNLOAD INSTRUCTION":
-		return true
-	case "TRANSFER INSTRUCTION":
-		return true
-	case "SHUNTING INSTRUCTION":
-		return true
-	default:
-		return false
+	keywordsMu.RLock()
+	defer keywordsMu.RUnlock()
 
-	}
+	return validInstructionTypes[it]
 }
 
+// IsValid says if there is a keyword dictionary for the language
 func (l Language) IsValid() bool {
-	switch l {
-	case French:
-		return true
-	case German:
-		return true
-	case English:
-		return true
-	case Ukrainian:
-		return true
-	case Polish:
-		return true
-	default:
-		return false
-	}
+	keywordsMu.RLock()
+	defer keywordsMu.RUnlock()
+
+	return validLanguages[l]
 }
 
 const (
@@ -137,7 +131,33 @@ const (
 	Polish    = "pl"
 )
 
-func ReadTaskShort(section *TaskSection) string {
+// formatWindowTime shows a window in the timezone of whoever reads it, with the zone so it is clear which one it is
+func formatWindowTime(t time.Time, loc *time.Location) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.In(loc).Format("2006-01-02 15:04 MST")
+}
+
+// TaskTypeTitle is the task type the way the reader of the chat calls it
+func TaskTypeTitle(lang config.LangCode, taskType string) string {
+	title := config.Translate(lang, "task_type:"+taskType)
+	if title == "task_type:"+taskType {
+		return taskType
+	}
+	return title
+}
+
+// cardLine renders one line of a shipment or task card from its locale template, the empty values are skipped
+func cardLine(lang config.LangCode, key string, value any) string {
+	if str, ok := value.(string); ok && str == "" {
+		return ""
+	}
+	return config.Translate(lang, "card:"+key, value)
+}
+
+// ReadTaskShort shows the task in lang and the windows in loc, the language and the timezone of the chat it is sent to
+func ReadTaskShort(section *TaskSection, lang config.LangCode, loc *time.Location) string {
 	var result string
 
 	if len(section.Address) > 0 {
@@ -150,43 +170,32 @@ func ReadTaskShort(section *TaskSection) string {
 			flag = GetCountryEmoji(countryCode)
 			country = GetCountryName(countryCode)
 		}
-		result += fmt.Sprintf("<b>Адреса</b>: %s; %s %s\n", section.Address, country, flag)
+		result += config.Translate(lang, "card:address_country", section.Address, country, flag)
 	}
 
-	if len(section.CustomerReference) > 0 {
-		result += fmt.Sprintf("<b>Customer</b>: %s\n", section.CustomerReference)
-	}
-	if len(section.LoadReference) > 0 {
-		result += fmt.Sprintf("<b>Load</b>: %s\n", section.LoadReference)
-	}
-	if len(section.UnloadReference) > 0 {
-		result += fmt.Sprintf("<b>Unload</b>: %s\n", section.UnloadReference)
-	}
+	result += cardLine(lang, "customer_ref", section.CustomerReference)
+	result += cardLine(lang, "load_ref", section.LoadReference)
+	result += cardLine(lang, "unload_ref", section.UnloadReference)
 
 	if len(section.LoadReference) > 0 {
-		result += fmt.Sprintf("<b>Очікуваний початок завантаження (Load)</b>: %s\n", section.LoadStartDate.Format("2006-01-02 15:04"))
-		result += fmt.Sprintf("<b>Очікуваний кінець завантаження (Load)</b>: %s\n", section.LoadEndDate.Format("2006-01-02 15:04"))
+		result += config.Translate(lang, "card:load_start", formatWindowTime(section.LoadStartDate, loc))
+		result += config.Translate(lang, "card:load_end", formatWindowTime(section.LoadEndDate, loc))
 	} else if len(section.UnloadReference) > 0 {
-		if !section.UnloadStartDate.IsZero() {
-			result += fmt.Sprintf("<b>Очікуваний початок розвантаження (Unload)</b>: %s\n", section.UnloadStartDate.Format("2006-01-02 15:04"))
-		}
-		if !section.UnloadEndDate.IsZero() {
-			result += fmt.Sprintf("<b>Очікуваний кінець розвантаження (Unload)</b>: %s\n", section.UnloadEndDate.Format("2006-01-02 15:04"))
-		}
+		result += cardLine(lang, "unload_start", formatWindowTime(section.UnloadStartDate, loc))
+		result += cardLine(lang, "unload_end", formatWindowTime(section.UnloadEndDate, loc))
 	}
 
 	if len(section.Product) > 0 {
-		result += fmt.Sprintf("<b>Продукт</b>: %s\n", section.Product)
-		result += fmt.Sprintf("<b>Вага</b>: %s\n", section.Weight)
-		result += fmt.Sprintf("<b>Обʼєм</b>: %s\n", section.Volume)
-		if len(section.Temperature) > 0 {
-			result += fmt.Sprintf("<b>Температура</b>: %s\n", section.Temperature)
-		}
+		result += config.Translate(lang, "card:product", section.Product)
+		result += config.Translate(lang, "card:weight", section.Weight)
+		result += config.Translate(lang, "card:volume", section.Volume)
+		result += cardLine(lang, "temperature", section.Temperature)
 	}
 
 	return result
 }
 
+// ReadDocAndPrint is for looking at a document from the terminal, so it is always in english
 func ReadDocAndPrint(filePath string) error {
 	var result string
 
@@ -202,13 +211,17 @@ func ReadDocAndPrint(filePath string) error {
 		return fmt.Errorf("ERR: get sequence of tasks: %v", err)
 	}
 
-	res, secRes := ReadDoc(shipment)
+	res, secRes := ReadDoc(shipment, config.English, config.WarsawLoc)
 
 	result = fmt.Sprintf("\n\n\nFILE: %s\n\n\n", filePath)
 	result += res
 
-	for k, v := range secRes {
-		result += fmt.Sprintf("Завдання: %s\n\n", k)
+	for _, task := range shipment.Tasks {
+		v, ok := secRes[task.Type]
+		if !ok {
+			continue
+		}
+		result += config.Translate(config.English, "card:task", TaskTypeTitle(config.English, task.Type))
 		for line := range strings.SplitSeq(v, "\n") {
 			result += fmt.Sprintf("%s\n", line)
 		}
@@ -232,12 +245,18 @@ func ReadDocAndSend(filePath string, chatID int64, loadingTopicId int, bot *tgbo
 		return fmt.Errorf("ERR: get sequence of tasks: %v", err)
 	}
 
-	res, secRes := ReadDoc(shipment)
+	lang := config.GetLang(chatID)
+	res, secRes := ReadDoc(shipment, lang, config.GetLoc(chatID))
 	msg := tgbotapi.NewMessage(chatID, res, loadingTopicId)
 	msg.ParseMode = tgbotapi.ModeHTML
 
-	for k, v := range secRes {
-		msg.Text += fmt.Sprintf("<i><b>Завдання: %s</b></i>\n\n", k)
+	// in the order of the document, not of the map
+	for _, task := range shipment.Tasks {
+		v, ok := secRes[task.Type]
+		if !ok {
+			continue
+		}
+		msg.Text += config.Translate(lang, "card:task", TaskTypeTitle(lang, task.Type))
 		for line := range strings.SplitSeq(v, "\n") {
 			msg.Text += fmt.Sprintf("%s\n", line)
 		}
@@ -247,68 +266,57 @@ func ReadDocAndSend(filePath string, chatID int64, loadingTopicId int, bot *tgbo
 	return err
 }
 
-// for bold
-func ReadDoc(details *Shipment) (header string, taskByType map[string]string) {
+// ReadDoc renders the shipment with the card:* templates of the locales in lang, the windows are shown in loc
+func ReadDoc(details *Shipment, lang config.LangCode, loc *time.Location) (header string, taskByType map[string]string) {
 
 	taskByType = make(map[string]string)
 
-	header += fmt.Sprintf("<b>Номер маршрут</b>:	%d\n", details.Id)
-	header += fmt.Sprintf("<b>Тип інструкції</b>:		%s\n", details.InstructionType)
-	header += fmt.Sprintf("<b>Мова документу</b>:		%s\n", details.DocLang)
-	header += fmt.Sprintf("<b>№ Авто</b>:				%s\n", details.CarId)
-	header += fmt.Sprintf("<b>Імʼя водія</b>:			%s\n", details.DriverName)
-	header += fmt.Sprintf("<b>Контейнер</b>:			%s\n", details.Container)
-	if len(details.Chassis) > 0 {
-		header += fmt.Sprintf("<b>Шасі</b>:				%s\n", details.Chassis)
-	}
-	header += fmt.Sprintf("<b>Про контейнер</b>:		%s\n", details.Tankdetails)
-	header += fmt.Sprintf("<b>Загальна нотатка</b>:	%s\n\n", details.GeneralRemark)
+	header += config.Translate(lang, "card:shipment_id", details.Id)
+	header += config.Translate(lang, "card:instruction", details.InstructionType)
+	header += config.Translate(lang, "card:doc_lang", details.DocLang)
+	header += config.Translate(lang, "card:truck", details.CarId)
+	header += config.Translate(lang, "card:driver_name", details.DriverName)
+	header += config.Translate(lang, "card:container", details.Container)
+	header += cardLine(lang, "chassis", details.Chassis)
+	header += config.Translate(lang, "card:tankdetails", details.Tankdetails)
+	header += config.Translate(lang, "card:general_remark", details.GeneralRemark) + "\n"
 
 	for _, task := range details.Tasks {
 		var temp string
 
-		if len(task.Address) > 0 {
-			temp += fmt.Sprintf("<b>Адреса</b>: %s\n", task.Address)
-		}
-
-		if len(task.DestinationAddress) > 0 {
-			temp += fmt.Sprintf("Адреса доставки: %s\n", task.DestinationAddress)
-		}
-
-		if len(task.TankStatus) > 0 {
-			temp += fmt.Sprintf("<b>Статус контейнера</b>: %s\n", task.TankStatus)
-		}
+		temp += cardLine(lang, "address", task.Address)
+		temp += cardLine(lang, "destination", task.DestinationAddress)
+		temp += cardLine(lang, "tank_status", task.TankStatus)
 
 		if len(task.CustomerReference) > 0 {
-			temp += fmt.Sprintf("<b>Customer референс</b>: %s\n", task.CustomerReference)
-			temp += fmt.Sprintf("<b>За дорученням</b>: %s\n", task.Company)
+			temp += config.Translate(lang, "card:customer_ref", task.CustomerReference)
+			temp += config.Translate(lang, "card:company", task.Company)
 		}
 
 		if len(task.LoadReference) > 0 {
-			temp += fmt.Sprintf("<b>Load референс</b>: %s\n", task.LoadReference)
-			temp += fmt.Sprintf("<b>Очікуванна дата/час початку</b>: %v\n", task.LoadStartDate.Format("2006-01-02 15:04:05"))
-			temp += fmt.Sprintf("<b>Очікуванна дата/час закінчення</b>: %v\n", task.LoadEndDate.Format("2006-01-02 15:04:05"))
+			temp += config.Translate(lang, "card:load_ref", task.LoadReference)
+			temp += config.Translate(lang, "card:window_start", formatWindowTime(task.LoadStartDate, loc))
+			temp += config.Translate(lang, "card:window_end", formatWindowTime(task.LoadEndDate, loc))
 		}
 
 		if len(task.UnloadReference) > 0 {
-			temp += fmt.Sprintf("<b>Unload референс</b>: %s\n", task.UnloadReference)
-			temp += fmt.Sprintf("<b>Очікувана дата/час початку</b>: %s\n", task.UnloadStartDate)
-			temp += fmt.Sprintf("<b>Очікувана дата/час закінчення</b>: %s\n", task.UnloadEndDate)
+			temp += config.Translate(lang, "card:unload_ref", task.UnloadReference)
+			temp += config.Translate(lang, "card:window_start", formatWindowTime(task.UnloadStartDate, loc))
+			temp += config.Translate(lang, "card:window_end", formatWindowTime(task.UnloadEndDate, loc))
 		}
 
 		if len(task.Product) > 0 {
-			temp += fmt.Sprintf("<b>Продукт перевезення</b>: %s\n", task.Product)
-			temp += fmt.Sprintf("<b>Вага</b>: %s\n", task.Weight)
-			temp += fmt.Sprintf("<b>Обʼєм</b>: %s\n", task.Volume)
-			if len(task.Temperature) > 0 {
-				temp += fmt.Sprintf("<b>Температура</b>: %s\n", task.Temperature)
+			temp += config.Translate(lang, "card:product", task.Product)
+			temp += config.Translate(lang, "card:weight", task.Weight)
+			temp += config.Translate(lang, "card:volume", task.Volume)
+			temp += cardLine(lang, "temperature", task.Temperature)
+			temp += config.Translate(lang, "card:compartments", task.Compartment)
+			for _, c := range task.Compartments {
+				temp += config.Translate(lang, "card:compartment", c.Number, c.summary())
 			}
-			temp += fmt.Sprintf("<b>Кількість секцій</b>: %d\n", task.Compartment)
 		}
 
-		if len(task.Remark) > 0 {
-			temp += fmt.Sprintf("<b>Нотатки</b>: %s\n", task.Remark)
-		}
+		temp += cardLine(lang, "remark", task.Remark)
 
 		if len(temp) > 0 {
 			taskByType[task.Type] = temp
@@ -319,42 +327,71 @@ func ReadDoc(details *Shipment) (header string, taskByType map[string]string) {
 	return header, taskByType
 }
 
+// ReadPdfDoc gives back the text of the document with its columns kept, which extractor is used depends on PDF_EXTRACTOR
 func ReadPdfDoc(pdfFilePath string) (docText string, err error) {
+	switch config.GetPdfExtractor() {
+	case config.PdfExtractorBuiltin:
+		return ExtractPdfText(pdfFilePath)
+	case config.PdfExtractorPdftotext:
+		return readPdfDocWithPdftotext(pdfFilePath)
+	}
+
+	docText, err = ExtractPdfText(pdfFilePath)
+	if err == nil || errors.Is(err, ErrNoTextLayer) {
+		return docText, err
+	}
+	if _, lookErr := exec.LookPath("pdftotext"); lookErr != nil {
+		return "", err
+	}
+
+	log.Printf("built-in pdf extractor could not read %s (%v), falling back to pdftotext\n", pdfFilePath, err)
+	return readPdfDocWithPdftotext(pdfFilePath)
+}
+
+func readPdfDocWithPdftotext(pdfFilePath string) (string, error) {
 	cmd := exec.Command("pdftotext", "-layout", pdfFilePath, "-")
-	output, err := cmd.CombinedOutput()
-	return string(output), err
+	output, err := cmd.Output()
+	empty := strings.TrimSpace(string(output)) == ""
+
+	// pdftotext exits with 1 on a damaged pdf, but often still reads it, then the text is worth more than the error
+	var exitErr *exec.ExitError
+	if err != nil && errors.As(err, &exitErr) && exitErr.ExitCode() == 1 && !empty {
+		log.Printf("WARN: pdftotext read %s with an error: %v\n", pdfFilePath, err)
+		return string(output), nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("ERR: pdftotext failed on %s: %v", pdfFilePath, err)
+	}
+
+	if empty {
+		return "", ErrNoTextLayer
+	}
+	return string(output), nil
 }
 
 func GetSequenceOfTasks(pdfFilePath string) (*Shipment, error) {
-	docText, err := ReadPdfDoc(pdfFilePath)
+	docText, err := ReadDocText(pdfFilePath)
 	if err != nil {
-		if !strings.Contains(err.Error(), "exit status 1") {
-			return nil, fmt.Errorf("ERR: failed reading doc %s: %v", pdfFilePath, err)
-		}
+		return nil, fmt.Errorf("ERR: failed reading doc %s: %w", pdfFilePath, err)
 	}
 
-	details := new(Shipment)
-	after, _ := details.IdentifyInstructionForDoc(docText)
-	after, _ = details.IdentifyShipmentIdForDoc(after)
-	after, _ = details.IdentifyDeliveryDetails(docText)
+	return ParseDocText(docText)
+}
 
-	sections := details.ExtractTaskSections(after)
-	for _, section := range sections {
-		if section.Type == "collect" {
-			fmt.Println(section.Content)
-		}
-		section.ParseTaskDetails()
+func GetSequenceOfTasksWithReport(pdfFilePath string) (*Shipment, *ParseReport, error) {
+	docText, err := ReadDocText(pdfFilePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ERR: failed reading doc %s: %w", pdfFilePath, err)
 	}
-	details.Tasks = sections
 
-	return details, nil
+	return ParseDocTextWithReport(docText)
 }
 
 // ExtractTaskSections parses the entire text and extracts sections by task
 func (s *Shipment) ExtractTaskSections(docText string) []*TaskSection {
 	sections := make([]*TaskSection, 0)
 	var currentSection *TaskSection
-	var isNextType bool
+	var pendingInstruction *keywordDictionary
 	var isTask bool
 
 	for line := range strings.SplitSeq(docText, "\n") {
@@ -365,13 +402,11 @@ func (s *Shipment) ExtractTaskSections(docText string) []*TaskSection {
 			continue
 		}
 
-		iType, _, isInstrType := identifyInstruction(line, isNextType)
-		if isInstrType {
-			if iType == "nextline" {
-				isNextType = true
-				continue
-			}
-			isNextType = false
+		iType, dictionary, isInstrType := identifyInstruction(line, pendingInstruction)
+		pendingInstruction = nil
+		if isInstrType && iType == "nextline" {
+			pendingInstruction = dictionary
+			continue
 		}
 
 		if !isInstrType {
@@ -433,15 +468,16 @@ func (t *TaskSection) ParseTaskDetails() bool {
 	found := false
 
 	a, f := t.findAddress()
-	found = f
+	found = found || f
 	t.Address = a
+	t.AddressParts, _ = ParseAddress(a)
 
 	c, f := t.findCompany()
-	found = f
+	found = found || f
 	t.Company = c
 
 	f = t.getTaskDetails()
-	found = f
+	found = found || f
 
 	return found
 }
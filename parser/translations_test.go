@@ -0,0 +1,64 @@
+package parser
+
+import (
+	"logistictbot/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadDocInEveryLanguage(t *testing.T) {
+	t.Chdir("..")
+	if err := config.LoadLocales(); err != nil {
+		t.Fatalf("LoadLocales: %v", err)
+	}
+
+	s := &Shipment{Id: 4051234, InstructionType: "ORDER EXAMPLE", DocLang: English, CarId: "AB123CD", Chassis: "CH1", Tasks: []*TaskSection{
+		{Type: TaskLoad, Address: "BASF SE, DE-67056 LUDWIGSHAFEN", LoadReference: "L-77", CustomerReference: "C-1", Company: "BASF",
+			LoadStartDate: time.Date(2026, 3, 2, 8, 0, 0, 0, time.UTC), Product: "ETHANOL", Weight: "24000 KG", Temperature: "20 C", Remark: "call"},
+		{Type: TaskUnload, Address: "VOPAK, 4542 NM HOEK", UnloadReference: "U-88", TankStatus: "LOADED", DestinationAddress: "HOEK"},
+	}}
+
+	for _, lang := range []config.LangCode{config.English, config.Ukrainian, config.Polish} {
+		t.Run(string(lang), func(t *testing.T) {
+			header, tasks := ReadDoc(s, lang, config.WarsawLoc)
+			out := header
+			for _, task := range s.Tasks {
+				out += TaskTypeTitle(lang, task.Type) + tasks[task.Type] + ReadTaskShort(task, lang, config.WarsawLoc)
+			}
+			for _, raw := range []string{"card:", "task_type:", "%!"} {
+				if strings.Contains(out, raw) {
+					t.Errorf("%s card has an untranslated or broken template (%s):\n%s", lang, raw, out)
+				}
+			}
+		})
+	}
+}
+
+func TestRouteSheet(t *testing.T) {
+	t.Chdir("..")
+	if err := config.LoadLocales(); err != nil {
+		t.Fatalf("LoadLocales: %v", err)
+	}
+
+	s := &Shipment{Id: 4051234, CarId: "AB123CD", DriverName: "JAN <B>", Tasks: []*TaskSection{
+		{Type: TaskLoad, Address: "BASF SE, DE-67056 LUDWIGSHAFEN", LoadReference: "L-77", Compartment: 3,
+			LoadStartDate: time.Date(2026, 3, 2, 7, 0, 0, 0, time.UTC), LoadEndDate: time.Date(2026, 3, 2, 13, 0, 0, 0, time.UTC), Product: "ETHANOL", Weight: "24000 KG"},
+		{Type: TaskUnload, Address: "VOPAK, 4542 NM HOEK", UnloadReference: "U-88", Remark: "CALL BEFORE"},
+	}}
+
+	sheet, err := RouteSheet(s, config.Polish, config.WarsawLoc)
+	if err != nil {
+		t.Fatalf("RouteSheet: %v", err)
+	}
+	out := string(sheet)
+
+	for _, want := range []string{"Karta trasy №4051234", "załadunek", "Załadunek: L-77", "Rozładunek: U-88", "02.03.2026 08:00", "02.03.2026 14:00", "Waga: 24000 KG", "CALL BEFORE", "JAN &lt;B&gt;"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("the route sheet does not have %q", want)
+		}
+	}
+	if strings.Contains(out, "sheet:") {
+		t.Errorf("the route sheet has untranslated labels:\n%s", out)
+	}
+}